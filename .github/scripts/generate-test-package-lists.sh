@@ -203,7 +203,7 @@ test_packages[7]+=" $base/vault/external_tests/misc"
 test_packages[7]+=" $base/vault/quotas"
 
 # Total time: 779
-test_packages[8]+=" $base/builtin/credential/aws/pkcs7"
+test_packages[8]+=" $base/helper/pkcs7"
 test_packages[8]+=" $base/builtin/logical/totp"
 test_packages[8]+=" $base/command/agentproxyshared/auth"
 test_packages[8]+=" $base/physical/raft"
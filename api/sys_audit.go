@@ -55,6 +55,86 @@ func (c *Sys) AuditHashWithContext(ctx context.Context, path string, input strin
 	return hashStr, nil
 }
 
+// AuditHashes hashes each of the inputs with the salt of the audit device
+// at path in a single request.
+func (c *Sys) AuditHashes(path string, inputs []string) ([]string, error) {
+	return c.AuditHashesWithContext(context.Background(), path, inputs)
+}
+
+func (c *Sys) AuditHashesWithContext(ctx context.Context, path string, inputs []string) ([]string, error) {
+	ctx, cancelFunc := c.c.withConfiguredTimeout(ctx)
+	defer cancelFunc()
+
+	body := map[string]interface{}{
+		"inputs": inputs,
+	}
+
+	r := c.c.NewRequest(http.MethodPut, fmt.Sprintf("/v1/sys/audit-hash/%s", path))
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.rawRequestWithContext(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("data from server response is empty")
+	}
+
+	var result struct {
+		Hashes []string `mapstructure:"hashes"`
+	}
+	if err := mapstructure.Decode(secret.Data, &result); err != nil {
+		return nil, fmt.Errorf("could not parse hashes in response data: %w", err)
+	}
+	if len(result.Hashes) != len(inputs) {
+		return nil, fmt.Errorf("expected %d hashes in response data, got %d", len(inputs), len(result.Hashes))
+	}
+
+	return result.Hashes, nil
+}
+
+// AuditHashChain returns the last entry the audit device at path linked
+// into its hash chain.
+func (c *Sys) AuditHashChain(path string) (*AuditHashChainHead, error) {
+	return c.AuditHashChainWithContext(context.Background(), path)
+}
+
+func (c *Sys) AuditHashChainWithContext(ctx context.Context, path string) (*AuditHashChainHead, error) {
+	ctx, cancelFunc := c.c.withConfiguredTimeout(ctx)
+	defer cancelFunc()
+
+	r := c.c.NewRequest(http.MethodGet, fmt.Sprintf("/v1/sys/audit-hash/%s", path))
+
+	resp, err := c.c.rawRequestWithContext(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("data from server response is empty")
+	}
+
+	var result AuditHashChainHead
+	if err := mapstructure.Decode(secret.Data, &result); err != nil {
+		return nil, fmt.Errorf("could not parse hash chain in response data: %w", err)
+	}
+
+	return &result, nil
+}
+
 func (c *Sys) ListAudit() (map[string]*Audit, error) {
 	return c.ListAuditWithContext(context.Background())
 }
@@ -157,3 +237,8 @@ type Audit struct {
 	Local       bool              `json:"local" mapstructure:"local"`
 	Path        string            `json:"path" mapstructure:"path"`
 }
+
+type AuditHashChainHead struct {
+	Seq  uint64 `json:"seq" mapstructure:"seq"`
+	HMAC string `json:"hmac" mapstructure:"hmac"`
+}
@@ -5,11 +5,17 @@ package audit
 
 import (
 	"context"
+	"errors"
 
 	"github.com/hashicorp/vault/sdk/helper/salt"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+// ErrEntryFiltered is returned by the formatters, and the backends using them,
+// when an entry is excluded by the device's filter. The entry is not written,
+// so it does not count towards the device that must log each request.
+var ErrEntryFiltered = errors.New("entry excluded by audit device filter")
+
 // Backend interface must be implemented for an audit
 // mechanism to be made available. Audit backends can be enabled to
 // sink information to different backends such as logs, file, databases,
@@ -45,6 +51,21 @@ type Backend interface {
 	Invalidate(context.Context)
 }
 
+// Closer is implemented by backends which hold resources, such as background
+// workers or files, that must be released once the backend is disabled or
+// the audit table is torn down.
+type Closer interface {
+	Close() error
+}
+
+// HashChainer is implemented by backends which link their entries into a
+// hash chain, so that a log can be checked for entries missing at its end.
+type HashChainer interface {
+	// HashChainHead returns the chain state recorded once the last entry
+	// was written, or nil if the backend does not chain its entries.
+	HashChainHead(context.Context) (*HashChain, error)
+}
+
 // BackendConfig contains configuration parameters used in the factory func to
 // instantiate audit backends
 type BackendConfig struct {
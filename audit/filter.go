@@ -0,0 +1,202 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-bexpr"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Filter decides which entries an audit device writes, by evaluating a
+// boolean expression (see https://github.com/hashicorp/go-bexpr) over
+// properties of the request being audited.
+type Filter struct {
+	expression string
+	evaluator  *bexpr.Evaluator
+}
+
+// filterDatum holds the properties of a request that a filter expression
+// can select on.
+type filterDatum struct {
+	MountType  string `bexpr:"mount_type"`
+	MountPoint string `bexpr:"mount_point"`
+	Path       string `bexpr:"path"`
+	Operation  string `bexpr:"operation"`
+	Namespace  string `bexpr:"namespace"`
+	EntityID   string `bexpr:"entity_id"`
+}
+
+// NewFilter parses a filter expression such as
+//
+//	mount_type != "kv" or operation != "read"
+//
+// Selectors are checked here, so that a typo is reported when the device is
+// enabled rather than when the first request is audited.
+func NewFilter(expression string) (*Filter, error) {
+	evaluator, err := bexpr.CreateEvaluator(expression)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing filter: %w", err)
+	}
+
+	if _, err := evaluator.Evaluate(filterDatum{}); err != nil {
+		return nil, fmt.Errorf("error validating filter: %w", err)
+	}
+
+	return &Filter{
+		expression: expression,
+		evaluator:  evaluator,
+	}, nil
+}
+
+// Matches reports whether an entry for the given input should be written.
+func (f *Filter) Matches(ctx context.Context, in *logical.LogInput) (bool, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	datum := filterDatum{
+		MountType:  in.Request.MountType,
+		MountPoint: in.Request.MountPoint,
+		Path:       in.Request.Path,
+		Operation:  string(in.Request.Operation),
+		Namespace:  ns.Path,
+	}
+	if in.Auth != nil {
+		datum.EntityID = in.Auth.EntityID
+	}
+
+	return f.evaluator.Evaluate(datum)
+}
+
+// String returns the filter expression.
+func (f *Filter) String() string {
+	return f.expression
+}
+
+// ParseFilterOptions reads the audit device options that control which
+// entries are written and which of their fields are redacted:
+//
+//   - filter: an expression entries must match to be written
+//   - drop_fields: a comma-separated list of fields to remove
+//   - hmac_fields: a comma-separated list of fields to HMAC
+//
+// Fields are dot-separated paths into the entry as it is written, such as
+// "request.remote_address" or "request.data.password".
+func (c *FormatterConfig) ParseFilterOptions(opts map[string]string) error {
+	if expression, ok := opts["filter"]; ok && strings.TrimSpace(expression) != "" {
+		filter, err := NewFilter(expression)
+		if err != nil {
+			return err
+		}
+		c.Filter = filter
+	}
+
+	c.DropFields = strutil.ParseDedupAndSortStrings(opts["drop_fields"], ",")
+	c.HMACFields = strutil.ParseDedupAndSortStrings(opts["hmac_fields"], ",")
+
+	for _, field := range append(append([]string{}, c.DropFields...), c.HMACFields...) {
+		for _, part := range strings.Split(field, ".") {
+			if part == "" {
+				return fmt.Errorf("invalid field %q", field)
+			}
+		}
+	}
+
+	return nil
+}
+
+// redactEntry returns a copy of entry with the configured fields removed or
+// replaced with their HMAC. The entry is round-tripped through its JSON form
+// so that fields are addressed by the names they are written with.
+func redactEntry[T any](salter *salt.Salt, config FormatterConfig, entry *T) (*T, error) {
+	if len(config.DropFields) == 0 && len(config.HMACFields) == 0 {
+		return entry, nil
+	}
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	for _, field := range config.DropFields {
+		dropField(m, strings.Split(field, "."))
+	}
+	for _, field := range config.HMACFields {
+		hmacField(salter, m, strings.Split(field, "."))
+	}
+
+	raw, err = json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := new(T)
+	dec = json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(ret); err != nil {
+		return nil, fmt.Errorf("error redacting audit entry: %w", err)
+	}
+
+	return ret, nil
+}
+
+// dropField removes the value at path, if present.
+func dropField(m map[string]interface{}, path []string) {
+	for len(path) > 1 {
+		next, ok := m[path[0]].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m, path = next, path[1:]
+	}
+	delete(m, path[0])
+}
+
+// hmacField replaces every string within the value at path, if present, with
+// its HMAC. As elsewhere in the audit log, other types are left as they are.
+func hmacField(salter *salt.Salt, m map[string]interface{}, path []string) {
+	for len(path) > 1 {
+		next, ok := m[path[0]].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m, path = next, path[1:]
+	}
+	if v, ok := m[path[0]]; ok {
+		m[path[0]] = hmacValue(salter, v)
+	}
+}
+
+func hmacValue(salter *salt.Salt, v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return HashString(salter, v)
+	case []interface{}:
+		for i := range v {
+			v[i] = hmacValue(salter, v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = hmacValue(salter, v[k])
+		}
+	}
+	return v
+}
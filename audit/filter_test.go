@@ -0,0 +1,184 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestFilter_new(t *testing.T) {
+	cases := map[string]bool{
+		`mount_type == "kv"`:                                     true,
+		`path matches "^sys/" or path matches "^auth/"`:          true,
+		`operation != "read" and namespace == "ns1/"`:            true,
+		`entity_id == "abc" and mount_point == "secret/"`:        true,
+		`mount_type ==`:                                          false,
+		`mount == "kv"`:                                          false,
+		`not (mount_type == "kv" and operation == "read")`:       true,
+		`not (mount_type == "kv" and "secret/ci/" in path)`:      true,
+		`not (mount_type == "kv" and path matches "^secret/ci")`: true,
+	}
+
+	for expression, valid := range cases {
+		_, err := NewFilter(expression)
+		if valid && err != nil {
+			t.Errorf("%q: unexpected error: %v", expression, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("%q: expected error", expression)
+		}
+	}
+}
+
+func TestFilter_matches(t *testing.T) {
+	filter, err := NewFilter(`not (mount_type == "kv" and operation == "read" and path matches "^secret/ci/")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		req      *logical.Request
+		expected bool
+	}{
+		{&logical.Request{MountType: "kv", Operation: logical.ReadOperation, Path: "secret/ci/foo"}, false},
+		{&logical.Request{MountType: "kv", Operation: logical.UpdateOperation, Path: "secret/ci/foo"}, true},
+		{&logical.Request{MountType: "kv", Operation: logical.ReadOperation, Path: "secret/app/foo"}, true},
+		{&logical.Request{MountType: "system", Operation: logical.ReadOperation, Path: "sys/mounts"}, true},
+	}
+
+	ctx := namespace.RootContext(nil)
+	for _, tc := range cases {
+		match, err := filter.Matches(ctx, &logical.LogInput{Request: tc.req})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match != tc.expected {
+			t.Errorf("%s %s: expected %t, got %t", tc.req.Operation, tc.req.Path, tc.expected, match)
+		}
+	}
+
+	filter, err = NewFilter(`entity_id == "ci-entity"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match, err := filter.Matches(ctx, &logical.LogInput{
+		Auth:    &logical.Auth{EntityID: "ci-entity"},
+		Request: &logical.Request{Path: "secret/foo"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("expected entity to match")
+	}
+}
+
+func TestFormatter_filterAndRedact(t *testing.T) {
+	salter, err := salt.NewSalt(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatter := AuditFormatter{
+		AuditFormatWriter: &JSONFormatWriter{
+			SaltFunc: func(context.Context) (*salt.Salt, error) {
+				return salter, nil
+			},
+		},
+	}
+
+	var config FormatterConfig
+	if err := config.ParseFilterOptions(map[string]string{
+		"filter":      `path matches "^sys/"`,
+		"drop_fields": "request.remote_address, response.data.dropped",
+		"hmac_fields": "request.path,response.data.nested",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	config.Raw = true
+
+	in := &logical.LogInput{
+		Request: &logical.Request{
+			Operation:  logical.ReadOperation,
+			Path:       "sys/foo",
+			Connection: &logical.Connection{RemoteAddr: "127.0.0.1"},
+		},
+		Response: &logical.Response{
+			Data: map[string]interface{}{
+				"dropped": "secret",
+				"kept":    "value",
+				"number":  json.Number("12345678901234567890"),
+				"nested":  map[string]interface{}{"a": "b", "c": []interface{}{"d", 1}},
+			},
+		},
+	}
+
+	ctx := namespace.RootContext(nil)
+	var buf bytes.Buffer
+	if err := formatter.FormatResponse(ctx, &buf, config, in); err != nil {
+		t.Fatal(err)
+	}
+
+	var entry AuditResponseEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Request.RemoteAddr != "" {
+		t.Errorf("expected remote address to be dropped, got %q", entry.Request.RemoteAddr)
+	}
+	if expected := HashString(salter, "sys/foo"); entry.Request.Path != expected {
+		t.Errorf("expected path %q, got %q", expected, entry.Request.Path)
+	}
+	if _, ok := entry.Response.Data["dropped"]; ok {
+		t.Error("expected response field to be dropped")
+	}
+	if entry.Response.Data["kept"] != "value" {
+		t.Errorf("expected unlisted field to be kept, got %v", entry.Response.Data["kept"])
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"number":12345678901234567890`)) {
+		t.Errorf("expected number to be preserved exactly: %s", buf.String())
+	}
+	nested := entry.Response.Data["nested"].(map[string]interface{})
+	if nested["a"] != HashString(salter, "b") {
+		t.Errorf("expected nested string to be HMACed, got %v", nested["a"])
+	}
+	if c := nested["c"].([]interface{}); c[0] != HashString(salter, "d") || c[1] != float64(1) {
+		t.Errorf("expected only strings in nested list to be HMACed, got %v", c)
+	}
+
+	// A request that does not match the filter is reported as filtered, and
+	// produces no output at all
+	buf.Reset()
+	in.Request.Path = "secret/foo"
+	if err := formatter.FormatRequest(ctx, &buf, config, in); !errors.Is(err, ErrEntryFiltered) {
+		t.Fatalf("expected request to be filtered, got %v", err)
+	}
+	if err := formatter.FormatResponse(ctx, &buf, config, in); !errors.Is(err, ErrEntryFiltered) {
+		t.Fatalf("expected response to be filtered, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected filtered request to produce no output, got %q", buf.String())
+	}
+}
+
+func TestFormatterConfig_parseFilterOptionsInvalid(t *testing.T) {
+	for _, opts := range []map[string]string{
+		{"filter": "nope =="},
+		{"filter": `unknown_field == "x"`},
+		{"drop_fields": "request..path"},
+		{"hmac_fields": "request."},
+	} {
+		var config FormatterConfig
+		if err := config.ParseFilterOptions(opts); err == nil {
+			t.Errorf("expected error for %v", opts)
+		}
+	}
+}
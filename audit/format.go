@@ -48,6 +48,16 @@ func (f *AuditFormatter) FormatRequest(ctx context.Context, w io.Writer, config
 		return fmt.Errorf("no format writer specified")
 	}
 
+	if config.Filter != nil {
+		match, err := config.Filter.Matches(ctx, in)
+		if err != nil {
+			return fmt.Errorf("error evaluating audit filter: %w", err)
+		}
+		if !match {
+			return ErrEntryFiltered
+		}
+	}
+
 	salt, err := f.Salt(ctx)
 	if err != nil {
 		return fmt.Errorf("error fetching salt: %w", err)
@@ -166,6 +176,11 @@ func (f *AuditFormatter) FormatRequest(ctx context.Context, w io.Writer, config
 		reqEntry.Time = time.Now().UTC().Format(time.RFC3339Nano)
 	}
 
+	reqEntry, err = redactEntry(salt, config, reqEntry)
+	if err != nil {
+		return err
+	}
+
 	return f.AuditFormatWriter.WriteRequest(w, reqEntry)
 }
 
@@ -182,6 +197,16 @@ func (f *AuditFormatter) FormatResponse(ctx context.Context, w io.Writer, config
 		return fmt.Errorf("no format writer specified")
 	}
 
+	if config.Filter != nil {
+		match, err := config.Filter.Matches(ctx, in)
+		if err != nil {
+			return fmt.Errorf("error evaluating audit filter: %w", err)
+		}
+		if !match {
+			return ErrEntryFiltered
+		}
+	}
+
 	salt, err := f.Salt(ctx)
 	if err != nil {
 		return fmt.Errorf("error fetching salt: %w", err)
@@ -388,6 +413,11 @@ func (f *AuditFormatter) FormatResponse(ctx context.Context, w io.Writer, config
 		respEntry.Time = time.Now().UTC().Format(time.RFC3339Nano)
 	}
 
+	respEntry, err = redactEntry(salt, config, respEntry)
+	if err != nil {
+		return err
+	}
+
 	return f.AuditFormatWriter.WriteResponse(w, respEntry)
 }
 
@@ -561,6 +591,16 @@ func NewTemporaryFormatter(format, prefix string) *AuditFormatter {
 			Prefix:   prefix,
 			SaltFunc: temporarySalt,
 		}
+	case "cef":
+		ret.AuditFormatWriter = &CEFFormatWriter{
+			Prefix:   prefix,
+			SaltFunc: temporarySalt,
+		}
+	case "ocsf":
+		ret.AuditFormatWriter = &OCSFFormatWriter{
+			Prefix:   prefix,
+			SaltFunc: temporarySalt,
+		}
 	default:
 		ret.AuditFormatWriter = &JSONFormatWriter{
 			Prefix:   prefix,
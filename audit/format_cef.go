@@ -0,0 +1,147 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package audit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/version"
+)
+
+const (
+	cefVersion = 0
+	cefVendor  = "HashiCorp"
+	cefProduct = "Vault"
+
+	cefSeverityInfo  = 3
+	cefSeverityError = 7
+)
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// CEFFormatWriter is an AuditFormatWriter implementation that structures data
+// as ArcSight Common Event Format (CEF) lines.
+type CEFFormatWriter struct {
+	Prefix   string
+	SaltFunc func(context.Context) (*salt.Salt, error)
+}
+
+// cefExtension is a single key=value pair of a CEF line's extension.
+type cefExtension struct {
+	key   string
+	value string
+}
+
+func (f *CEFFormatWriter) WriteRequest(w io.Writer, req *AuditRequestEntry) error {
+	if req == nil {
+		return fmt.Errorf("request entry was nil, cannot encode")
+	}
+
+	return f.write(w, req.Type, req.Time, req.Error, req.Auth, req.Request, nil)
+}
+
+func (f *CEFFormatWriter) WriteResponse(w io.Writer, resp *AuditResponseEntry) error {
+	if resp == nil {
+		return fmt.Errorf("response entry was nil, cannot encode")
+	}
+
+	return f.write(w, resp.Type, resp.Time, resp.Error, resp.Auth, resp.Request, resp.Response)
+}
+
+func (f *CEFFormatWriter) Salt(ctx context.Context) (*salt.Salt, error) {
+	return f.SaltFunc(ctx)
+}
+
+func (f *CEFFormatWriter) write(w io.Writer, entryType, entryTime, entryError string, auth *AuditAuth, req *AuditRequest, resp *AuditResponse) error {
+	if req == nil {
+		req = &AuditRequest{}
+	}
+	if auth == nil {
+		auth = &AuditAuth{}
+	}
+
+	severity := cefSeverityInfo
+	outcome := "success"
+	if entryError != "" {
+		severity = cefSeverityError
+		outcome = "failure"
+	}
+
+	name := strings.TrimSpace(fmt.Sprintf("%s %s", req.Operation, req.Path))
+
+	var ext []cefExtension
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, cefExtension{key: key, value: value})
+		}
+	}
+	addCustom := func(key, label, value string) {
+		if value != "" {
+			add(key+"Label", label)
+			add(key, value)
+		}
+	}
+
+	if entryTime != "" {
+		t, err := time.Parse(time.RFC3339Nano, entryTime)
+		if err != nil {
+			return err
+		}
+		add("rt", strconv.FormatInt(t.UnixMilli(), 10))
+	}
+	add("externalId", req.ID)
+	add("act", string(req.Operation))
+	add("request", req.Path)
+	add("src", req.RemoteAddr)
+	if req.RemotePort != 0 {
+		add("spt", strconv.Itoa(req.RemotePort))
+	}
+	add("suser", auth.DisplayName)
+	add("suid", auth.EntityID)
+	add("outcome", outcome)
+	add("reason", entryError)
+	addCustom("cs1", "mountType", req.MountType)
+	addCustom("cs2", "mountPoint", req.MountPoint)
+	if req.Namespace != nil {
+		addCustom("cs3", "namespace", req.Namespace.Path)
+	}
+	addCustom("cs4", "clientTokenAccessor", req.ClientTokenAccessor)
+	addCustom("cs5", "policies", strings.Join(auth.Policies, ","))
+	if resp != nil && resp.Secret != nil {
+		addCustom("cs6", "leaseId", resp.Secret.LeaseID)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(f.Prefix)
+	fmt.Fprintf(&sb, "CEF:%d|%s|%s|%s|%s|%s|%d|",
+		cefVersion,
+		cefHeaderEscaper.Replace(cefVendor),
+		cefHeaderEscaper.Replace(cefProduct),
+		cefHeaderEscaper.Replace(version.GetVersion().VersionNumber()),
+		cefHeaderEscaper.Replace(entryType),
+		cefHeaderEscaper.Replace(name),
+		severity,
+	)
+	for i, e := range ext {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(e.key)
+		sb.WriteByte('=')
+		sb.WriteString(cefExtensionEscaper.Replace(e.value))
+	}
+	sb.WriteByte('\n')
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,102 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/version"
+)
+
+func TestFormatCEF_formatRequest(t *testing.T) {
+	salter, err := salt.NewSalt(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saltFunc := func(context.Context) (*salt.Salt, error) {
+		return salter, nil
+	}
+
+	header := fmt.Sprintf("CEF:0|HashiCorp|Vault|%s|", version.GetVersion().VersionNumber())
+
+	cases := map[string]struct {
+		Auth     *logical.Auth
+		Req      *logical.Request
+		Err      error
+		Prefix   string
+		Expected string
+	}{
+		"auth, request": {
+			&logical.Auth{
+				ClientToken: "foo",
+				DisplayName: "testtoken",
+				EntityID:    "foobarentity",
+				Policies:    []string{"default", "root"},
+			},
+			&logical.Request{
+				ID:                  "request",
+				ClientToken:         "foo",
+				ClientTokenAccessor: "bar",
+				Operation:           logical.UpdateOperation,
+				Path:                "secret/foo",
+				MountType:           "kv",
+				MountPoint:          "secret/",
+				Connection: &logical.Connection{
+					RemoteAddr: "127.0.0.1",
+					RemotePort: 1234,
+				},
+				Data: map[string]interface{}{
+					"password": "foo",
+				},
+			},
+			nil,
+			"",
+			header + "request|update secret/foo|3|externalId=request act=update request=secret/foo src=127.0.0.1 spt=1234 suser=testtoken suid=foobarentity outcome=success cs1Label=mountType cs1=kv cs2Label=mountPoint cs2=secret/ cs4Label=clientTokenAccessor cs4=bar cs5Label=policies cs5=default,root\n",
+		},
+		"error with prefix and escaping": {
+			nil,
+			&logical.Request{
+				ID:        "request",
+				Operation: logical.ReadOperation,
+				Path:      "weird|path=x",
+			},
+			errors.New("permission denied\nfor this"),
+			"@cee: ",
+			"@cee: " + header + `request|read weird\|path=x|7|externalId=request act=read request=weird|path\=x outcome=failure reason=permission denied\nfor this` + "\n",
+		},
+	}
+
+	for name, tc := range cases {
+		var buf bytes.Buffer
+		formatter := AuditFormatter{
+			AuditFormatWriter: &CEFFormatWriter{
+				Prefix:   tc.Prefix,
+				SaltFunc: saltFunc,
+			},
+		}
+		config := FormatterConfig{
+			OmitTime:     true,
+			HMACAccessor: false,
+		}
+		in := &logical.LogInput{
+			Auth:     tc.Auth,
+			Request:  tc.Req,
+			OuterErr: tc.Err,
+		}
+		if err := formatter.FormatRequest(namespace.RootContext(nil), &buf, config, in); err != nil {
+			t.Fatalf("bad: %s\nerr: %s", name, err)
+		}
+
+		if buf.String() != tc.Expected {
+			t.Fatalf("bad: %s\nResult:\n\n%q\n\nExpected:\n\n%q", name, buf.String(), tc.Expected)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/version"
+)
+
+// OCSF schema constants for the API Activity event class, see
+// https://schema.ocsf.io/1.0.0/classes/api_activity.
+const (
+	ocsfSchemaVersion = "1.0.0"
+
+	ocsfCategoryUID  = 6
+	ocsfCategoryName = "Application Activity"
+	ocsfClassUID     = 6003
+	ocsfClassName    = "API Activity"
+
+	ocsfActivityCreate = 1
+	ocsfActivityRead   = 2
+	ocsfActivityUpdate = 3
+	ocsfActivityDelete = 4
+	ocsfActivityOther  = 99
+
+	ocsfSeverityInformational = 1
+	ocsfSeverityLow           = 2
+
+	ocsfStatusSuccess = 1
+	ocsfStatusFailure = 2
+)
+
+// OCSFFormatWriter is an AuditFormatWriter implementation that structures
+// data as Open Cybersecurity Schema Framework (OCSF) API Activity events, one
+// JSON object per line.
+type OCSFFormatWriter struct {
+	Prefix   string
+	SaltFunc func(context.Context) (*salt.Salt, error)
+}
+
+// OCSFAPIActivity is the subset of the OCSF API Activity event class that
+// audit entries are mapped onto. Fields with no OCSF equivalent are kept
+// under Unmapped.
+type OCSFAPIActivity struct {
+	ActivityID   int    `json:"activity_id"`
+	ActivityName string `json:"activity_name"`
+	CategoryUID  int    `json:"category_uid"`
+	CategoryName string `json:"category_name"`
+	ClassUID     int    `json:"class_uid"`
+	ClassName    string `json:"class_name"`
+	TypeUID      int    `json:"type_uid"`
+	TypeName     string `json:"type_name"`
+	SeverityID   int    `json:"severity_id"`
+	Severity     string `json:"severity"`
+	StatusID     int    `json:"status_id"`
+	Status       string `json:"status"`
+	StatusDetail string `json:"status_detail,omitempty"`
+	Time         int64  `json:"time,omitempty"`
+
+	Metadata    OCSFMetadata      `json:"metadata"`
+	Actor       OCSFActor         `json:"actor"`
+	API         OCSFAPI           `json:"api"`
+	SrcEndpoint *OCSFEndpoint     `json:"src_endpoint,omitempty"`
+	Resources   []OCSFResource    `json:"resources,omitempty"`
+	Unmapped    *OCSFUnmappedData `json:"unmapped,omitempty"`
+}
+
+type OCSFMetadata struct {
+	Version string      `json:"version"`
+	Product OCSFProduct `json:"product"`
+	UID     string      `json:"uid,omitempty"`
+	LogName string      `json:"log_name,omitempty"`
+}
+
+type OCSFProduct struct {
+	Name       string `json:"name"`
+	VendorName string `json:"vendor_name"`
+	Version    string `json:"version,omitempty"`
+}
+
+type OCSFActor struct {
+	User    *OCSFUser    `json:"user,omitempty"`
+	Session *OCSFSession `json:"session,omitempty"`
+}
+
+type OCSFUser struct {
+	UID  string `json:"uid,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type OCSFSession struct {
+	UID string `json:"uid,omitempty"`
+}
+
+type OCSFAPI struct {
+	Operation string           `json:"operation"`
+	Request   *OCSFAPIRequest  `json:"request,omitempty"`
+	Response  *OCSFAPIResponse `json:"response,omitempty"`
+}
+
+type OCSFAPIRequest struct {
+	UID string `json:"uid,omitempty"`
+}
+
+type OCSFAPIResponse struct {
+	Error        string `json:"error,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+type OCSFEndpoint struct {
+	IP   string `json:"ip,omitempty"`
+	Port int    `json:"port,omitempty"`
+}
+
+type OCSFResource struct {
+	Name  string     `json:"name"`
+	Type  string     `json:"type,omitempty"`
+	Group *OCSFGroup `json:"group,omitempty"`
+}
+
+type OCSFGroup struct {
+	Name string `json:"name,omitempty"`
+	UID  string `json:"uid,omitempty"`
+}
+
+// OCSFUnmappedData holds the Vault-specific parts of an audit entry.
+type OCSFUnmappedData struct {
+	Namespace    *AuditNamespace        `json:"namespace,omitempty"`
+	Policies     []string               `json:"policies,omitempty"`
+	RequestData  map[string]interface{} `json:"request_data,omitempty"`
+	ResponseData map[string]interface{} `json:"response_data,omitempty"`
+	LeaseID      string                 `json:"lease_id,omitempty"`
+	Warnings     []string               `json:"warnings,omitempty"`
+}
+
+func (f *OCSFFormatWriter) WriteRequest(w io.Writer, req *AuditRequestEntry) error {
+	if req == nil {
+		return fmt.Errorf("request entry was nil, cannot encode")
+	}
+
+	event, err := newOCSFAPIActivity(req.Type, req.Time, req.Error, req.Auth, req.Request, nil)
+	if err != nil {
+		return err
+	}
+
+	return f.write(w, event)
+}
+
+func (f *OCSFFormatWriter) WriteResponse(w io.Writer, resp *AuditResponseEntry) error {
+	if resp == nil {
+		return fmt.Errorf("response entry was nil, cannot encode")
+	}
+
+	event, err := newOCSFAPIActivity(resp.Type, resp.Time, resp.Error, resp.Auth, resp.Request, resp.Response)
+	if err != nil {
+		return err
+	}
+
+	return f.write(w, event)
+}
+
+func (f *OCSFFormatWriter) Salt(ctx context.Context) (*salt.Salt, error) {
+	return f.SaltFunc(ctx)
+}
+
+func (f *OCSFFormatWriter) write(w io.Writer, event *OCSFAPIActivity) error {
+	if len(f.Prefix) > 0 {
+		_, err := w.Write([]byte(f.Prefix))
+		if err != nil {
+			return err
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	return enc.Encode(event)
+}
+
+func newOCSFAPIActivity(entryType, entryTime, entryError string, auth *AuditAuth, req *AuditRequest, resp *AuditResponse) (*OCSFAPIActivity, error) {
+	if req == nil {
+		req = &AuditRequest{}
+	}
+	if auth == nil {
+		auth = &AuditAuth{}
+	}
+
+	activityID, activityName := ocsfActivity(req.Operation)
+	event := &OCSFAPIActivity{
+		ActivityID:   activityID,
+		ActivityName: activityName,
+		CategoryUID:  ocsfCategoryUID,
+		CategoryName: ocsfCategoryName,
+		ClassUID:     ocsfClassUID,
+		ClassName:    ocsfClassName,
+		TypeUID:      ocsfClassUID*100 + activityID,
+		TypeName:     ocsfClassName + ": " + activityName,
+		SeverityID:   ocsfSeverityInformational,
+		Severity:     "Informational",
+		StatusID:     ocsfStatusSuccess,
+		Status:       "Success",
+		Metadata: OCSFMetadata{
+			Version: ocsfSchemaVersion,
+			Product: OCSFProduct{
+				Name:       cefProduct,
+				VendorName: cefVendor,
+				Version:    version.GetVersion().VersionNumber(),
+			},
+			UID:     req.ID,
+			LogName: entryType,
+		},
+		API: OCSFAPI{
+			Operation: string(req.Operation),
+		},
+	}
+
+	if entryTime != "" {
+		t, err := time.Parse(time.RFC3339Nano, entryTime)
+		if err != nil {
+			return nil, err
+		}
+		event.Time = t.UnixMilli()
+	}
+
+	if entryError != "" {
+		event.SeverityID = ocsfSeverityLow
+		event.Severity = "Low"
+		event.StatusID = ocsfStatusFailure
+		event.Status = "Failure"
+		event.StatusDetail = entryError
+		event.API.Response = &OCSFAPIResponse{
+			Error:        "error",
+			ErrorMessage: entryError,
+		}
+	}
+
+	if req.ID != "" {
+		event.API.Request = &OCSFAPIRequest{UID: req.ID}
+	}
+
+	if auth.EntityID != "" || auth.DisplayName != "" {
+		event.Actor.User = &OCSFUser{
+			UID:  auth.EntityID,
+			Name: auth.DisplayName,
+		}
+	}
+	if req.ClientTokenAccessor != "" {
+		event.Actor.Session = &OCSFSession{UID: req.ClientTokenAccessor}
+	}
+
+	if req.RemoteAddr != "" {
+		event.SrcEndpoint = &OCSFEndpoint{
+			IP:   req.RemoteAddr,
+			Port: req.RemotePort,
+		}
+	}
+
+	if req.Path != "" {
+		resource := OCSFResource{
+			Name: req.Path,
+			Type: req.MountType,
+		}
+		if req.MountPoint != "" || req.MountAccessor != "" {
+			resource.Group = &OCSFGroup{
+				Name: req.MountPoint,
+				UID:  req.MountAccessor,
+			}
+		}
+		event.Resources = []OCSFResource{resource}
+	}
+
+	unmapped := &OCSFUnmappedData{
+		Namespace:   req.Namespace,
+		Policies:    auth.Policies,
+		RequestData: req.Data,
+	}
+	if resp != nil {
+		unmapped.ResponseData = resp.Data
+		unmapped.Warnings = resp.Warnings
+		if resp.Secret != nil {
+			unmapped.LeaseID = resp.Secret.LeaseID
+		}
+	}
+	event.Unmapped = unmapped
+
+	return event, nil
+}
+
+// ocsfActivity maps a Vault operation onto an OCSF API Activity activity.
+func ocsfActivity(op logical.Operation) (int, string) {
+	switch op {
+	case logical.CreateOperation:
+		return ocsfActivityCreate, "Create"
+	case logical.ReadOperation, logical.ListOperation:
+		return ocsfActivityRead, "Read"
+	case logical.UpdateOperation, logical.PatchOperation:
+		return ocsfActivityUpdate, "Update"
+	case logical.DeleteOperation:
+		return ocsfActivityDelete, "Delete"
+	default:
+		return ocsfActivityOther, "Other"
+	}
+}
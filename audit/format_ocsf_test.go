@@ -0,0 +1,154 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestFormatOCSF_formatResponse(t *testing.T) {
+	salter, err := salt.NewSalt(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saltFunc := func(context.Context) (*salt.Salt, error) {
+		return salter, nil
+	}
+
+	fooSalted := salter.GetIdentifiedHMAC("foo")
+
+	cases := map[string]struct {
+		Req          *logical.Request
+		Err          error
+		Prefix       string
+		ActivityID   int
+		StatusID     int
+		StatusDetail string
+	}{
+		"create": {
+			&logical.Request{
+				ID:        "request",
+				Operation: logical.CreateOperation,
+				Path:      "secret/foo",
+			},
+			nil,
+			"",
+			ocsfActivityCreate,
+			ocsfStatusSuccess,
+			"",
+		},
+		"list with prefix": {
+			&logical.Request{
+				ID:        "request",
+				Operation: logical.ListOperation,
+				Path:      "secret/foo",
+			},
+			nil,
+			"@cee: ",
+			ocsfActivityRead,
+			ocsfStatusSuccess,
+			"",
+		},
+		"error": {
+			&logical.Request{
+				ID:        "request",
+				Operation: logical.DeleteOperation,
+				Path:      "secret/foo",
+			},
+			errors.New("permission denied"),
+			"",
+			ocsfActivityDelete,
+			ocsfStatusFailure,
+			"permission denied",
+		},
+	}
+
+	for name, tc := range cases {
+		tc.Req.ClientToken = "foo"
+		tc.Req.ClientTokenAccessor = "bar"
+		tc.Req.MountType = "kv"
+		tc.Req.MountPoint = "secret/"
+		tc.Req.Connection = &logical.Connection{
+			RemoteAddr: "127.0.0.1",
+			RemotePort: 1234,
+		}
+
+		var buf bytes.Buffer
+		formatter := AuditFormatter{
+			AuditFormatWriter: &OCSFFormatWriter{
+				Prefix:   tc.Prefix,
+				SaltFunc: saltFunc,
+			},
+		}
+		config := FormatterConfig{
+			HMACAccessor: false,
+		}
+		in := &logical.LogInput{
+			Auth: &logical.Auth{
+				ClientToken: "foo",
+				DisplayName: "testtoken",
+				EntityID:    "foobarentity",
+			},
+			Request: tc.Req,
+			Response: &logical.Response{
+				Data: map[string]interface{}{
+					"value": "foo",
+				},
+			},
+			OuterErr: tc.Err,
+		}
+		if err := formatter.FormatResponse(namespace.RootContext(nil), &buf, config, in); err != nil {
+			t.Fatalf("bad: %s\nerr: %s", name, err)
+		}
+
+		if !strings.HasPrefix(buf.String(), tc.Prefix) {
+			t.Fatalf("no prefix: %s\nlog: %s\nprefix: %s", name, buf.String(), tc.Prefix)
+		}
+
+		var event OCSFAPIActivity
+		if err := json.Unmarshal(buf.Bytes()[len(tc.Prefix):], &event); err != nil {
+			t.Fatalf("bad: %s\nerr: %s", name, err)
+		}
+
+		if event.ClassUID != ocsfClassUID || event.CategoryUID != ocsfCategoryUID {
+			t.Fatalf("bad: %s\nclass %d, category %d", name, event.ClassUID, event.CategoryUID)
+		}
+		if event.ActivityID != tc.ActivityID || event.TypeUID != ocsfClassUID*100+tc.ActivityID {
+			t.Fatalf("bad: %s\nactivity %d, type %d", name, event.ActivityID, event.TypeUID)
+		}
+		if event.StatusID != tc.StatusID || event.StatusDetail != tc.StatusDetail {
+			t.Fatalf("bad: %s\nstatus %d, detail %q", name, event.StatusID, event.StatusDetail)
+		}
+		if event.Time == 0 {
+			t.Fatalf("bad: %s\nmissing time", name)
+		}
+		if event.Metadata.LogName != "response" || event.Metadata.UID != "request" {
+			t.Fatalf("bad: %s\nmetadata %#v", name, event.Metadata)
+		}
+		if event.Actor.User == nil || event.Actor.User.UID != "foobarentity" {
+			t.Fatalf("bad: %s\nactor %#v", name, event.Actor)
+		}
+		if event.Actor.Session == nil || event.Actor.Session.UID != "bar" {
+			t.Fatalf("bad: %s\nactor %#v", name, event.Actor)
+		}
+		if event.SrcEndpoint == nil || event.SrcEndpoint.IP != "127.0.0.1" || event.SrcEndpoint.Port != 1234 {
+			t.Fatalf("bad: %s\nsrc_endpoint %#v", name, event.SrcEndpoint)
+		}
+		if len(event.Resources) != 1 || event.Resources[0].Name != "secret/foo" || event.Resources[0].Type != "kv" {
+			t.Fatalf("bad: %s\nresources %#v", name, event.Resources)
+		}
+		if event.Unmapped == nil || event.Unmapped.ResponseData["value"] != fooSalted {
+			t.Fatalf("bad: %s\nresponse data was not HMACed: %#v", name, event.Unmapped)
+		}
+	}
+}
@@ -46,6 +46,18 @@ type FormatterConfig struct {
 	// "Was any data returned?" or "How many records were listed?".
 	ElideListResponses bool
 
+	// Filter, if set, restricts the entries that are written to those whose
+	// request matches it. Nothing at all is written for other requests, so
+	// callers should skip delivering an empty result.
+	Filter *Filter
+
+	// DropFields and HMACFields list fields, as dot-separated paths into the
+	// entry as it is written (for example "request.headers.user-agent"), to
+	// remove or replace with their HMAC before the entry is written. Unlike
+	// the options above these apply regardless of Raw.
+	DropFields []string
+	HMACFields []string
+
 	// This should only ever be used in a testing context
 	OmitTime bool
 }
@@ -0,0 +1,345 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// hashChainStoragePath is where the state of a device's hash chain is kept,
+// in the same view as its salt.
+const hashChainStoragePath = "hash_chain"
+
+// chainFieldPrefix is inserted before the final closing brace of a JSON
+// audit entry when hash chaining is enabled. Quotes inside JSON string
+// values are always escaped, so this sequence can only occur as a key.
+var chainFieldPrefix = []byte(`,"chain":`)
+
+// ErrNotChained is returned by ParseChainedEntry for entries that do not
+// carry a chain field.
+var ErrNotChained = errors.New("audit entry is not chained")
+
+// AuditChain is the field appended to every JSON audit entry when hash
+// chaining is enabled. HMAC is computed over the whole entry (including any
+// prefix, Seq and Prev) with the HMAC field itself omitted, and Prev is the
+// HMAC of the preceding entry, so editing, removing or reordering entries
+// breaks the chain.
+type AuditChain struct {
+	Seq  uint64 `json:"seq"`
+	Prev string `json:"prev"`
+	HMAC string `json:"hmac,omitempty"`
+}
+
+// HashChain is the state needed to link the next audit entry to the one
+// before it. The zero value starts a new chain.
+type HashChain struct {
+	Seq  uint64 `json:"seq"`
+	HMAC string `json:"hmac"`
+}
+
+// LoadHashChain returns the chain state stored in view, which is the zero
+// value if no chained entry has been written yet.
+func LoadHashChain(ctx context.Context, view logical.Storage) (HashChain, error) {
+	var chain HashChain
+	entry, err := view.Get(ctx, hashChainStoragePath)
+	if err != nil {
+		return chain, fmt.Errorf("failed to read hash chain: %w", err)
+	}
+	if entry == nil {
+		return chain, nil
+	}
+	if err := entry.DecodeJSON(&chain); err != nil {
+		return chain, fmt.Errorf("failed to decode hash chain: %w", err)
+	}
+	return chain, nil
+}
+
+// StoreHashChain records the chain state after an entry has been written.
+// Since it is kept in the barrier rather than in the log, a log that has
+// been cut short can be told apart from one that is complete.
+func StoreHashChain(ctx context.Context, view logical.Storage, chain HashChain) error {
+	entry, err := logical.StorageEntryJSON(hashChainStoragePath, chain)
+	if err != nil {
+		return fmt.Errorf("failed to encode hash chain: %w", err)
+	}
+	if err := view.Put(ctx, entry); err != nil {
+		return fmt.Errorf("failed to store hash chain: %w", err)
+	}
+	return nil
+}
+
+// Link appends a chain field to a formatted JSON audit entry, keyed with the
+// given salt, and returns the linked entry together with the chain state
+// that should be used for the following entry. The receiver is not
+// modified, so that callers can discard the result if writing fails.
+func (c HashChain) Link(salter *salt.Salt, entry []byte) ([]byte, HashChain, error) {
+	body := bytes.TrimRight(entry, "\r\n")
+	if !bytes.HasSuffix(body, []byte("}")) || bytes.HasSuffix(body, []byte("{}")) {
+		return nil, c, fmt.Errorf("audit entry is not a non-empty JSON object")
+	}
+	body = body[:len(body)-1]
+
+	link := AuditChain{
+		Seq:  c.Seq + 1,
+		Prev: c.HMAC,
+	}
+	unsigned, err := appendChain(body, link)
+	if err != nil {
+		return nil, c, err
+	}
+
+	link.HMAC = HashString(salter, string(unsigned))
+	signed, err := appendChain(body, link)
+	if err != nil {
+		return nil, c, err
+	}
+
+	return append(signed, '\n'), HashChain{Seq: link.Seq, HMAC: link.HMAC}, nil
+}
+
+// ParseChainedEntry extracts the chain field from a single line written
+// with hash chaining enabled. It returns the chain field together with the
+// bytes its HMAC was computed over.
+func ParseChainedEntry(line []byte) (*AuditChain, []byte, error) {
+	line = bytes.TrimRight(line, "\r\n")
+
+	idx := bytes.LastIndex(line, chainFieldPrefix)
+	if idx == -1 || !bytes.HasSuffix(line, []byte("}")) {
+		return nil, nil, ErrNotChained
+	}
+	body := line[:idx]
+	chainJSON := line[idx+len(chainFieldPrefix) : len(line)-1]
+
+	var link AuditChain
+	if err := json.Unmarshal(chainJSON, &link); err != nil {
+		return nil, nil, fmt.Errorf("malformed chain field: %w", err)
+	}
+	if link.HMAC == "" {
+		return nil, nil, fmt.Errorf("malformed chain field: missing hmac")
+	}
+
+	// Rebuild the field and make sure it round-trips exactly, otherwise the
+	// unsigned form derived from it would not be what was actually hashed.
+	signed, err := appendChain(body, link)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(signed, line) {
+		return nil, nil, fmt.Errorf("malformed chain field: not in canonical form")
+	}
+
+	hmac := link.HMAC
+	link.HMAC = ""
+	unsigned, err := appendChain(body, link)
+	if err != nil {
+		return nil, nil, err
+	}
+	link.HMAC = hmac
+
+	return &link, unsigned, nil
+}
+
+// appendChain returns body (a JSON object without its closing brace)
+// followed by the chain field and the closing brace.
+func appendChain(body []byte, link AuditChain) ([]byte, error) {
+	chainJSON, err := json.Marshal(link)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]byte, 0, len(body)+len(chainFieldPrefix)+len(chainJSON)+1)
+	ret = append(ret, body...)
+	ret = append(ret, chainFieldPrefix...)
+	ret = append(ret, chainJSON...)
+	ret = append(ret, '}')
+	return ret, nil
+}
+
+// ChainError reports the line at which verification of an audit log failed.
+type ChainError struct {
+	// Line is the number of the offending line, counting from one across
+	// every line passed to Verify.
+	Line int
+	Err  error
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *ChainError) Unwrap() error {
+	return e.Err
+}
+
+// ChainVerifier checks, line by line, that an audit log written with hash
+// chaining enabled has not been modified. Lines before the first chained
+// entry (for example those written before chaining was enabled) are
+// skipped, but once the chain has started every line must link to the one
+// before it. A log split across rotated files is verified by passing the
+// lines of every file, oldest first, to the same verifier.
+//
+// Links are checked as each line is read, but the HMACs are computed in
+// batches, so Flush must be called after the last line. Errors are returned
+// as a *ChainError.
+type ChainVerifier struct {
+	// HashFunc computes the identified HMAC of each of its inputs with the
+	// audit device's salt, as GetHash on the device would.
+	HashFunc func([]string) ([]string, error)
+
+	// BatchSize is the maximum number of entries passed to a single call to
+	// HashFunc. Zero or less computes them one at a time.
+	BatchSize int
+
+	// Head is the chain state the audit device recorded after the last
+	// entry it wrote. If set, the log must contain that entry, so that
+	// entries removed from its end are detected by Finish.
+	Head *HashChain
+
+	// AllowPartial accepts a log that does not hold the start of the chain,
+	// as is the case when the oldest archives of a rotated log have been
+	// removed. Otherwise, the first chained entry must be the first entry
+	// of the chain.
+	AllowPartial bool
+
+	// FirstSeq is the sequence number of the first chained entry. It is
+	// only greater than one if the log does not hold the start of the chain.
+	FirstSeq uint64
+
+	// Skipped is the number of unchained lines before the chain started.
+	Skipped int
+
+	// Verified is the number of chained entries verified so far.
+	Verified int
+
+	lines    int
+	last     HashChain
+	pending  []pendingEntry
+	headSeen bool
+}
+
+// pendingEntry is a linked entry whose HMAC has yet to be checked.
+type pendingEntry struct {
+	line     int
+	hmac     string
+	unsigned string
+}
+
+// Verify checks the next line of the log. Blank lines are ignored.
+func (v *ChainVerifier) Verify(line []byte) error {
+	v.lines++
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+
+	link, unsigned, err := ParseChainedEntry(line)
+	switch {
+	case errors.Is(err, ErrNotChained) && v.Verified == 0 && len(v.pending) == 0:
+		v.Skipped++
+		return nil
+	case err != nil:
+		return v.fail(err)
+	}
+
+	if v.Verified == 0 && len(v.pending) == 0 {
+		if link.Seq != 1 && !v.AllowPartial {
+			return v.fail(fmt.Errorf("missing link: the chain starts at sequence %d, so the earlier entries are missing", link.Seq))
+		}
+		v.FirstSeq = link.Seq
+	} else {
+		if link.Seq != v.last.Seq+1 {
+			return v.fail(fmt.Errorf("missing link: expected sequence %d, found %d", v.last.Seq+1, link.Seq))
+		}
+		if link.Prev != v.last.HMAC {
+			return v.fail(fmt.Errorf("missing link: entry does not link to the previous entry"))
+		}
+	}
+
+	if v.Head != nil && link.Seq == v.Head.Seq {
+		if link.HMAC != v.Head.HMAC {
+			return v.fail(errors.New("broken link: entry is not the one recorded by the audit device"))
+		}
+		v.headSeen = true
+	}
+
+	v.last = HashChain{Seq: link.Seq, HMAC: link.HMAC}
+	v.pending = append(v.pending, pendingEntry{
+		line:     v.lines,
+		hmac:     link.HMAC,
+		unsigned: string(unsigned),
+	})
+	if len(v.pending) >= v.BatchSize {
+		return v.Flush()
+	}
+	return nil
+}
+
+// Flush checks the HMACs of the entries that have been linked but not yet
+// hashed.
+func (v *ChainVerifier) Flush() error {
+	if len(v.pending) == 0 {
+		return nil
+	}
+	pending := v.pending
+	v.pending = nil
+
+	inputs := make([]string, 0, len(pending))
+	for _, entry := range pending {
+		inputs = append(inputs, entry.unsigned)
+	}
+	hashes, err := v.HashFunc(inputs)
+	if err == nil && len(hashes) != len(inputs) {
+		err = fmt.Errorf("expected %d HMACs, got %d", len(inputs), len(hashes))
+	}
+	if err != nil {
+		return &ChainError{Line: pending[0].line, Err: fmt.Errorf("error computing HMAC: %w", err)}
+	}
+
+	for i, entry := range pending {
+		if hashes[i] != entry.hmac {
+			return &ChainError{Line: entry.line, Err: errors.New("broken link: entry HMAC does not match its contents")}
+		}
+		v.Verified++
+	}
+	return nil
+}
+
+// Finish checks the entries still waiting to be hashed, and then that the
+// log contains the last entry recorded by the audit device, if Head is set.
+// It must be called once every line has been passed to Verify.
+func (v *ChainVerifier) Finish() error {
+	if err := v.Flush(); err != nil {
+		return err
+	}
+	if v.Head == nil || v.Verified == 0 || v.headSeen {
+		return nil
+	}
+
+	var err error
+	switch {
+	case v.Head.Seq == 0:
+		err = errors.New("missing link: the audit device has not recorded any chained entry")
+	case v.last.Seq < v.Head.Seq:
+		err = fmt.Errorf("missing link: the log ends at sequence %d, but the audit device recorded entries up to sequence %d", v.last.Seq, v.Head.Seq)
+	default:
+		err = fmt.Errorf("missing link: the log does not contain the entry at sequence %d recorded by the audit device", v.Head.Seq)
+	}
+	return &ChainError{Line: v.lines, Err: err}
+}
+
+// fail reports err at the current line, unless an earlier entry still
+// waiting to be hashed turns out to be broken, in which case that is the
+// first failure.
+func (v *ChainVerifier) fail(err error) error {
+	if fErr := v.Flush(); fErr != nil {
+		return fErr
+	}
+	return &ChainError{Line: v.lines, Err: err}
+}
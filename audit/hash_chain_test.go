@@ -0,0 +1,261 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/salt"
+)
+
+func testChainedLog(t *testing.T, salter *salt.Salt, prefix string, n int) [][]byte {
+	t.Helper()
+
+	var chain HashChain
+	var lines [][]byte
+	for i := 0; i < n; i++ {
+		var buf bytes.Buffer
+		buf.WriteString(prefix)
+		if err := json.NewEncoder(&buf).Encode(&AuditRequestEntry{
+			Type:    "request",
+			Request: &AuditRequest{Path: "secret/foo", Data: map[string]interface{}{"hmac": `","chain":{}`}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		line, next, err := chain.Link(salter, buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next.Seq != uint64(i+1) {
+			t.Fatalf("expected sequence %d, got %d", i+1, next.Seq)
+		}
+		chain = next
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func testChainVerifier(salter *salt.Salt, batchSize int) *ChainVerifier {
+	return &ChainVerifier{
+		HashFunc: func(inputs []string) ([]string, error) {
+			hashes := make([]string, 0, len(inputs))
+			for _, input := range inputs {
+				hashes = append(hashes, HashString(salter, input))
+			}
+			return hashes, nil
+		},
+		BatchSize: batchSize,
+	}
+}
+
+func TestHashChain_linkAndVerify(t *testing.T) {
+	salter, err := salt.NewSalt(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, prefix := range []string{"", "@cee: "} {
+		lines := testChainedLog(t, salter, prefix, 5)
+
+		for i, line := range lines {
+			if !bytes.HasSuffix(line, []byte("\n")) || !bytes.HasPrefix(line, []byte(prefix)) {
+				t.Fatalf("line %d is not well formed: %q", i, line)
+			}
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(bytes.TrimPrefix(line, []byte(prefix)), &entry); err != nil {
+				t.Fatalf("line %d is not valid JSON: %v", i, err)
+			}
+			if _, ok := entry["chain"]; !ok {
+				t.Fatalf("line %d has no chain field", i)
+			}
+		}
+
+		v := testChainVerifier(salter, 2)
+		for i, line := range lines {
+			if err := v.Verify(line); err != nil {
+				t.Fatalf("line %d: %v", i, err)
+			}
+		}
+		if err := v.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if v.Verified != 5 || v.FirstSeq != 1 || v.Skipped != 0 {
+			t.Fatalf("unexpected verifier state: %#v", v)
+		}
+	}
+}
+
+func TestHashChain_tampering(t *testing.T) {
+	salter, err := salt.NewSalt(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSalter, err := salt.NewSalt(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := testChainedLog(t, salter, "", 4)
+
+	edited := append([][]byte{}, lines...)
+	edited[2] = bytes.Replace(edited[2], []byte("secret/foo"), []byte("secret/bar"), 1)
+
+	removed := append(append([][]byte{}, lines[:2]...), lines[3:]...)
+
+	reordered := [][]byte{lines[0], lines[2], lines[1], lines[3]}
+
+	inserted := append(append(append([][]byte{}, lines[:2]...), []byte(`{"type":"request"}`+"\n")), lines[2:]...)
+
+	cases := map[string]struct {
+		lines    [][]byte
+		salter   *salt.Salt
+		badLine  int
+		expected string
+	}{
+		"edited":    {edited, salter, 2, "broken link"},
+		"removed":   {removed, salter, 2, "missing link"},
+		"reordered": {reordered, salter, 1, "missing link"},
+		"inserted":  {inserted, salter, 2, ErrNotChained.Error()},
+		"wrong key": {lines, otherSalter, 0, "broken link"},
+	}
+
+	for name, tc := range cases {
+		// Whether or not HMACs are computed in batches, the first bad line
+		// must be the one reported
+		for _, batchSize := range []int{0, 3} {
+			t.Run(fmt.Sprintf("%s/batch=%d", name, batchSize), func(t *testing.T) {
+				v := testChainVerifier(tc.salter, batchSize)
+				var err error
+				for _, line := range tc.lines {
+					if err = v.Verify(line); err != nil {
+						break
+					}
+				}
+				if err == nil {
+					err = v.Flush()
+				}
+
+				var chainErr *ChainError
+				if !errors.As(err, &chainErr) || !strings.Contains(err.Error(), tc.expected) {
+					t.Fatalf("expected error containing %q, got %v", tc.expected, err)
+				}
+				if chainErr.Line != tc.badLine+1 {
+					t.Fatalf("expected error on line %d, got %v", tc.badLine+1, err)
+				}
+			})
+		}
+	}
+}
+
+func TestHashChain_resume(t *testing.T) {
+	salter, err := salt.NewSalt(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := testChainedLog(t, salter, "", 6)
+
+	// A rotated log starts part way through the chain, and may be preceded
+	// by lines written before chaining was enabled.
+	rotated := append([][]byte{[]byte(`{"type":"request"}` + "\n")}, lines[3:]...)
+
+	// Unless that is allowed, the missing start of the chain is reported
+	v := testChainVerifier(salter, 0)
+	var chainErr *ChainError
+	if err := v.Verify(rotated[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(rotated[1]); !errors.As(err, &chainErr) || chainErr.Line != 2 || !strings.Contains(err.Error(), "starts at sequence 4") {
+		t.Fatalf("expected the missing start of the chain to be reported, got %v", err)
+	}
+
+	v = testChainVerifier(salter, 0)
+	v.AllowPartial = true
+	for i, line := range rotated {
+		if err := v.Verify(line); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+	}
+	if v.Verified != 3 || v.FirstSeq != 4 || v.Skipped != 1 {
+		t.Fatalf("unexpected verifier state: %#v", v)
+	}
+
+	link, _, err := ParseChainedEntry(lines[5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed := HashChain{Seq: link.Seq, HMAC: link.HMAC}
+	next, _, err := resumed.Link(salter, []byte(`{"type":"response"}`+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(next); err != nil {
+		t.Fatalf("resumed entry did not verify: %v", err)
+	}
+}
+
+func TestHashChain_head(t *testing.T) {
+	salter, err := salt.NewSalt(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSalter, err := salt.NewSalt(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := testChainedLog(t, salter, "", 4)
+	headOf := func(line []byte) *HashChain {
+		link, _, err := ParseChainedEntry(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &HashChain{Seq: link.Seq, HMAC: link.HMAC}
+	}
+	head := headOf(lines[2])
+
+	cases := map[string]struct {
+		lines    [][]byte
+		head     *HashChain
+		expected string
+	}{
+		// Entries written after the head was read are fine
+		"complete":   {lines, head, ""},
+		"at head":    {lines[:3], head, ""},
+		"truncated":  {lines[:2], head, "ends at sequence 2"},
+		"nothing":    {lines, &HashChain{}, "has not recorded any chained entry"},
+		"other head": {lines, headOf(testChainedLog(t, otherSalter, "", 3)[2]), "not the one recorded"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			v := testChainVerifier(salter, 0)
+			v.Head = tc.head
+			var err error
+			for _, line := range tc.lines {
+				if err = v.Verify(line); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = v.Finish()
+			}
+
+			switch {
+			case tc.expected == "" && err != nil:
+				t.Fatalf("expected log to verify, got %v", err)
+			case tc.expected != "" && (err == nil || !strings.Contains(err.Error(), tc.expected)):
+				t.Fatalf("expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -14,7 +14,9 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/sdk/helper/salt"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -49,7 +51,7 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		format = "json"
 	}
 	switch format {
-	case "json", "jsonx":
+	case "json", "jsonx", "cef", "ocsf":
 	default:
 		return nil, fmt.Errorf("unknown format type %q", format)
 	}
@@ -83,6 +85,66 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		elideListResponses = value
 	}
 
+	// Check if entries should be chained together with an HMAC
+	hashChain := false
+	if hashChainRaw, ok := conf.Config["hash_chain"]; ok {
+		value, err := strconv.ParseBool(hashChainRaw)
+		if err != nil {
+			return nil, err
+		}
+		if value && format != "json" && format != "ocsf" {
+			return nil, fmt.Errorf("hash_chain is only supported with the json and ocsf formats")
+		}
+		hashChain = value
+	}
+
+	// Check if the file should be rotated by size or age
+	var rotateBytes int64
+	if rotateBytesRaw, ok := conf.Config["rotate_bytes"]; ok {
+		value, err := parseutil.ParseCapacityString(rotateBytesRaw)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing rotate_bytes: %w", err)
+		}
+		rotateBytes = int64(value)
+	}
+
+	var rotateDuration time.Duration
+	if rotateDurationRaw, ok := conf.Config["rotate_duration"]; ok {
+		value, err := parseutil.ParseDurationSecond(rotateDurationRaw)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing rotate_duration: %w", err)
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("rotate_duration must not be negative")
+		}
+		rotateDuration = value
+	}
+
+	var rotateMaxFiles int
+	if rotateMaxFilesRaw, ok := conf.Config["rotate_max_files"]; ok {
+		value, err := strconv.Atoi(rotateMaxFilesRaw)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing rotate_max_files: %w", err)
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("rotate_max_files must not be negative")
+		}
+		rotateMaxFiles = value
+	}
+
+	rotateCompress := false
+	if rotateCompressRaw, ok := conf.Config["rotate_compress"]; ok {
+		value, err := strconv.ParseBool(rotateCompressRaw)
+		if err != nil {
+			return nil, err
+		}
+		rotateCompress = value
+	}
+
+	if (rotateBytes > 0 || rotateDuration > 0) && (path == "stdout" || path == "discard") {
+		return nil, fmt.Errorf("rotation is not supported when writing to %s", path)
+	}
+
 	// Check if mode is provided
 	mode := os.FileMode(0o600)
 	if modeRaw, ok := conf.Config["mode"]; ok {
@@ -110,6 +172,7 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 	b := &Backend{
 		path:       path,
 		mode:       mode,
+		hashChain:  hashChain,
 		saltConfig: conf.SaltConfig,
 		saltView:   conf.SaltView,
 		salt:       new(atomic.Value),
@@ -118,6 +181,14 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 			HMACAccessor:       hmacAccessor,
 			ElideListResponses: elideListResponses,
 		},
+		rotateBytes:    rotateBytes,
+		rotateDuration: rotateDuration,
+		rotateMaxFiles: rotateMaxFiles,
+		rotateCompress: rotateCompress,
+	}
+
+	if err := b.formatConfig.ParseFilterOptions(conf.Config); err != nil {
+		return nil, err
 	}
 
 	// Ensure we are working with the right type by explicitly storing a nil of
@@ -135,6 +206,16 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 			Prefix:   conf.Config["prefix"],
 			SaltFunc: b.Salt,
 		}
+	case "cef":
+		b.formatter.AuditFormatWriter = &audit.CEFFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
+	case "ocsf":
+		b.formatter.AuditFormatWriter = &audit.OCSFFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
 	}
 
 	switch path {
@@ -152,11 +233,8 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 	return b, nil
 }
 
-// Backend is the audit backend for the file-based audit store.
-//
-// NOTE: This audit backend is currently very simple: it appends to a file.
-// It doesn't do anything more at the moment to assist with rotation
-// or reset the write cursor, this should be done in the future.
+// Backend is the audit backend for the file-based audit store. It appends
+// to a file, which can optionally be rotated by size or age.
 type Backend struct {
 	path string
 
@@ -167,13 +245,38 @@ type Backend struct {
 	f        *os.File
 	mode     os.FileMode
 
+	// hashChain links every entry to the previous one with an HMAC. The
+	// chain state is protected by the file lock. It is stored in the barrier
+	// after every write, and loaded from there before the first one.
+	hashChain   bool
+	chain       audit.HashChain
+	chainLoaded bool
+
+	// Rotation settings. The size and age of the current file are protected
+	// by the file lock; rotated files are archived (compressed and pruned)
+	// in the background under the archive lock. Archives are only added to
+	// and waited for under the file lock, so that a rotation cannot start
+	// one while it is being waited for.
+	rotateBytes    int64
+	rotateDuration time.Duration
+	rotateMaxFiles int
+	rotateCompress bool
+	bytesWritten   int64
+	startedAt      time.Time
+	archiveLock    sync.Mutex
+	archiveWg      sync.WaitGroup
+
 	saltMutex  sync.RWMutex
 	salt       *atomic.Value
 	saltConfig *salt.Config
 	saltView   logical.Storage
 }
 
-var _ audit.Backend = (*Backend)(nil)
+var (
+	_ audit.Backend     = (*Backend)(nil)
+	_ audit.Closer      = (*Backend)(nil)
+	_ audit.HashChainer = (*Backend)(nil)
+)
 
 func (b *Backend) Salt(ctx context.Context) (*salt.Salt, error) {
 	s := b.salt.Load().(*salt.Salt)
@@ -230,20 +333,36 @@ func (b *Backend) log(ctx context.Context, buf *bytes.Buffer, writer io.Writer)
 	reader := bytes.NewReader(buf.Bytes())
 
 	b.fileLock.Lock()
+	defer b.fileLock.Unlock()
 
 	if writer == nil {
 		if err := b.open(); err != nil {
-			b.fileLock.Unlock()
 			return err
 		}
 		writer = b.f
 	}
 
-	if _, err := reader.WriteTo(writer); err == nil {
-		b.fileLock.Unlock()
-		return nil
+	var nextChain audit.HashChain
+	if b.hashChain {
+		linked, next, err := b.link(ctx, buf.Bytes())
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(linked)
+		nextChain = next
+	}
+
+	if writer == b.f && (b.rotateBytes > 0 || b.rotateDuration > 0) && b.shouldRotate(reader.Len()) {
+		if err := b.rotate(); err != nil {
+			return fmt.Errorf("error rotating audit log: %w", err)
+		}
+		writer = b.f
+	}
+
+	if n, err := reader.WriteTo(writer); err == nil {
+		b.bytesWritten += n
+		return b.advanceChain(ctx, nextChain)
 	} else if b.path == "stdout" {
-		b.fileLock.Unlock()
 		return err
 	}
 
@@ -254,14 +373,64 @@ func (b *Backend) log(ctx context.Context, buf *bytes.Buffer, writer io.Writer)
 	b.f = nil
 
 	if err := b.open(); err != nil {
-		b.fileLock.Unlock()
 		return err
 	}
 
 	reader.Seek(0, io.SeekStart)
-	_, err := reader.WriteTo(writer)
-	b.fileLock.Unlock()
-	return err
+	n, err := reader.WriteTo(b.f)
+	if err != nil {
+		return err
+	}
+	b.bytesWritten += n
+	return b.advanceChain(ctx, nextChain)
+}
+
+// link returns the entry with a chain field linking it to the previously
+// written entry, and the chain state to keep once it has been written. The
+// file lock must be held before calling this.
+func (b *Backend) link(ctx context.Context, entry []byte) ([]byte, audit.HashChain, error) {
+	if !b.chainLoaded {
+		chain, err := audit.LoadHashChain(ctx, b.saltView)
+		if err != nil {
+			return nil, b.chain, fmt.Errorf("unable to resume hash chain: %w", err)
+		}
+		b.chain = chain
+		b.chainLoaded = true
+	}
+
+	salt, err := b.Salt(ctx)
+	if err != nil {
+		return nil, b.chain, err
+	}
+
+	return b.chain.Link(salt, entry)
+}
+
+// advanceChain keeps the chain state to link the next entry to, once the
+// entry it was returned for by link has been written. The state is stored as
+// well, so that the log can be checked for entries missing at its end. The
+// file lock must be held before calling this.
+func (b *Backend) advanceChain(ctx context.Context, next audit.HashChain) error {
+	if !b.hashChain {
+		return nil
+	}
+
+	b.chain = next
+	return audit.StoreHashChain(ctx, b.saltView, next)
+}
+
+// HashChainHead returns the chain state stored after the last entry was
+// written, or nil if entries are not chained.
+func (b *Backend) HashChainHead(ctx context.Context) (*audit.HashChain, error) {
+	if !b.hashChain {
+		return nil, nil
+	}
+
+	chain, err := audit.LoadHashChain(ctx, b.saltView)
+	if err != nil {
+		return nil, err
+	}
+	return &chain, nil
 }
 
 func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
@@ -291,6 +460,13 @@ func (b *Backend) LogTestMessage(ctx context.Context, in *logical.LogInput, conf
 		return nil
 	}
 
+	// The test message cannot be linked into the hash chain without the
+	// persistent salt, and an unlinked line would show up as a break, so
+	// rely on the sanity check in Factory instead.
+	if b.hashChain {
+		return nil
+	}
+
 	var buf bytes.Buffer
 	temporaryFormatter := audit.NewTemporaryFormatter(config["format"], config["prefix"])
 	if err := temporaryFormatter.FormatRequest(ctx, &buf, b.formatConfig, in); err != nil {
@@ -328,6 +504,18 @@ func (b *Backend) open() error {
 		}
 	}
 
+	// Pick up the size of an existing file so that rotation by size takes
+	// what was written before a restart or reload into account
+	info, err := b.f.Stat()
+	if err != nil {
+		return err
+	}
+	b.bytesWritten = info.Size()
+	b.startedAt = now()
+	if b.bytesWritten > 0 {
+		b.startedAt = b.fileStarted(info)
+	}
+
 	return nil
 }
 
@@ -340,6 +528,10 @@ func (b *Backend) Reload(_ context.Context) error {
 	b.fileLock.Lock()
 	defer b.fileLock.Unlock()
 
+	// Let archiving of a previously rotated file finish first, so that it
+	// cannot race with whatever prompted the reload
+	b.archiveWg.Wait()
+
 	if b.f == nil {
 		return b.open()
 	}
@@ -355,6 +547,21 @@ func (b *Backend) Reload(_ context.Context) error {
 	return b.open()
 }
 
+// Close waits for rotated files to be archived and closes the current file.
+func (b *Backend) Close() error {
+	b.fileLock.Lock()
+	defer b.fileLock.Unlock()
+
+	b.archiveWg.Wait()
+
+	if b.f == nil {
+		return nil
+	}
+	err := b.f.Close()
+	b.f = nil
+	return err
+}
+
 func (b *Backend) Invalidate(_ context.Context) {
 	b.saltMutex.Lock()
 	defer b.saltMutex.Unlock()
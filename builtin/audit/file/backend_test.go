@@ -4,11 +4,19 @@
 package file
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -136,6 +144,485 @@ func TestAuditFile_fileMode0000(t *testing.T) {
 	}
 }
 
+func TestAuditFile_hashChain(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	saltView := &logical.InmemStorage{}
+
+	newBackend := func() *Backend {
+		be, err := Factory(context.Background(), &audit.BackendConfig{
+			SaltConfig: &salt.Config{},
+			SaltView:   saltView,
+			Config: map[string]string{
+				"path":       file,
+				"hash_chain": "true",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return be.(*Backend)
+	}
+
+	in := &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "/foo",
+		},
+	}
+	ctx := namespace.RootContext(nil)
+
+	// Log from two backends in turn, as happens across a restart, and make
+	// sure the second continues the chain started by the first.
+	be := newBackend()
+	if err := be.LogTestMessage(ctx, in, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := be.LogRequest(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := be.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := be.LogResponse(ctx, in); err != nil {
+		t.Fatal(err)
+	}
+
+	be = newBackend()
+	if err := be.LogResponse(ctx, in); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := be.HashChainHead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head == nil || head.Seq != 4 {
+		t.Fatalf("expected the stored chain to end at sequence 4, got %#v", head)
+	}
+
+	lines := bytes.SplitAfter(bytes.TrimSpace(contents), []byte("\n"))
+	v := testChainVerifier(ctx, be)
+	v.Head = head
+	for _, line := range lines {
+		if err := v.Verify(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := v.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Verified != 4 || v.Skipped != 0 {
+		t.Fatalf("expected 4 chained entries, got %d (%d skipped)", v.Verified, v.Skipped)
+	}
+
+	// Removing the last entry from the file can neither be hidden from the
+	// verifier, nor make the next entry reuse its place in the chain
+	if err := os.WriteFile(file, bytes.Join(lines[:3], nil), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v = testChainVerifier(ctx, be)
+	v.Head = head
+	for _, line := range lines[:3] {
+		if err := v.Verify(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := v.Finish(); err == nil || !strings.Contains(err.Error(), "ends at sequence 3") {
+		t.Fatalf("expected the removed entry to be detected, got %v", err)
+	}
+
+	be = newBackend()
+	if err := be.LogRequest(ctx, in); err != nil {
+		t.Fatal(err)
+	}
+	contents, err = os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines = bytes.SplitAfter(bytes.TrimSpace(contents), []byte("\n"))
+	link, _, err := audit.ParseChainedEntry(lines[len(lines)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Seq != 5 || link.Prev != head.HMAC {
+		t.Fatalf("expected the next entry to follow the stored chain, got %#v", link)
+	}
+}
+
+func testChainVerifier(ctx context.Context, be *Backend) *audit.ChainVerifier {
+	return &audit.ChainVerifier{
+		HashFunc: func(inputs []string) ([]string, error) {
+			hashes := make([]string, 0, len(inputs))
+			for _, input := range inputs {
+				hash, err := be.GetHash(ctx, input)
+				if err != nil {
+					return nil, err
+				}
+				hashes = append(hashes, hash)
+			}
+			return hashes, nil
+		},
+	}
+}
+
+func TestAuditFile_hashChainRotate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	saltView := &logical.InmemStorage{}
+
+	newBackend := func() *Backend {
+		be, err := Factory(context.Background(), &audit.BackendConfig{
+			SaltConfig: &salt.Config{},
+			SaltView:   saltView,
+			Config: map[string]string{
+				"path":            file,
+				"hash_chain":      "true",
+				"rotate_bytes":    "2000",
+				"rotate_compress": "true",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return be.(*Backend)
+	}
+
+	in := &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "/foo",
+		},
+	}
+	ctx := namespace.RootContext(nil)
+
+	be := newBackend()
+	for i := 0; i < 10; i++ {
+		if err := be.LogRequest(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Restart right after a rotation, when the current file is empty, and
+	// make sure the chain is still picked up.
+	be.fileLock.Lock()
+	if err := be.rotate(); err != nil {
+		t.Fatal(err)
+	}
+	be.fileLock.Unlock()
+	be.archiveWg.Wait()
+
+	be = newBackend()
+	if err := be.LogResponse(ctx, in); err != nil {
+		t.Fatal(err)
+	}
+
+	archives, err := be.listArchives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := testChainVerifier(ctx, be)
+	for _, path := range append(archives, file) {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var r io.Reader = f
+		if strings.HasSuffix(path, ".gz") {
+			if r, err = gzip.NewReader(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		contents, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range bytes.SplitAfter(contents, []byte("\n")) {
+			if err := v.Verify(line); err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+		}
+	}
+	if err := v.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Verified != 11 || v.FirstSeq != 1 {
+		t.Fatalf("expected 11 chained entries from sequence 1, got %d from %d", v.Verified, v.FirstSeq)
+	}
+}
+
+func TestAuditFile_hashChainFormat(t *testing.T) {
+	_, err := Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config: map[string]string{
+			"path":       "discard",
+			"format":     "jsonx",
+			"hash_chain": "true",
+		},
+	})
+	if err == nil {
+		t.Fatal("expected error enabling hash_chain with jsonx format")
+	}
+}
+
+func TestAuditFile_rotate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "audit.log")
+
+	be, err := Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config: map[string]string{
+			"path":            file,
+			"rotate_bytes":    "2000",
+			"rotate_compress": "true",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := be.(*Backend)
+	ctx := namespace.RootContext(nil)
+
+	// Log concurrently, so that rotations race with writes and reloads, and
+	// make sure every entry ends up in exactly one file.
+	const writers, entries = 8, 50
+	var wg sync.WaitGroup
+	errCh := make(chan error, writers+1)
+	stopReload := make(chan struct{})
+	reloadDone := make(chan struct{})
+	go func() {
+		defer close(reloadDone)
+		for {
+			select {
+			case <-stopReload:
+				return
+			default:
+			}
+			if err := b.Reload(ctx); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < entries; i++ {
+				in := &logical.LogInput{
+					Request: &logical.Request{
+						Operation: logical.UpdateOperation,
+						Path:      fmt.Sprintf("foo/%d/%d", w, i),
+					},
+				}
+				if err := b.LogRequest(ctx, in); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stopReload)
+	<-reloadDone
+	close(errCh)
+	for err := range errCh {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archives, err := b.listArchives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) < 2 {
+		t.Fatalf("expected the log to be rotated, got %d archives", len(archives))
+	}
+
+	seen := make(map[string]bool)
+	for _, path := range append(archives, file) {
+		var r io.Reader
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		r = f
+		if path != file {
+			if !strings.HasSuffix(path, ".gz") {
+				t.Fatalf("expected %s to be compressed", path)
+			}
+			if r, err = gzip.NewReader(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		contents, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(contents) > 2000 {
+			t.Fatalf("expected %s to be at most 2000 bytes, got %d", path, len(contents))
+		}
+
+		for _, line := range bytes.Split(bytes.TrimSpace(contents), []byte("\n")) {
+			var entry audit.AuditRequestEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+			if seen[entry.Request.Path] {
+				t.Fatalf("duplicate entry for %s", entry.Request.Path)
+			}
+			seen[entry.Request.Path] = true
+		}
+	}
+	if len(seen) != writers*entries {
+		t.Fatalf("expected %d entries, got %d", writers*entries, len(seen))
+	}
+}
+
+func TestAuditFile_rotateRetention(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "audit.log")
+
+	// A file that only shares the naming pattern must be left alone
+	other := filepath.Join(dir, "audit-old.log")
+	if err := os.WriteFile(other, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	be, err := Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config: map[string]string{
+			"path":             file,
+			"rotate_duration":  "1h",
+			"rotate_max_files": "2",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := be.(*Backend)
+	ctx := namespace.RootContext(nil)
+
+	start := time.Now()
+	defer func() { now = time.Now }()
+
+	in := &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "foo",
+		},
+	}
+	for i := 0; i < 5; i++ {
+		now = func() time.Time { return start.Add(time.Duration(i) * time.Hour) }
+		if err := b.LogRequest(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+		b.archiveWg.Wait()
+	}
+
+	archives, err := b.listArchives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join(dir, fmt.Sprintf("audit-%d.log", start.Add(3*time.Hour).UnixNano())),
+		filepath.Join(dir, fmt.Sprintf("audit-%d.log", start.Add(4*time.Hour).UnixNano())),
+	}
+	if !reflect.DeepEqual(archives, expected) {
+		t.Fatalf("expected archives %v, got %v", expected, archives)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditFile_rotateDurationRestart(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "audit.log")
+
+	start := time.Now()
+	defer func() { now = time.Now }()
+	at := func(d time.Duration) {
+		now = func() time.Time { return start.Add(d) }
+	}
+
+	in := &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "foo",
+		},
+	}
+	ctx := namespace.RootContext(nil)
+
+	// Each log call is made by a new backend, as after a restart, so the
+	// age of the file must not start again from when it was opened.
+	logAt := func(d time.Duration) {
+		at(d)
+		be, err := Factory(context.Background(), &audit.BackendConfig{
+			SaltConfig: &salt.Config{},
+			SaltView:   &logical.InmemStorage{},
+			Config: map[string]string{
+				"path":            file,
+				"rotate_duration": "1h",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := be.LogRequest(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+		if err := be.(*Backend).Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logAt(0)
+	logAt(time.Hour)
+	logAt(90 * time.Minute)
+	logAt(125 * time.Minute)
+
+	be := &Backend{path: file}
+	archives, err := be.listArchives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join(dir, fmt.Sprintf("audit-%d.log", start.Add(time.Hour).UnixNano())),
+		filepath.Join(dir, fmt.Sprintf("audit-%d.log", start.Add(125*time.Minute).UnixNano())),
+	}
+	if !reflect.DeepEqual(archives, expected) {
+		t.Fatalf("expected archives %v, got %v", expected, archives)
+	}
+}
+
+func TestAuditFile_rotateStdout(t *testing.T) {
+	_, err := Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config: map[string]string{
+			"path":         "stdout",
+			"rotate_bytes": "10MiB",
+		},
+	})
+	if err == nil {
+		t.Fatal("expected error enabling rotation when writing to stdout")
+	}
+}
+
 func BenchmarkAuditFile_request(b *testing.B) {
 	config := map[string]string{
 		"path": "/dev/null",
@@ -0,0 +1,20 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build darwin || freebsd || netbsd
+
+package file
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileCreated returns the birth time of the file.
+func fileCreated(_ string, info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Birthtimespec.Unix())
+	}
+	return info.ModTime()
+}
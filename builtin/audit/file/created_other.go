@@ -0,0 +1,17 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !linux && !darwin && !freebsd && !netbsd && !windows
+
+package file
+
+import (
+	"os"
+	"time"
+)
+
+// fileCreated returns the modification time of the file, as this platform
+// does not record when files were created.
+func fileCreated(_ string, info os.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -0,0 +1,20 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build windows
+
+package file
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileCreated returns the creation time of the file.
+func fileCreated(_ string, info os.FileInfo) time.Time {
+	if attrs, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return time.Unix(0, attrs.CreationTime.Nanoseconds())
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,233 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package file
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/go-multierror"
+)
+
+// archiveSuffix is appended to archived audit logs that have been
+// compressed.
+const archiveSuffix = ".gz"
+
+var now = time.Now
+
+// shouldRotate reports whether the current file has to be rotated before an
+// entry of n bytes is written to it. An empty file is never rotated, so a
+// single entry larger than rotate_bytes still gets written. The file lock
+// must be held before calling this.
+func (b *Backend) shouldRotate(n int) bool {
+	if b.bytesWritten == 0 {
+		return false
+	}
+	if b.rotateBytes > 0 && b.bytesWritten+int64(n) > b.rotateBytes {
+		return true
+	}
+	if b.rotateDuration > 0 && now().Sub(b.startedAt) >= b.rotateDuration {
+		return true
+	}
+	return false
+}
+
+// rotate moves the current file aside and opens a new one in its place. The
+// moved file is compressed and old archives are pruned in the background, so
+// that requests are not held up. The file lock must be held before calling
+// this, as the archive is added to archiveWg under it.
+func (b *Backend) rotate() error {
+	err := b.f.Close()
+	// Set to nil here so that even if we error out, on the next access open()
+	// will be tried
+	b.f = nil
+	if err != nil {
+		return err
+	}
+
+	archive := fmt.Sprintf(b.archivePattern(), strconv.FormatInt(now().UnixNano(), 10))
+	if err := os.Rename(b.path, archive); err != nil {
+		return err
+	}
+
+	if err := b.open(); err != nil {
+		return err
+	}
+
+	b.archiveWg.Add(1)
+	go b.archive(archive)
+
+	return nil
+}
+
+// archivePattern returns the pattern used to name archived files, with a
+// single %s for the time of rotation. As for the server log, an audit log
+// at /var/log/vault_audit.log is archived as /var/log/vault_audit-<ts>.log.
+func (b *Backend) archivePattern() string {
+	ext := filepath.Ext(b.path)
+	base := strings.TrimSuffix(b.path, ext)
+	if ext == "" {
+		ext = ".log"
+	}
+	return base + "-%s" + ext
+}
+
+// archive compresses a rotated file, if configured, and then removes the
+// oldest archives beyond the retention count.
+func (b *Backend) archive(path string) {
+	defer b.archiveWg.Done()
+
+	b.archiveLock.Lock()
+	defer b.archiveLock.Unlock()
+
+	if b.rotateCompress {
+		if err := compressFile(path, b.mode); err != nil {
+			metrics.IncrCounter([]string{"audit", "file", "compress_failure"}, 1)
+		}
+	}
+
+	if err := b.pruneArchives(); err != nil {
+		metrics.IncrCounter([]string{"audit", "file", "prune_failure"}, 1)
+	}
+}
+
+// pruneArchives removes all but the newest rotate_max_files archives. A
+// retention count of zero keeps every archive.
+func (b *Backend) pruneArchives() error {
+	if b.rotateMaxFiles <= 0 {
+		return nil
+	}
+
+	archives, err := b.listArchives()
+	if err != nil {
+		return err
+	}
+	if len(archives) <= b.rotateMaxFiles {
+		return nil
+	}
+
+	var retErr error
+	for _, archive := range archives[:len(archives)-b.rotateMaxFiles] {
+		if err := os.Remove(archive); err != nil {
+			retErr = multierror.Append(retErr, fmt.Errorf("error removing file %s: %w", archive, err))
+		}
+	}
+	return retErr
+}
+
+// fileStarted returns when the existing, non-empty current file was
+// started, so that its age survives restarts and reloads: the time of the
+// latest rotation if there has been one, and otherwise the time the file was
+// created, as far as the platform can tell. The file lock must be held
+// before calling this.
+func (b *Backend) fileStarted(info os.FileInfo) time.Time {
+	archives, err := b.listArchives()
+	if err == nil && len(archives) > 0 {
+		if ts, ok := b.archiveTime(archives[len(archives)-1]); ok {
+			return time.Unix(0, ts)
+		}
+	}
+	return fileCreated(b.path, info)
+}
+
+// archiveTime returns the time of rotation recorded in the name of an
+// archived file, in nanoseconds since the epoch, and whether the name is
+// that of an archive of this log at all.
+func (b *Backend) archiveTime(path string) (int64, bool) {
+	prefix, suffix, _ := strings.Cut(b.archivePattern(), "%s")
+	name := strings.TrimSuffix(path, archiveSuffix)
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return 0, false
+	}
+	ts, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return ts, true
+}
+
+// listArchives returns the archived files of this log, compressed or not,
+// oldest first.
+func (b *Backend) listArchives() ([]string, error) {
+	pattern := b.archivePattern()
+
+	matches, err := filepath.Glob(fmt.Sprintf(pattern, "*"))
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := filepath.Glob(fmt.Sprintf(pattern, "*") + archiveSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	type archive struct {
+		path string
+		ts   int64
+	}
+	var archives []archive
+	for _, match := range append(matches, compressed...) {
+		ts, ok := b.archiveTime(match)
+		if !ok {
+			// Not one of ours
+			continue
+		}
+		archives = append(archives, archive{path: match, ts: ts})
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].ts < archives[j].ts
+	})
+
+	ret := make([]string, 0, len(archives))
+	for _, a := range archives {
+		ret = append(ret, a.path)
+	}
+	return ret, nil
+}
+
+// compressFile gzips the file at path into path.gz and removes the original.
+// The compressed file is written under a temporary name first, so that an
+// interrupted compression never leaves a truncated archive behind.
+func compressFile(path string, mode os.FileMode) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := path + archiveSuffix + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path+archiveSuffix)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,680 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	defaultBatchSize      = 100
+	defaultBatchInterval  = time.Second
+	defaultQueueSize      = 10000
+	defaultRequestTimeout = 5 * time.Second
+	defaultMaxRetries     = 3
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 30 * time.Second
+	defaultSpoolMaxSize   = 100 * 1024 * 1024
+
+	jsonxNamespace = "http://www.ibm.com/xmlns/prod/2009/jsonx"
+)
+
+func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, error) {
+	if conf.SaltConfig == nil {
+		return nil, fmt.Errorf("nil salt config")
+	}
+	if conf.SaltView == nil {
+		return nil, fmt.Errorf("nil salt view")
+	}
+
+	address, ok := conf.Config["address"]
+	if !ok {
+		return nil, fmt.Errorf("address is required")
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing address: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("address must be an http or https URL")
+	}
+
+	format, ok := conf.Config["format"]
+	if !ok {
+		format = "json"
+	}
+	switch format {
+	case "json", "jsonx", "cef", "ocsf":
+	default:
+		return nil, fmt.Errorf("unknown format type %q", format)
+	}
+
+	// Check if hashing of accessor is disabled
+	hmacAccessor := true
+	if hmacAccessorRaw, ok := conf.Config["hmac_accessor"]; ok {
+		value, err := strconv.ParseBool(hmacAccessorRaw)
+		if err != nil {
+			return nil, err
+		}
+		hmacAccessor = value
+	}
+
+	// Check if raw logging is enabled
+	logRaw := false
+	if raw, ok := conf.Config["log_raw"]; ok {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		logRaw = b
+	}
+
+	elideListResponses := false
+	if elideListResponsesRaw, ok := conf.Config["elide_list_responses"]; ok {
+		value, err := strconv.ParseBool(elideListResponsesRaw)
+		if err != nil {
+			return nil, err
+		}
+		elideListResponses = value
+	}
+
+	batchSize, err := parsePositiveInt(conf.Config, "batch_size", defaultBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	queueSize, err := parsePositiveInt(conf.Config, "queue_size", defaultQueueSize)
+	if err != nil {
+		return nil, err
+	}
+	if queueSize < batchSize {
+		return nil, fmt.Errorf("queue_size must not be smaller than batch_size")
+	}
+
+	maxRetries := defaultMaxRetries
+	if maxRetriesRaw, ok := conf.Config["max_retries"]; ok {
+		value, err := strconv.Atoi(maxRetriesRaw)
+		if err != nil {
+			return nil, err
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("max_retries must not be negative")
+		}
+		maxRetries = value
+	}
+
+	batchInterval, err := parseDuration(conf.Config, "batch_interval", defaultBatchInterval)
+	if err != nil {
+		return nil, err
+	}
+	requestTimeout, err := parseDuration(conf.Config, "request_timeout", defaultRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	initialBackoff, err := parseDuration(conf.Config, "retry_initial_backoff", defaultInitialBackoff)
+	if err != nil {
+		return nil, err
+	}
+	maxBackoff, err := parseDuration(conf.Config, "retry_max_backoff", defaultMaxBackoff)
+	if err != nil {
+		return nil, err
+	}
+	if maxBackoff < initialBackoff {
+		return nil, fmt.Errorf("retry_max_backoff must not be smaller than retry_initial_backoff")
+	}
+
+	b := &Backend{
+		address:    address,
+		saltConfig: conf.SaltConfig,
+		saltView:   conf.SaltView,
+		salt:       new(atomic.Value),
+		formatConfig: audit.FormatterConfig{
+			Raw:                logRaw,
+			HMACAccessor:       hmacAccessor,
+			ElideListResponses: elideListResponses,
+		},
+
+		client: &http.Client{
+			Transport: cleanhttp.DefaultPooledTransport(),
+			Timeout:   requestTimeout,
+		},
+		batchSize:      batchSize,
+		batchInterval:  batchInterval,
+		queueSize:      queueSize,
+		maxRetries:     maxRetries,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		flushCh:        make(chan struct{}, 1),
+	}
+
+	if err := b.formatConfig.ParseFilterOptions(conf.Config); err != nil {
+		return nil, err
+	}
+
+	// Ensure we are working with the right type by explicitly storing a nil of
+	// the right type
+	b.salt.Store((*salt.Salt)(nil))
+
+	switch format {
+	case "json":
+		b.contentType = "application/x-ndjson"
+		b.formatter.AuditFormatWriter = &audit.JSONFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
+	case "jsonx":
+		// Each entry is a sequence of JSONx members, so wrap it in an object
+		// and the batch in an array to give the receiver one XML document
+		b.contentType = "application/xml"
+		b.batchHeader = []byte(xml.Header + `<json:array xmlns:json="` + jsonxNamespace + `">` + "\n")
+		b.batchFooter = []byte("</json:array>\n")
+		b.entryHeader = []byte("<json:object>")
+		b.entryFooter = []byte("</json:object>")
+		b.formatter.AuditFormatWriter = &audit.JSONxFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
+	case "cef":
+		b.contentType = "text/plain"
+		b.formatter.AuditFormatWriter = &audit.CEFFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
+	case "ocsf":
+		b.contentType = "application/x-ndjson"
+		b.formatter.AuditFormatWriter = &audit.OCSFFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
+	}
+
+	// Nothing can fail after this point except opening the spool, which
+	// cancels the context itself, so the worker cannot be leaked
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+
+	if spoolPath := conf.Config["spool_path"]; spoolPath != "" {
+		spoolMaxSize := uint64(defaultSpoolMaxSize)
+		if spoolMaxSizeRaw, ok := conf.Config["spool_max_size"]; ok {
+			spoolMaxSize, err = parseutil.ParseCapacityString(spoolMaxSizeRaw)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing spool_max_size: %w", err)
+			}
+		}
+
+		b.spool, err = newSpool(spoolPath, int64(spoolMaxSize))
+		if err != nil {
+			b.cancel()
+			return nil, fmt.Errorf("unable to open spool directory %q: %w", spoolPath, err)
+		}
+
+		// Deliver anything left over from before a restart.
+		if b.spool.len() > 0 {
+			b.queueLock.Lock()
+			b.startLocked()
+			b.queueLock.Unlock()
+		}
+	}
+
+	return b, nil
+}
+
+// Backend is the audit backend for the HTTP audit transport. Formatted
+// entries are queued in memory and POSTed to the configured address in
+// newline-delimited batches by a background worker. Batches that cannot be
+// delivered after retrying are written to an optional on-disk spool and
+// redelivered, oldest first, once the endpoint recovers.
+//
+// Because delivery is asynchronous, LogRequest and LogResponse only fail
+// when an entry cannot be queued: that is, when the in-memory queue is full
+// and either no spool is configured or the spool is also full. Entries are
+// delivered at least once; while the endpoint is unavailable their relative
+// order across batches is not guaranteed.
+//
+// The spool directory is locked while the backend is in use, so it cannot be
+// shared with another device. Close stops delivery and releases the spool,
+// leaving undelivered entries in it for the next device using it.
+type Backend struct {
+	address     string
+	contentType string
+	client      *http.Client
+
+	// batchHeader and batchFooter enclose each request body, and entryHeader
+	// and entryFooter each entry within it, for formats that need a single
+	// root element
+	batchHeader []byte
+	batchFooter []byte
+	entryHeader []byte
+	entryFooter []byte
+
+	formatter    audit.AuditFormatter
+	formatConfig audit.FormatterConfig
+
+	batchSize      int
+	batchInterval  time.Duration
+	queueSize      int
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	spool *spool
+
+	// flushLock serializes delivery so that batches are sent in order
+	flushLock sync.Mutex
+
+	queueLock sync.Mutex
+	queue     [][]byte
+	running   bool
+	closed    bool
+	flushCh   chan struct{}
+
+	// ctx is cancelled by Close to stop the delivery worker, which workers
+	// tracks
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+
+	saltMutex  sync.RWMutex
+	salt       *atomic.Value
+	saltConfig *salt.Config
+	saltView   logical.Storage
+}
+
+var (
+	_ audit.Backend = (*Backend)(nil)
+	_ audit.Closer  = (*Backend)(nil)
+)
+
+func (b *Backend) Salt(ctx context.Context) (*salt.Salt, error) {
+	s := b.salt.Load().(*salt.Salt)
+	if s != nil {
+		return s, nil
+	}
+
+	b.saltMutex.Lock()
+	defer b.saltMutex.Unlock()
+
+	s = b.salt.Load().(*salt.Salt)
+	if s != nil {
+		return s, nil
+	}
+
+	newSalt, err := salt.NewSalt(ctx, b.saltView, b.saltConfig)
+	if err != nil {
+		b.salt.Store((*salt.Salt)(nil))
+		return nil, err
+	}
+
+	b.salt.Store(newSalt)
+	return newSalt, nil
+}
+
+func (b *Backend) GetHash(ctx context.Context, data string) (string, error) {
+	salt, err := b.Salt(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return audit.HashString(salt, data), nil
+}
+
+func (b *Backend) LogRequest(ctx context.Context, in *logical.LogInput) error {
+	var buf bytes.Buffer
+	if err := b.formatter.FormatRequest(ctx, &buf, b.formatConfig, in); err != nil {
+		return err
+	}
+
+	return b.enqueue(buf.Bytes())
+}
+
+func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
+	var buf bytes.Buffer
+	if err := b.formatter.FormatResponse(ctx, &buf, b.formatConfig, in); err != nil {
+		return err
+	}
+
+	return b.enqueue(buf.Bytes())
+}
+
+// LogTestMessage bypasses the queue and delivers the message synchronously,
+// without retrying, so that enabling a device with an unreachable address
+// fails immediately.
+func (b *Backend) LogTestMessage(ctx context.Context, in *logical.LogInput, config map[string]string) error {
+	var buf bytes.Buffer
+	temporaryFormatter := audit.NewTemporaryFormatter(config["format"], config["prefix"])
+	if err := temporaryFormatter.FormatRequest(ctx, &buf, b.formatConfig, in); err != nil {
+		return err
+	}
+
+	return b.post(ctx, b.joinEntries([][]byte{buf.Bytes()}))
+}
+
+// Reload drops any idle connections to the endpoint and synchronously
+// attempts to deliver everything that is currently queued or spooled.
+func (b *Backend) Reload(ctx context.Context) error {
+	b.client.CloseIdleConnections()
+	return b.flush(ctx)
+}
+
+// Close stops the delivery worker, moves anything still queued to the spool
+// and releases the spool directory. Entries are lost only when no spool is
+// configured.
+func (b *Backend) Close() error {
+	b.queueLock.Lock()
+	b.closed = true
+	b.queueLock.Unlock()
+
+	b.cancel()
+	b.workers.Wait()
+
+	// Wait for a delivery started by Reload
+	b.flushLock.Lock()
+	defer b.flushLock.Unlock()
+
+	if b.spool == nil {
+		return nil
+	}
+	b.spillQueue()
+	return b.spool.close()
+}
+
+func (b *Backend) Invalidate(_ context.Context) {
+	b.saltMutex.Lock()
+	defer b.saltMutex.Unlock()
+	b.salt.Store((*salt.Salt)(nil))
+}
+
+// enqueue adds a formatted entry to the in-memory queue, spilling the queue
+// to the spool if it is full.
+func (b *Backend) enqueue(entry []byte) error {
+	b.queueLock.Lock()
+	defer b.queueLock.Unlock()
+
+	if b.closed {
+		return fmt.Errorf("audit device is closed")
+	}
+
+	if len(b.queue) >= b.queueSize {
+		if b.spool == nil {
+			metrics.IncrCounter([]string{"audit", "http", "queue_full"}, 1)
+			return fmt.Errorf("audit queue is full")
+		}
+		if err := b.spool.push(b.joinEntries(b.queue)); err != nil {
+			metrics.IncrCounter([]string{"audit", "http", "queue_full"}, 1)
+			return fmt.Errorf("audit queue is full and could not be spooled: %w", err)
+		}
+		b.queue = nil
+	}
+
+	b.queue = append(b.queue, entry)
+	if len(b.queue) >= b.batchSize {
+		select {
+		case b.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	b.startLocked()
+
+	return nil
+}
+
+// startLocked starts the delivery worker if it is not already running and
+// the backend has not been closed. The queue lock must be held when calling
+// this.
+func (b *Backend) startLocked() {
+	if b.running || b.closed {
+		return
+	}
+	b.running = true
+	b.workers.Add(1)
+	go b.run()
+}
+
+// run delivers batches until both the queue and the spool are empty, at
+// which point it exits; enqueue starts it again as needed. It also exits,
+// abandoning any delivery in progress, once the backend is closed.
+func (b *Backend) run() {
+	defer b.workers.Done()
+
+	ticker := time.NewTicker(b.batchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.flushCh:
+		case <-b.ctx.Done():
+			b.queueLock.Lock()
+			b.running = false
+			b.queueLock.Unlock()
+			return
+		}
+
+		if err := b.flush(b.ctx); err != nil {
+			metrics.IncrCounter([]string{"audit", "http", "flush_failure"}, 1)
+		}
+
+		b.queueLock.Lock()
+		if len(b.queue) == 0 && b.spool.len() == 0 {
+			b.running = false
+			b.queueLock.Unlock()
+			return
+		}
+		b.queueLock.Unlock()
+	}
+}
+
+// flush delivers spooled batches followed by queued entries. If delivery
+// fails, the remaining entries are moved to the spool when one is
+// configured, and otherwise kept in the queue for the next attempt.
+func (b *Backend) flush(ctx context.Context) error {
+	b.flushLock.Lock()
+	defer b.flushLock.Unlock()
+
+	if err := b.drainSpool(ctx); err != nil {
+		b.spillQueue()
+		return err
+	}
+
+	for {
+		batch := b.takeBatch()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		body := b.joinEntries(batch)
+		err := b.send(ctx, body)
+		if err == nil {
+			continue
+		}
+
+		if b.spool != nil {
+			if sErr := b.spool.push(body); sErr == nil {
+				b.spillQueue()
+				return err
+			}
+		}
+		b.requeue(batch)
+		return err
+	}
+}
+
+// drainSpool delivers spooled batches oldest first, stopping at the first
+// failure.
+func (b *Backend) drainSpool(ctx context.Context) error {
+	if b.spool == nil {
+		return nil
+	}
+
+	for {
+		name, body, err := b.spool.peek()
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			return nil
+		}
+		if err := b.send(ctx, body); err != nil {
+			return err
+		}
+		if err := b.spool.remove(name); err != nil {
+			return err
+		}
+	}
+}
+
+// spillQueue moves everything currently queued into the spool, if there is
+// one and it has room.
+func (b *Backend) spillQueue() {
+	if b.spool == nil {
+		return
+	}
+
+	b.queueLock.Lock()
+	defer b.queueLock.Unlock()
+
+	if len(b.queue) == 0 {
+		return
+	}
+	if err := b.spool.push(b.joinEntries(b.queue)); err == nil {
+		b.queue = nil
+	}
+}
+
+// takeBatch removes and returns up to batchSize entries from the head of
+// the queue.
+func (b *Backend) takeBatch() [][]byte {
+	b.queueLock.Lock()
+	defer b.queueLock.Unlock()
+
+	n := len(b.queue)
+	if n > b.batchSize {
+		n = b.batchSize
+	}
+	batch := b.queue[:n:n]
+	b.queue = b.queue[n:]
+
+	return batch
+}
+
+// requeue puts a batch that could not be delivered back at the head of the
+// queue.
+func (b *Backend) requeue(batch [][]byte) {
+	b.queueLock.Lock()
+	defer b.queueLock.Unlock()
+
+	b.queue = append(batch, b.queue...)
+}
+
+// send POSTs a batch, retrying with exponential backoff.
+func (b *Backend) send(ctx context.Context, body []byte) error {
+	backoff := b.initialBackoff
+	for attempt := 0; ; attempt++ {
+		err := b.post(ctx, body)
+		if err == nil {
+			metrics.IncrCounter([]string{"audit", "http", "batch_sent"}, 1)
+			return nil
+		}
+		if attempt >= b.maxRetries {
+			return err
+		}
+
+		metrics.IncrCounter([]string{"audit", "http", "retry"}, 1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > b.maxBackoff {
+			backoff = b.maxBackoff
+		}
+	}
+}
+
+// post makes a single delivery attempt.
+func (b *Backend) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", b.contentType)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response from audit endpoint: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// joinEntries builds a request body from formatted entries, one per line.
+func (b *Backend) joinEntries(entries [][]byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(b.batchHeader)
+	for _, entry := range entries {
+		buf.Write(b.entryHeader)
+		buf.Write(bytes.TrimSuffix(entry, []byte("\n")))
+		buf.Write(b.entryFooter)
+		buf.WriteByte('\n')
+	}
+	buf.Write(b.batchFooter)
+	return buf.Bytes()
+}
+
+func parsePositiveInt(config map[string]string, key string, def int) (int, error) {
+	raw, ok := config[key]
+	if !ok {
+		return def, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s: %w", key, err)
+	}
+	if value <= 0 {
+		return 0, fmt.Errorf("%s must be greater than zero", key)
+	}
+	return value, nil
+}
+
+func parseDuration(config map[string]string, key string, def time.Duration) (time.Duration, error) {
+	raw, ok := config[key]
+	if !ok {
+		return def, nil
+	}
+	value, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s: %w", key, err)
+	}
+	if value <= 0 {
+		return 0, fmt.Errorf("%s must be greater than zero", key)
+	}
+	return value, nil
+}
@@ -0,0 +1,424 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// testCollector is an httptest server that records the request IDs of every
+// entry it accepts, and can be told to fail.
+type testCollector struct {
+	*httptest.Server
+
+	failing atomic.Bool
+
+	l       sync.Mutex
+	batches int
+	ids     []string
+}
+
+func newTestCollector(t *testing.T) *testCollector {
+	c := &testCollector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		c.l.Lock()
+		defer c.l.Unlock()
+		c.batches++
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			var entry audit.AuditRequestEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				t.Errorf("bad entry %q: %v", scanner.Text(), err)
+				continue
+			}
+			c.ids = append(c.ids, entry.Request.ID)
+		}
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *testCollector) received() (int, []string) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.batches, append([]string(nil), c.ids...)
+}
+
+func (c *testCollector) waitFor(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ids := c.received(); len(ids) >= n {
+			return ids
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, ids := c.received()
+	t.Fatalf("timed out waiting for %d entries, got %d", n, len(ids))
+	return nil
+}
+
+func testBackend(t *testing.T, config map[string]string) *Backend {
+	t.Helper()
+	be, err := Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config:     config,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { be.(*Backend).Close() })
+	return be.(*Backend)
+}
+
+func testLogInput(id string) *logical.LogInput {
+	return &logical.LogInput{
+		Request: &logical.Request{
+			ID:        id,
+			Operation: logical.UpdateOperation,
+			Path:      "secret/foo",
+		},
+	}
+}
+
+func TestAuditHTTP_batching(t *testing.T) {
+	collector := newTestCollector(t)
+	b := testBackend(t, map[string]string{
+		"address":        collector.URL,
+		"batch_size":     "5",
+		"batch_interval": "1h",
+	})
+
+	ctx := namespace.RootContext(nil)
+	var expected []string
+	for i := 0; i < 10; i++ {
+		id := string(rune('a' + i))
+		expected = append(expected, id)
+		if err := b.LogRequest(ctx, testLogInput(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := collector.waitFor(t, 10)
+	if strings.Join(ids, "") != strings.Join(expected, "") {
+		t.Fatalf("entries delivered out of order: %v", ids)
+	}
+	if batches, _ := collector.received(); batches != 2 {
+		t.Fatalf("expected 2 batches, got %d", batches)
+	}
+}
+
+func TestAuditHTTP_jsonxBatch(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	t.Cleanup(srv.Close)
+
+	b := testBackend(t, map[string]string{
+		"address":        srv.URL,
+		"format":         "jsonx",
+		"batch_size":     "2",
+		"batch_interval": "1h",
+	})
+
+	ctx := namespace.RootContext(nil)
+	for _, id := range []string{"a", "b"} {
+		if err := b.LogRequest(ctx, testLogInput(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var body []byte
+	select {
+	case body = <-bodies:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for batch")
+	}
+
+	// The batch must be a single well-formed document holding both entries
+	var doc struct {
+		XMLName xml.Name
+		Objects []struct{} `xml:"object"`
+	}
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("batch is not valid XML: %v\n%s", err, body)
+	}
+	if doc.XMLName.Local != "array" || len(doc.Objects) != 2 {
+		t.Fatalf("unexpected batch: %s", body)
+	}
+}
+
+func TestAuditHTTP_retry(t *testing.T) {
+	collector := newTestCollector(t)
+	collector.failing.Store(true)
+
+	b := testBackend(t, map[string]string{
+		"address":               collector.URL,
+		"batch_interval":        "10ms",
+		"max_retries":           "10",
+		"retry_initial_backoff": "10ms",
+		"retry_max_backoff":     "50ms",
+	})
+
+	if err := b.LogRequest(namespace.RootContext(nil), testLogInput("retried")); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	collector.failing.Store(false)
+
+	ids := collector.waitFor(t, 1)
+	if ids[0] != "retried" {
+		t.Fatalf("unexpected entries: %v", ids)
+	}
+}
+
+func TestAuditHTTP_spool(t *testing.T) {
+	collector := newTestCollector(t)
+	collector.failing.Store(true)
+
+	spoolPath := t.TempDir()
+	config := map[string]string{
+		"address":               collector.URL,
+		"batch_size":            "2",
+		"batch_interval":        "10ms",
+		"queue_size":            "2",
+		"max_retries":           "0",
+		"retry_initial_backoff": "10ms",
+		"spool_path":            spoolPath,
+	}
+	b := testBackend(t, config)
+
+	ctx := namespace.RootContext(nil)
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		if err := b.LogRequest(ctx, testLogInput(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Everything should end up on disk while the collector is down.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		b.queueLock.Lock()
+		queued := len(b.queue)
+		b.queueLock.Unlock()
+		if queued == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("entries were not spooled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	files, err := os.ReadDir(spoolPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("expected spooled batches")
+	}
+
+	collector.failing.Store(false)
+
+	// Ordering across the queue and the spool is only best-effort while
+	// the collector is down, but nothing may be lost.
+	ids := collector.waitFor(t, 5)
+	sort.Strings(ids)
+	if strings.Join(ids, "") != "abcde" {
+		t.Fatalf("unexpected spooled entries: %v", ids)
+	}
+}
+
+func TestAuditHTTP_spoolRestart(t *testing.T) {
+	collector := newTestCollector(t)
+
+	// Simulate batches left behind by a previous process, including a
+	// partially written one that must be ignored.
+	spoolPath := t.TempDir()
+	s, err := newSpool(spoolPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ids := range [][]string{{"a", "b"}, {"c"}} {
+		var entries [][]byte
+		for _, id := range ids {
+			entries = append(entries, []byte(`{"request":{"id":"`+id+`"}}`))
+		}
+		if err := s.push((&Backend{}).joinEntries(entries)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(spoolPath, "00000000000000000002.batch.tmp"), []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	testBackend(t, map[string]string{
+		"address":        collector.URL,
+		"batch_interval": "10ms",
+		"spool_path":     spoolPath,
+	})
+
+	ids := collector.waitFor(t, 3)
+	if strings.Join(ids, "") != "abc" {
+		t.Fatalf("spooled entries delivered out of order: %v", ids)
+	}
+}
+
+func TestAuditHTTP_close(t *testing.T) {
+	collector := newTestCollector(t)
+	collector.failing.Store(true)
+
+	spoolPath := t.TempDir()
+	config := map[string]string{
+		"address":               collector.URL,
+		"batch_interval":        "10ms",
+		"max_retries":           "1000",
+		"retry_initial_backoff": "10ms",
+		"spool_path":            spoolPath,
+	}
+	b := testBackend(t, config)
+
+	if err := b.LogRequest(namespace.RootContext(nil), testLogInput("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The spool belongs to b until it is closed.
+	_, err := Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config:     config,
+	})
+	if err == nil || !strings.Contains(err.Error(), errSpoolInUse.Error()) {
+		t.Fatalf("expected the spool to be in use, got: %v", err)
+	}
+
+	// Closing abandons the retries and spools the entry being delivered.
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b.queueLock.Lock()
+	running := b.running
+	b.queueLock.Unlock()
+	if running {
+		t.Fatal("delivery worker is still running")
+	}
+	if b.spool.len() != 1 {
+		t.Fatalf("expected 1 spooled batch, got %d", b.spool.len())
+	}
+	if err := b.LogRequest(namespace.RootContext(nil), testLogInput("b")); err == nil {
+		t.Fatal("expected logging to a closed device to fail")
+	}
+
+	// A new device takes over the spool and delivers its contents.
+	collector.failing.Store(false)
+	testBackend(t, config)
+	ids := collector.waitFor(t, 1)
+	if strings.Join(ids, "") != "a" {
+		t.Fatalf("unexpected entries: %v", ids)
+	}
+}
+
+func TestAuditHTTP_queueFull(t *testing.T) {
+	collector := newTestCollector(t)
+	collector.failing.Store(true)
+
+	b := testBackend(t, map[string]string{
+		"address":        collector.URL,
+		"batch_size":     "1",
+		"batch_interval": "1h",
+		"queue_size":     "1",
+		"max_retries":    "0",
+	})
+
+	ctx := namespace.RootContext(nil)
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = b.LogRequest(ctx, testLogInput("x"))
+		time.Sleep(time.Millisecond)
+	}
+	if err == nil {
+		t.Fatal("expected an error once the queue filled up")
+	}
+}
+
+func TestAuditHTTP_logTestMessage(t *testing.T) {
+	collector := newTestCollector(t)
+	b := testBackend(t, map[string]string{
+		"address": collector.URL,
+	})
+
+	ctx := namespace.RootContext(nil)
+	if err := b.LogTestMessage(ctx, testLogInput("test"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ids := collector.received(); len(ids) != 1 || ids[0] != "test" {
+		t.Fatalf("unexpected entries: %v", ids)
+	}
+
+	collector.failing.Store(true)
+	if err := b.LogTestMessage(ctx, testLogInput("test"), nil); err == nil {
+		t.Fatal("expected error from failing collector")
+	}
+}
+
+func TestAuditHTTP_badConfig(t *testing.T) {
+	cases := map[string]map[string]string{
+		"missing address": {},
+		"bad scheme":      {"address": "tcp://127.0.0.1:9090"},
+		"bad format":      {"address": "http://127.0.0.1", "format": "xml"},
+		"zero batch":      {"address": "http://127.0.0.1", "batch_size": "0"},
+		"small queue":     {"address": "http://127.0.0.1", "batch_size": "10", "queue_size": "5"},
+		"bad backoff":     {"address": "http://127.0.0.1", "retry_initial_backoff": "10s", "retry_max_backoff": "1s"},
+	}
+
+	for name, config := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Factory(context.Background(), &audit.BackendConfig{
+				SaltConfig: &salt.Config{},
+				SaltView:   &logical.InmemStorage{},
+				Config:     config,
+			})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
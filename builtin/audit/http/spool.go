@@ -0,0 +1,253 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package http
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	spoolFileSuffix = ".batch"
+	spoolTempSuffix = ".tmp"
+	spoolLockFile   = "spool.lock"
+)
+
+var (
+	errSpoolFull  = errors.New("audit spool is full")
+	errSpoolInUse = errors.New("audit spool directory is in use by another audit device")
+)
+
+// spoolDirs holds the spool directories locked by devices in this process.
+var (
+	spoolDirsLock sync.Mutex
+	spoolDirs     = map[string]struct{}{}
+)
+
+// spool is a bounded, directory-backed FIFO of batches that could not be
+// delivered. Each batch is stored in its own file, named with a sequence
+// number so that lexical order matches the order in which batches were
+// spooled.
+type spool struct {
+	dir     string
+	maxSize int64
+	lock    *spoolLock
+
+	l     sync.Mutex
+	size  int64
+	seq   uint64
+	files []string
+}
+
+// newSpool opens (creating if necessary) and locks the spool directory, and
+// loads any batches left behind by a previous process or device.
+func newSpool(dir string, maxSize int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	lock, err := lockSpoolDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	loaded := false
+	defer func() {
+		if !loaded {
+			lock.release()
+		}
+	}()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spool{
+		dir:     dir,
+		maxSize: maxSize,
+		lock:    lock,
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case entry.IsDir():
+			continue
+		case strings.HasSuffix(name, spoolTempSuffix):
+			// A partially written batch from a crash; it was never
+			// acknowledged as spooled, so it is safe to discard.
+			os.Remove(filepath.Join(dir, name))
+			continue
+		case !strings.HasSuffix(name, spoolFileSuffix):
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		s.files = append(s.files, name)
+		s.size += info.Size()
+		if seq >= s.seq {
+			s.seq = seq + 1
+		}
+	}
+	sort.Strings(s.files)
+
+	loaded = true
+	return s, nil
+}
+
+// close releases the spool directory; batches remain on disk.
+func (s *spool) close() error {
+	return s.lock.release()
+}
+
+// push appends a batch to the tail of the spool. It returns errSpoolFull if
+// storing the batch would exceed the configured maximum size.
+func (s *spool) push(batch []byte) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.maxSize > 0 && s.size+int64(len(batch)) > s.maxSize {
+		return errSpoolFull
+	}
+
+	name := fmt.Sprintf("%020d%s", s.seq, spoolFileSuffix)
+	path := filepath.Join(s.dir, name)
+	tmpPath := path + spoolTempSuffix
+
+	if err := os.WriteFile(tmpPath, batch, 0o600); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	s.seq++
+	s.size += int64(len(batch))
+	s.files = append(s.files, name)
+
+	return nil
+}
+
+// peek returns the name and contents of the oldest batch in the spool, or
+// an empty name if the spool is empty.
+func (s *spool) peek() (string, []byte, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if len(s.files) == 0 {
+		return "", nil, nil
+	}
+
+	name := s.files[0]
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return name, data, nil
+}
+
+// remove deletes a batch previously returned by peek.
+func (s *spool) remove(name string) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if len(s.files) == 0 || s.files[0] != name {
+		return fmt.Errorf("batch %q is not at the head of the spool", name)
+	}
+
+	path := filepath.Join(s.dir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	s.files = s.files[1:]
+	s.size -= info.Size()
+
+	return nil
+}
+
+// len returns the number of batches currently spooled.
+func (s *spool) len() int {
+	if s == nil {
+		return 0
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	return len(s.files)
+}
+
+// spoolLock is the exclusive ownership of a spool directory, held through a
+// lock file so that other processes are excluded as well.
+type spoolLock struct {
+	key string
+	f   *os.File
+}
+
+func lockSpoolDir(dir string) (*spoolLock, error) {
+	key, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if key, err = filepath.EvalSymlinks(key); err != nil {
+		return nil, err
+	}
+
+	spoolDirsLock.Lock()
+	defer spoolDirsLock.Unlock()
+
+	if _, ok := spoolDirs[key]; ok {
+		return nil, errSpoolInUse
+	}
+
+	f, err := os.OpenFile(filepath.Join(key, spoolLockFile), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: %v", errSpoolInUse, err)
+	}
+
+	spoolDirs[key] = struct{}{}
+	return &spoolLock{key: key, f: f}, nil
+}
+
+// release unlocks the spool directory; it is safe to call more than once.
+func (l *spoolLock) release() error {
+	spoolDirsLock.Lock()
+	defer spoolDirsLock.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+
+	// Closing the lock file releases the lock held on it.
+	err := l.f.Close()
+	l.f = nil
+	delete(spoolDirs, l.key)
+	return err
+}
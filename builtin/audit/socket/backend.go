@@ -51,7 +51,7 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		format = "json"
 	}
 	switch format {
-	case "json", "jsonx":
+	case "json", "jsonx", "cef", "ocsf":
 	default:
 		return nil, fmt.Errorf("unknown format type %q", format)
 	}
@@ -99,6 +99,10 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		socketType:    socketType,
 	}
 
+	if err := b.formatConfig.ParseFilterOptions(conf.Config); err != nil {
+		return nil, err
+	}
+
 	switch format {
 	case "json":
 		b.formatter.AuditFormatWriter = &audit.JSONFormatWriter{
@@ -110,6 +114,16 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 			Prefix:   conf.Config["prefix"],
 			SaltFunc: b.Salt,
 		}
+	case "cef":
+		b.formatter.AuditFormatWriter = &audit.CEFFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
+	case "ocsf":
+		b.formatter.AuditFormatWriter = &audit.OCSFFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
 	}
 
 	return b, nil
@@ -116,7 +116,7 @@ func Backend(conf *logical.BackendConfig) *backend {
 				"unified-ocsp",   // Unified OCSP POST
 				"unified-ocsp/*", // Unified OCSP GET
 
-				// ACME paths are added below
+				// ACME, EST, SCEP and CMP paths are added below
 			},
 
 			LocalStorage: []string{
@@ -220,6 +220,19 @@ func Backend(conf *logical.BackendConfig) *backend {
 			pathAcmeConfig(&b),
 			pathAcmeEabList(&b),
 			pathAcmeEabDelete(&b),
+
+			// EST
+			pathEstConfig(&b),
+
+			// SCEP
+			pathScepConfig(&b),
+			pathScepChallengeList(&b),
+			pathScepChallengeDelete(&b),
+
+			// CMP
+			pathCmpConfig(&b),
+			pathCmpSecretList(&b),
+			pathCmpSecretDelete(&b),
 		},
 
 		Secrets: []*framework.Secret{
@@ -271,6 +284,55 @@ func Backend(conf *logical.BackendConfig) *backend {
 		// We specifically do NOT add acme/new-eab to this as it should be auth'd
 	}
 
+	// Add EST paths to backend
+	var estPaths []*framework.Path
+	estPaths = append(estPaths, pathEstCaCerts(&b)...)
+	estPaths = append(estPaths, pathEstCsrAttrs(&b)...)
+	estPaths = append(estPaths, pathEstSimpleEnroll(&b)...)
+	estPaths = append(estPaths, pathEstSimpleReenroll(&b)...)
+
+	for _, estPath := range estPaths {
+		b.Backend.Paths = append(b.Backend.Paths, estPath)
+	}
+
+	// Add specific un-auth'd paths for EST APIs; the enrollment APIs remain
+	// auth'd and are reached with a token obtained through config/est.
+	for _, estPrefix := range []string{"", "issuer/+/", "roles/+/", "issuer/+/roles/+/"} {
+		b.PathsSpecial.Unauthenticated = append(b.PathsSpecial.Unauthenticated, estPrefix+"est/cacerts")
+		b.PathsSpecial.Unauthenticated = append(b.PathsSpecial.Unauthenticated, estPrefix+"est/csrattrs")
+	}
+
+	// Add SCEP paths to backend
+	var scepPaths []*framework.Path
+	scepPaths = append(scepPaths, pathScep(&b)...)
+	scepPaths = append(scepPaths, pathScepNewChallenge(&b)...)
+
+	for _, scepPath := range scepPaths {
+		b.Backend.Paths = append(b.Backend.Paths, scepPath)
+	}
+
+	// SCEP clients authenticate through challenge passwords or their current
+	// certificate; scep/new-challenge remains auth'd.
+	for _, scepPrefix := range []string{"", "issuer/+/", "roles/+/", "issuer/+/roles/+/"} {
+		b.PathsSpecial.Unauthenticated = append(b.PathsSpecial.Unauthenticated, scepPrefix+"scep")
+		b.PathsSpecial.Unauthenticated = append(b.PathsSpecial.Unauthenticated, scepPrefix+"scep/pkiclient.exe")
+	}
+
+	// Add CMP paths to backend
+	var cmpPaths []*framework.Path
+	cmpPaths = append(cmpPaths, pathCmp(&b)...)
+	cmpPaths = append(cmpPaths, pathCmpNewSecret(&b)...)
+
+	for _, cmpPath := range cmpPaths {
+		b.Backend.Paths = append(b.Backend.Paths, cmpPath)
+	}
+
+	// CMP clients authenticate through the protection of their messages;
+	// cmp/new-secret remains auth'd.
+	for _, cmpPrefix := range []string{"", "issuer/+/", "roles/+/", "issuer/+/roles/+/"} {
+		b.PathsSpecial.Unauthenticated = append(b.PathsSpecial.Unauthenticated, cmpPrefix+"cmp")
+	}
+
 	if constants.IsEnterprise {
 		// Unified CRL/OCSP paths are ENT only
 		entOnly := []*framework.Path{
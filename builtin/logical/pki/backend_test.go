@@ -6680,18 +6680,49 @@ func pathShouldBeUnauthedWriteOnly(t *testing.T, client *api.Client, path string
 	}
 }
 
+func pathShouldBeUnauthedReadWrite(t *testing.T, client *api.Client, path string, token string) {
+	// Should be able to read and write both with and without a token.
+	for _, useToken := range []string{"", token} {
+		client.SetToken(useToken)
+		resp, err := client.Logical().ReadWithContext(ctx, path)
+		if err != nil && isPermDenied(err) {
+			t.Fatalf("unexpected failure to read %v (token: %v): %v / %v", path, useToken != "", err, resp)
+		}
+		resp, err = client.Logical().WriteWithContext(ctx, path, map[string]interface{}{})
+		if err != nil && isPermDenied(err) {
+			t.Fatalf("unexpected failure to write %v (token: %v): %v / %v", path, useToken != "", err, resp)
+		}
+
+		// These should all be denied.
+		resp, err = client.Logical().ListWithContext(ctx, path)
+		if (err == nil && resp != nil) || (err != nil && !isDeniedOp(err)) {
+			t.Fatalf("unexpected failure during list on read-write path %v (token: %v): %v / %v", path, useToken != "", err, resp)
+		}
+		resp, err = client.Logical().DeleteWithContext(ctx, path)
+		if (err == nil && resp != nil) || (err != nil && !isDeniedOp(err)) {
+			t.Fatalf("unexpected failure during delete on read-write path %v (token: %v): %v / %v", path, useToken != "", err, resp)
+		}
+		resp, err = client.Logical().JSONMergePatch(ctx, path, map[string]interface{}{})
+		if (err == nil && resp != nil) || (err != nil && !isDeniedOp(err)) {
+			t.Fatalf("unexpected failure during patch on read-write path %v (token: %v): %v / %v", path, useToken != "", err, resp)
+		}
+	}
+}
+
 type pathAuthChecker int
 
 const (
 	shouldBeAuthed pathAuthChecker = iota
 	shouldBeUnauthedReadList
 	shouldBeUnauthedWriteOnly
+	shouldBeUnauthedReadWrite
 )
 
 var pathAuthChckerMap = map[pathAuthChecker]pathAuthCheckerFunc{
 	shouldBeAuthed:            pathShouldBeAuthed,
 	shouldBeUnauthedReadList:  pathShouldBeUnauthedReadList,
 	shouldBeUnauthedWriteOnly: pathShouldBeUnauthedWriteOnly,
+	shouldBeUnauthedReadWrite: pathShouldBeUnauthedReadWrite,
 }
 
 func TestProperAuthing(t *testing.T) {
@@ -6775,8 +6806,11 @@ func TestProperAuthing(t *testing.T) {
 		"config/ca":                              shouldBeAuthed,
 		"config/cluster":                         shouldBeAuthed,
 		"config/crl":                             shouldBeAuthed,
+		"config/cmp":                             shouldBeAuthed,
+		"config/est":                             shouldBeAuthed,
 		"config/issuers":                         shouldBeAuthed,
 		"config/keys":                            shouldBeAuthed,
+		"config/scep":                            shouldBeAuthed,
 		"config/urls":                            shouldBeAuthed,
 		"crl":                                    shouldBeUnauthedReadList,
 		"crl/pem":                                shouldBeUnauthedReadList,
@@ -6865,6 +6899,10 @@ func TestProperAuthing(t *testing.T) {
 		"unified-ocsp/dGVzdAo=":                  shouldBeUnauthedReadList,
 		"eab":                                    shouldBeAuthed,
 		"eab/" + eabKid:                          shouldBeAuthed,
+		"scep/challenges":                        shouldBeAuthed,
+		"scep/challenges/" + eabKid:              shouldBeAuthed,
+		"cmp/secrets":                            shouldBeAuthed,
+		"cmp/secrets/" + eabKid:                  shouldBeAuthed,
 	}
 
 	// Add ACME based paths to the test suite
@@ -6886,6 +6924,25 @@ func TestProperAuthing(t *testing.T) {
 		paths[acmePrefix+"acme/new-eab"] = shouldBeAuthed
 	}
 
+	// Add EST based paths to the test suite; only the discovery endpoints
+	// are unauthenticated, enrollment requires a token.
+	for _, estPrefix := range []string{"", "issuer/default/", "roles/test/", "issuer/default/roles/test/"} {
+		paths[estPrefix+"est/cacerts"] = shouldBeUnauthedReadList
+		paths[estPrefix+"est/csrattrs"] = shouldBeUnauthedReadList
+		paths[estPrefix+"est/simpleenroll"] = shouldBeAuthed
+		paths[estPrefix+"est/simplereenroll"] = shouldBeAuthed
+	}
+
+	// Add SCEP and CMP based paths to the test suite; generating challenges
+	// and shared secrets requires a token.
+	for _, enrollPrefix := range []string{"", "issuer/default/", "roles/test/", "issuer/default/roles/test/"} {
+		paths[enrollPrefix+"scep"] = shouldBeUnauthedReadWrite
+		paths[enrollPrefix+"scep/pkiclient.exe"] = shouldBeUnauthedReadWrite
+		paths[enrollPrefix+"scep/new-challenge"] = shouldBeAuthed
+		paths[enrollPrefix+"cmp"] = shouldBeUnauthedWriteOnly
+		paths[enrollPrefix+"cmp/new-secret"] = shouldBeAuthed
+	}
+
 	for path, checkerType := range paths {
 		checker := pathAuthChckerMap[checkerType]
 		checker(t, client, "pki/"+path, token)
@@ -6944,6 +7001,12 @@ func TestProperAuthing(t *testing.T) {
 		if strings.Contains(raw_path, "eab") && strings.Contains(raw_path, "{key_id}") {
 			raw_path = strings.ReplaceAll(raw_path, "{key_id}", eabKid)
 		}
+		if strings.Contains(raw_path, "scep/") && strings.Contains(raw_path, "{challenge_id}") {
+			raw_path = strings.ReplaceAll(raw_path, "{challenge_id}", eabKid)
+		}
+		if strings.Contains(raw_path, "cmp/") && strings.Contains(raw_path, "{secret_id}") {
+			raw_path = strings.ReplaceAll(raw_path, "{secret_id}", eabKid)
+		}
 
 		handler, present := paths[raw_path]
 		if !present {
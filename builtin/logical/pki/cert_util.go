@@ -859,6 +859,22 @@ func signCert(b *backend,
 		return nil, nil, errutil.UserError{Err: fmt.Sprintf("certificate request could not be parsed: %v", err)}
 	}
 
+	return signCertFromCSR(b, data, caSign, csr, isCA, useCSRValues)
+}
+
+// signCertFromCSR is signCert for a certificate request which was already
+// parsed, or assembled from another enrollment protocol's request format.
+func signCertFromCSR(b *backend,
+	data *inputBundle,
+	caSign *certutil.CAInfoBundle,
+	csr *x509.CertificateRequest,
+	isCA bool,
+	useCSRValues bool) (*certutil.ParsedCertBundle, []string, error,
+) {
+	if data.role == nil {
+		return nil, nil, errutil.InternalError{Err: "no role found in data bundle"}
+	}
+
 	if csr.PublicKeyAlgorithm == x509.UnknownPublicKeyAlgorithm || csr.PublicKey == nil {
 		return nil, nil, errutil.UserError{Err: "Refusing to sign CSR with empty PublicKey. This usually means the SubjectPublicKeyInfo field has an OID not recognized by Go, such as 1.2.840.113549.1.1.10 for rsaPSS."}
 	}
@@ -965,6 +981,7 @@ func signCert(b *backend,
 		// set for KeyBits when KeyType was set to any. This also enforces the
 		// docs saying when key_type=any, we only enforce our specified minimums
 		// for signing operations
+		var err error
 		if data.role.KeyBits, data.role.SignatureBits, err = certutil.ValidateDefaultOrValueKeyTypeSignatureLength(
 			actualKeyType, 0, data.role.SignatureBits); err != nil {
 			return nil, nil, errutil.InternalError{Err: fmt.Sprintf("unknown internal error updating default values: %v", err)}
@@ -0,0 +1,688 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// RFC 4211 Section 4.4 and RFC 4210 Section 5.1.1.
+	oidCmpPasswordBasedMac = asn1.ObjectIdentifier{1, 2, 840, 113533, 7, 66, 13}
+	oidCmpImplicitConfirm  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 4, 13}
+
+	oidExtensionRequest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+
+	oidSha1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSha256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSha384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSha512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidHmacSha1       = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 8, 1, 2}
+	oidHmacWithSha1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHmacWithSha256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHmacWithSha384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHmacWithSha512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+)
+
+// cmpSignatureAlgorithms are the signature algorithms accepted for, and used
+// in, the signature protection of CMP messages.
+var cmpSignatureAlgorithms = []struct {
+	oid  asn1.ObjectIdentifier
+	alg  x509.SignatureAlgorithm
+	hash crypto.Hash
+}{
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, x509.SHA1WithRSA, crypto.SHA1},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, x509.SHA256WithRSA, crypto.SHA256},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, x509.SHA384WithRSA, crypto.SHA384},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, x509.SHA512WithRSA, crypto.SHA512},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, x509.ECDSAWithSHA1, crypto.SHA1},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, x509.ECDSAWithSHA256, crypto.SHA256},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, x509.ECDSAWithSHA384, crypto.SHA384},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, x509.ECDSAWithSHA512, crypto.SHA512},
+	{oidEd25519, x509.PureEd25519, crypto.Hash(0)},
+}
+
+// CMP protocol versions, RFC 9480 Section 2.20.
+const (
+	cmpVersion2000 = 2
+	cmpVersion2021 = 3
+)
+
+// PKIBody choices, RFC 4210 Section 5.1.2.
+const (
+	cmpBodyIR       = 0
+	cmpBodyIP       = 1
+	cmpBodyCR       = 2
+	cmpBodyCP       = 3
+	cmpBodyP10CR    = 4
+	cmpBodyKUR      = 7
+	cmpBodyKUP      = 8
+	cmpBodyPKIConf  = 19
+	cmpBodyError    = 23
+	cmpBodyCertConf = 24
+)
+
+// PKIStatus values, RFC 4210 Section 5.2.3.
+const (
+	cmpStatusAccepted  = 0
+	cmpStatusRejection = 2
+)
+
+// PKIFailureInfo bits, RFC 4210 Section 5.2.3.
+const (
+	cmpFailBadAlg             = 0
+	cmpFailBadMessageCheck    = 1
+	cmpFailBadRequest         = 2
+	cmpFailBadCertId          = 4
+	cmpFailBadDataFormat      = 5
+	cmpFailBadPOP             = 9
+	cmpFailBadCertTemplate    = 19
+	cmpFailSignerNotTrusted   = 20
+	cmpFailUnsupportedVersion = 22
+	cmpFailNotAuthorized      = 23
+)
+
+// The PBM iteration count is chosen by the client; bound the work a request
+// can make Vault do. This matches the limit of OpenSSL.
+const maxCmpPbmIterations = 100000
+
+// cmpPKIMessage is the PKIMessage structure of RFC 4210 Section 5.1.
+type cmpPKIMessage struct {
+	Header     asn1.RawValue
+	Body       asn1.RawValue
+	Protection asn1.BitString  `asn1:"explicit,optional,tag:0"`
+	ExtraCerts []asn1.RawValue `asn1:"explicit,optional,tag:1"`
+}
+
+// cmpPKIHeader is the PKIHeader structure of RFC 4210 Section 5.1.1.
+type cmpPKIHeader struct {
+	PVNO          int
+	Sender        asn1.RawValue
+	Recipient     asn1.RawValue
+	MessageTime   time.Time                `asn1:"generalized,explicit,optional,tag:0"`
+	ProtectionAlg pkix.AlgorithmIdentifier `asn1:"explicit,optional,tag:1"`
+	SenderKID     []byte                   `asn1:"explicit,optional,tag:2"`
+	RecipKID      []byte                   `asn1:"explicit,optional,tag:3"`
+	TransactionID []byte                   `asn1:"explicit,optional,tag:4"`
+	SenderNonce   []byte                   `asn1:"explicit,optional,tag:5"`
+	RecipNonce    []byte                   `asn1:"explicit,optional,tag:6"`
+	FreeText      []asn1.RawValue          `asn1:"explicit,optional,tag:7"`
+	GeneralInfo   []cmpInfoTypeAndValue    `asn1:"explicit,optional,tag:8"`
+}
+
+type cmpInfoTypeAndValue struct {
+	InfoType  asn1.ObjectIdentifier
+	InfoValue asn1.RawValue `asn1:"optional"`
+}
+
+// cmpPBMParameter is the PBMParameter structure of RFC 4211 Section 4.4.
+type cmpPBMParameter struct {
+	Salt           []byte
+	OWF            pkix.AlgorithmIdentifier
+	IterationCount int
+	MAC            pkix.AlgorithmIdentifier
+}
+
+type cmpPKIStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+// cmpCertRepMessage is the CertRepMessage structure of RFC 4210 Section
+// 5.3.4, carrying a certificate in the clear.
+type cmpCertRepMessage struct {
+	CAPubs   []asn1.RawValue `asn1:"explicit,optional,tag:1"`
+	Response []cmpCertResponse
+}
+
+type cmpCertResponse struct {
+	CertReqID        int
+	Status           cmpPKIStatusInfo
+	CertifiedKeyPair cmpCertifiedKeyPair `asn1:"optional"`
+}
+
+type cmpCertifiedKeyPair struct {
+	CertOrEncCert asn1.RawValue
+}
+
+type cmpErrorMsgContent struct {
+	PKIStatusInfo cmpPKIStatusInfo
+}
+
+// cmpCertStatus is the CertStatus structure of RFC 4210 Section 5.3.18, as
+// extended by RFC 9480.
+type cmpCertStatus struct {
+	CertHash   []byte
+	CertReqID  int
+	StatusInfo cmpPKIStatusInfo         `asn1:"optional"`
+	HashAlg    pkix.AlgorithmIdentifier `asn1:"explicit,optional,tag:0"`
+}
+
+// cmpMessage is a parsed PKIMessage.
+type cmpMessage struct {
+	Header     cmpPKIHeader
+	BodyType   int
+	Body       []byte
+	Protection asn1.BitString
+	ExtraCerts []*x509.Certificate
+	// protectedPart is the DER encoding of the ProtectedPart the protection
+	// was computed over.
+	protectedPart []byte
+}
+
+// cmpCertRequest is a certificate request of an ir, cr, kur or p10cr message.
+type cmpCertRequest struct {
+	CertReqID int
+	CSR       *x509.CertificateRequest
+}
+
+func parseCmpMessage(der []byte) (*cmpMessage, error) {
+	var raw cmpPKIMessage
+	rest, err := asn1.Unmarshal(der, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CMP message: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after CMP message")
+	}
+
+	msg := &cmpMessage{Protection: raw.Protection}
+	if _, err := asn1.Unmarshal(raw.Header.FullBytes, &msg.Header); err != nil {
+		return nil, fmt.Errorf("failed to parse CMP message header: %w", err)
+	}
+
+	if raw.Body.Class != asn1.ClassContextSpecific || !raw.Body.IsCompound {
+		return nil, errors.New("malformed CMP message body")
+	}
+	msg.BodyType = raw.Body.Tag
+	msg.Body = raw.Body.Bytes
+
+	msg.protectedPart, err = asn1.Marshal(struct {
+		Header asn1.RawValue
+		Body   asn1.RawValue
+	}{raw.Header, raw.Body})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rawCert := range raw.ExtraCerts {
+		cert, err := x509.ParseCertificate(rawCert.FullBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CMP extraCerts: %w", err)
+		}
+		msg.ExtraCerts = append(msg.ExtraCerts, cert)
+	}
+
+	return msg, nil
+}
+
+// implicitConfirm returns whether the client asked to skip the certificate
+// confirmation, RFC 4210 Section 5.1.1.1.
+func (msg *cmpMessage) implicitConfirm() bool {
+	for _, info := range msg.Header.GeneralInfo {
+		if info.InfoType.Equal(oidCmpImplicitConfirm) {
+			return true
+		}
+	}
+	return false
+}
+
+func cmpOwfHash(owf asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case owf.Equal(oidSha1):
+		return crypto.SHA1, nil
+	case owf.Equal(oidSha256):
+		return crypto.SHA256, nil
+	case owf.Equal(oidSha384):
+		return crypto.SHA384, nil
+	case owf.Equal(oidSha512):
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported one-way function %s", owf)
+	}
+}
+
+func cmpMacHash(mac asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case mac.Equal(oidHmacSha1), mac.Equal(oidHmacWithSha1):
+		return crypto.SHA1, nil
+	case mac.Equal(oidHmacWithSha256):
+		return crypto.SHA256, nil
+	case mac.Equal(oidHmacWithSha384):
+		return crypto.SHA384, nil
+	case mac.Equal(oidHmacWithSha512):
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported MAC algorithm %s", mac)
+	}
+}
+
+// parseCmpPBMParameter parses the parameters of a password based MAC
+// protection algorithm identifier.
+func parseCmpPBMParameter(alg pkix.AlgorithmIdentifier) (*cmpPBMParameter, error) {
+	var params cmpPBMParameter
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse PBM parameters: %w", err)
+	}
+	return &params, nil
+}
+
+// mac computes the password based MAC of RFC 4211 Section 4.4 over data.
+func (params *cmpPBMParameter) mac(secret []byte, data []byte) ([]byte, error) {
+	if params.IterationCount < 1 || params.IterationCount > maxCmpPbmIterations {
+		return nil, fmt.Errorf("PBM iteration count must be between 1 and %d", maxCmpPbmIterations)
+	}
+
+	owf, err := cmpOwfHash(params.OWF.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	macHash, err := cmpMacHash(params.MAC.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	h := owf.New()
+	h.Write(secret)
+	h.Write(params.Salt)
+	key := h.Sum(nil)
+	for i := 1; i < params.IterationCount; i++ {
+		h.Reset()
+		h.Write(key)
+		key = h.Sum(key[:0])
+	}
+
+	mac := hmac.New(macHash.New, key)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func cmpSignatureAlgorithm(oid asn1.ObjectIdentifier) x509.SignatureAlgorithm {
+	for _, details := range cmpSignatureAlgorithms {
+		if details.oid.Equal(oid) {
+			return details.alg
+		}
+	}
+	return x509.UnknownSignatureAlgorithm
+}
+
+// cmpSignatureAlgorithmForKey returns the algorithm Vault signs CMP messages
+// with for the given CA key.
+func cmpSignatureAlgorithmForKey(pub crypto.PublicKey) (pkix.AlgorithmIdentifier, crypto.Hash, error) {
+	var alg x509.SignatureAlgorithm
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		alg = x509.SHA256WithRSA
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P384():
+			alg = x509.ECDSAWithSHA384
+		case elliptic.P521():
+			alg = x509.ECDSAWithSHA512
+		default:
+			alg = x509.ECDSAWithSHA256
+		}
+	case ed25519.PublicKey:
+		alg = x509.PureEd25519
+	default:
+		return pkix.AlgorithmIdentifier{}, 0, fmt.Errorf("unsupported CA key type %T", pub)
+	}
+
+	for _, details := range cmpSignatureAlgorithms {
+		if details.alg != alg {
+			continue
+		}
+		algId := pkix.AlgorithmIdentifier{Algorithm: details.oid}
+		if alg == x509.SHA256WithRSA {
+			algId.Parameters = asn1.NullRawValue
+		}
+		return algId, details.hash, nil
+	}
+
+	return pkix.AlgorithmIdentifier{}, 0, fmt.Errorf("unsupported signature algorithm %s", alg)
+}
+
+// cmpCertHash computes the certHash of a certConf message for a certificate,
+// RFC 9480 Section 2.10: with the given hash algorithm, or else the one the
+// certificate was signed with.
+func cmpCertHash(cert *x509.Certificate, hashAlg pkix.AlgorithmIdentifier) ([]byte, error) {
+	var h crypto.Hash
+	if len(hashAlg.Algorithm) > 0 {
+		var err error
+		h, err = cmpOwfHash(hashAlg.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		switch cert.SignatureAlgorithm {
+		case x509.SHA1WithRSA, x509.ECDSAWithSHA1:
+			h = crypto.SHA1
+		case x509.SHA256WithRSA, x509.SHA256WithRSAPSS, x509.ECDSAWithSHA256:
+			h = crypto.SHA256
+		case x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384:
+			h = crypto.SHA384
+		case x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512, x509.PureEd25519:
+			h = crypto.SHA512
+		default:
+			return nil, fmt.Errorf("unable to determine certHash algorithm for %s", cert.SignatureAlgorithm)
+		}
+	}
+
+	hasher := h.New()
+	hasher.Write(cert.Raw)
+	return hasher.Sum(nil), nil
+}
+
+// parseCmpP10cr parses the PKCS#10 request of a p10cr message.
+func parseCmpP10cr(body []byte) (*cmpCertRequest, error) {
+	csr, err := x509.ParseCertificateRequest(body)
+	if err != nil {
+		return nil, &cmpError{FailInfo: cmpFailBadDataFormat, Err: fmt.Errorf("failed to parse certificate request: %w", err)}
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, &cmpError{FailInfo: cmpFailBadPOP, Err: fmt.Errorf("invalid certificate request signature: %w", err)}
+	}
+
+	// RFC 9483 Section 4.1.4: the response to a p10cr uses -1.
+	return &cmpCertRequest{CertReqID: -1, CSR: csr}, nil
+}
+
+// parseCmpCertReqMessages parses the CertReqMessages of an ir, cr or kur
+// message, RFC 4211 Section 3, which must carry a single request with
+// signature based proof of possession.
+//
+// The request is returned as a PKCS#10 request whose to-be-signed part is the
+// CRMF CertRequest and whose signature is the proof of possession, so that it
+// can be issued, and its signature checked, like any other.
+func parseCmpCertReqMessages(body []byte) (*cmpCertRequest, error) {
+	var msgs []asn1.RawValue
+	if _, err := asn1.Unmarshal(body, &msgs); err != nil {
+		return nil, &cmpError{FailInfo: cmpFailBadDataFormat, Err: fmt.Errorf("failed to parse certificate request messages: %w", err)}
+	}
+	if len(msgs) != 1 {
+		return nil, &cmpError{FailInfo: cmpFailBadRequest, Err: errors.New("exactly one certificate request is supported per message")}
+	}
+
+	// CRMF uses implicit tagging with optional members which Go's asn1
+	// package can not tell apart, so the structures are walked by hand.
+	elements, err := cmpSequenceElements(msgs[0])
+	if err != nil || len(elements) == 0 {
+		return nil, &cmpError{FailInfo: cmpFailBadDataFormat, Err: errors.New("malformed certificate request message")}
+	}
+	certReq := elements[0]
+
+	var popo *asn1.RawValue
+	if len(elements) > 1 && elements[1].Class == asn1.ClassContextSpecific {
+		popo = &elements[1]
+	}
+
+	var request struct {
+		CertReqID    int
+		CertTemplate asn1.RawValue
+		Controls     asn1.RawValue `asn1:"optional"`
+	}
+	if _, err := asn1.Unmarshal(certReq.FullBytes, &request); err != nil {
+		return nil, &cmpError{FailInfo: cmpFailBadDataFormat, Err: fmt.Errorf("failed to parse certificate request: %w", err)}
+	}
+
+	template, err := cmpSequenceElements(request.CertTemplate)
+	if err != nil {
+		return nil, &cmpError{FailInfo: cmpFailBadDataFormat, Err: fmt.Errorf("failed to parse certificate template: %w", err)}
+	}
+
+	subject := []byte{0x30, 0x00}
+	var publicKey []byte
+	var extensions []asn1.RawValue
+	for _, field := range template {
+		if field.Class != asn1.ClassContextSpecific {
+			return nil, &cmpError{FailInfo: cmpFailBadDataFormat, Err: errors.New("malformed certificate template")}
+		}
+		switch field.Tag {
+		case 5:
+			// Name is a CHOICE, so its tag is explicit.
+			subject = field.Bytes
+		case 6:
+			publicKey, err = asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: field.Bytes})
+			if err != nil {
+				return nil, err
+			}
+		case 9:
+			extensions = append(extensions, asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: field.Bytes})
+		}
+	}
+	if publicKey == nil {
+		return nil, &cmpError{FailInfo: cmpFailBadCertTemplate, Err: errors.New("certificate template must contain the public key")}
+	}
+
+	if popo == nil || popo.Tag != 1 {
+		return nil, &cmpError{FailInfo: cmpFailBadPOP, Err: errors.New("certificate request must use signature based proof of possession")}
+	}
+	popoElements, err := cmpSequenceElements(*popo)
+	if err != nil || len(popoElements) != 2 {
+		// The poposkInput alternative is only used for templates without a
+		// subject, which Vault does not accept.
+		return nil, &cmpError{FailInfo: cmpFailBadPOP, Err: errors.New("unsupported proof of possession")}
+	}
+
+	var attributes []asn1.RawValue
+	if len(extensions) > 0 {
+		attr, err := asn1.Marshal(struct {
+			Type   asn1.ObjectIdentifier
+			Values []asn1.RawValue `asn1:"set"`
+		}{oidExtensionRequest, extensions})
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, asn1.RawValue{FullBytes: attr})
+	}
+
+	csrDer, err := asn1.Marshal(struct {
+		TBS struct {
+			Version    int
+			Subject    asn1.RawValue
+			PublicKey  asn1.RawValue
+			Attributes []asn1.RawValue `asn1:"tag:0"`
+		}
+		Algorithm asn1.RawValue
+		Signature asn1.RawValue
+	}{
+		TBS: struct {
+			Version    int
+			Subject    asn1.RawValue
+			PublicKey  asn1.RawValue
+			Attributes []asn1.RawValue `asn1:"tag:0"`
+		}{
+			Subject:    asn1.RawValue{FullBytes: subject},
+			PublicKey:  asn1.RawValue{FullBytes: publicKey},
+			Attributes: attributes,
+		},
+		Algorithm: popoElements[0],
+		Signature: popoElements[1],
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrDer)
+	if err != nil {
+		return nil, &cmpError{FailInfo: cmpFailBadCertTemplate, Err: fmt.Errorf("failed to parse certificate template: %w", err)}
+	}
+
+	// Without poposkInput, the proof of possession signs the CertRequest.
+	csr.RawTBSCertificateRequest = certReq.FullBytes
+	if err := csr.CheckSignature(); err != nil {
+		return nil, &cmpError{FailInfo: cmpFailBadPOP, Err: fmt.Errorf("invalid proof of possession: %w", err)}
+	}
+
+	return &cmpCertRequest{CertReqID: request.CertReqID, CSR: csr}, nil
+}
+
+func cmpSequenceElements(seq asn1.RawValue) ([]asn1.RawValue, error) {
+	if !seq.IsCompound {
+		return nil, errors.New("expected a constructed value")
+	}
+
+	var elements []asn1.RawValue
+	rest := seq.Bytes
+	for len(rest) > 0 {
+		var element asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &element)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+
+	return elements, nil
+}
+
+func cmpFreeText(text string) []asn1.RawValue {
+	return []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte(text)}}
+}
+
+func cmpFailInfo(bit int) asn1.BitString {
+	bytes := make([]byte, bit/8+1)
+	bytes[bit/8] = 0x80 >> (bit % 8)
+	return asn1.BitString{Bytes: bytes, BitLength: bit + 1}
+}
+
+// buildCmpCertRepContent returns the CertRepMessage of an ip, cp or kup
+// message carrying the issued certificate.
+func buildCmpCertRepContent(certReqId int, issued *x509.Certificate, caPubs []*x509.Certificate) ([]byte, error) {
+	rep := cmpCertRepMessage{
+		Response: []cmpCertResponse{{
+			CertReqID: certReqId,
+			Status:    cmpPKIStatusInfo{Status: cmpStatusAccepted},
+			CertifiedKeyPair: cmpCertifiedKeyPair{
+				CertOrEncCert: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: issued.Raw},
+			},
+		}},
+	}
+	for _, cert := range caPubs {
+		rep.CAPubs = append(rep.CAPubs, asn1.RawValue{FullBytes: cert.Raw})
+	}
+
+	return asn1.Marshal(rep)
+}
+
+// buildCmpErrorContent returns the ErrorMsgContent of an error message.
+func buildCmpErrorContent(failInfo int, text string) ([]byte, error) {
+	return asn1.Marshal(cmpErrorMsgContent{
+		PKIStatusInfo: cmpPKIStatusInfo{
+			Status:       cmpStatusRejection,
+			StatusString: cmpFreeText(text),
+			FailInfo:     cmpFailInfo(failInfo),
+		},
+	})
+}
+
+// buildCmpResponse builds the response to a request, RFC 4210 Section 5.1,
+// protected with the shared secret the request was protected with, or else
+// signed by the CA.
+func buildCmpResponse(req *cmpMessage, bodyType int, body []byte, secret []byte, caCert *x509.Certificate, caKey crypto.Signer, extraCerts []*x509.Certificate, implicitConfirm bool) ([]byte, error) {
+	senderNonce := make([]byte, 16)
+	if _, err := rand.Read(senderNonce); err != nil {
+		return nil, err
+	}
+
+	pvno := req.Header.PVNO
+	if pvno != cmpVersion2021 {
+		pvno = cmpVersion2000
+	}
+
+	header := cmpPKIHeader{
+		PVNO:          pvno,
+		Sender:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: caCert.RawSubject},
+		Recipient:     req.Header.Sender,
+		MessageTime:   time.Now().UTC().Truncate(time.Second),
+		RecipKID:      req.Header.SenderKID,
+		TransactionID: req.Header.TransactionID,
+		SenderNonce:   senderNonce,
+		RecipNonce:    req.Header.SenderNonce,
+	}
+	if implicitConfirm {
+		header.GeneralInfo = []cmpInfoTypeAndValue{{InfoType: oidCmpImplicitConfirm, InfoValue: asn1.NullRawValue}}
+	}
+
+	var params *cmpPBMParameter
+	var sigHash crypto.Hash
+	if secret != nil {
+		var err error
+		params, err = parseCmpPBMParameter(req.Header.ProtectionAlg)
+		if err != nil {
+			return nil, err
+		}
+		params.Salt = make([]byte, 16)
+		if _, err := rand.Read(params.Salt); err != nil {
+			return nil, err
+		}
+		rawParams, err := asn1.Marshal(*params)
+		if err != nil {
+			return nil, err
+		}
+		header.ProtectionAlg = pkix.AlgorithmIdentifier{Algorithm: oidCmpPasswordBasedMac, Parameters: asn1.RawValue{FullBytes: rawParams}}
+	} else {
+		var err error
+		header.ProtectionAlg, sigHash, err = cmpSignatureAlgorithmForKey(caCert.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		header.SenderKID = caCert.SubjectKeyId
+	}
+
+	rawHeader, err := asn1.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode CMP response header: %w", err)
+	}
+
+	msg := cmpPKIMessage{
+		Header: asn1.RawValue{FullBytes: rawHeader},
+		Body:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: bodyType, IsCompound: true, Bytes: body},
+	}
+	for _, cert := range extraCerts {
+		msg.ExtraCerts = append(msg.ExtraCerts, asn1.RawValue{FullBytes: cert.Raw})
+	}
+
+	protectedPart, err := asn1.Marshal(struct {
+		Header asn1.RawValue
+		Body   asn1.RawValue
+	}{msg.Header, msg.Body})
+	if err != nil {
+		return nil, err
+	}
+
+	var protection []byte
+	if params != nil {
+		protection, err = params.mac(secret, protectedPart)
+	} else {
+		digest := protectedPart
+		if sigHash != 0 {
+			hasher := sigHash.New()
+			hasher.Write(protectedPart)
+			digest = hasher.Sum(nil)
+		}
+		protection, err = caKey.Sign(rand.Reader, digest, sigHash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to protect CMP response: %w", err)
+	}
+	msg.Protection = asn1.BitString{Bytes: protection, BitLength: len(protection) * 8}
+
+	return asn1.Marshal(msg)
+}
@@ -0,0 +1,315 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// enrollContext is the role and issuer a request to one of the enrollment
+// protocols (EST, SCEP and CMP) maps onto, resolved from the request path and
+// the protocol's default path policy.
+type enrollContext struct {
+	sc     *storageContext
+	role   *roleEntry
+	issuer *issuerEntry
+	// signVerbatim is set when the request was mapped onto the default
+	// sign-verbatim policy rather than a role.
+	signVerbatim bool
+}
+
+type enrollOperation func(enrollCtx *enrollContext, r *logical.Request, data *framework.FieldData) (*logical.Response, error)
+
+// A helper function that will build up the various path patterns we want for
+// an enrollment protocol, served under the given path segment (est, scep or
+// cmp) of the mount, a role, an issuer or both.
+func buildEnrollFrameworkPaths(b *backend, segment string, patternFunc func(b *backend, pattern string) *framework.Path, api string) []*framework.Path {
+	var patterns []*framework.Path
+	for _, baseUrl := range []string{
+		segment,
+		"roles/" + framework.GenericNameRegex("role") + "/" + segment,
+		"issuer/" + framework.GenericNameRegex(issuerRefParam) + "/" + segment,
+		"issuer/" + framework.GenericNameRegex(issuerRefParam) + "/roles/" + framework.GenericNameRegex("role") + "/" + segment,
+	} {
+		if api != "" && !strings.HasPrefix(api, "/") {
+			api = "/" + api
+		}
+
+		patterns = append(patterns, patternFunc(b, baseUrl+api))
+	}
+
+	return patterns
+}
+
+func addFieldsForEnrollPath(fields map[string]*framework.FieldSchema, pattern string, protocol string) map[string]*framework.FieldSchema {
+	if strings.Contains(pattern, framework.GenericNameRegex("role")) {
+		fields["role"] = &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: fmt.Sprintf(`The desired role for the %s request`, protocol),
+			Required:    true,
+		}
+	}
+	if strings.Contains(pattern, framework.GenericNameRegex(issuerRefParam)) {
+		fields[issuerRefParam] = &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: `Reference to an existing issuer name or issuer id`,
+			Required:    true,
+		}
+	}
+
+	return fields
+}
+
+// getEnrollPath returns the path, relative to the mount, of the enrollment
+// protocol endpoint the request was made to or below, such as
+// "roles/devices/scep". Credentials handed out for one endpoint are bound to
+// it, like ACME EAB keys are bound to their directory.
+func getEnrollPath(r *logical.Request, segment string) (string, error) {
+	enrollPath := "/" + strings.TrimPrefix(r.Path, "/")
+
+	lastIndex := strings.LastIndex(enrollPath+"/", "/"+segment+"/")
+	if lastIndex == -1 {
+		return "", fmt.Errorf("unable to determine %s base path: %s", segment, enrollPath)
+	}
+
+	return strings.TrimLeft(enrollPath[0:lastIndex]+"/"+segment, "/"), nil
+}
+
+// validateEnrollDefaultPathPolicy validates the default_path_policy of an
+// enrollment protocol's configuration, which shares its syntax with ACME's
+// default_directory_policy.
+func (b *backend) validateEnrollDefaultPathPolicy(ctx context.Context, req *logical.Request, policy string) (*logical.Response, error) {
+	policyType, err := getDefaultDirectoryPolicyType(policy)
+	if err != nil {
+		return logical.ErrorResponse("invalid default_path_policy: %v", err), nil
+	}
+	if policyType != Role {
+		return nil, nil
+	}
+
+	roleName, err := getDefaultDirectoryPolicyRole(policy)
+	if err != nil {
+		return nil, err
+	}
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse("default_path_policy role %q does not exist", roleName), nil
+	}
+
+	return nil, nil
+}
+
+func getEnrollContext(sc *storageContext, data *framework.FieldData, protocol string, defaultPathPolicy string) (*enrollContext, error) {
+	requestedIssuer := getRequestedAcmeIssuerFromPath(data)
+	requestedRole := getRequestedAcmeRoleFromPath(data)
+
+	enrollCtx := &enrollContext{sc: sc}
+
+	if len(requestedRole) == 0 {
+		policyType, err := getDefaultDirectoryPolicyType(defaultPathPolicy)
+		if err != nil {
+			return nil, err
+		}
+		switch policyType {
+		case Forbid:
+			return nil, fmt.Errorf("the default %s path is not allowed by the %s configuration; use a role-qualified path", protocol, protocol)
+		case SignVerbatim:
+			enrollCtx.role = buildSignVerbatimRoleWithNoData(&roleEntry{
+				Issuer: requestedIssuer,
+			})
+			enrollCtx.signVerbatim = true
+		case Role:
+			requestedRole, err = getDefaultDirectoryPolicyRole(defaultPathPolicy)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if enrollCtx.role == nil {
+		role, err := sc.Backend.getRole(sc.Context, sc.Storage, requestedRole)
+		if err != nil {
+			return nil, fmt.Errorf("failed loading role %q: %w", requestedRole, err)
+		}
+		if role == nil {
+			return nil, fmt.Errorf("role %q does not exist", requestedRole)
+		}
+		enrollCtx.role = role
+	}
+
+	issuerToLoad := requestedIssuer
+	if len(issuerToLoad) == 0 {
+		issuerToLoad = enrollCtx.role.Issuer
+	}
+	if len(issuerToLoad) == 0 {
+		issuerToLoad = defaultRef
+	}
+
+	issuerId, err := sc.resolveIssuerReference(issuerToLoad)
+	if err != nil {
+		return nil, fmt.Errorf("issuer %q does not exist", issuerToLoad)
+	}
+
+	issuer, err := sc.fetchIssuerById(issuerId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load issuer %q: %w", issuerToLoad, err)
+	}
+
+	if !issuer.Usage.HasUsage(IssuanceUsage) || len(issuer.KeyID) == 0 {
+		return nil, fmt.Errorf("issuer %q is missing the issuance usage or its key", issuerToLoad)
+	}
+	enrollCtx.issuer = issuer
+
+	return enrollCtx, nil
+}
+
+// caChain returns the parsed certificate chain of the issuer, starting with
+// the issuer's own certificate.
+func (enrollCtx *enrollContext) caChain() ([]*x509.Certificate, error) {
+	chain := enrollCtx.issuer.CAChain
+	if len(chain) == 0 {
+		chain = []string{enrollCtx.issuer.Certificate}
+	}
+
+	var certs []*x509.Certificate
+	for _, pemCert := range chain {
+		cert, err := parseCertificateFromBytes([]byte(pemCert))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse issuer certificate chain: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+func (enrollCtx *enrollContext) fetchSigningBundle() (*certutil.CAInfoBundle, error) {
+	signingBundle, _, err := enrollCtx.sc.fetchCAInfoWithIssuer(enrollCtx.issuer.ID.String(), IssuanceUsage)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading CA %s: %w", enrollCtx.issuer.ID.String(), err)
+	}
+
+	return signingBundle, nil
+}
+
+// issueCertFromCsr signs the certificate request under the role and issuer of
+// the context, storing the certificate unless the role has no_store set.
+func (enrollCtx *enrollContext) issueCertFromCsr(r *logical.Request, csr *x509.CertificateRequest) (*certutil.ParsedCertBundle, error) {
+	data := &framework.FieldData{
+		Raw:    map[string]interface{}{},
+		Schema: getCsrSignVerbatimSchemaFields(),
+	}
+
+	signingBundle, err := enrollCtx.fetchSigningBundle()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &inputBundle{
+		req:     r,
+		apiData: data,
+		role:    enrollCtx.role,
+	}
+
+	// Like the sign-verbatim endpoint, the default policy copies the
+	// extensions of the CSR; roles only take the subject and SANs from it.
+	parsedBundle, _, err := signCertFromCSR(enrollCtx.sc.Backend, input, signingBundle, csr, false /* is_ca=false */, enrollCtx.signVerbatim)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := parsedBundle.Verify(); err != nil {
+		return nil, fmt.Errorf("verification of parsed bundle failed: %w", err)
+	}
+
+	if !enrollCtx.role.NoStore {
+		if err := storeCertificate(enrollCtx.sc, parsedBundle); err != nil {
+			return nil, err
+		}
+	}
+
+	return parsedBundle, nil
+}
+
+// validateEnrollCertificate checks that a certificate presented by a client
+// was issued by this mount and is still valid.
+func validateEnrollCertificate(sc *storageContext, current *x509.Certificate) error {
+	entry, err := fetchCertBySerialBigInt(sc, "certs/", current.SerialNumber)
+	if err != nil {
+		return err
+	}
+	if entry == nil || !bytes.Equal(entry.Value, current.Raw) {
+		return errors.New("the current certificate was not issued by this mount")
+	}
+
+	now := time.Now()
+	if now.Before(current.NotBefore) || now.After(current.NotAfter) {
+		return errors.New("the current certificate is not within its validity period")
+	}
+
+	revInfo, err := sc.fetchRevocationInfo(serialFromCert(current))
+	if err != nil {
+		return err
+	}
+	if revInfo != nil {
+		return errors.New("the current certificate has been revoked")
+	}
+
+	return nil
+}
+
+// validateEnrollRenewal checks that a certificate presented to renew itself
+// was issued by this mount and is still valid, and that the new request keeps
+// its subject and subject alternative names.
+func validateEnrollRenewal(sc *storageContext, current *x509.Certificate, csr *x509.CertificateRequest) error {
+	if err := validateEnrollCertificate(sc, current); err != nil {
+		return err
+	}
+
+	if csr.Subject.String() != current.Subject.String() {
+		return errors.New("the subject of the certificate request does not match the current certificate")
+	}
+
+	if !strutil.EquivalentSlices(enrollSubjectAltNames(csr.DNSNames, csr.EmailAddresses, csr.IPAddresses, csr.URIs),
+		enrollSubjectAltNames(current.DNSNames, current.EmailAddresses, current.IPAddresses, current.URIs)) {
+		return errors.New("the subject alternative names of the certificate request do not match the current certificate")
+	}
+
+	return nil
+}
+
+func enrollSubjectAltNames(dnsNames, emails []string, ips []net.IP, uris []*url.URL) []string {
+	var names []string
+	for _, name := range dnsNames {
+		names = append(names, "dns:"+name)
+	}
+	for _, email := range emails {
+		names = append(names, "email:"+email)
+	}
+	for _, ip := range ips {
+		names = append(names, "ip:"+ip.String())
+	}
+	for _, uri := range uris {
+		names = append(names, "uri:"+uri.String())
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,170 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+)
+
+var (
+	oidPkcs7Data       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPkcs7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+	oidRsaEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidEcPublicKey   = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidEd25519       = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+	oidNamedCurveP224 = asn1.ObjectIdentifier{1, 3, 132, 0, 33}
+	oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidNamedCurveP384 = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidNamedCurveP521 = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+)
+
+// pkcs7ContentInfo is the ContentInfo structure of RFC 5652, Section 3.
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// pkcs7SignedData is the SignedData structure of RFC 5652, Section 5.1,
+// limited to what a degenerate, certificates-only message needs.
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo pkcs7EncapsulatedContentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      asn1.RawValue
+}
+
+type pkcs7EncapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+// estAttribute is one entry of the CsrAttrs sequence of RFC 7030, Section
+// 4.5.2, in its attribute form.
+type estAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.ObjectIdentifier `asn1:"set"`
+}
+
+// buildCertsOnlyPkcs7 returns the DER encoding of a degenerate PKCS#7
+// SignedData message carrying the given certificates, as used by the EST
+// cacerts and enrollment responses.
+func buildCertsOnlyPkcs7(certs []*x509.Certificate) ([]byte, error) {
+	var rawCerts bytes.Buffer
+	for _, cert := range certs {
+		rawCerts.Write(cert.Raw)
+	}
+
+	emptySet := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true}
+	signedData, err := asn1.Marshal(pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		EncapContentInfo: pkcs7EncapsulatedContentInfo{ContentType: oidPkcs7Data},
+		Certificates: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      rawCerts.Bytes(),
+		},
+		SignerInfos: emptySet,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode PKCS#7 signed data: %w", err)
+	}
+
+	return asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidPkcs7SignedData,
+		Content: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      signedData,
+		},
+	})
+}
+
+// buildEstCsrAttrs returns the DER encoding of the CSR attributes EST clients
+// should use for the given role, or nil when the role does not restrict the
+// key type.
+func buildEstCsrAttrs(role *roleEntry) ([]byte, error) {
+	var attrs []interface{}
+	switch role.KeyType {
+	case "rsa":
+		attrs = append(attrs, oidRsaEncryption)
+	case "ec":
+		var curve asn1.ObjectIdentifier
+		switch role.KeyBits {
+		case 224:
+			curve = oidNamedCurveP224
+		case 256:
+			curve = oidNamedCurveP256
+		case 384:
+			curve = oidNamedCurveP384
+		case 521:
+			curve = oidNamedCurveP521
+		}
+		if curve == nil {
+			attrs = append(attrs, oidEcPublicKey)
+		} else {
+			attrs = append(attrs, estAttribute{Type: oidEcPublicKey, Values: []asn1.ObjectIdentifier{curve}})
+		}
+	case "ed25519":
+		attrs = append(attrs, oidEd25519)
+	default:
+		return nil, nil
+	}
+
+	return asn1.Marshal(attrs)
+}
+
+// parseEstCsr parses the body of an EST enrollment request: a base64 encoded
+// PKCS#10 request as mandated by RFC 7030, with PEM and raw DER accepted for
+// convenience.
+func parseEstCsr(rawBody []byte) (*x509.CertificateRequest, error) {
+	body := bytes.TrimSpace(rawBody)
+	if len(body) == 0 {
+		return nil, fmt.Errorf("no certificate request was provided")
+	}
+
+	var der []byte
+	if bytes.HasPrefix(body, []byte("-----BEGIN")) {
+		block, _ := pem.Decode(body)
+		if block == nil {
+			return nil, fmt.Errorf("failed to decode PEM certificate request")
+		}
+		der = block.Bytes
+	} else {
+		stripped := bytes.Map(func(r rune) rune {
+			switch r {
+			case '\r', '\n', ' ', '\t':
+				return -1
+			}
+			return r
+		}, body)
+		der = make([]byte, base64.StdEncoding.DecodedLen(len(stripped)))
+		n, err := base64.StdEncoding.Decode(der, stripped)
+		if err == nil {
+			der = der[:n]
+		} else {
+			// Not base64; assume the client sent the DER encoding directly.
+			der = rawBody
+		}
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+
+	return csr, nil
+}
@@ -0,0 +1,452 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// A CMP request carries a single certificate request and the client's
+	// certificates; anything past this is rejected before parsing.
+	maxCmpRequestSize = 64 * 1024
+
+	cmpContentType = "application/pkixcmp"
+
+	pathCmpHelpSync = `An endpoint implementing the CMP (RFC 4210, RFC 9483) protocol`
+	pathCmpHelpDesc = `This endpoint implements the Certificate Management Protocol over HTTP for
+the ir, cr, p10cr, kur and certConf messages. It is unauthenticated; initial
+enrollment requests are authorized by their password based MAC protection with
+a shared secret created through the new-secret endpoint, key update requests
+by their signature with the certificate being updated.`
+)
+
+var ErrCmpDisabled = errors.New("CMP is disabled on this mount")
+
+// cmpError rejects a CMP request with an error message carrying the
+// failInfo, rather than with an HTTP error.
+type cmpError struct {
+	FailInfo int
+	Err      error
+}
+
+func (e *cmpError) Error() string {
+	return e.Err.Error()
+}
+
+// cmpTransaction is the state of processing a single CMP request.
+type cmpTransaction struct {
+	enrollCtx *enrollContext
+	r         *logical.Request
+	req       *cmpMessage
+	cmpPath   string
+	// secret is set once the request's MAC protection was verified with it;
+	// the response is then protected with the same secret.
+	secret *cmpSecret
+	// signer is set once the request's signature protection was verified
+	// with this certificate, issued by the mount.
+	signer          *x509.Certificate
+	implicitConfirm bool
+}
+
+// cmpWrapper validates the CMP configuration and resolves the role and issuer
+// the request path maps onto before handing off to the operation.
+func (b *backend) cmpWrapper(op enrollOperation) framework.OperationFunc {
+	return func(ctx context.Context, r *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		sc := b.makeStorageContext(ctx, r.Storage)
+
+		config, err := sc.getCmpConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch CMP configuration: %w", err)
+		}
+
+		if !config.Enabled {
+			return nil, logical.CodedError(http.StatusNotFound, ErrCmpDisabled.Error())
+		}
+
+		if b.useLegacyBundleCaStorage() {
+			return nil, fmt.Errorf("can not perform CMP operations until migration has completed")
+		}
+
+		enrollCtx, err := getEnrollContext(sc, data, "CMP", config.DefaultPathPolicy)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		return op(enrollCtx, r, data)
+	}
+}
+
+func pathCmp(b *backend) []*framework.Path {
+	return buildEnrollFrameworkPaths(b, "cmp", patternCmp, "")
+}
+
+func patternCmp(b *backend, pattern string) *framework.Path {
+	fields := map[string]*framework.FieldSchema{}
+	addFieldsForEnrollPath(fields, pattern, "CMP")
+
+	return &framework.Path{
+		Pattern: pattern,
+		Fields:  fields,
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.cmpWrapper(b.cmpHandler),
+				ForwardPerformanceSecondary: false,
+				ForwardPerformanceStandby:   true,
+			},
+		},
+
+		HelpSynopsis:    pathCmpHelpSync,
+		HelpDescription: pathCmpHelpDesc,
+	}
+}
+
+func (b *backend) cmpHandler(enrollCtx *enrollContext, r *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	der, err := fetchCmpMessage(r)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	req, err := parseCmpMessage(der)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	cmpPath, err := getEnrollPath(r, "cmp")
+	if err != nil {
+		return nil, err
+	}
+
+	signingBundle, err := enrollCtx.fetchSigningBundle()
+	if err != nil {
+		return nil, err
+	}
+	chain, err := enrollCtx.caChain()
+	if err != nil {
+		return nil, err
+	}
+
+	txn := &cmpTransaction{
+		enrollCtx: enrollCtx,
+		r:         r,
+		req:       req,
+		cmpPath:   cmpPath,
+	}
+
+	bodyType, body, err := b.cmpProcess(txn, chain)
+	var cmpErr *cmpError
+	if errors.As(err, &cmpErr) {
+		b.Logger().Debug("rejected CMP request", "transaction_id", hex.EncodeToString(req.Header.TransactionID), "body_type", req.BodyType, "fail_info", cmpErr.FailInfo, "error", cmpErr.Err)
+		txn.implicitConfirm = false
+		bodyType = cmpBodyError
+		body, err = buildCmpErrorContent(cmpErr.FailInfo, cmpErr.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var secret []byte
+	if txn.secret != nil {
+		secret = []byte(txn.secret.Secret)
+	}
+
+	rep, err := buildCmpResponse(req, bodyType, body, secret, signingBundle.Certificate, signingBundle.PrivateKey, chain, txn.implicitConfirm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: cmpContentType,
+			logical.HTTPStatusCode:  http.StatusOK,
+			logical.HTTPRawBody:     rep,
+		},
+	}, nil
+}
+
+// cmpProcess verifies the protection of a request and processes it, returning
+// the type and content of the response body. Requests are rejected with a
+// cmpError; other errors are internal.
+func (b *backend) cmpProcess(txn *cmpTransaction, chain []*x509.Certificate) (int, []byte, error) {
+	req := txn.req
+
+	if req.Header.PVNO != cmpVersion2000 && req.Header.PVNO != cmpVersion2021 {
+		return 0, nil, &cmpError{FailInfo: cmpFailUnsupportedVersion, Err: fmt.Errorf("unsupported CMP version %d", req.Header.PVNO)}
+	}
+	if len(req.Header.TransactionID) == 0 || len(req.Header.SenderNonce) == 0 {
+		return 0, nil, &cmpError{FailInfo: cmpFailBadRequest, Err: errors.New("CMP requests must carry a transactionID and a senderNonce")}
+	}
+
+	switch req.BodyType {
+	case cmpBodyIR, cmpBodyCR, cmpBodyP10CR, cmpBodyKUR, cmpBodyCertConf:
+	default:
+		return 0, nil, &cmpError{FailInfo: cmpFailBadRequest, Err: fmt.Errorf("CMP message body type %d is not supported", req.BodyType)}
+	}
+
+	if err := b.cmpVerifyProtection(txn); err != nil {
+		return 0, nil, err
+	}
+
+	if req.BodyType == cmpBodyCertConf {
+		return b.cmpCertConf(txn)
+	}
+
+	return b.cmpEnroll(txn, chain)
+}
+
+func (b *backend) cmpVerifyProtection(txn *cmpTransaction) error {
+	req := txn.req
+	sc := txn.enrollCtx.sc
+	alg := req.Header.ProtectionAlg
+
+	if len(alg.Algorithm) == 0 || len(req.Protection.Bytes) == 0 {
+		return &cmpError{FailInfo: cmpFailBadMessageCheck, Err: errors.New("CMP requests must be protected")}
+	}
+
+	if !alg.Algorithm.Equal(oidCmpPasswordBasedMac) {
+		if len(req.ExtraCerts) == 0 {
+			return &cmpError{FailInfo: cmpFailBadMessageCheck, Err: errors.New("signature protected CMP requests must include the protection certificate in extraCerts")}
+		}
+		signer := req.ExtraCerts[0]
+
+		sigAlg := cmpSignatureAlgorithm(alg.Algorithm)
+		if sigAlg == x509.UnknownSignatureAlgorithm {
+			return &cmpError{FailInfo: cmpFailBadAlg, Err: fmt.Errorf("unsupported protection algorithm %s", alg.Algorithm)}
+		}
+		if err := signer.CheckSignature(sigAlg, req.protectedPart, req.Protection.RightAlign()); err != nil {
+			return &cmpError{FailInfo: cmpFailBadMessageCheck, Err: fmt.Errorf("invalid message protection: %w", err)}
+		}
+
+		if err := validateEnrollCertificate(sc, signer); err != nil {
+			return &cmpError{FailInfo: cmpFailSignerNotTrusted, Err: err}
+		}
+
+		txn.signer = signer
+		return nil
+	}
+
+	// The senderKID references the shared secret, RFC 9483 Section 3.1.
+	secretId := string(req.Header.SenderKID)
+	if _, err := uuid.ParseUUID(secretId); err != nil {
+		return &cmpError{FailInfo: cmpFailNotAuthorized, Err: errors.New("senderKID does not reference a CMP shared secret")}
+	}
+
+	secret, err := sc.loadCmpSecret(secretId)
+	if err != nil {
+		if errors.Is(err, ErrStorageItemNotFound) {
+			return &cmpError{FailInfo: cmpFailNotAuthorized, Err: fmt.Errorf("unknown shared secret: %w", err)}
+		}
+		return err
+	}
+
+	params, err := parseCmpPBMParameter(alg)
+	if err != nil {
+		return &cmpError{FailInfo: cmpFailBadDataFormat, Err: err}
+	}
+	mac, err := params.mac([]byte(secret.Secret), req.protectedPart)
+	if err != nil {
+		return &cmpError{FailInfo: cmpFailBadAlg, Err: err}
+	}
+	if !hmac.Equal(mac, req.Protection.RightAlign()) {
+		return &cmpError{FailInfo: cmpFailBadMessageCheck, Err: errors.New("invalid message protection")}
+	}
+
+	txn.secret = secret
+
+	if secret.CmpPath != txn.cmpPath {
+		return &cmpError{FailInfo: cmpFailNotAuthorized, Err: fmt.Errorf("shared secret was created for %s, not %s", secret.CmpPath, txn.cmpPath)}
+	}
+
+	return nil
+}
+
+// cmpEnroll processes ir, cr, p10cr and kur messages.
+func (b *backend) cmpEnroll(txn *cmpTransaction, chain []*x509.Certificate) (int, []byte, error) {
+	req := txn.req
+	sc := txn.enrollCtx.sc
+
+	var certReq *cmpCertRequest
+	var err error
+	if req.BodyType == cmpBodyP10CR {
+		certReq, err = parseCmpP10cr(req.Body)
+	} else {
+		certReq, err = parseCmpCertReqMessages(req.Body)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	txn.implicitConfirm = req.implicitConfirm()
+
+	if req.BodyType == cmpBodyKUR {
+		// Key update requests are signed with the certificate being updated.
+		if txn.signer == nil {
+			return 0, nil, &cmpError{FailInfo: cmpFailNotAuthorized, Err: errors.New("key update requests must be signed with the certificate being updated")}
+		}
+		if err := validateEnrollRenewal(sc, txn.signer, certReq.CSR); err != nil {
+			return 0, nil, &cmpError{FailInfo: cmpFailBadCertTemplate, Err: err}
+		}
+	} else {
+		if txn.secret == nil {
+			return 0, nil, &cmpError{FailInfo: cmpFailNotAuthorized, Err: errors.New("enrollment requests must be protected with a CMP shared secret")}
+		}
+		if err := b.cmpConsumeSecret(txn); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	parsedBundle, err := txn.enrollCtx.issueCertFromCsr(txn.r, certReq.CSR)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return 0, nil, &cmpError{FailInfo: cmpFailBadCertTemplate, Err: err}
+		default:
+			return 0, nil, err
+		}
+	}
+	issued := parsedBundle.Certificate
+
+	b.Logger().Debug("issued certificate over CMP", "serial_number", serialFromCert(issued), "transaction_id", hex.EncodeToString(req.Header.TransactionID), "body_type", req.BodyType)
+
+	if txn.secret != nil && !txn.implicitConfirm {
+		txn.secret.Certificate = issued.Raw
+		if err := sc.saveCmpSecret(txn.secret); err != nil {
+			return 0, nil, fmt.Errorf("failed saving cmp secret: %w", err)
+		}
+	}
+
+	// Clients enrolling with a shared secret may not yet know the root to
+	// validate the issued certificate against.
+	var caPubs []*x509.Certificate
+	if txn.secret != nil {
+		caPubs = chain[len(chain)-1:]
+	}
+
+	body, err := buildCmpCertRepContent(certReq.CertReqID, issued, caPubs)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	switch req.BodyType {
+	case cmpBodyIR:
+		return cmpBodyIP, body, nil
+	case cmpBodyKUR:
+		return cmpBodyKUP, body, nil
+	default:
+		return cmpBodyCP, body, nil
+	}
+}
+
+// cmpConsumeSecret marks the shared secret of an enrollment request as used,
+// so that it can not be used for another one. Without implicit confirmation,
+// it is kept for the client's certConf in the same transaction.
+func (b *backend) cmpConsumeSecret(txn *cmpTransaction) error {
+	sc := txn.enrollCtx.sc
+	secret := txn.secret
+
+	if secret.TransactionID != "" {
+		return &cmpError{FailInfo: cmpFailNotAuthorized, Err: errors.New("shared secret was already used")}
+	}
+
+	if !txn.implicitConfirm {
+		secret.TransactionID = hex.EncodeToString(txn.req.Header.TransactionID)
+		if err := sc.saveCmpSecret(secret); err != nil {
+			return fmt.Errorf("failed saving cmp secret: %w", err)
+		}
+		return nil
+	}
+
+	// Like EABs, the secret is deleted before issuance to prevent its re-use;
+	// should issuance fail, the operator creates another one.
+	deleted, err := sc.deleteCmpSecret(secret.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete cmp secret: %w", err)
+	}
+	if !deleted {
+		return &cmpError{FailInfo: cmpFailNotAuthorized, Err: errors.New("shared secret was already used")}
+	}
+
+	return nil
+}
+
+// cmpCertConf processes the certConf message of a transaction, answered with
+// a pkiconf message.
+func (b *backend) cmpCertConf(txn *cmpTransaction) (int, []byte, error) {
+	req := txn.req
+
+	var statuses []cmpCertStatus
+	if _, err := asn1.Unmarshal(req.Body, &statuses); err != nil {
+		return 0, nil, &cmpError{FailInfo: cmpFailBadDataFormat, Err: fmt.Errorf("failed to parse certificate confirmation: %w", err)}
+	}
+	if len(statuses) > 1 {
+		return 0, nil, &cmpError{FailInfo: cmpFailBadRequest, Err: errors.New("exactly one certificate confirmation is supported per message")}
+	}
+
+	// Enrollments with a shared secret keep it until their confirmation; key
+	// update requests leave nothing to clean up.
+	if txn.secret != nil {
+		secret := txn.secret
+		if secret.TransactionID != hex.EncodeToString(req.Header.TransactionID) || len(secret.Certificate) == 0 {
+			return 0, nil, &cmpError{FailInfo: cmpFailBadRequest, Err: errors.New("no certificate awaits confirmation in this transaction")}
+		}
+
+		if len(statuses) == 1 {
+			cert, err := x509.ParseCertificate(secret.Certificate)
+			if err != nil {
+				return 0, nil, err
+			}
+			certHash, err := cmpCertHash(cert, statuses[0].HashAlg)
+			if err != nil {
+				return 0, nil, &cmpError{FailInfo: cmpFailBadAlg, Err: err}
+			}
+			if !hmac.Equal(certHash, statuses[0].CertHash) {
+				return 0, nil, &cmpError{FailInfo: cmpFailBadCertId, Err: errors.New("certHash does not match the issued certificate")}
+			}
+		}
+
+		if _, err := txn.enrollCtx.sc.deleteCmpSecret(secret.ID); err != nil {
+			return 0, nil, fmt.Errorf("failed to delete cmp secret: %w", err)
+		}
+	}
+
+	if len(statuses) == 1 && statuses[0].StatusInfo.Status == cmpStatusRejection {
+		b.Logger().Debug("CMP client rejected the issued certificate", "transaction_id", hex.EncodeToString(req.Header.TransactionID))
+	}
+
+	return cmpBodyPKIConf, asn1.NullBytes, nil
+}
+
+// fetchCmpMessage returns the PKIMessage of a request, sent as the body of a
+// POST request, RFC 6712 Section 3.
+func fetchCmpMessage(r *logical.Request) ([]byte, error) {
+	if r.HTTPRequest == nil || r.HTTPRequest.Body == nil {
+		return nil, fmt.Errorf("CMP messages must be sent with the %s content type", cmpContentType)
+	}
+
+	rawBody := r.HTTPRequest.Body
+	defer rawBody.Close()
+
+	body, err := io.ReadAll(io.LimitReader(rawBody, maxCmpRequestSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) >= maxCmpRequestSize {
+		return nil, errors.New("request is too large")
+	}
+
+	return body, nil
+}
@@ -0,0 +1,312 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const cmpSecretPrefix = "cmp/secrets/"
+
+/*
+ * These are VAULT APIs to manage the shared secrets CMP clients protect their
+ * initial requests with, the CMP counterpart of the ACME External Account
+ * Bindings. They are not used by CMP clients themselves.
+ */
+func pathCmpSecretList(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "cmp/secrets/?$",
+		Fields:  map[string]*framework.FieldSchema{},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathCmpListSecrets,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationPrefix: operationPrefixPKI,
+					OperationVerb:   "list-cmp-secrets",
+					Description:     "List all CMP shared secret references yet to be used.",
+				},
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"keys": {
+								Type:        framework.TypeStringSlice,
+								Description: `A list of unused shared secret references`,
+								Required:    true,
+							},
+							"key_info": {
+								Type:        framework.TypeMap,
+								Description: `Shared secret details keyed by reference`,
+								Required:    false,
+							},
+						},
+					}},
+				},
+			},
+		},
+
+		HelpSynopsis:    "list shared secrets to be used for CMP",
+		HelpDescription: `list references of shared secrets that have been generated but yet to be used.`,
+	}
+}
+
+func pathCmpNewSecret(b *backend) []*framework.Path {
+	return buildEnrollFrameworkPaths(b, "cmp", patternCmpNewSecret, "/new-secret")
+}
+
+func patternCmpNewSecret(b *backend, pattern string) *framework.Path {
+	fields := map[string]*framework.FieldSchema{}
+	addFieldsForEnrollPath(fields, pattern, "CMP")
+
+	opSuffix := getAcmeOperationSuffix(pattern)
+
+	return &framework.Path{
+		Pattern: pattern,
+		Fields:  fields,
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.pathCmpCreateSecret,
+				ForwardPerformanceSecondary: false,
+				ForwardPerformanceStandby:   true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationPrefix: operationPrefixPKI,
+					OperationVerb:   "generate-cmp-secret",
+					OperationSuffix: opSuffix,
+					Description:     "Generate a CMP shared secret for a CMP path",
+				},
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"id": {
+								Type:        framework.TypeString,
+								Description: `The reference identifying the shared secret, sent by the client as the senderKID`,
+								Required:    true,
+							},
+							"secret": {
+								Type:        framework.TypeString,
+								Description: `The shared secret the client protects its requests with`,
+								Required:    true,
+							},
+							"cmp_path": {
+								Type:        framework.TypeString,
+								Description: `The CMP path to which the shared secret belongs`,
+								Required:    true,
+							},
+							"created_on": {
+								Type:        framework.TypeTime,
+								Description: `An RFC3339 formatted date time when the shared secret was created`,
+								Required:    true,
+							},
+						},
+					}},
+				},
+			},
+		},
+
+		HelpSynopsis:    "Generate shared secrets to be used for CMP",
+		HelpDescription: `Generate single use shared secrets for password based MAC protected CMP enrollment requests.`,
+	}
+}
+
+func pathCmpSecretDelete(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "cmp/secrets/" + uuidNameRegex("secret_id"),
+
+		Fields: map[string]*framework.FieldSchema{
+			"secret_id": {
+				Type:        framework.TypeString,
+				Description: "CMP shared secret reference",
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback:                    b.pathCmpDeleteSecret,
+				ForwardPerformanceSecondary: false,
+				ForwardPerformanceStandby:   true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationPrefix: operationPrefixPKI,
+					OperationVerb:   "delete-cmp-secret",
+					Description:     "Delete an unused CMP shared secret",
+				},
+			},
+		},
+
+		HelpSynopsis: "Delete a CMP shared secret prior to its use",
+		HelpDescription: `Allows an operator to delete a CMP shared secret before it is used in an
+enrollment request. If the reference provided does not exist or was already
+used a successful response is returned along with a warning that it did not
+exist.`,
+	}
+}
+
+type cmpSecret struct {
+	ID        string    `json:"-"`
+	Secret    string    `json:"secret"`
+	CmpPath   string    `json:"cmp-path"`
+	CreatedOn time.Time `json:"created-on"`
+	// TransactionID and Certificate are set once the secret was used for a
+	// request awaiting the client's certConf; the certificate is kept here as
+	// roles may not store it.
+	TransactionID string `json:"transaction-id,omitempty"`
+	Certificate   []byte `json:"certificate,omitempty"`
+}
+
+func (sc *storageContext) saveCmpSecret(secret *cmpSecret) error {
+	json, err := logical.StorageEntryJSON(path.Join(cmpSecretPrefix, secret.ID), secret)
+	if err != nil {
+		return err
+	}
+	return sc.Storage.Put(sc.Context, json)
+}
+
+func (sc *storageContext) loadCmpSecret(id string) (*cmpSecret, error) {
+	rawEntry, err := sc.Storage.Get(sc.Context, path.Join(cmpSecretPrefix, id))
+	if err != nil {
+		return nil, err
+	}
+	if rawEntry == nil {
+		return nil, fmt.Errorf("%w: no cmp secret found for id %s", ErrStorageItemNotFound, id)
+	}
+
+	var secret cmpSecret
+	if err := rawEntry.DecodeJSON(&secret); err != nil {
+		return nil, err
+	}
+
+	secret.ID = id
+	return &secret, nil
+}
+
+func (sc *storageContext) deleteCmpSecret(id string) (bool, error) {
+	rawEntry, err := sc.Storage.Get(sc.Context, path.Join(cmpSecretPrefix, id))
+	if err != nil {
+		return false, err
+	}
+	if rawEntry == nil {
+		return false, nil
+	}
+
+	if err := sc.Storage.Delete(sc.Context, path.Join(cmpSecretPrefix, id)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (sc *storageContext) listCmpSecretIds() ([]string, error) {
+	entries, err := sc.Storage.List(sc.Context, cmpSecretPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, "/") {
+			continue
+		}
+		ids = append(ids, entry)
+	}
+
+	return ids, nil
+}
+
+func (b *backend) pathCmpListSecrets(ctx context.Context, r *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, r.Storage)
+
+	secretIds, err := sc.listCmpSecretIds()
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	var keyIds []string
+	keyInfos := map[string]interface{}{}
+
+	for _, secretId := range secretIds {
+		secret, err := sc.loadCmpSecret(secretId)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed loading cmp secret %s: %v", secretId, err))
+			continue
+		}
+
+		keyIds = append(keyIds, secret.ID)
+		keyInfos[secret.ID] = map[string]interface{}{
+			"cmp_path":   secret.CmpPath,
+			"created_on": secret.CreatedOn.Format(time.RFC3339),
+		}
+	}
+
+	resp := logical.ListResponseWithInfo(keyIds, keyInfos)
+	for _, warning := range warnings {
+		resp.AddWarning(warning)
+	}
+	return resp, nil
+}
+
+func (b *backend) pathCmpCreateSecret(ctx context.Context, r *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	rawSecret, err := uuid.GenerateRandomBytesWithReader(16, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating cmp secret: %w", err)
+	}
+
+	cmpPath, err := getEnrollPath(r, "cmp")
+	if err != nil {
+		return nil, err
+	}
+
+	// The secret is handed out, and used by clients, as its hex encoding.
+	secret := &cmpSecret{
+		ID:        genUuid(),
+		Secret:    hex.EncodeToString(rawSecret),
+		CmpPath:   cmpPath,
+		CreatedOn: time.Now(),
+	}
+
+	sc := b.makeStorageContext(ctx, r.Storage)
+	if err := sc.saveCmpSecret(secret); err != nil {
+		return nil, fmt.Errorf("failed saving generated cmp secret: %w", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":         secret.ID,
+			"secret":     secret.Secret,
+			"cmp_path":   secret.CmpPath,
+			"created_on": secret.CreatedOn.Format(time.RFC3339),
+		},
+	}, nil
+}
+
+func (b *backend) pathCmpDeleteSecret(ctx context.Context, r *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, r.Storage)
+	secretId := d.Get("secret_id").(string)
+
+	_, err := uuid.ParseUUID(secretId)
+	if err != nil {
+		return nil, fmt.Errorf("badly formatted secret_id field")
+	}
+
+	deleted, err := sc.deleteCmpSecret(secretId)
+	if err != nil {
+		return nil, fmt.Errorf("failed deleting secret id: %w", err)
+	}
+
+	resp := &logical.Response{}
+	if !deleted {
+		resp.AddWarning("No shared secret found with id: " + secretId)
+	}
+	return resp, nil
+}
@@ -0,0 +1,486 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCmp_Backend(t *testing.T) {
+	t.Parallel()
+	b, s := CreateBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"key_type":    "ec",
+		"ttl":         "720h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootCert := parseCert(t, resp.Data["certificate"].(string))
+
+	resp, err = CBWrite(b, s, "roles/devices", map[string]interface{}{
+		"allowed_domains":  "devices.example.com",
+		"allow_subdomains": true,
+		"key_type":         "any",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	cmpPost := func(path string, message []byte) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation:   logical.UpdateOperation,
+			Path:        path,
+			Storage:     s,
+			HTTPRequest: &http.Request{Body: io.NopCloser(bytes.NewReader(message))},
+		})
+	}
+	newSecret := func(path string) *cmpTestSecret {
+		resp, err := CBWrite(b, s, path+"/new-secret", nil)
+		requireSuccessNonNilResponse(t, resp, err)
+		require.Equal(t, path, resp.Data["cmp_path"])
+		return &cmpTestSecret{id: resp.Data["id"].(string), secret: resp.Data["secret"].(string)}
+	}
+
+	client := newCmpTestClient(t, "node1.devices.example.com")
+
+	// CMP is disabled by default.
+	_, err = cmpPost("roles/devices/cmp", client.message(t, cmpBodyIR, client.certReqMessages(t, true), &cmpTestSecret{}, false))
+	require.Error(t, err)
+
+	resp, err = CBWrite(b, s, "config/cmp", map[string]interface{}{"enabled": true})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	cmpExchange := func(client *cmpTestClient, path string, message []byte, secret *cmpTestSecret) *cmpMessage {
+		resp, err := cmpPost(path, message)
+		requireSuccessNonNilResponse(t, resp, err)
+		require.Equal(t, "application/pkixcmp", resp.Data[logical.HTTPContentType])
+		return client.parseResponse(t, resp.Data[logical.HTTPRawBody].([]byte), secret, rootCert)
+	}
+
+	// Initial enrollment, protected with a shared secret and confirmed with a
+	// certConf message.
+	secret := newSecret("roles/devices/cmp")
+	rep := cmpExchange(client, "roles/devices/cmp", client.message(t, cmpBodyIR, client.certReqMessages(t, true), secret, false), secret)
+	require.Equal(t, cmpBodyIP, rep.BodyType)
+	require.False(t, rep.implicitConfirm())
+	leaf, caPubs := requireCmpCertRep(t, rep, 0)
+	requireSignedBy(t, leaf, rootCert)
+	requireMatchingPublicKeys(t, leaf, client.key.Public())
+	require.Equal(t, "node1.devices.example.com", leaf.Subject.CommonName)
+	require.Equal(t, []string{"node1.devices.example.com"}, leaf.DNSNames)
+	require.Equal(t, []*x509.Certificate{rootCert}, caPubs)
+
+	resp, err = CBRead(b, s, "cert/"+serialFromCert(leaf))
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// The secret is single use, even before the certificate was confirmed.
+	resp, err = CBList(b, s, "cmp/secrets")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{secret.id}, resp.Data["keys"])
+
+	otherTransaction := newCmpTestClient(t, "node2.devices.example.com")
+	rep = cmpExchange(otherTransaction, "roles/devices/cmp", otherTransaction.message(t, cmpBodyIR, otherTransaction.certReqMessages(t, true), secret, false), secret)
+	requireCmpError(t, rep, cmpFailNotAuthorized)
+
+	rep = cmpExchange(client, "roles/devices/cmp", client.certConf(t, []byte("wrong"), secret), secret)
+	requireCmpError(t, rep, cmpFailBadCertId)
+
+	certHash := sha256.Sum256(leaf.Raw)
+	rep = cmpExchange(client, "roles/devices/cmp", client.certConf(t, certHash[:], secret), secret)
+	require.Equal(t, cmpBodyPKIConf, rep.BodyType)
+
+	resp, err = CBList(b, s, "cmp/secrets")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Empty(t, resp.Data["keys"])
+
+	// Requests protected with an unknown or mismatched secret, or for another
+	// CMP path, are rejected.
+	rep = cmpExchange(client, "roles/devices/cmp", client.message(t, cmpBodyCR, client.certReqMessages(t, true), secret, false), nil)
+	requireCmpError(t, rep, cmpFailNotAuthorized)
+
+	secret = newSecret("cmp")
+	wrongSecret := &cmpTestSecret{id: secret.id, secret: "00"}
+	rep = cmpExchange(client, "cmp", client.message(t, cmpBodyCR, client.certReqMessages(t, true), wrongSecret, false), nil)
+	requireCmpError(t, rep, cmpFailBadMessageCheck)
+
+	rep = cmpExchange(client, "roles/devices/cmp", client.message(t, cmpBodyCR, client.certReqMessages(t, true), secret, false), secret)
+	requireCmpError(t, rep, cmpFailNotAuthorized)
+
+	rep = cmpExchange(client, "roles/devices/cmp", client.message(t, cmpBodyCR, client.certReqMessages(t, true), nil, false), nil)
+	requireCmpError(t, rep, cmpFailBadMessageCheck)
+
+	// Requests need a valid proof of possession.
+	rep = cmpExchange(client, "cmp", client.message(t, cmpBodyCR, client.certReqMessages(t, false), secret, false), secret)
+	requireCmpError(t, rep, cmpFailBadPOP)
+
+	// Rejected requests leave the secret unused.
+	unusedSecretId := secret.id
+
+	// PKCS#10 requests, with implicit confirmation.
+	secret = newSecret("roles/devices/cmp")
+	p10Client := newCmpTestClient(t, "node3.devices.example.com")
+	rep = cmpExchange(p10Client, "roles/devices/cmp", p10Client.message(t, cmpBodyP10CR, p10Client.csr(t), secret, true), secret)
+	require.Equal(t, cmpBodyCP, rep.BodyType)
+	require.True(t, rep.implicitConfirm())
+	p10Leaf, _ := requireCmpCertRep(t, rep, -1)
+	require.Equal(t, "node3.devices.example.com", p10Leaf.Subject.CommonName)
+
+	resp, err = CBList(b, s, "cmp/secrets")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{unusedSecretId}, resp.Data["keys"])
+
+	// Key update requests are signed with the certificate being updated and
+	// keep its subject.
+	updating := newCmpTestClient(t, "node1.devices.example.com")
+	updating.signer, updating.signerKey = leaf, client.key
+	rep = cmpExchange(updating, "roles/devices/cmp", updating.message(t, cmpBodyKUR, updating.certReqMessages(t, true), nil, false), nil)
+	require.Equal(t, cmpBodyKUP, rep.BodyType)
+	updated, caPubs := requireCmpCertRep(t, rep, 0)
+	require.Empty(t, caPubs)
+	require.Equal(t, leaf.Subject.String(), updated.Subject.String())
+	requireMatchingPublicKeys(t, updated, updating.key.Public())
+
+	rep = cmpExchange(updating, "roles/devices/cmp", updating.certConf(t, nil, nil), nil)
+	require.Equal(t, cmpBodyPKIConf, rep.BodyType)
+
+	renamed := newCmpTestClient(t, "node4.devices.example.com")
+	renamed.signer, renamed.signerKey = leaf, client.key
+	rep = cmpExchange(renamed, "roles/devices/cmp", renamed.message(t, cmpBodyKUR, renamed.certReqMessages(t, true), nil, false), nil)
+	requireCmpError(t, rep, cmpFailBadCertTemplate)
+
+	selfSigned := newCmpTestClient(t, "node1.devices.example.com")
+	selfSigned.signer, selfSigned.signerKey = selfSigned.selfSignedCert(t), selfSigned.key
+	rep = cmpExchange(selfSigned, "roles/devices/cmp", selfSigned.message(t, cmpBodyKUR, selfSigned.certReqMessages(t, true), nil, false), nil)
+	requireCmpError(t, rep, cmpFailSignerNotTrusted)
+
+	// Initial enrollment requires a shared secret.
+	rep = cmpExchange(updating, "roles/devices/cmp", updating.message(t, cmpBodyIR, updating.certReqMessages(t, true), nil, false), nil)
+	requireCmpError(t, rep, cmpFailNotAuthorized)
+}
+
+func TestCmp_HTTP(t *testing.T) {
+	t.Parallel()
+
+	cluster := vault.NewTestCluster(t, &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki": Factory,
+		},
+	}, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+	client := cluster.Cores[0].Client
+	mountPKIEndpoint(t, client, "pki")
+
+	resp, err := client.Logical().Write("pki/root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"key_type":    "rsa",
+		"ttl":         "32h",
+	})
+	require.NoError(t, err)
+	rootCert := parseCert(t, resp.Data["certificate"].(string))
+
+	_, err = client.Logical().Write("pki/config/cmp", map[string]interface{}{"enabled": true})
+	require.NoError(t, err)
+
+	resp, err = client.Logical().Write("pki/cmp/new-secret", nil)
+	require.NoError(t, err)
+	secret := &cmpTestSecret{id: resp.Data["id"].(string), secret: resp.Data["secret"].(string)}
+
+	cmpClient := newCmpTestClient(t, "node1.example.com")
+	message := cmpClient.message(t, cmpBodyIR, cmpClient.certReqMessages(t, true), secret, true)
+
+	httpClient := &http.Client{Transport: cleanhttp.DefaultTransport()}
+	httpClient.Transport.(*http.Transport).TLSClientConfig = cluster.Cores[0].TLSConfig()
+	httpResp, err := httpClient.Post(client.Address()+"/v1/pki/cmp", "application/pkixcmp", bytes.NewReader(message))
+	require.NoError(t, err)
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(httpResp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, httpResp.StatusCode, string(body))
+	require.Equal(t, "application/pkixcmp", httpResp.Header.Get("Content-Type"))
+
+	rep := cmpClient.parseResponse(t, body, secret, rootCert)
+	require.Equal(t, cmpBodyIP, rep.BodyType)
+	leaf, _ := requireCmpCertRep(t, rep, 0)
+	requireSignedBy(t, leaf, rootCert)
+}
+
+type cmpTestSecret struct {
+	id     string
+	secret string
+}
+
+// cmpTestClient builds CMP requests for its key, protected with a shared
+// secret or signed with an existing certificate.
+type cmpTestClient struct {
+	key        *ecdsa.PrivateKey
+	commonName string
+
+	signer    *x509.Certificate
+	signerKey crypto.Signer
+
+	transactionId []byte
+	senderNonce   []byte
+}
+
+func newCmpTestClient(t *testing.T, commonName string) *cmpTestClient {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	transactionId := make([]byte, 16)
+	_, err = rand.Read(transactionId)
+	require.NoError(t, err)
+
+	return &cmpTestClient{key: key, commonName: commonName, transactionId: transactionId}
+}
+
+func (c *cmpTestClient) selfSignedCert(t *testing.T) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: c.commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, c.key.Public(), c.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func (c *cmpTestClient) csr(t *testing.T) []byte {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: c.commonName},
+		DNSNames: []string{c.commonName},
+	}, c.key)
+	require.NoError(t, err)
+	return der
+}
+
+// certReqMessages returns the CertReqMessages of an ir, cr or kur message,
+// with a signature based proof of possession if requested.
+func (c *cmpTestClient) certReqMessages(t *testing.T, withPop bool) []byte {
+	subject, err := asn1.Marshal(pkix.Name{CommonName: c.commonName}.ToRDNSequence())
+	require.NoError(t, err)
+
+	spki, err := x509.MarshalPKIXPublicKey(c.key.Public())
+	require.NoError(t, err)
+	var rawSpki asn1.RawValue
+	_, err = asn1.Unmarshal(spki, &rawSpki)
+	require.NoError(t, err)
+
+	san, err := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte(c.commonName)}})
+	require.NoError(t, err)
+	extensions, err := asn1.Marshal([]pkix.Extension{{Id: oidExtensionSubjectAltName, Value: san}})
+	require.NoError(t, err)
+	var rawExtensions asn1.RawValue
+	_, err = asn1.Unmarshal(extensions, &rawExtensions)
+	require.NoError(t, err)
+
+	certReq, err := asn1.Marshal(struct {
+		CertReqID    int
+		CertTemplate struct {
+			Subject    asn1.RawValue
+			PublicKey  asn1.RawValue
+			Extensions asn1.RawValue
+		}
+	}{
+		CertTemplate: struct {
+			Subject    asn1.RawValue
+			PublicKey  asn1.RawValue
+			Extensions asn1.RawValue
+		}{
+			Subject:    asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 5, IsCompound: true, Bytes: subject},
+			PublicKey:  asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 6, IsCompound: true, Bytes: rawSpki.Bytes},
+			Extensions: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 9, IsCompound: true, Bytes: rawExtensions.Bytes},
+		},
+	})
+	require.NoError(t, err)
+
+	certReqMsg := []asn1.RawValue{{FullBytes: certReq}}
+	if withPop {
+		digest := sha256.Sum256(certReq)
+		signature, err := c.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+		require.NoError(t, err)
+
+		alg, err := asn1.Marshal(pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}})
+		require.NoError(t, err)
+		sig, err := asn1.Marshal(asn1.BitString{Bytes: signature, BitLength: len(signature) * 8})
+		require.NoError(t, err)
+
+		certReqMsg = append(certReqMsg, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: append(alg, sig...)})
+	}
+
+	rawMsg, err := asn1.Marshal(certReqMsg)
+	require.NoError(t, err)
+	der, err := asn1.Marshal([]asn1.RawValue{{FullBytes: rawMsg}})
+	require.NoError(t, err)
+	return der
+}
+
+func (c *cmpTestClient) certConf(t *testing.T, certHash []byte, secret *cmpTestSecret) []byte {
+	var content []byte
+	var err error
+	if certHash != nil {
+		content, err = asn1.Marshal([]cmpCertStatus{{CertHash: certHash}})
+	} else {
+		content, err = asn1.Marshal([]cmpCertStatus{})
+	}
+	require.NoError(t, err)
+	return c.message(t, cmpBodyCertConf, content, secret, false)
+}
+
+// message returns a PKIMessage, protected with the secret if one is given,
+// or else signed with the client's signer if it has one.
+func (c *cmpTestClient) message(t *testing.T, bodyType int, body []byte, secret *cmpTestSecret, implicitConfirm bool) []byte {
+	c.senderNonce = make([]byte, 16)
+	_, err := rand.Read(c.senderNonce)
+	require.NoError(t, err)
+
+	subject, err := asn1.Marshal(pkix.Name{CommonName: c.commonName}.ToRDNSequence())
+	require.NoError(t, err)
+
+	header := cmpPKIHeader{
+		PVNO:          cmpVersion2000,
+		Sender:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: subject},
+		Recipient:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: []byte{0x30, 0x00}},
+		TransactionID: c.transactionId,
+		SenderNonce:   c.senderNonce,
+	}
+	if implicitConfirm {
+		header.GeneralInfo = []cmpInfoTypeAndValue{{InfoType: oidCmpImplicitConfirm, InfoValue: asn1.NullRawValue}}
+	}
+
+	var params *cmpPBMParameter
+	var extraCerts []asn1.RawValue
+	switch {
+	case secret != nil:
+		params = &cmpPBMParameter{
+			Salt:           []byte("0123456789abcdef"),
+			OWF:            pkix.AlgorithmIdentifier{Algorithm: oidSha256},
+			IterationCount: 500,
+			MAC:            pkix.AlgorithmIdentifier{Algorithm: oidHmacWithSha256},
+		}
+		rawParams, err := asn1.Marshal(*params)
+		require.NoError(t, err)
+		header.ProtectionAlg = pkix.AlgorithmIdentifier{Algorithm: oidCmpPasswordBasedMac, Parameters: asn1.RawValue{FullBytes: rawParams}}
+		header.SenderKID = []byte(secret.id)
+	case c.signer != nil:
+		header.ProtectionAlg = pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}}
+		header.SenderKID = c.signer.SubjectKeyId
+		extraCerts = []asn1.RawValue{{FullBytes: c.signer.Raw}}
+	}
+
+	rawHeader, err := asn1.Marshal(header)
+	require.NoError(t, err)
+	msg := cmpPKIMessage{
+		Header:     asn1.RawValue{FullBytes: rawHeader},
+		Body:       asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: bodyType, IsCompound: true, Bytes: body},
+		ExtraCerts: extraCerts,
+	}
+
+	protectedPart, err := asn1.Marshal(struct {
+		Header asn1.RawValue
+		Body   asn1.RawValue
+	}{msg.Header, msg.Body})
+	require.NoError(t, err)
+
+	var protection []byte
+	switch {
+	case params != nil:
+		protection, err = params.mac([]byte(secret.secret), protectedPart)
+		require.NoError(t, err)
+	case c.signer != nil:
+		digest := sha256.Sum256(protectedPart)
+		protection, err = c.signerKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+		require.NoError(t, err)
+	}
+	if protection != nil {
+		msg.Protection = asn1.BitString{Bytes: protection, BitLength: len(protection) * 8}
+	}
+
+	der, err := asn1.Marshal(msg)
+	require.NoError(t, err)
+	return der
+}
+
+// parseResponse parses a response and verifies its header and protection:
+// with the secret if one is given, or else the CA's signature.
+func (c *cmpTestClient) parseResponse(t *testing.T, der []byte, secret *cmpTestSecret, caCert *x509.Certificate) *cmpMessage {
+	rep, err := parseCmpMessage(der)
+	require.NoError(t, err)
+
+	require.Equal(t, cmpVersion2000, rep.Header.PVNO)
+	require.Equal(t, c.transactionId, rep.Header.TransactionID)
+	require.Equal(t, c.senderNonce, rep.Header.RecipNonce)
+	require.NotEmpty(t, rep.Header.SenderNonce)
+	require.Equal(t, caCert.RawSubject, rep.Header.Sender.Bytes)
+
+	if secret != nil {
+		require.Equal(t, oidCmpPasswordBasedMac, rep.Header.ProtectionAlg.Algorithm)
+		params, err := parseCmpPBMParameter(rep.Header.ProtectionAlg)
+		require.NoError(t, err)
+		mac, err := params.mac([]byte(secret.secret), rep.protectedPart)
+		require.NoError(t, err)
+		require.True(t, hmac.Equal(mac, rep.Protection.RightAlign()), "invalid response MAC")
+	} else {
+		require.Equal(t, caCert.Raw, rep.ExtraCerts[0].Raw)
+		sigAlg := cmpSignatureAlgorithm(rep.Header.ProtectionAlg.Algorithm)
+		require.NoError(t, caCert.CheckSignature(sigAlg, rep.protectedPart, rep.Protection.RightAlign()))
+	}
+
+	return rep
+}
+
+func requireCmpCertRep(t *testing.T, rep *cmpMessage, certReqId int) (*x509.Certificate, []*x509.Certificate) {
+	var content cmpCertRepMessage
+	_, err := asn1.Unmarshal(rep.Body, &content)
+	require.NoError(t, err)
+	require.Len(t, content.Response, 1)
+	require.Equal(t, certReqId, content.Response[0].CertReqID)
+	require.Equal(t, cmpStatusAccepted, content.Response[0].Status.Status)
+
+	cert, err := x509.ParseCertificate(content.Response[0].CertifiedKeyPair.CertOrEncCert.Bytes)
+	require.NoError(t, err)
+
+	var caPubs []*x509.Certificate
+	for _, rawCert := range content.CAPubs {
+		caPub, err := x509.ParseCertificate(rawCert.FullBytes)
+		require.NoError(t, err)
+		caPubs = append(caPubs, caPub)
+	}
+
+	return cert, caPubs
+}
+
+func requireCmpError(t *testing.T, rep *cmpMessage, failInfo int) {
+	require.Equal(t, cmpBodyError, rep.BodyType)
+
+	var content cmpErrorMsgContent
+	_, err := asn1.Unmarshal(rep.Body, &content)
+	require.NoError(t, err)
+	require.Equal(t, cmpStatusRejection, content.PKIStatusInfo.Status)
+	require.Equal(t, 1, content.PKIStatusInfo.FailInfo.At(failInfo), "unexpected failInfo %v", content.PKIStatusInfo.FailInfo)
+}
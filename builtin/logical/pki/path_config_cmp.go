@@ -0,0 +1,152 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	storageCmpConfig      = "config/cmp"
+	pathConfigCmpHelpSyn  = "Configuration of CMP Endpoints"
+	pathConfigCmpHelpDesc = "Here we configure:\n\nenabled=false, whether CMP is enabled, defaults to false meaning that clusters will by default not get CMP support,\ndefault_path_policy=\"sign-verbatim\", either \"forbid\", preventing the non-role-qualified CMP paths from being used at all, \"role:<role_name>\" which is the role to be used for non-role-qualified CMP requests; or \"sign-verbatim\", the default meaning CMP issuance will be equivalent to sign-verbatim"
+)
+
+type cmpConfigEntry struct {
+	Enabled           bool   `json:"enabled"`
+	DefaultPathPolicy string `json:"default_path_policy"`
+}
+
+var defaultCmpConfig = cmpConfigEntry{
+	Enabled:           false,
+	DefaultPathPolicy: "sign-verbatim",
+}
+
+func (sc *storageContext) getCmpConfig() (*cmpConfigEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, storageCmpConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var mapping cmpConfigEntry
+	if entry == nil {
+		mapping = defaultCmpConfig
+		return &mapping, nil
+	}
+
+	if err := entry.DecodeJSON(&mapping); err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode CMP configuration: %v", err)}
+	}
+
+	return &mapping, nil
+}
+
+func (sc *storageContext) setCmpConfig(entry *cmpConfigEntry) error {
+	json, err := logical.StorageEntryJSON(storageCmpConfig, entry)
+	if err != nil {
+		return fmt.Errorf("failed creating storage entry: %w", err)
+	}
+
+	if err := sc.Storage.Put(sc.Context, json); err != nil {
+		return fmt.Errorf("failed writing storage entry: %w", err)
+	}
+
+	return nil
+}
+
+func pathCmpConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/cmp",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixPKI,
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type:        framework.TypeBool,
+				Description: `whether CMP is enabled, defaults to false meaning that clusters will by default not get CMP support`,
+				Default:     false,
+			},
+			"default_path_policy": {
+				Type:        framework.TypeString,
+				Description: `the policy to be used for non-role-qualified CMP requests; by default CMP issuance will be otherwise unrestricted, equivalent to the sign-verbatim endpoint; one may also specify a role to use as this policy, as "role:<role_name>", or "forbid" to only allow role-qualified CMP paths`,
+				Default:     "sign-verbatim",
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "cmp-configuration",
+				},
+				Callback: b.pathCmpConfigRead,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathCmpConfigWrite,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationVerb:   "configure",
+					OperationSuffix: "cmp",
+				},
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigCmpHelpSyn,
+		HelpDescription: pathConfigCmpHelpDesc,
+	}
+}
+
+func (b *backend) pathCmpConfigRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getCmpConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return genResponseFromCmpConfig(config), nil
+}
+
+func genResponseFromCmpConfig(config *cmpConfigEntry) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":             config.Enabled,
+			"default_path_policy": config.DefaultPathPolicy,
+		},
+	}
+}
+
+func (b *backend) pathCmpConfigWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+
+	config, err := sc.getCmpConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := d.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+
+	if defaultPathPolicyRaw, ok := d.GetOk("default_path_policy"); ok {
+		config.DefaultPathPolicy = defaultPathPolicyRaw.(string)
+	}
+
+	if resp, err := b.validateEnrollDefaultPathPolicy(ctx, req, config.DefaultPathPolicy); resp != nil || err != nil {
+		return resp, err
+	}
+
+	if err := sc.setCmpConfig(config); err != nil {
+		return nil, err
+	}
+
+	return genResponseFromCmpConfig(config), nil
+}
@@ -0,0 +1,245 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	storageEstConfig      = "config/est"
+	pathConfigEstHelpSyn  = "Configuration of EST Endpoints"
+	pathConfigEstHelpDesc = "Here we configure:\n\nenabled=false, whether EST is enabled, defaults to false meaning that clusters will by default not get EST support,\ndefault_path_policy=\"sign-verbatim\", either \"forbid\", preventing the non-role-qualified EST paths from being used at all, \"role:<role_name>\" which is the role to be used for non-role-qualified EST requests; or \"sign-verbatim\", the default meaning EST issuance will be equivalent to sign-verbatim,\nauthenticators={}, the auth mounts EST clients authenticate against, keyed by \"cert\" (with \"accessor\" and \"cert_role\") and \"userpass\" (with \"accessor\")"
+
+	estAuthenticatorCert     = "cert"
+	estAuthenticatorUserpass = "userpass"
+)
+
+type estAuthenticatorEntry struct {
+	Accessor string `json:"accessor"`
+	CertRole string `json:"cert_role,omitempty"`
+}
+
+type estConfigEntry struct {
+	Enabled           bool                              `json:"enabled"`
+	DefaultPathPolicy string                            `json:"default_path_policy"`
+	Authenticators    map[string]*estAuthenticatorEntry `json:"authenticators"`
+}
+
+var defaultEstConfig = estConfigEntry{
+	Enabled:           false,
+	DefaultPathPolicy: "sign-verbatim",
+	Authenticators:    map[string]*estAuthenticatorEntry{},
+}
+
+func (sc *storageContext) getEstConfig() (*estConfigEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, storageEstConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var mapping estConfigEntry
+	if entry == nil {
+		mapping = defaultEstConfig
+		mapping.Authenticators = map[string]*estAuthenticatorEntry{}
+		return &mapping, nil
+	}
+
+	if err := entry.DecodeJSON(&mapping); err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode EST configuration: %v", err)}
+	}
+
+	if mapping.Authenticators == nil {
+		mapping.Authenticators = map[string]*estAuthenticatorEntry{}
+	}
+
+	return &mapping, nil
+}
+
+func (sc *storageContext) setEstConfig(entry *estConfigEntry) error {
+	json, err := logical.StorageEntryJSON(storageEstConfig, entry)
+	if err != nil {
+		return fmt.Errorf("failed creating storage entry: %w", err)
+	}
+
+	if err := sc.Storage.Put(sc.Context, json); err != nil {
+		return fmt.Errorf("failed writing storage entry: %w", err)
+	}
+
+	return nil
+}
+
+func pathEstConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/est",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixPKI,
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type:        framework.TypeBool,
+				Description: `whether EST is enabled, defaults to false meaning that clusters will by default not get EST support`,
+				Default:     false,
+			},
+			"default_path_policy": {
+				Type:        framework.TypeString,
+				Description: `the policy to be used for non-role-qualified EST requests; by default EST issuance will be otherwise unrestricted, equivalent to the sign-verbatim endpoint; one may also specify a role to use as this policy, as "role:<role_name>", or "forbid" to only allow role-qualified EST paths`,
+				Default:     "sign-verbatim",
+			},
+			"authenticators": {
+				Type:        framework.TypeMap,
+				Description: `the auth mounts EST clients may authenticate against when they do not present a Vault token; a map keyed by "cert", holding the "accessor" of a TLS certificate auth mount and the "cert_role" to log in with, and "userpass", holding the "accessor" of a userpass auth mount used with HTTP Basic authentication`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "est-configuration",
+				},
+				Callback: b.pathEstConfigRead,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathEstConfigWrite,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationVerb:   "configure",
+					OperationSuffix: "est",
+				},
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigEstHelpSyn,
+		HelpDescription: pathConfigEstHelpDesc,
+	}
+}
+
+func (b *backend) pathEstConfigRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getEstConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return genResponseFromEstConfig(config), nil
+}
+
+func genResponseFromEstConfig(config *estConfigEntry) *logical.Response {
+	authenticators := map[string]interface{}{}
+	for name, authenticator := range config.Authenticators {
+		entry := map[string]interface{}{
+			"accessor": authenticator.Accessor,
+		}
+		if name == estAuthenticatorCert {
+			entry["cert_role"] = authenticator.CertRole
+		}
+		authenticators[name] = entry
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":             config.Enabled,
+			"default_path_policy": config.DefaultPathPolicy,
+			"authenticators":      authenticators,
+		},
+	}
+}
+
+func (b *backend) pathEstConfigWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+
+	config, err := sc.getEstConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := d.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+
+	if defaultPathPolicyRaw, ok := d.GetOk("default_path_policy"); ok {
+		config.DefaultPathPolicy = defaultPathPolicyRaw.(string)
+	}
+
+	if authenticatorsRaw, ok := d.GetOk("authenticators"); ok {
+		authenticators, err := parseEstAuthenticators(authenticatorsRaw.(map[string]interface{}))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		config.Authenticators = authenticators
+	}
+
+	if resp, err := b.validateEnrollDefaultPathPolicy(ctx, req, config.DefaultPathPolicy); resp != nil || err != nil {
+		return resp, err
+	}
+
+	if err := sc.setEstConfig(config); err != nil {
+		return nil, err
+	}
+
+	return genResponseFromEstConfig(config), nil
+}
+
+func parseEstAuthenticators(raw map[string]interface{}) (map[string]*estAuthenticatorEntry, error) {
+	authenticators := map[string]*estAuthenticatorEntry{}
+	for name, value := range raw {
+		settings, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("authenticator %q must be a map", name)
+		}
+
+		var allowedKeys []string
+		switch name {
+		case estAuthenticatorCert:
+			allowedKeys = []string{"accessor", "cert_role"}
+		case estAuthenticatorUserpass:
+			allowedKeys = []string{"accessor"}
+		default:
+			return nil, fmt.Errorf("unsupported authenticator %q; valid values are %q and %q", name, estAuthenticatorCert, estAuthenticatorUserpass)
+		}
+
+		entry := &estAuthenticatorEntry{}
+		for key, value := range settings {
+			found := false
+			for _, allowed := range allowedKeys {
+				if key == allowed {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unsupported field %q for authenticator %q; valid fields are %s", key, name, strings.Join(allowedKeys, ", "))
+			}
+
+			str, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("field %q of authenticator %q must be a string", key, name)
+			}
+			switch key {
+			case "accessor":
+				entry.Accessor = str
+			case "cert_role":
+				entry.CertRole = str
+			}
+		}
+
+		if entry.Accessor == "" {
+			return nil, fmt.Errorf("authenticator %q requires an accessor", name)
+		}
+
+		authenticators[name] = entry
+	}
+
+	return authenticators, nil
+}
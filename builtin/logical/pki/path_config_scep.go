@@ -0,0 +1,152 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	storageScepConfig      = "config/scep"
+	pathConfigScepHelpSyn  = "Configuration of SCEP Endpoints"
+	pathConfigScepHelpDesc = "Here we configure:\n\nenabled=false, whether SCEP is enabled, defaults to false meaning that clusters will by default not get SCEP support,\ndefault_path_policy=\"sign-verbatim\", either \"forbid\", preventing the non-role-qualified SCEP paths from being used at all, \"role:<role_name>\" which is the role to be used for non-role-qualified SCEP requests; or \"sign-verbatim\", the default meaning SCEP issuance will be equivalent to sign-verbatim"
+)
+
+type scepConfigEntry struct {
+	Enabled           bool   `json:"enabled"`
+	DefaultPathPolicy string `json:"default_path_policy"`
+}
+
+var defaultScepConfig = scepConfigEntry{
+	Enabled:           false,
+	DefaultPathPolicy: "sign-verbatim",
+}
+
+func (sc *storageContext) getScepConfig() (*scepConfigEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, storageScepConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var mapping scepConfigEntry
+	if entry == nil {
+		mapping = defaultScepConfig
+		return &mapping, nil
+	}
+
+	if err := entry.DecodeJSON(&mapping); err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode SCEP configuration: %v", err)}
+	}
+
+	return &mapping, nil
+}
+
+func (sc *storageContext) setScepConfig(entry *scepConfigEntry) error {
+	json, err := logical.StorageEntryJSON(storageScepConfig, entry)
+	if err != nil {
+		return fmt.Errorf("failed creating storage entry: %w", err)
+	}
+
+	if err := sc.Storage.Put(sc.Context, json); err != nil {
+		return fmt.Errorf("failed writing storage entry: %w", err)
+	}
+
+	return nil
+}
+
+func pathScepConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/scep",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixPKI,
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type:        framework.TypeBool,
+				Description: `whether SCEP is enabled, defaults to false meaning that clusters will by default not get SCEP support`,
+				Default:     false,
+			},
+			"default_path_policy": {
+				Type:        framework.TypeString,
+				Description: `the policy to be used for non-role-qualified SCEP requests; by default SCEP issuance will be otherwise unrestricted, equivalent to the sign-verbatim endpoint; one may also specify a role to use as this policy, as "role:<role_name>", or "forbid" to only allow role-qualified SCEP paths`,
+				Default:     "sign-verbatim",
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "scep-configuration",
+				},
+				Callback: b.pathScepConfigRead,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathScepConfigWrite,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationVerb:   "configure",
+					OperationSuffix: "scep",
+				},
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigScepHelpSyn,
+		HelpDescription: pathConfigScepHelpDesc,
+	}
+}
+
+func (b *backend) pathScepConfigRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getScepConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return genResponseFromScepConfig(config), nil
+}
+
+func genResponseFromScepConfig(config *scepConfigEntry) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":             config.Enabled,
+			"default_path_policy": config.DefaultPathPolicy,
+		},
+	}
+}
+
+func (b *backend) pathScepConfigWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+
+	config, err := sc.getScepConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := d.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+
+	if defaultPathPolicyRaw, ok := d.GetOk("default_path_policy"); ok {
+		config.DefaultPathPolicy = defaultPathPolicyRaw.(string)
+	}
+
+	if resp, err := b.validateEnrollDefaultPathPolicy(ctx, req, config.DefaultPathPolicy); resp != nil || err != nil {
+		return resp, err
+	}
+
+	if err := sc.setScepConfig(config); err != nil {
+		return nil, err
+	}
+
+	return genResponseFromScepConfig(config), nil
+}
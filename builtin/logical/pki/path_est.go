@@ -0,0 +1,271 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// A PKCS#10 request is rarely more than a few kilobytes, even with large
+	// RSA keys; anything past this is rejected before parsing.
+	maxEstRequestSize = 64 * 1024
+
+	estPkcs7ContentType    = "application/pkcs7-mime"
+	estEnrollContentType   = "application/pkcs7-mime; smime-type=certs-only"
+	estCsrAttrsContentType = "application/csrattrs"
+
+	pathEstHelpSync = `An endpoint implementing the EST (RFC 7030) protocol`
+	pathEstHelpDesc = `These endpoints implement the Enrollment over Secure Transport
+protocol. The cacerts and csrattrs endpoints are unauthenticated; the
+simpleenroll and simplereenroll endpoints require a Vault token, which EST
+clients usually obtain implicitly through the authenticators configured in
+config/est.`
+)
+
+var ErrEstDisabled = errors.New("EST is disabled on this mount")
+
+// estWrapper validates the EST configuration and resolves the role and issuer
+// the request path maps onto before handing off to the operation.
+func (b *backend) estWrapper(op enrollOperation) framework.OperationFunc {
+	return func(ctx context.Context, r *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		sc := b.makeStorageContext(ctx, r.Storage)
+
+		config, err := sc.getEstConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch EST configuration: %w", err)
+		}
+
+		if !config.Enabled {
+			return nil, logical.CodedError(http.StatusNotFound, ErrEstDisabled.Error())
+		}
+
+		if b.useLegacyBundleCaStorage() {
+			return nil, fmt.Errorf("can not perform EST operations until migration has completed")
+		}
+
+		enrollCtx, err := getEnrollContext(sc, data, "EST", config.DefaultPathPolicy)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		return op(enrollCtx, r, data)
+	}
+}
+
+func pathEstCaCerts(b *backend) []*framework.Path {
+	return buildEnrollFrameworkPaths(b, "est", patternEstCaCerts, "/cacerts")
+}
+
+func pathEstCsrAttrs(b *backend) []*framework.Path {
+	return buildEnrollFrameworkPaths(b, "est", patternEstCsrAttrs, "/csrattrs")
+}
+
+func pathEstSimpleEnroll(b *backend) []*framework.Path {
+	return buildEnrollFrameworkPaths(b, "est", patternEstSimpleEnroll, "/simpleenroll")
+}
+
+func pathEstSimpleReenroll(b *backend) []*framework.Path {
+	return buildEnrollFrameworkPaths(b, "est", patternEstSimpleReenroll, "/simplereenroll")
+}
+
+func patternEstCaCerts(b *backend, pattern string) *framework.Path {
+	fields := map[string]*framework.FieldSchema{}
+	addFieldsForEnrollPath(fields, pattern, "EST")
+
+	return &framework.Path{
+		Pattern: pattern,
+		Fields:  fields,
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.estWrapper(b.estCaCertsHandler),
+			},
+		},
+
+		HelpSynopsis:    pathEstHelpSync,
+		HelpDescription: pathEstHelpDesc,
+	}
+}
+
+func patternEstCsrAttrs(b *backend, pattern string) *framework.Path {
+	fields := map[string]*framework.FieldSchema{}
+	addFieldsForEnrollPath(fields, pattern, "EST")
+
+	return &framework.Path{
+		Pattern: pattern,
+		Fields:  fields,
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.estWrapper(b.estCsrAttrsHandler),
+			},
+		},
+
+		HelpSynopsis:    pathEstHelpSync,
+		HelpDescription: pathEstHelpDesc,
+	}
+}
+
+func patternEstSimpleEnroll(b *backend, pattern string) *framework.Path {
+	return buildEstEnrollPath(b, pattern, b.estSimpleEnrollHandler)
+}
+
+func patternEstSimpleReenroll(b *backend, pattern string) *framework.Path {
+	return buildEstEnrollPath(b, pattern, b.estSimpleReenrollHandler)
+}
+
+func buildEstEnrollPath(b *backend, pattern string, op enrollOperation) *framework.Path {
+	fields := map[string]*framework.FieldSchema{}
+	addFieldsForEnrollPath(fields, pattern, "EST")
+	fields["csr"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `PEM or base64 encoded CSR, used when the request is not sent with the application/pkcs10 content type.`,
+	}
+
+	return &framework.Path{
+		Pattern: pattern,
+		Fields:  fields,
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.estWrapper(op),
+				ForwardPerformanceSecondary: false,
+				ForwardPerformanceStandby:   true,
+			},
+		},
+
+		HelpSynopsis:    pathEstHelpSync,
+		HelpDescription: pathEstHelpDesc,
+	}
+}
+
+func (b *backend) estCaCertsHandler(enrollCtx *enrollContext, _ *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	certs, err := enrollCtx.caChain()
+	if err != nil {
+		return nil, err
+	}
+
+	return buildEstPkcs7Response(certs, estPkcs7ContentType)
+}
+
+func (b *backend) estCsrAttrsHandler(enrollCtx *enrollContext, _ *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	attrs, err := buildEstCsrAttrs(enrollCtx.role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode CSR attributes: %w", err)
+	}
+
+	// RFC 7030 Section 4.5.2: no attributes are signalled by an empty response.
+	if attrs == nil {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				logical.HTTPStatusCode: http.StatusNoContent,
+			},
+		}, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: estCsrAttrsContentType,
+			logical.HTTPStatusCode:  http.StatusOK,
+			logical.HTTPRawBody:     []byte(base64.StdEncoding.EncodeToString(attrs)),
+		},
+	}, nil
+}
+
+func (b *backend) estSimpleEnrollHandler(enrollCtx *enrollContext, r *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.estEnroll(enrollCtx, r, data, false)
+}
+
+func (b *backend) estSimpleReenrollHandler(enrollCtx *enrollContext, r *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.estEnroll(enrollCtx, r, data, true)
+}
+
+func (b *backend) estEnroll(enrollCtx *enrollContext, r *logical.Request, data *framework.FieldData, reenroll bool) (*logical.Response, error) {
+	body, err := fetchEstRequestBody(r, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	csr, err := parseEstCsr(body)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if reenroll {
+		if err := validateEstReenrollment(enrollCtx.sc, r, csr); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	parsedBundle, err := enrollCtx.issueCertFromCsr(r, csr)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+
+	b.Logger().Debug("issued certificate over EST", "serial_number", serialFromCert(parsedBundle.Certificate), "reenroll", reenroll)
+
+	return buildEstPkcs7Response([]*x509.Certificate{parsedBundle.Certificate}, estEnrollContentType)
+}
+
+func buildEstPkcs7Response(certs []*x509.Certificate, contentType string) (*logical.Response, error) {
+	pkcs7, err := buildCertsOnlyPkcs7(certs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: contentType,
+			logical.HTTPStatusCode:  http.StatusOK,
+			logical.HTTPRawBody:     []byte(base64.StdEncoding.EncodeToString(pkcs7)),
+		},
+	}, nil
+}
+
+// fetchEstRequestBody returns the CSR of an enrollment request. EST clients
+// post it as the raw body with the application/pkcs10 content type; other
+// clients may pass it in the csr field instead.
+func fetchEstRequestBody(r *logical.Request, data *framework.FieldData) ([]byte, error) {
+	if r.HTTPRequest == nil || r.HTTPRequest.Body == nil {
+		return []byte(data.Get("csr").(string)), nil
+	}
+
+	rawBody := r.HTTPRequest.Body
+	defer rawBody.Close()
+
+	body, err := io.ReadAll(io.LimitReader(rawBody, maxEstRequestSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) >= maxEstRequestSize {
+		return nil, errors.New("request is too large")
+	}
+
+	return body, nil
+}
+
+// validateEstReenrollment checks the conditions RFC 7030 Section 4.2.2 places
+// on re-enrollment: the client authenticates with the certificate being
+// renewed, which must have been issued by this mount and still be valid, and
+// the new request keeps its subject and subject alternative names.
+func validateEstReenrollment(sc *storageContext, r *logical.Request, csr *x509.CertificateRequest) error {
+	if r.Connection == nil || r.Connection.ConnState == nil || len(r.Connection.ConnState.PeerCertificates) == 0 {
+		return errors.New("re-enrollment requires the current certificate to be presented as the TLS client certificate")
+	}
+
+	return validateEnrollRenewal(sc, r.Connection.ConnState.PeerCertificates[0], csr)
+}
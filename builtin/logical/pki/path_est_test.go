@@ -0,0 +1,377 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/credential/cert"
+	"github.com/hashicorp/vault/builtin/credential/userpass"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEst_Config(t *testing.T) {
+	t.Parallel()
+	b, s := CreateBackendWithStorage(t)
+
+	resp, err := CBRead(b, s, "config/est")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, false, resp.Data["enabled"])
+	require.Equal(t, "sign-verbatim", resp.Data["default_path_policy"])
+
+	for _, data := range []map[string]interface{}{
+		{"default_path_policy": "role:missing"},
+		{"default_path_policy": "bad"},
+		{"authenticators": map[string]interface{}{"ldap": map[string]interface{}{"accessor": "auth_ldap_1234"}}},
+		{"authenticators": map[string]interface{}{"userpass": map[string]interface{}{}}},
+		{"authenticators": map[string]interface{}{"userpass": map[string]interface{}{"accessor": "auth_userpass_1234", "cert_role": "web"}}},
+	} {
+		_, err = CBWrite(b, s, "config/est", data)
+		require.Error(t, err, data)
+	}
+
+	resp, err = CBWrite(b, s, "config/est", map[string]interface{}{
+		"enabled": true,
+		"authenticators": map[string]interface{}{
+			"cert":     map[string]interface{}{"accessor": "auth_cert_1234", "cert_role": "devices"},
+			"userpass": map[string]interface{}{"accessor": "auth_userpass_1234"},
+		},
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	resp, err = CBRead(b, s, "config/est")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["enabled"])
+	require.Equal(t, map[string]interface{}{
+		"cert":     map[string]interface{}{"accessor": "auth_cert_1234", "cert_role": "devices"},
+		"userpass": map[string]interface{}{"accessor": "auth_userpass_1234"},
+	}, resp.Data["authenticators"])
+}
+
+func TestEst_Backend(t *testing.T) {
+	t.Parallel()
+	b, s := CreateBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"key_type":    "ec",
+		"ttl":         "720h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootCert := parseCert(t, resp.Data["certificate"].(string))
+
+	resp, err = CBWrite(b, s, "roles/devices", map[string]interface{}{
+		"allowed_domains":  "devices.example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"key_bits":         384,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	key, csr := generateEstCsr(t, "sensor1.devices.example.com")
+
+	// EST is disabled by default.
+	_, err = CBRead(b, s, "est/cacerts")
+	require.Error(t, err)
+
+	resp, err = CBWrite(b, s, "config/est", map[string]interface{}{"enabled": true})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	resp, err = CBRead(b, s, "est/cacerts")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "application/pkcs7-mime", resp.Data[logical.HTTPContentType])
+	certs := parseEstPkcs7(t, resp.Data[logical.HTTPRawBody].([]byte))
+	require.Len(t, certs, 1)
+	require.Equal(t, rootCert.Raw, certs[0].Raw)
+
+	resp, err = CBRead(b, s, "est/csrattrs")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, http.StatusNoContent, resp.Data[logical.HTTPStatusCode])
+
+	resp, err = CBRead(b, s, "roles/devices/est/csrattrs")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "application/csrattrs", resp.Data[logical.HTTPContentType])
+	attrs, err := base64.StdEncoding.DecodeString(string(resp.Data[logical.HTTPRawBody].([]byte)))
+	require.NoError(t, err)
+	var parsedAttrs []estAttribute
+	_, err = asn1.Unmarshal(attrs, &parsedAttrs)
+	require.NoError(t, err)
+	require.Equal(t, []estAttribute{{Type: oidEcPublicKey, Values: []asn1.ObjectIdentifier{oidNamedCurveP384}}}, parsedAttrs)
+
+	_, err = CBRead(b, s, "roles/unknown/est/cacerts")
+	require.Error(t, err)
+
+	// The role rejects the P-256 key of the request.
+	_, err = CBWrite(b, s, "roles/devices/est/simpleenroll", map[string]interface{}{"csr": csr})
+	require.Error(t, err)
+
+	// The default path signs verbatim, with the CSR read from the raw body.
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "est/simpleenroll",
+		Storage:     s,
+		HTTPRequest: &http.Request{Body: io.NopCloser(strings.NewReader(csr))},
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "application/pkcs7-mime; smime-type=certs-only", resp.Data[logical.HTTPContentType])
+	certs = parseEstPkcs7(t, resp.Data[logical.HTTPRawBody].([]byte))
+	require.Len(t, certs, 1)
+	leaf := certs[0]
+	requireSignedBy(t, leaf, rootCert)
+	requireMatchingPublicKeys(t, leaf, key.Public())
+	require.Equal(t, "sensor1.devices.example.com", leaf.Subject.CommonName)
+
+	resp, err = CBRead(b, s, "cert/"+serialFromCert(leaf))
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// Re-enrollment requires the current certificate on the TLS connection,
+	// with a matching subject.
+	reenroll := func(csr string, peer *x509.Certificate) (*logical.Response, error) {
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "est/simplereenroll",
+			Storage:   s,
+			Data:      map[string]interface{}{"csr": csr},
+		}
+		if peer != nil {
+			req.Connection = &logical.Connection{ConnState: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}}}
+		}
+		return b.HandleRequest(ctx, req)
+	}
+
+	resp, err = reenroll(csr, nil)
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	resp, err = reenroll(csr, rootCert)
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	_, otherCsr := generateEstCsr(t, "sensor2.devices.example.com")
+	resp, err = reenroll(otherCsr, leaf)
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	_, renewedCsr := generateEstCsr(t, "sensor1.devices.example.com")
+	resp, err = reenroll(renewedCsr, leaf)
+	requireSuccessNonNilResponse(t, resp, err)
+	certs = parseEstPkcs7(t, resp.Data[logical.HTTPRawBody].([]byte))
+	require.Equal(t, leaf.Subject.String(), certs[0].Subject.String())
+
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{"serial_number": serialFromCert(leaf)})
+	requireSuccessNonNilResponse(t, resp, err)
+	resp, err = reenroll(renewedCsr, leaf)
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	// Forbidding the default path leaves the role-qualified paths usable.
+	resp, err = CBWrite(b, s, "config/est", map[string]interface{}{"default_path_policy": "forbid"})
+	requireSuccessNonNilResponse(t, resp, err)
+	_, err = CBWrite(b, s, "est/simpleenroll", map[string]interface{}{"csr": csr})
+	require.Error(t, err)
+
+	_, csr = generateEstCsrWithCurve(t, "sensor3.devices.example.com", elliptic.P384())
+	resp, err = CBWrite(b, s, "roles/devices/est/simpleenroll", map[string]interface{}{"csr": csr})
+	requireSuccessNonNilResponse(t, resp, err)
+}
+
+func TestEst_Authenticators(t *testing.T) {
+	t.Parallel()
+
+	cluster := vault.NewTestCluster(t, &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki": Factory,
+		},
+		CredentialBackends: map[string]logical.Factory{
+			"cert":     cert.Factory,
+			"userpass": userpass.Factory,
+		},
+	}, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+	client := cluster.Cores[0].Client
+	mountPKIEndpoint(t, client, "pki")
+
+	resp, err := client.Logical().Write("pki/root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"key_type":    "ec",
+		"ttl":         "32h",
+	})
+	require.NoError(t, err)
+	rootPem := resp.Data["certificate"].(string)
+	rootCert := parseCert(t, rootPem)
+
+	_, err = client.Logical().Write("pki/roles/devices", map[string]interface{}{
+		"allowed_domains":  "devices.example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, client.Sys().PutPolicy("est", `path "pki/roles/devices/est/*" { capabilities = ["update"] }`))
+
+	require.NoError(t, client.Sys().EnableAuthWithOptions("userpass", &api.EnableAuthOptions{Type: "userpass"}))
+	_, err = client.Logical().Write("auth/userpass/users/sensor", map[string]interface{}{
+		"password":   "hunter2",
+		"policies":   "est",
+		"token_type": "batch",
+	})
+	require.NoError(t, err)
+	_, err = client.Logical().Write("auth/userpass/users/gateway", map[string]interface{}{
+		"password": "hunter3",
+		"policies": "est",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, client.Sys().EnableAuthWithOptions("cert", &api.EnableAuthOptions{Type: "cert"}))
+	_, err = client.Logical().Write("auth/cert/certs/devices", map[string]interface{}{
+		"certificate": rootPem,
+		"policies":    "est",
+		"token_type":  "batch",
+	})
+	require.NoError(t, err)
+
+	auths, err := client.Sys().ListAuth()
+	require.NoError(t, err)
+	_, err = client.Logical().Write("pki/config/est", map[string]interface{}{
+		"enabled": true,
+		"authenticators": map[string]interface{}{
+			"cert":     map[string]interface{}{"accessor": auths["cert/"].Accessor, "cert_role": "devices"},
+			"userpass": map[string]interface{}{"accessor": auths["userpass/"].Accessor},
+		},
+	})
+	require.NoError(t, err)
+
+	baseURL := fmt.Sprintf("https://%s/v1/pki/", cluster.Cores[0].Listeners[0].Address.String())
+	estRequest := func(method, path, body string, clientCert *tls.Certificate, setAuth func(*http.Request)) (int, []byte) {
+		tlsConfig := &tls.Config{RootCAs: cluster.Cores[0].TLSConfig().RootCAs}
+		if clientCert != nil {
+			// The listener only advertises the cluster CA as acceptable, so
+			// present the certificate regardless.
+			tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return clientCert, nil
+			}
+		}
+		transport := cleanhttp.DefaultTransport()
+		transport.TLSClientConfig = tlsConfig
+		httpClient := &http.Client{Transport: transport}
+
+		req, err := http.NewRequest(method, baseURL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/pkcs10")
+		}
+		if setAuth != nil {
+			setAuth(req)
+		}
+		resp, err := httpClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, respBody
+	}
+	basicAuth := func(user, password string) func(*http.Request) {
+		return func(req *http.Request) { req.SetBasicAuth(user, password) }
+	}
+
+	// cacerts is served without authentication.
+	status, body := estRequest(http.MethodGet, "est/cacerts", "", nil, nil)
+	require.Equal(t, http.StatusOK, status)
+	certs := parseEstPkcs7(t, body)
+	require.Equal(t, rootCert.Raw, certs[0].Raw)
+
+	key, csr := generateEstCsr(t, "sensor1.devices.example.com")
+
+	// Clients are challenged for HTTP Basic credentials.
+	status, _ = estRequest(http.MethodPost, "roles/devices/est/simpleenroll", csr, nil, nil)
+	require.Equal(t, http.StatusUnauthorized, status)
+
+	status, _ = estRequest(http.MethodPost, "roles/devices/est/simpleenroll", csr, nil, basicAuth("sensor", "wrong"))
+	require.Equal(t, http.StatusUnauthorized, status)
+
+	// The token obtained through userpass is still subject to its policies.
+	status, _ = estRequest(http.MethodPost, "est/simpleenroll", csr, nil, basicAuth("sensor", "hunter2"))
+	require.Equal(t, http.StatusForbidden, status)
+
+	status, body = estRequest(http.MethodPost, "roles/devices/est/simpleenroll", csr, nil, basicAuth("sensor", "hunter2"))
+	require.Equal(t, http.StatusOK, status, string(body))
+	leaf := parseEstPkcs7(t, body)[0]
+	requireSignedBy(t, leaf, rootCert)
+
+	// Service tokens are revoked once the enrollment is done.
+	_, gatewayCsr := generateEstCsr(t, "gateway.devices.example.com")
+	status, body = estRequest(http.MethodPost, "roles/devices/est/simpleenroll", gatewayCsr, nil, basicAuth("gateway", "hunter3"))
+	require.Equal(t, http.StatusOK, status, string(body))
+	leases, err := client.Logical().List("sys/leases/lookup/auth/userpass/login/gateway")
+	require.NoError(t, err)
+	require.Nil(t, leases)
+
+	// The issued certificate authenticates re-enrollment through cert auth.
+	clientCert := &tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: key}
+	_, renewedCsr := generateEstCsr(t, "sensor1.devices.example.com")
+	status, body = estRequest(http.MethodPost, "roles/devices/est/simplereenroll", renewedCsr, clientCert, nil)
+	require.Equal(t, http.StatusOK, status, string(body))
+	renewed := parseEstPkcs7(t, body)[0]
+	require.Equal(t, leaf.Subject.String(), renewed.Subject.String())
+	require.NotEqual(t, leaf.SerialNumber, renewed.SerialNumber)
+}
+
+func generateEstCsr(t *testing.T, commonName string) (crypto.Signer, string) {
+	return generateEstCsrWithCurve(t, commonName, elliptic.P256())
+}
+
+func generateEstCsrWithCurve(t *testing.T, commonName string, curve elliptic.Curve) (crypto.Signer, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: []string{commonName},
+	}, key)
+	require.NoError(t, err)
+	return key, base64.StdEncoding.EncodeToString(der)
+}
+
+func parseEstPkcs7(t *testing.T, body []byte) []*x509.Certificate {
+	t.Helper()
+
+	der, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(body)))
+	require.NoError(t, err)
+
+	var contentInfo pkcs7ContentInfo
+	_, err = asn1.Unmarshal(der, &contentInfo)
+	require.NoError(t, err)
+	require.True(t, contentInfo.ContentType.Equal(oidPkcs7SignedData))
+
+	var signedData pkcs7SignedData
+	_, err = asn1.Unmarshal(contentInfo.Content.Bytes, &signedData)
+	require.NoError(t, err)
+
+	certs, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+	require.NoError(t, err)
+	return certs
+}
@@ -0,0 +1,314 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/pkcs7"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// A SCEP pkiMessage carries a PKCS#10 request and the client's
+	// certificate; anything past this is rejected before parsing.
+	maxScepRequestSize = 64 * 1024
+
+	scepCaCertContentType     = "application/x-x509-ca-cert"
+	scepPkiMessageContentType = "application/x-pki-message"
+
+	// The capabilities advertised in the GetCACaps response, RFC 8894
+	// Section 3.5.2.
+	scepCaCaps = "POSTPKIOperation\nRenewal\nSHA-256\nAES\nSCEPStandard\n"
+
+	pathScepHelpSync = `An endpoint implementing the SCEP (RFC 8894) protocol`
+	pathScepHelpDesc = `This endpoint implements the Simple Certificate Enrolment Protocol
+for the GetCACaps, GetCACert and PKIOperation operations. It is
+unauthenticated; initial enrollment requests are authorized by a challenge
+password created through the new-challenge endpoint, renewal requests by the
+certificate being renewed.`
+)
+
+var ErrScepDisabled = errors.New("SCEP is disabled on this mount")
+
+// scepError rejects a SCEP request with a CertRep carrying the failInfo,
+// rather than with an HTTP error.
+type scepError struct {
+	FailInfo string
+	Err      error
+}
+
+func (e *scepError) Error() string {
+	return e.Err.Error()
+}
+
+// scepWrapper validates the SCEP configuration and resolves the role and
+// issuer the request path maps onto before handing off to the operation.
+func (b *backend) scepWrapper(op enrollOperation) framework.OperationFunc {
+	return func(ctx context.Context, r *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		sc := b.makeStorageContext(ctx, r.Storage)
+
+		config, err := sc.getScepConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch SCEP configuration: %w", err)
+		}
+
+		if !config.Enabled {
+			return nil, logical.CodedError(http.StatusNotFound, ErrScepDisabled.Error())
+		}
+
+		if b.useLegacyBundleCaStorage() {
+			return nil, fmt.Errorf("can not perform SCEP operations until migration has completed")
+		}
+
+		enrollCtx, err := getEnrollContext(sc, data, "SCEP", config.DefaultPathPolicy)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		return op(enrollCtx, r, data)
+	}
+}
+
+func pathScep(b *backend) []*framework.Path {
+	// Many clients append the CGI name of the original SCEP implementation
+	// to the URL they are configured with.
+	return append(buildEnrollFrameworkPaths(b, "scep", patternScep, ""),
+		buildEnrollFrameworkPaths(b, "scep", patternScep, `/pkiclient\.exe`)...)
+}
+
+func patternScep(b *backend, pattern string) *framework.Path {
+	fields := map[string]*framework.FieldSchema{}
+	addFieldsForEnrollPath(fields, pattern, "SCEP")
+	fields["operation"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `The SCEP operation: GetCACaps, GetCACert or PKIOperation`,
+		Query:       true,
+	}
+	fields["message"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `The base64 encoded pkiMessage of a PKIOperation, when it is not sent as the request body`,
+		Query:       true,
+	}
+
+	return &framework.Path{
+		Pattern: pattern,
+		Fields:  fields,
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback:                    b.scepWrapper(b.scepHandler),
+				ForwardPerformanceSecondary: false,
+				ForwardPerformanceStandby:   true,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.scepWrapper(b.scepHandler),
+				ForwardPerformanceSecondary: false,
+				ForwardPerformanceStandby:   true,
+			},
+		},
+
+		HelpSynopsis:    pathScepHelpSync,
+		HelpDescription: pathScepHelpDesc,
+	}
+}
+
+func (b *backend) scepHandler(enrollCtx *enrollContext, r *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	operation := data.Get("operation").(string)
+	if operation == "" && r.HTTPRequest != nil && r.HTTPRequest.URL != nil {
+		// POSTed PKIOperations carry the operation in the query string,
+		// which is not parsed for requests with a body.
+		operation = r.HTTPRequest.URL.Query().Get("operation")
+	}
+
+	switch operation {
+	case "GetCACaps":
+		return &logical.Response{
+			Data: map[string]interface{}{
+				logical.HTTPContentType: "text/plain",
+				logical.HTTPStatusCode:  http.StatusOK,
+				logical.HTTPRawBody:     []byte(scepCaCaps),
+			},
+		}, nil
+	case "GetCACert":
+		return b.scepGetCaCert(enrollCtx)
+	case "PKIOperation":
+		return b.scepPkiOperation(enrollCtx, r, data)
+	default:
+		return logical.ErrorResponse("unsupported SCEP operation %q", operation), nil
+	}
+}
+
+// scepGetCaCert returns the issuer certificate, which SCEP clients encrypt
+// their requests to and verify the responses with; Vault acts as the CA
+// without a separate RA certificate.
+func (b *backend) scepGetCaCert(enrollCtx *enrollContext) (*logical.Response, error) {
+	cert, err := parseCertificateFromBytes([]byte(enrollCtx.issuer.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse issuer certificate: %w", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: scepCaCertContentType,
+			logical.HTTPStatusCode:  http.StatusOK,
+			logical.HTTPRawBody:     cert.Raw,
+		},
+	}, nil
+}
+
+func (b *backend) scepPkiOperation(enrollCtx *enrollContext, r *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	message, err := fetchScepMessage(r, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	req, err := parseScepRequest(message)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	signingBundle, err := enrollCtx.fetchSigningBundle()
+	if err != nil {
+		return nil, err
+	}
+
+	// The request content is encrypted to the CA certificate, which requires
+	// a key Vault can decrypt with directly.
+	caKey, ok := signingBundle.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return logical.ErrorResponse("SCEP requires an issuer with an RSA key which is not a managed key"), nil
+	}
+	caCert := signingBundle.Certificate
+
+	var rep []byte
+	issued, err := b.scepEnroll(enrollCtx, r, req, caCert, caKey)
+	var scepErr *scepError
+	switch {
+	case errors.As(err, &scepErr):
+		b.Logger().Debug("rejected SCEP request", "transaction_id", req.TransactionID, "fail_info", scepErr.FailInfo, "error", scepErr.Err)
+		rep, err = buildScepCertRep(req, caCert, caKey, nil, scepErr.FailInfo, scepErr.Error())
+	case err != nil:
+		return nil, err
+	default:
+		b.Logger().Debug("issued certificate over SCEP", "serial_number", serialFromCert(issued), "transaction_id", req.TransactionID, "message_type", req.MessageType)
+		rep, err = buildScepCertRep(req, caCert, caKey, issued, "", "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: scepPkiMessageContentType,
+			logical.HTTPStatusCode:  http.StatusOK,
+			logical.HTTPRawBody:     rep,
+		},
+	}, nil
+}
+
+// scepEnroll processes PKCSReq and RenewalReq messages. Requests are rejected
+// with a scepError; other errors are internal.
+func (b *backend) scepEnroll(enrollCtx *enrollContext, r *logical.Request, req *scepRequest, caCert *x509.Certificate, caKey *rsa.PrivateKey) (*x509.Certificate, error) {
+	switch req.MessageType {
+	case scepPKCSReq, scepRenewalReq:
+	case scepCertPoll, scepGetCert, scepGetCRL:
+		return nil, &scepError{FailInfo: scepFailBadRequest, Err: fmt.Errorf("SCEP message type %s is not supported", req.MessageType)}
+	default:
+		return nil, &scepError{FailInfo: scepFailBadRequest, Err: fmt.Errorf("unknown SCEP message type %s", req.MessageType)}
+	}
+
+	content, err := req.decryptContent(caCert, caKey)
+	if err != nil {
+		if errors.Is(err, pkcs7.ErrUnsupportedAlgorithm) {
+			return nil, &scepError{FailInfo: scepFailBadAlg, Err: err}
+		}
+		return nil, &scepError{FailInfo: scepFailBadMessageCheck, Err: err}
+	}
+
+	csr, err := x509.ParseCertificateRequest(content)
+	if err != nil {
+		return nil, &scepError{FailInfo: scepFailBadRequest, Err: fmt.Errorf("failed to parse certificate request: %w", err)}
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, &scepError{FailInfo: scepFailBadMessageCheck, Err: fmt.Errorf("invalid certificate request signature: %w", err)}
+	}
+
+	if req.MessageType == scepRenewalReq {
+		// Renewal requests are signed with the certificate being renewed.
+		if err := validateEnrollRenewal(enrollCtx.sc, req.Signer, csr); err != nil {
+			return nil, &scepError{FailInfo: scepFailBadRequest, Err: err}
+		}
+	} else {
+		password, err := scepCsrChallengePassword(csr)
+		if err != nil {
+			return nil, &scepError{FailInfo: scepFailBadRequest, Err: err}
+		}
+		if password == "" {
+			return nil, &scepError{FailInfo: scepFailBadRequest, Err: errors.New("certificate request has no challenge password")}
+		}
+
+		scepPath, err := getEnrollPath(r, "scep")
+		if err != nil {
+			return nil, err
+		}
+		if err := enrollCtx.sc.consumeScepChallenge(password, scepPath); err != nil {
+			return nil, &scepError{FailInfo: scepFailBadRequest, Err: err}
+		}
+	}
+
+	parsedBundle, err := enrollCtx.issueCertFromCsr(r, csr)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return nil, &scepError{FailInfo: scepFailBadRequest, Err: err}
+		default:
+			return nil, err
+		}
+	}
+
+	return parsedBundle.Certificate, nil
+}
+
+// fetchScepMessage returns the pkiMessage of a PKIOperation: the body of POST
+// requests, or the base64 encoded message parameter of GET requests.
+func fetchScepMessage(r *logical.Request, data *framework.FieldData) ([]byte, error) {
+	if r.Operation == logical.UpdateOperation && r.HTTPRequest != nil && r.HTTPRequest.Body != nil {
+		rawBody := r.HTTPRequest.Body
+		defer rawBody.Close()
+
+		body, err := io.ReadAll(io.LimitReader(rawBody, maxScepRequestSize))
+		if err != nil {
+			return nil, err
+		}
+		if len(body) >= maxScepRequestSize {
+			return nil, errors.New("request is too large")
+		}
+
+		return body, nil
+	}
+
+	// Clients do not always escape the '+' of the base64 alphabet in the
+	// query string, in which case it arrives as a space.
+	message := strings.ReplaceAll(data.Get("message").(string), " ", "+")
+	if message == "" {
+		return nil, errors.New("no SCEP message was provided")
+	}
+
+	der, err := base64.StdEncoding.DecodeString(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode SCEP message: %w", err)
+	}
+
+	return der, nil
+}
@@ -0,0 +1,354 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const scepChallengePrefix = "scep/challenges/"
+
+/*
+ * These are VAULT APIs to manage the SCEP challenge passwords, the SCEP
+ * counterpart of the ACME External Account Bindings. They are not used by
+ * SCEP clients themselves.
+ */
+func pathScepChallengeList(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "scep/challenges/?$",
+		Fields:  map[string]*framework.FieldSchema{},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathScepListChallenges,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationPrefix: operationPrefixPKI,
+					OperationVerb:   "list-scep-challenges",
+					Description:     "List all SCEP challenge password identifiers yet to be used.",
+				},
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"keys": {
+								Type:        framework.TypeStringSlice,
+								Description: `A list of unused challenge password identifiers`,
+								Required:    true,
+							},
+							"key_info": {
+								Type:        framework.TypeMap,
+								Description: `Challenge password details keyed by identifier`,
+								Required:    false,
+							},
+						},
+					}},
+				},
+			},
+		},
+
+		HelpSynopsis:    "list challenge passwords to be used for SCEP",
+		HelpDescription: `list identifiers of challenge passwords that have been generated but yet to be used.`,
+	}
+}
+
+func pathScepNewChallenge(b *backend) []*framework.Path {
+	return buildEnrollFrameworkPaths(b, "scep", patternScepNewChallenge, "/new-challenge")
+}
+
+func patternScepNewChallenge(b *backend, pattern string) *framework.Path {
+	fields := map[string]*framework.FieldSchema{}
+	addFieldsForEnrollPath(fields, pattern, "SCEP")
+
+	opSuffix := getAcmeOperationSuffix(pattern)
+
+	return &framework.Path{
+		Pattern: pattern,
+		Fields:  fields,
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.pathScepCreateChallenge,
+				ForwardPerformanceSecondary: false,
+				ForwardPerformanceStandby:   true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationPrefix: operationPrefixPKI,
+					OperationVerb:   "generate-scep-challenge",
+					OperationSuffix: opSuffix,
+					Description:     "Generate a SCEP challenge password for a SCEP path",
+				},
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"id": {
+								Type:        framework.TypeString,
+								Description: `The challenge password identifier`,
+								Required:    true,
+							},
+							"challenge_password": {
+								Type:        framework.TypeString,
+								Description: `The challenge password to place in the certificate request`,
+								Required:    true,
+							},
+							"scep_path": {
+								Type:        framework.TypeString,
+								Description: `The SCEP path to which the challenge password belongs`,
+								Required:    true,
+							},
+							"created_on": {
+								Type:        framework.TypeTime,
+								Description: `An RFC3339 formatted date time when the challenge password was created`,
+								Required:    true,
+							},
+						},
+					}},
+				},
+			},
+		},
+
+		HelpSynopsis:    "Generate challenge passwords to be used for SCEP",
+		HelpDescription: `Generate single use challenge passwords for SCEP enrollment requests.`,
+	}
+}
+
+func pathScepChallengeDelete(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "scep/challenges/" + uuidNameRegex("challenge_id"),
+
+		Fields: map[string]*framework.FieldSchema{
+			"challenge_id": {
+				Type:        framework.TypeString,
+				Description: "SCEP challenge password identifier",
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback:                    b.pathScepDeleteChallenge,
+				ForwardPerformanceSecondary: false,
+				ForwardPerformanceStandby:   true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationPrefix: operationPrefixPKI,
+					OperationVerb:   "delete-scep-challenge",
+					Description:     "Delete an unused SCEP challenge password",
+				},
+			},
+		},
+
+		HelpSynopsis: "Delete a SCEP challenge password prior to its use",
+		HelpDescription: `Allows an operator to delete a SCEP challenge password before it is
+used in an enrollment request. If the identifier provided does not exist or
+was already used a successful response is returned along with a warning that
+it did not exist.`,
+	}
+}
+
+type scepChallenge struct {
+	ID        string    `json:"-"`
+	Secret    []byte    `json:"secret"`
+	ScepPath  string    `json:"scep-path"`
+	CreatedOn time.Time `json:"created-on"`
+}
+
+// Password returns the challenge password handed out to the operator. It
+// carries the identifier so that it can be looked up directly, and only uses
+// characters valid in the PrintableString SCEP clients encode it as.
+func (c *scepChallenge) Password() string {
+	return c.ID + "." + hex.EncodeToString(c.Secret)
+}
+
+func (sc *storageContext) saveScepChallenge(challenge *scepChallenge) error {
+	json, err := logical.StorageEntryJSON(path.Join(scepChallengePrefix, challenge.ID), challenge)
+	if err != nil {
+		return err
+	}
+	return sc.Storage.Put(sc.Context, json)
+}
+
+func (sc *storageContext) loadScepChallenge(id string) (*scepChallenge, error) {
+	rawEntry, err := sc.Storage.Get(sc.Context, path.Join(scepChallengePrefix, id))
+	if err != nil {
+		return nil, err
+	}
+	if rawEntry == nil {
+		return nil, fmt.Errorf("%w: no scep challenge found for id %s", ErrStorageItemNotFound, id)
+	}
+
+	var challenge scepChallenge
+	if err := rawEntry.DecodeJSON(&challenge); err != nil {
+		return nil, err
+	}
+
+	challenge.ID = id
+	return &challenge, nil
+}
+
+func (sc *storageContext) deleteScepChallenge(id string) (bool, error) {
+	rawEntry, err := sc.Storage.Get(sc.Context, path.Join(scepChallengePrefix, id))
+	if err != nil {
+		return false, err
+	}
+	if rawEntry == nil {
+		return false, nil
+	}
+
+	if err := sc.Storage.Delete(sc.Context, path.Join(scepChallengePrefix, id)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (sc *storageContext) listScepChallengeIds() ([]string, error) {
+	entries, err := sc.Storage.List(sc.Context, scepChallengePrefix)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, "/") {
+			continue
+		}
+		ids = append(ids, entry)
+	}
+
+	return ids, nil
+}
+
+// consumeScepChallenge validates a challenge password sent by a SCEP client
+// for the given SCEP path and deletes it, so that it can not be used again.
+func (sc *storageContext) consumeScepChallenge(password string, scepPath string) error {
+	id, encodedSecret, found := strings.Cut(password, ".")
+	if !found {
+		return fmt.Errorf("malformed challenge password")
+	}
+	if _, err := uuid.ParseUUID(id); err != nil {
+		return fmt.Errorf("malformed challenge password")
+	}
+	secret, err := hex.DecodeString(encodedSecret)
+	if err != nil {
+		return fmt.Errorf("malformed challenge password")
+	}
+
+	challenge, err := sc.loadScepChallenge(id)
+	if err != nil {
+		return fmt.Errorf("unknown challenge password: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare(challenge.Secret, secret) != 1 {
+		return fmt.Errorf("invalid challenge password")
+	}
+	if challenge.ScepPath != scepPath {
+		return fmt.Errorf("challenge password was created for %s, not %s", challenge.ScepPath, scepPath)
+	}
+
+	// Like EABs, the challenge is deleted before issuance to prevent its
+	// re-use; should issuance fail, the operator creates another one.
+	deleted, err := sc.deleteScepChallenge(id)
+	if err != nil {
+		return fmt.Errorf("failed to delete challenge password: %w", err)
+	}
+	if !deleted {
+		return fmt.Errorf("challenge password was already used")
+	}
+
+	return nil
+}
+
+func (b *backend) pathScepListChallenges(ctx context.Context, r *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, r.Storage)
+
+	challengeIds, err := sc.listScepChallengeIds()
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	var keyIds []string
+	keyInfos := map[string]interface{}{}
+
+	for _, challengeId := range challengeIds {
+		challenge, err := sc.loadScepChallenge(challengeId)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed loading scep challenge %s: %v", challengeId, err))
+			continue
+		}
+
+		keyIds = append(keyIds, challenge.ID)
+		keyInfos[challenge.ID] = map[string]interface{}{
+			"scep_path":  challenge.ScepPath,
+			"created_on": challenge.CreatedOn.Format(time.RFC3339),
+		}
+	}
+
+	resp := logical.ListResponseWithInfo(keyIds, keyInfos)
+	for _, warning := range warnings {
+		resp.AddWarning(warning)
+	}
+	return resp, nil
+}
+
+func (b *backend) pathScepCreateChallenge(ctx context.Context, r *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	secret, err := uuid.GenerateRandomBytesWithReader(16, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating scep challenge: %w", err)
+	}
+
+	scepPath, err := getEnrollPath(r, "scep")
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := &scepChallenge{
+		ID:        genUuid(),
+		Secret:    secret,
+		ScepPath:  scepPath,
+		CreatedOn: time.Now(),
+	}
+
+	sc := b.makeStorageContext(ctx, r.Storage)
+	if err := sc.saveScepChallenge(challenge); err != nil {
+		return nil, fmt.Errorf("failed saving generated scep challenge: %w", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":                 challenge.ID,
+			"challenge_password": challenge.Password(),
+			"scep_path":          challenge.ScepPath,
+			"created_on":         challenge.CreatedOn.Format(time.RFC3339),
+		},
+	}, nil
+}
+
+func (b *backend) pathScepDeleteChallenge(ctx context.Context, r *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, r.Storage)
+	challengeId := d.Get("challenge_id").(string)
+
+	_, err := uuid.ParseUUID(challengeId)
+	if err != nil {
+		return nil, fmt.Errorf("badly formatted challenge_id field")
+	}
+
+	deleted, err := sc.deleteScepChallenge(challengeId)
+	if err != nil {
+		return nil, fmt.Errorf("failed deleting challenge id: %w", err)
+	}
+
+	resp := &logical.Response{}
+	if !deleted {
+		resp.AddWarning("No challenge found with id: " + challengeId)
+	}
+	return resp, nil
+}
@@ -0,0 +1,430 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/pkcs7"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScep_Config(t *testing.T) {
+	t.Parallel()
+	b, s := CreateBackendWithStorage(t)
+
+	resp, err := CBRead(b, s, "config/scep")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, false, resp.Data["enabled"])
+	require.Equal(t, "sign-verbatim", resp.Data["default_path_policy"])
+
+	_, err = CBWrite(b, s, "config/scep", map[string]interface{}{"default_path_policy": "role:unknown"})
+	require.Error(t, err)
+
+	resp, err = CBWrite(b, s, "config/scep", map[string]interface{}{
+		"enabled":             true,
+		"default_path_policy": "forbid",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	resp, err = CBRead(b, s, "config/scep")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["enabled"])
+	require.Equal(t, "forbid", resp.Data["default_path_policy"])
+}
+
+func TestScep_Backend(t *testing.T) {
+	t.Parallel()
+	b, s := CreateBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"key_type":    "rsa",
+		"ttl":         "720h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootCert := parseCert(t, resp.Data["certificate"].(string))
+
+	resp, err = CBWrite(b, s, "roles/devices", map[string]interface{}{
+		"allowed_domains":  "devices.example.com",
+		"allow_subdomains": true,
+		"key_type":         "rsa",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	scepRead := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+	}
+
+	// SCEP is disabled by default.
+	_, err = CBRead(b, s, "scep")
+	require.Error(t, err)
+
+	resp, err = CBWrite(b, s, "config/scep", map[string]interface{}{"enabled": true})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	resp, err = scepRead("scep/pkiclient.exe", map[string]interface{}{"operation": "GetCACaps"})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Contains(t, string(resp.Data[logical.HTTPRawBody].([]byte)), "POSTPKIOperation")
+
+	resp, err = scepRead("roles/devices/scep", map[string]interface{}{"operation": "GetCACert"})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "application/x-x509-ca-cert", resp.Data[logical.HTTPContentType])
+	require.Equal(t, rootCert.Raw, resp.Data[logical.HTTPRawBody])
+
+	resp, err = scepRead("scep", map[string]interface{}{"operation": "GetNextCACert"})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	// Challenge passwords are bound to the SCEP path they were created for.
+	resp, err = CBWrite(b, s, "roles/devices/scep/new-challenge", nil)
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "roles/devices/scep", resp.Data["scep_path"])
+	challengeId := resp.Data["id"].(string)
+	challenge := resp.Data["challenge_password"].(string)
+
+	resp, err = CBList(b, s, "scep/challenges")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{challengeId}, resp.Data["keys"])
+
+	pkiOperation := func(path string, message []byte) *logical.Response {
+		resp, err := CBWrite(b, s, path, map[string]interface{}{
+			"operation": "PKIOperation",
+			"message":   base64.StdEncoding.EncodeToString(message),
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		require.Equal(t, "application/x-pki-message", resp.Data[logical.HTTPContentType])
+		return resp
+	}
+
+	client := newScepTestClient(t, "sensor1.devices.example.com")
+
+	// A challenge for another path, an unknown challenge and no challenge
+	// are all rejected.
+	message := client.pkiMessage(t, rootCert, scepPKCSReq, client.csr(t, challenge))
+	rep := client.parseCertRep(t, pkiOperation("scep", message), rootCert)
+	require.Equal(t, scepStatusFailure, rep.status)
+	require.Equal(t, scepFailBadRequest, rep.failInfo)
+
+	message = client.pkiMessage(t, rootCert, scepPKCSReq, client.csr(t, challengeId+".00"))
+	rep = client.parseCertRep(t, pkiOperation("roles/devices/scep", message), rootCert)
+	require.Equal(t, scepStatusFailure, rep.status)
+
+	message = client.pkiMessage(t, rootCert, scepPKCSReq, client.csr(t, ""))
+	rep = client.parseCertRep(t, pkiOperation("roles/devices/scep", message), rootCert)
+	require.Equal(t, scepStatusFailure, rep.status)
+
+	message = client.pkiMessage(t, rootCert, scepPKCSReq, client.csr(t, challenge))
+	rep = client.parseCertRep(t, pkiOperation("roles/devices/scep/pkiclient.exe", message), rootCert)
+	require.Equal(t, scepStatusSuccess, rep.status)
+	leaf := rep.cert
+	requireSignedBy(t, leaf, rootCert)
+	requireMatchingPublicKeys(t, leaf, client.key.Public())
+	require.Equal(t, "sensor1.devices.example.com", leaf.Subject.CommonName)
+
+	resp, err = CBRead(b, s, "cert/"+serialFromCert(leaf))
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// The challenge password is single use.
+	resp, err = CBList(b, s, "scep/challenges")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Empty(t, resp.Data["keys"])
+
+	message = client.pkiMessage(t, rootCert, scepPKCSReq, client.csr(t, challenge))
+	rep = client.parseCertRep(t, pkiOperation("roles/devices/scep", message), rootCert)
+	require.Equal(t, scepStatusFailure, rep.status)
+
+	// Renewal requests are signed with the current certificate and keep its
+	// subject.
+	selfSigned := newScepTestClient(t, "sensor1.devices.example.com")
+	message = selfSigned.pkiMessage(t, rootCert, scepRenewalReq, selfSigned.csr(t, ""))
+	rep = selfSigned.parseCertRep(t, pkiOperation("roles/devices/scep", message), rootCert)
+	require.Equal(t, scepStatusFailure, rep.status)
+
+	renewing := &scepTestClient{key: client.key, cert: leaf, commonName: "sensor2.devices.example.com"}
+	message = renewing.pkiMessage(t, rootCert, scepRenewalReq, renewing.csr(t, ""))
+	rep = renewing.parseCertRep(t, pkiOperation("roles/devices/scep", message), rootCert)
+	require.Equal(t, scepStatusFailure, rep.status)
+
+	renewing.commonName = "sensor1.devices.example.com"
+	message = renewing.pkiMessage(t, rootCert, scepRenewalReq, renewing.csr(t, ""))
+	rep = renewing.parseCertRep(t, pkiOperation("roles/devices/scep", message), rootCert)
+	require.Equal(t, scepStatusSuccess, rep.status)
+	require.Equal(t, leaf.Subject.String(), rep.cert.Subject.String())
+	require.NotEqual(t, leaf.SerialNumber, rep.cert.SerialNumber)
+
+	// Challenges can be deleted before use; the message can also be passed
+	// to GET requests.
+	resp, err = CBWrite(b, s, "scep/new-challenge", nil)
+	requireSuccessNonNilResponse(t, resp, err)
+	challenge = resp.Data["challenge_password"].(string)
+	_, err = CBDelete(b, s, "scep/challenges/"+resp.Data["id"].(string))
+	require.NoError(t, err)
+
+	message = client.pkiMessage(t, rootCert, scepPKCSReq, client.csr(t, challenge))
+	resp, err = scepRead("scep", map[string]interface{}{
+		"operation": "PKIOperation",
+		"message":   base64.StdEncoding.EncodeToString(message),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rep = client.parseCertRep(t, resp, rootCert)
+	require.Equal(t, scepStatusFailure, rep.status)
+
+	// SCEP needs an RSA issuer to decrypt requests; the issuer key is checked
+	// before the message is decrypted.
+	resp, err = CBWrite(b, s, "issuers/generate/root/internal", map[string]interface{}{
+		"common_name": "ec-root.example.com",
+		"issuer_name": "ec-root",
+		"key_type":    "ec",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	message = client.pkiMessage(t, rootCert, scepPKCSReq, client.csr(t, challenge))
+	_, err = CBWrite(b, s, "issuer/ec-root/scep", map[string]interface{}{
+		"operation": "PKIOperation",
+		"message":   base64.StdEncoding.EncodeToString(message),
+	})
+	require.ErrorContains(t, err, "RSA")
+}
+
+func TestScep_HTTP(t *testing.T) {
+	t.Parallel()
+
+	cluster := vault.NewTestCluster(t, &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki": Factory,
+		},
+	}, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+	client := cluster.Cores[0].Client
+	mountPKIEndpoint(t, client, "pki")
+
+	resp, err := client.Logical().Write("pki/root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"key_type":    "rsa",
+		"ttl":         "32h",
+	})
+	require.NoError(t, err)
+	rootCert := parseCert(t, resp.Data["certificate"].(string))
+
+	_, err = client.Logical().Write("pki/config/scep", map[string]interface{}{"enabled": true})
+	require.NoError(t, err)
+
+	httpClient := &http.Client{Transport: cleanhttp.DefaultTransport()}
+	httpClient.Transport.(*http.Transport).TLSClientConfig = cluster.Cores[0].TLSConfig()
+	baseURL := client.Address() + "/v1/pki/scep/pkiclient.exe"
+
+	scepRequest := func(req *http.Request) (string, []byte) {
+		httpResp, err := httpClient.Do(req)
+		require.NoError(t, err)
+		defer httpResp.Body.Close()
+		body, err := io.ReadAll(httpResp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, httpResp.StatusCode, string(body))
+		return httpResp.Header.Get("Content-Type"), body
+	}
+
+	req, err := http.NewRequest(http.MethodGet, baseURL+"?operation=GetCACert", nil)
+	require.NoError(t, err)
+	contentType, body := scepRequest(req)
+	require.Equal(t, "application/x-x509-ca-cert", contentType)
+	require.Equal(t, rootCert.Raw, body)
+
+	scepClient := newScepTestClient(t, "sensor1.example.com")
+	for _, method := range []string{http.MethodPost, http.MethodGet} {
+		resp, err = client.Logical().Write("pki/scep/new-challenge", nil)
+		require.NoError(t, err)
+		message := scepClient.pkiMessage(t, rootCert, scepPKCSReq, scepClient.csr(t, resp.Data["challenge_password"].(string)))
+
+		if method == http.MethodPost {
+			req, err = http.NewRequest(method, baseURL+"?operation=PKIOperation", bytes.NewReader(message))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/x-pki-message")
+		} else {
+			query := url.Values{"operation": {"PKIOperation"}, "message": {base64.StdEncoding.EncodeToString(message)}}
+			req, err = http.NewRequest(method, baseURL+"?"+query.Encode(), nil)
+			require.NoError(t, err)
+		}
+
+		contentType, body = scepRequest(req)
+		require.Equal(t, "application/x-pki-message", contentType)
+		rep := scepClient.parseCertRep(t, &logical.Response{Data: map[string]interface{}{logical.HTTPRawBody: body}}, rootCert)
+		require.Equal(t, scepStatusSuccess, rep.status, method)
+		requireSignedBy(t, rep.cert, rootCert)
+	}
+}
+
+// scepTestClient builds SCEP requests the way SCEP clients do, signed with a
+// certificate for its key.
+type scepTestClient struct {
+	key        *rsa.PrivateKey
+	cert       *x509.Certificate
+	commonName string
+	nonce      []byte
+}
+
+type scepTestCertRep struct {
+	status   string
+	failInfo string
+	cert     *x509.Certificate
+}
+
+func newScepTestClient(t *testing.T, commonName string) *scepTestClient {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &scepTestClient{key: key, cert: cert, commonName: commonName}
+}
+
+// csr returns a PKCS#10 request for the client's key, with the challenge
+// password attribute when one is given. Go's x509 package can not encode
+// that attribute, so the request is assembled and signed here.
+func (c *scepTestClient) csr(t *testing.T, challenge string) []byte {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: c.commonName},
+		DNSNames: []string{c.commonName},
+	}, c.key)
+	require.NoError(t, err)
+	if challenge == "" {
+		return der
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+
+	var tbs struct {
+		Version       int
+		Subject       asn1.RawValue
+		PublicKey     asn1.RawValue
+		RawAttributes []asn1.RawValue `asn1:"tag:0"`
+	}
+	_, err = asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs)
+	require.NoError(t, err)
+
+	attr, err := asn1.Marshal(struct {
+		Type   asn1.ObjectIdentifier
+		Values []asn1.RawValue `asn1:"set"`
+	}{
+		Type:   oidChallengePassword,
+		Values: []asn1.RawValue{{Tag: asn1.TagPrintableString, Bytes: []byte(challenge)}},
+	})
+	require.NoError(t, err)
+	tbs.RawAttributes = append(tbs.RawAttributes, asn1.RawValue{FullBytes: attr})
+
+	tbsDer, err := asn1.Marshal(tbs)
+	require.NoError(t, err)
+	digest := sha256.Sum256(tbsDer)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	der, err = asn1.Marshal(struct {
+		TBS       asn1.RawValue
+		Algorithm pkix.AlgorithmIdentifier
+		Signature asn1.BitString
+	}{
+		TBS:       asn1.RawValue{FullBytes: tbsDer},
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, Parameters: asn1.NullRawValue},
+		Signature: asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+	require.NoError(t, err)
+
+	parsed, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+	require.NoError(t, parsed.CheckSignature())
+	return der
+}
+
+func (c *scepTestClient) pkiMessage(t *testing.T, caCert *x509.Certificate, messageType string, content []byte) []byte {
+	envelope, err := pkcs7.EncryptWithAlgorithm(content, []*x509.Certificate{caCert}, pkcs7.EncryptionAlgorithmAES256CBC)
+	require.NoError(t, err)
+
+	c.nonce = make([]byte, 16)
+	_, err = rand.Read(c.nonce)
+	require.NoError(t, err)
+
+	signedData, err := pkcs7.NewSignedData(envelope)
+	require.NoError(t, err)
+	err = signedData.AddSigner(c.cert, c.key, pkcs7.SignerInfoConfig{
+		ExtraSignedAttributes: []pkcs7.Attribute{
+			{Type: oidScepMessageType, Value: messageType},
+			{Type: oidScepTransactionID, Value: "transaction-" + c.commonName},
+			{Type: oidScepSenderNonce, Value: c.nonce},
+		},
+	})
+	require.NoError(t, err)
+
+	der, err := signedData.Finish()
+	require.NoError(t, err)
+	return der
+}
+
+func (c *scepTestClient) parseCertRep(t *testing.T, resp *logical.Response, caCert *x509.Certificate) *scepTestCertRep {
+	p7, err := pkcs7.Parse(resp.Data[logical.HTTPRawBody].([]byte))
+	require.NoError(t, err)
+	require.NoError(t, p7.Verify())
+	require.Equal(t, caCert.Raw, p7.GetOnlySigner().Raw)
+
+	var messageType, transactionId string
+	var recipientNonce []byte
+	require.NoError(t, p7.UnmarshalSignedAttribute(oidScepMessageType, &messageType))
+	require.NoError(t, p7.UnmarshalSignedAttribute(oidScepTransactionID, &transactionId))
+	require.NoError(t, p7.UnmarshalSignedAttribute(oidScepRecipientNonce, &recipientNonce))
+	require.Equal(t, scepCertRep, messageType)
+	require.Equal(t, "transaction-"+c.commonName, transactionId)
+	require.Equal(t, c.nonce, recipientNonce)
+
+	rep := &scepTestCertRep{}
+	require.NoError(t, p7.UnmarshalSignedAttribute(oidScepPkiStatus, &rep.status))
+	if rep.status != scepStatusSuccess {
+		require.NoError(t, p7.UnmarshalSignedAttribute(oidScepFailInfo, &rep.failInfo))
+		return rep
+	}
+
+	envelope, err := pkcs7.Parse(p7.Content)
+	require.NoError(t, err)
+	content, err := envelope.Decrypt(c.cert, c.key)
+	require.NoError(t, err)
+	degenerate, err := pkcs7.Parse(content)
+	require.NoError(t, err)
+	require.Len(t, degenerate.Certificates, 1)
+	rep.cert = degenerate.Certificates[0]
+
+	return rep
+}
@@ -0,0 +1,252 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package pki
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/pkcs7"
+)
+
+// SCEP message attributes, RFC 8894 Section 3.2.1.
+var (
+	oidScepMessageType    = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 2}
+	oidScepPkiStatus      = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 3}
+	oidScepFailInfo       = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 4}
+	oidScepSenderNonce    = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 5}
+	oidScepRecipientNonce = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 6}
+	oidScepTransactionID  = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 7}
+	oidScepFailInfoText   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 24, 1}
+
+	oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+
+	oidDesCbc    = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 7}
+	oidAes128Cbc = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAes256Cbc = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidAes128Gcm = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 6}
+	oidAes256Gcm = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 46}
+)
+
+// SCEP messageType values.
+const (
+	scepCertRep    = "3"
+	scepRenewalReq = "17"
+	scepPKCSReq    = "19"
+	scepCertPoll   = "20"
+	scepGetCert    = "21"
+	scepGetCRL     = "22"
+)
+
+// SCEP pkiStatus values.
+const (
+	scepStatusSuccess = "0"
+	scepStatusFailure = "2"
+)
+
+// SCEP failInfo values.
+const (
+	scepFailBadAlg          = "0"
+	scepFailBadMessageCheck = "1"
+	scepFailBadRequest      = "2"
+)
+
+// scepRequest is a parsed and verified SCEP pkiMessage.
+type scepRequest struct {
+	MessageType   string
+	TransactionID string
+	SenderNonce   []byte
+	// Signer is the certificate the request was signed with: a self-signed
+	// certificate for initial enrollment, or the certificate being renewed.
+	Signer *x509.Certificate
+	// EncryptionAlgorithm is the content encryption the client used, which is
+	// also used for the response.
+	EncryptionAlgorithm int
+	// envelope is the pkcsPKIEnvelope carrying the message content.
+	envelope []byte
+}
+
+// scepEnvelopedData is the part of the EnvelopedData structure of RFC 5652,
+// Section 6.1, needed to determine the client's content encryption.
+type scepEnvelopedData struct {
+	Version              int
+	RecipientInfos       asn1.RawValue
+	EncryptedContentInfo struct {
+		ContentType                asn1.ObjectIdentifier
+		ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	}
+}
+
+// parseScepRequest verifies the signature of a SCEP pkiMessage and decodes
+// its attributes, RFC 8894 Section 3.2.
+func parseScepRequest(der []byte) (*scepRequest, error) {
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SCEP message: %w", err)
+	}
+
+	signer := p7.GetOnlySigner()
+	if signer == nil {
+		return nil, errors.New("SCEP message must be signed by exactly one signer which includes its certificate")
+	}
+
+	if err := p7.Verify(); err != nil {
+		return nil, fmt.Errorf("failed to verify SCEP message signature: %w", err)
+	}
+
+	req := &scepRequest{
+		Signer:   signer,
+		envelope: p7.Content,
+	}
+	if err := p7.UnmarshalSignedAttribute(oidScepMessageType, &req.MessageType); err != nil {
+		return nil, fmt.Errorf("SCEP message is missing its messageType: %w", err)
+	}
+	if err := p7.UnmarshalSignedAttribute(oidScepTransactionID, &req.TransactionID); err != nil {
+		return nil, fmt.Errorf("SCEP message is missing its transactionID: %w", err)
+	}
+	if err := p7.UnmarshalSignedAttribute(oidScepSenderNonce, &req.SenderNonce); err != nil {
+		return nil, fmt.Errorf("SCEP message is missing its senderNonce: %w", err)
+	}
+
+	req.EncryptionAlgorithm = scepEncryptionAlgorithm(p7.Content)
+
+	return req, nil
+}
+
+// scepEncryptionAlgorithm maps the content encryption of the request onto the
+// one used for the response, defaulting to AES-128-CBC which the GetCACaps
+// response advertises.
+func scepEncryptionAlgorithm(envelope []byte) int {
+	var contentInfo pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(envelope, &contentInfo); err != nil {
+		return pkcs7.EncryptionAlgorithmAES128CBC
+	}
+	var envelopedData scepEnvelopedData
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &envelopedData); err != nil {
+		return pkcs7.EncryptionAlgorithmAES128CBC
+	}
+
+	alg := envelopedData.EncryptedContentInfo.ContentEncryptionAlgorithm.Algorithm
+	switch {
+	case alg.Equal(oidDesCbc):
+		return pkcs7.EncryptionAlgorithmDESCBC
+	case alg.Equal(oidAes256Cbc):
+		return pkcs7.EncryptionAlgorithmAES256CBC
+	case alg.Equal(oidAes128Gcm):
+		return pkcs7.EncryptionAlgorithmAES128GCM
+	case alg.Equal(oidAes256Gcm):
+		return pkcs7.EncryptionAlgorithmAES256GCM
+	default:
+		return pkcs7.EncryptionAlgorithmAES128CBC
+	}
+}
+
+// decryptContent returns the content of the request's pkcsPKIEnvelope, which
+// the client encrypted to the CA certificate.
+func (req *scepRequest) decryptContent(caCert *x509.Certificate, caKey crypto.PrivateKey) ([]byte, error) {
+	envelope, err := pkcs7.Parse(req.envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SCEP envelope: %w", err)
+	}
+
+	content, err := envelope.Decrypt(caCert, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt SCEP envelope: %w", err)
+	}
+
+	return content, nil
+}
+
+// scepCsrChallengePassword returns the challengePassword attribute of a
+// PKCS#10 request, RFC 2985 Section 5.4.1, or an empty string if it has none.
+func scepCsrChallengePassword(csr *x509.CertificateRequest) (string, error) {
+	var tbs struct {
+		Version       int
+		Subject       asn1.RawValue
+		PublicKey     asn1.RawValue
+		RawAttributes []asn1.RawValue `asn1:"tag:0"`
+	}
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		return "", fmt.Errorf("failed to parse certificate request attributes: %w", err)
+	}
+
+	for _, rawAttr := range tbs.RawAttributes {
+		var attr struct {
+			Type   asn1.ObjectIdentifier
+			Values []asn1.RawValue `asn1:"set"`
+		}
+		if _, err := asn1.Unmarshal(rawAttr.FullBytes, &attr); err != nil {
+			return "", fmt.Errorf("failed to parse certificate request attribute: %w", err)
+		}
+		if !attr.Type.Equal(oidChallengePassword) {
+			continue
+		}
+		if len(attr.Values) != 1 {
+			return "", errors.New("challengePassword attribute must have exactly one value")
+		}
+
+		var password string
+		if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &password); err != nil {
+			return "", fmt.Errorf("failed to parse challengePassword attribute: %w", err)
+		}
+		return password, nil
+	}
+
+	return "", nil
+}
+
+// buildScepCertRep builds the CertRep response to a request, RFC 8894 Section
+// 3.3.2, signed by the CA. On success, the issued certificate is encrypted to
+// the certificate the request was signed with.
+func buildScepCertRep(req *scepRequest, caCert *x509.Certificate, caKey crypto.PrivateKey, issued *x509.Certificate, failInfo string, failText string) ([]byte, error) {
+	senderNonce := make([]byte, 16)
+	if _, err := rand.Read(senderNonce); err != nil {
+		return nil, err
+	}
+
+	attrs := []pkcs7.Attribute{
+		{Type: oidScepMessageType, Value: scepCertRep},
+		{Type: oidScepTransactionID, Value: req.TransactionID},
+		{Type: oidScepSenderNonce, Value: senderNonce},
+		{Type: oidScepRecipientNonce, Value: req.SenderNonce},
+	}
+
+	var content []byte
+	if issued != nil {
+		degenerate, err := pkcs7.DegenerateCertificate(issued.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode issued certificate: %w", err)
+		}
+
+		content, err = pkcs7.EncryptWithAlgorithm(degenerate, []*x509.Certificate{req.Signer}, req.EncryptionAlgorithm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt SCEP response: %w", err)
+		}
+
+		attrs = append(attrs, pkcs7.Attribute{Type: oidScepPkiStatus, Value: scepStatusSuccess})
+	} else {
+		attrs = append(attrs,
+			pkcs7.Attribute{Type: oidScepPkiStatus, Value: scepStatusFailure},
+			pkcs7.Attribute{Type: oidScepFailInfo, Value: failInfo})
+		if failText != "" {
+			attrs = append(attrs, pkcs7.Attribute{Type: oidScepFailInfoText, Value: asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(failText)}})
+		}
+	}
+
+	signedData, err := pkcs7.NewSignedData(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SCEP response: %w", err)
+	}
+
+	if err := signedData.AddSigner(caCert, caKey, pkcs7.SignerInfoConfig{ExtraSignedAttributes: attrs}); err != nil {
+		return nil, fmt.Errorf("failed to sign SCEP response: %w", err)
+	}
+
+	return signedData.Finish()
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/helper/salt"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -20,6 +21,14 @@ type backend struct {
 	view      logical.Storage
 	salt      *salt.Salt
 	saltMutex sync.RWMutex
+
+	// issuersLock serializes changes to the issuers and their configuration
+	issuersLock sync.Mutex
+
+	// revocationLock serializes revocations and rebuilds of the KRL
+	revocationLock sync.Mutex
+
+	backendUUID string
 }
 
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
@@ -36,6 +45,7 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 func Backend(conf *logical.BackendConfig) (*backend, error) {
 	var b backend
 	b.view = conf.StorageView
+	b.backendUUID = conf.BackendUUID
 	b.Backend = &framework.Backend{
 		Help: strings.TrimSpace(backendHelp),
 
@@ -43,6 +53,8 @@ func Backend(conf *logical.BackendConfig) (*backend, error) {
 			Unauthenticated: []string{
 				"verify",
 				"public_key",
+				"issuer/+/public_key",
+				"krl",
 			},
 
 			LocalStorage: []string{
@@ -52,6 +64,7 @@ func Backend(conf *logical.BackendConfig) (*backend, error) {
 			SealWrapStorage: []string{
 				caPrivateKey,
 				caPrivateKeyStoragePath,
+				issuerPrefix,
 				keysStoragePrefix,
 			},
 		},
@@ -64,9 +77,21 @@ func Backend(conf *logical.BackendConfig) (*backend, error) {
 			pathLookup(&b),
 			pathVerify(&b),
 			pathConfigCA(&b),
+			pathConfigIssuers(&b),
+			pathListIssuers(&b),
+			pathIssuersGenerate(&b),
+			pathIssuersImport(&b),
+			pathIssuer(&b),
+			pathIssuerPublicKey(&b),
+			pathRevoke(&b),
+			pathFetchKRL(&b),
+			pathRotateKRL(&b),
+			pathListCerts(&b),
+			pathFetchCert(&b),
 			pathSign(&b),
 			pathIssue(&b),
 			pathFetchPublicKey(&b),
+			pathTidy(&b),
 			pathCleanupKeys(&b),
 		},
 
@@ -74,12 +99,29 @@ func Backend(conf *logical.BackendConfig) (*backend, error) {
 			secretOTP(&b),
 		},
 
-		Invalidate:  b.invalidate,
-		BackendType: logical.TypeLogical,
+		InitializeFunc: b.initialize,
+		Invalidate:     b.invalidate,
+		BackendType:    logical.TypeLogical,
 	}
 	return &b, nil
 }
 
+func (b *backend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
+	// Only migrate on the primary cluster's active node, or a performance
+	// secondary's for a local mount; other nodes serve the legacy key pair
+	// until the migrated issuer is replicated to them.
+	if b.System().ReplicationState().HasState(consts.ReplicationDRSecondary|consts.ReplicationPerformanceStandby) ||
+		(!b.System().LocalMount() && b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary)) {
+		return nil
+	}
+
+	if err := b.migrateLegacyCA(ctx, req.Storage); err != nil {
+		b.Logger().Error("failed to migrate CA key pair to an issuer", "error", err)
+		return err
+	}
+	return nil
+}
+
 func (b *backend) Salt(ctx context.Context) (*salt.Salt, error) {
 	b.saltMutex.RLock()
 	if b.salt != nil {
@@ -0,0 +1,436 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ssh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	issuerPrefix                = "config/issuer/"
+	storageIssuerConfig         = "config/issuers"
+	storageLegacyCAMigrationLog = "config/ca_migration"
+
+	// defaultRef refers to the issuer configured as the default one
+	defaultRef = "default"
+)
+
+var issuerNameMatcher = regexp.MustCompile("^" + framework.GenericNameRegex("issuer_name") + "$")
+
+// sshIssuer is a CA key pair used to sign certificates. Several issuers can
+// coexist so that the CA can be rotated without breaking every host trusting
+// the previous one.
+type sshIssuer struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key"`
+
+	// ManagedKeyID references the managed key holding the private key, in
+	// which case PrivateKey is empty
+	ManagedKeyID   string `json:"managed_key_id,omitempty"`
+	ManagedKeyName string `json:"managed_key_name,omitempty"`
+}
+
+type issuerConfigEntry struct {
+	DefaultIssuerID string `json:"default"`
+}
+
+func (i *sshIssuer) keyType() string {
+	publicKey, err := parsePublicSSHKey(i.PublicKey)
+	if err != nil {
+		return ""
+	}
+	return publicKey.Type()
+}
+
+func getIssuersConfig(ctx context.Context, s logical.Storage) (*issuerConfigEntry, error) {
+	entry, err := s.Get(ctx, storageIssuerConfig)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var config issuerConfigEntry
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, fmt.Errorf("unable to decode issuer configuration: %w", err)
+	}
+	return &config, nil
+}
+
+func setIssuersConfig(ctx context.Context, s logical.Storage, config *issuerConfigEntry) error {
+	entry, err := logical.StorageEntryJSON(storageIssuerConfig, config)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func listIssuers(ctx context.Context, s logical.Storage) ([]string, error) {
+	return s.List(ctx, issuerPrefix)
+}
+
+func fetchIssuerByID(ctx context.Context, s logical.Storage, id string) (*sshIssuer, error) {
+	entry, err := s.Get(ctx, issuerPrefix+id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH issuer %q: %w", id, err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var issuer sshIssuer
+	if err := entry.DecodeJSON(&issuer); err != nil {
+		return nil, fmt.Errorf("failed to decode SSH issuer %q: %w", id, err)
+	}
+	return &issuer, nil
+}
+
+func writeIssuer(ctx context.Context, s logical.Storage, issuer *sshIssuer) error {
+	entry, err := logical.StorageEntryJSON(issuerPrefix+issuer.ID, issuer)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// fetchIssuerByRef resolves a reference to an issuer, which is either
+// "default", an issuer identifier or an issuer name. It returns nil when no
+// issuer matches the reference. The legacy key pair stands in for the default
+// issuer on nodes where it has not been migrated yet.
+func fetchIssuerByRef(ctx context.Context, s logical.Storage, ref string) (*sshIssuer, error) {
+	if ref == "" || ref == defaultRef {
+		config, err := getIssuersConfig(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		if config == nil {
+			return legacyIssuer(ctx, s)
+		}
+		if config.DefaultIssuerID == "" {
+			return nil, nil
+		}
+		return fetchIssuerByID(ctx, s, config.DefaultIssuerID)
+	}
+
+	issuer, err := fetchIssuerByID(ctx, s, ref)
+	if err != nil || issuer != nil {
+		return issuer, err
+	}
+
+	ids, err := listIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		issuer, err := fetchIssuerByID(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		if issuer != nil && issuer.Name == ref {
+			return issuer, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// fetchAllIssuers returns every issuer, starting with the default one. On
+// nodes where the legacy key pair has not been migrated yet, it is returned
+// instead.
+func fetchAllIssuers(ctx context.Context, s logical.Storage) ([]*sshIssuer, error) {
+	config, err := getIssuersConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := listIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil && len(ids) == 0 {
+		issuer, err := legacyIssuer(ctx, s)
+		if err != nil || issuer == nil {
+			return nil, err
+		}
+		return []*sshIssuer{issuer}, nil
+	}
+
+	issuers := make([]*sshIssuer, 0, len(ids))
+	for _, id := range ids {
+		issuer, err := fetchIssuerByID(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		if issuer == nil {
+			continue
+		}
+		if config != nil && issuer.ID == config.DefaultIssuerID {
+			issuers = append([]*sshIssuer{issuer}, issuers...)
+		} else {
+			issuers = append(issuers, issuer)
+		}
+	}
+
+	return issuers, nil
+}
+
+func fetchIssuerByPublicKey(ctx context.Context, s logical.Storage, publicKey string) (*sshIssuer, error) {
+	ids, err := listIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		issuer, err := fetchIssuerByID(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		if issuer != nil && issuer.PublicKey == publicKey {
+			return issuer, nil
+		}
+	}
+	return nil, nil
+}
+
+// importIssuer stores a new issuer for the key pair of the given issuer,
+// assigning it an identifier. The first issuer of the mount becomes the
+// default one. The issuers lock must be held.
+func importIssuer(ctx context.Context, s logical.Storage, issuer *sshIssuer) (*sshIssuer, error) {
+	ids, err := listIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		existing, err := fetchIssuerByID(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			continue
+		}
+		if issuer.Name != "" && existing.Name == issuer.Name {
+			return nil, errutil.UserError{Err: fmt.Sprintf("issuer name %q is already in use", issuer.Name)}
+		}
+		if existing.PublicKey == issuer.PublicKey {
+			return nil, errutil.UserError{Err: fmt.Sprintf("key is already in use by issuer %q", existing.ID)}
+		}
+	}
+
+	issuer.ID, err = uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeIssuer(ctx, s, issuer); err != nil {
+		return nil, err
+	}
+
+	config, err := getIssuersConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &issuerConfigEntry{}
+	}
+	if config.DefaultIssuerID == "" {
+		config.DefaultIssuerID = issuer.ID
+		if err := setIssuersConfig(ctx, s, config); err != nil {
+			return nil, err
+		}
+	}
+
+	return issuer, nil
+}
+
+// validateIssuerKeyPair checks that the private key parses and, when given,
+// matches the public key. It returns the public key in authorized_keys format.
+func validateIssuerKeyPair(publicKey, privateKey string) (string, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		return "", fmt.Errorf("Unable to parse private_key as an SSH private key: %v", err)
+	}
+	derived := string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	if publicKey == "" {
+		return derived, nil
+	}
+
+	parsed, err := parsePublicSSHKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("Unable to parse public_key as an SSH public key: %v", err)
+	}
+	if string(ssh.MarshalAuthorizedKey(parsed)) != derived {
+		return "", fmt.Errorf("public_key does not match private_key")
+	}
+	return publicKey, nil
+}
+
+// legacyCAMigrationLog records the legacy key pair last migrated to an
+// issuer, so that it is only migrated again if it changed, as it can when a
+// node running an older version configures config/ca.
+type legacyCAMigrationLog struct {
+	Hash     string    `json:"hash"`
+	IssuerID string    `json:"issuer_id"`
+	Created  time.Time `json:"created"`
+}
+
+// migrateLegacyCA copies the key pair configured through config/ca before
+// issuers existed to an issuer, which becomes the default one. It runs once
+// when the mount is initialized on a node that can write to it. The legacy
+// entries are kept, so that the CA survives a downgrade.
+func (b *backend) migrateLegacyCA(ctx context.Context, s logical.Storage) error {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	publicKeyEntry, err := caKey(ctx, s, caPublicKey)
+	if err != nil {
+		return err
+	}
+	privateKeyEntry, err := caKey(ctx, s, caPrivateKey)
+	if err != nil {
+		return err
+	}
+	if publicKeyEntry == nil || publicKeyEntry.Key == "" || privateKeyEntry == nil || privateKeyEntry.Key == "" {
+		return nil
+	}
+
+	hash := sha256.Sum256([]byte(publicKeyEntry.Key + privateKeyEntry.Key))
+	migrationLog, err := getLegacyCAMigrationLog(ctx, s)
+	if err != nil {
+		return err
+	}
+	if migrationLog != nil && migrationLog.Hash == hex.EncodeToString(hash[:]) {
+		return nil
+	}
+
+	issuer, err := importIssuer(ctx, s, &sshIssuer{
+		PublicKey:  publicKeyEntry.Key,
+		PrivateKey: privateKeyEntry.Key,
+	})
+	if err != nil {
+		if _, ok := err.(errutil.UserError); !ok {
+			return fmt.Errorf("failed to migrate CA key pair to an issuer: %w", err)
+		}
+
+		// Already imported through the issuers endpoints
+		issuer, err = fetchIssuerByPublicKey(ctx, s, publicKeyEntry.Key)
+		if err != nil || issuer == nil {
+			return fmt.Errorf("failed to migrate CA key pair to an issuer: %w", err)
+		}
+	}
+
+	// The legacy key pair was changed since it was last migrated, so it is
+	// the one in use
+	if migrationLog != nil {
+		if err := setIssuersConfig(ctx, s, &issuerConfigEntry{DefaultIssuerID: issuer.ID}); err != nil {
+			return err
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(storageLegacyCAMigrationLog, &legacyCAMigrationLog{
+		Hash:     hex.EncodeToString(hash[:]),
+		IssuerID: issuer.ID,
+		Created:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return err
+	}
+
+	b.Logger().Info("migrated CA key pair to issuer", "issuer_id", issuer.ID)
+	return nil
+}
+
+func getLegacyCAMigrationLog(ctx context.Context, s logical.Storage) (*legacyCAMigrationLog, error) {
+	entry, err := s.Get(ctx, storageLegacyCAMigrationLog)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var migrationLog legacyCAMigrationLog
+	if err := entry.DecodeJSON(&migrationLog); err != nil {
+		return nil, fmt.Errorf("unable to decode CA migration log: %w", err)
+	}
+	return &migrationLog, nil
+}
+
+// legacyIssuer returns the key pair configured through config/ca before
+// issuers existed. It is used in place of the default issuer on nodes where
+// the key pair has not been migrated yet, such as performance secondaries
+// whose primary still runs an older version. Nothing is written, as these
+// nodes cannot write to the mount.
+func legacyIssuer(ctx context.Context, s logical.Storage) (*sshIssuer, error) {
+	var keys [2]string
+	for i, paths := range [][2]string{
+		{caPublicKeyStoragePath, caPublicKeyStoragePathDeprecated},
+		{caPrivateKeyStoragePath, caPrivateKeyStoragePathDeprecated},
+	} {
+		entry, err := s.Get(ctx, paths[0])
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			var keyEntry keyStorageEntry
+			if err := entry.DecodeJSON(&keyEntry); err != nil {
+				return nil, err
+			}
+			keys[i] = keyEntry.Key
+			continue
+		}
+
+		entry, err = s.Get(ctx, paths[1])
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			keys[i] = string(entry.Value)
+		}
+	}
+
+	if keys[0] == "" || keys[1] == "" {
+		return nil, nil
+	}
+	return &sshIssuer{
+		PublicKey:  keys[0],
+		PrivateKey: keys[1],
+	}, nil
+}
+
+// deleteLegacyCA removes the legacy key pair along with the issuer it was
+// migrated to, so that a downgrade does not bring back a deleted CA.
+func deleteLegacyCA(ctx context.Context, s logical.Storage, publicKey string) error {
+	legacy, err := legacyIssuer(ctx, s)
+	if err != nil || legacy == nil || legacy.PublicKey != publicKey {
+		return err
+	}
+
+	for _, path := range []string{
+		caPrivateKeyStoragePath,
+		caPrivateKeyStoragePathDeprecated,
+		caPublicKeyStoragePath,
+		caPublicKeyStoragePathDeprecated,
+	} {
+		if err := s.Delete(ctx, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ssh
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The OpenSSH Key Revocation List format is described in PROTOCOL.krl of the
+// OpenSSH sources.
+const (
+	krlMagic         uint64 = 0x5353484b524c0a00
+	krlFormatVersion uint32 = 1
+
+	krlSectionCertificates = 1
+	krlSectionSignature    = 4
+
+	krlSectionCertSerialList = 0x20
+	krlSectionCertKeyID      = 0x23
+)
+
+// krlCertificates holds the certificates revoked for one CA key.
+type krlCertificates struct {
+	CAKey   ssh.PublicKey
+	Serials []uint64
+	KeyIDs  []string
+}
+
+type krl struct {
+	Version      uint64
+	GeneratedAt  time.Time
+	Comment      string
+	Certificates []krlCertificates
+}
+
+// marshal encodes the KRL, and signs it with the given signer when not nil.
+func (k *krl) marshal(signer ssh.Signer) ([]byte, error) {
+	var buf []byte
+	buf = binary.BigEndian.AppendUint64(buf, krlMagic)
+	buf = binary.BigEndian.AppendUint32(buf, krlFormatVersion)
+	buf = binary.BigEndian.AppendUint64(buf, k.Version)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(k.GeneratedAt.Unix()))
+	buf = binary.BigEndian.AppendUint64(buf, 0) // flags
+	buf = appendKRLString(buf, nil)             // reserved
+	buf = appendKRLString(buf, []byte(k.Comment))
+
+	for _, certs := range k.Certificates {
+		if len(certs.Serials) == 0 && len(certs.KeyIDs) == 0 {
+			continue
+		}
+
+		var section []byte
+		section = appendKRLString(section, certs.CAKey.Marshal())
+		section = appendKRLString(section, nil) // reserved
+
+		if len(certs.Serials) > 0 {
+			serials := append([]uint64(nil), certs.Serials...)
+			sort.Slice(serials, func(i, j int) bool { return serials[i] < serials[j] })
+
+			var list []byte
+			for _, serial := range serials {
+				list = binary.BigEndian.AppendUint64(list, serial)
+			}
+			section = append(section, krlSectionCertSerialList)
+			section = appendKRLString(section, list)
+		}
+
+		if len(certs.KeyIDs) > 0 {
+			keyIDs := append([]string(nil), certs.KeyIDs...)
+			sort.Strings(keyIDs)
+
+			var list []byte
+			for _, keyID := range keyIDs {
+				list = appendKRLString(list, []byte(keyID))
+			}
+			section = append(section, krlSectionCertKeyID)
+			section = appendKRLString(section, list)
+		}
+
+		buf = append(buf, krlSectionCertificates)
+		buf = appendKRLString(buf, section)
+	}
+
+	if signer == nil {
+		return buf, nil
+	}
+
+	// The signature covers the whole KRL up to and including the signing key
+	buf = append(buf, krlSectionSignature)
+	buf = appendKRLString(buf, signer.PublicKey().Marshal())
+
+	var signature *ssh.Signature
+	var err error
+	if algorithmSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		signature, err = algorithmSigner.SignWithAlgorithm(rand.Reader, buf, ssh.KeyAlgoRSASHA256)
+	} else {
+		signature, err = signer.Sign(rand.Reader, buf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign KRL: %w", err)
+	}
+
+	return appendKRLString(buf, ssh.Marshal(signature)), nil
+}
+
+func appendKRLString(buf, s []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(s)))
+	return append(buf, s...)
+}
@@ -0,0 +1,128 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ssh"
+)
+
+var errManagedKeysUnsupported = errors.New("managed keys are supported within enterprise edition only")
+
+func (b *backend) managedKeySystemView() (logical.ManagedKeySystemView, error) {
+	managedKeySystemView, ok := b.System().(logical.ManagedKeySystemView)
+	if !ok {
+		return nil, errManagedKeysUnsupported
+	}
+	return managedKeySystemView, nil
+}
+
+// managedKeyIssuer returns an issuer referencing the given managed key, which
+// is looked up by identifier, or by name when the identifier is empty. The
+// public key of the issuer is the one of the managed key.
+func (b *backend) managedKeyIssuer(ctx context.Context, keyName, keyID string) (*sshIssuer, error) {
+	managedKeySystemView, err := b.managedKeySystemView()
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := &sshIssuer{}
+	consumer := func(ctx context.Context, key logical.ManagedSigningKey) error {
+		if !key.AllowsAll([]logical.KeyUsage{logical.KeyUsageSign}) {
+			return errutil.UserError{Err: fmt.Sprintf("managed key %q does not allow signing", key.Name())}
+		}
+
+		publicKey, err := key.GetPublicKey(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read public key of managed key %q: %w", key.Name(), err)
+		}
+		sshPublicKey, err := ssh.NewPublicKey(publicKey)
+		if err != nil {
+			return errutil.UserError{Err: fmt.Sprintf("managed key %q cannot be used as an SSH CA key: %v", key.Name(), err)}
+		}
+
+		issuer.ManagedKeyID = key.UUID()
+		issuer.ManagedKeyName = key.Name()
+		issuer.PublicKey = string(ssh.MarshalAuthorizedKey(sshPublicKey))
+		return nil
+	}
+
+	if keyID != "" {
+		err = managedKeySystemView.WithManagedSigningKeyByUUID(ctx, keyID, b.backendUUID, consumer)
+	} else {
+		err = managedKeySystemView.WithManagedSigningKeyByName(ctx, keyName, b.backendUUID, consumer)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return issuer, nil
+}
+
+// managedKeyIssuerForRequest resolves the managed key referenced by a request,
+// checking that it matches the public key when one was provided.
+func (b *backend) managedKeyIssuerForRequest(ctx context.Context, keyName, keyID, publicKey string) (*sshIssuer, *logical.Response, error) {
+	issuer, err := b.managedKeyIssuer(ctx, keyName, keyID)
+	if err != nil {
+		if _, ok := err.(errutil.UserError); ok || errors.Is(err, errManagedKeysUnsupported) {
+			return nil, logical.ErrorResponse(err.Error()), nil
+		}
+		return nil, nil, err
+	}
+
+	if publicKey != "" {
+		parsed, err := parsePublicSSHKey(publicKey)
+		if err != nil {
+			return nil, logical.ErrorResponse("failed to parse public_key: %v", err), nil
+		}
+		managedPublicKey, err := parsePublicSSHKey(issuer.PublicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !bytes.Equal(parsed.Marshal(), managedPublicKey.Marshal()) {
+			return nil, logical.ErrorResponse("public_key does not match the public key of the managed key"), nil
+		}
+	}
+
+	return issuer, nil, nil
+}
+
+// withIssuerSigner calls f with a signer for the private key of the issuer.
+// When the private key is held by a managed key, the signer is only valid
+// within f.
+func (b *backend) withIssuerSigner(ctx context.Context, issuer *sshIssuer, f func(ssh.Signer) error) error {
+	if issuer.ManagedKeyID == "" {
+		if issuer.PrivateKey == "" {
+			return errors.New("failed to read CA private key")
+		}
+		signer, err := ssh.ParsePrivateKey([]byte(issuer.PrivateKey))
+		if err != nil {
+			return fmt.Errorf("failed to parse stored CA private key: %w", err)
+		}
+		return f(signer)
+	}
+
+	managedKeySystemView, err := b.managedKeySystemView()
+	if err != nil {
+		return err
+	}
+
+	return managedKeySystemView.WithManagedSigningKeyByUUID(ctx, issuer.ManagedKeyID, b.backendUUID, func(ctx context.Context, key logical.ManagedSigningKey) error {
+		cryptoSigner, err := key.GetSigner(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get signer for managed key %q: %w", issuer.ManagedKeyID, err)
+		}
+		signer, err := ssh.NewSignerFromSigner(cryptoSigner)
+		if err != nil {
+			return fmt.Errorf("managed key %q cannot be used as an SSH CA key: %w", issuer.ManagedKeyID, err)
+		}
+		return f(signer)
+	})
+}
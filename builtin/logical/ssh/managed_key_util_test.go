@@ -0,0 +1,189 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ssh
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSH_ManagedKeyIssuer(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	managedKey := &testManagedSigningKey{name: "hsm-ca", uuid: "8a6f3c1e-0000-4000-8000-000000000001", key: privateKey}
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	config.BackendUUID = "ssh-mount"
+	config.System = &testManagedKeySystemView{
+		StaticSystemView: logical.TestSystemView(),
+		t:                t,
+		keys:             []*testManagedSigningKey{managedKey},
+	}
+
+	b, err := Factory(context.Background(), config)
+	require.NoError(t, err)
+
+	doReq := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Data:      data,
+			Storage:   config.StorageView,
+		})
+	}
+
+	sshPublicKey, err := ssh.NewPublicKey(privateKey.Public())
+	require.NoError(t, err)
+	expectedPublicKey := string(ssh.MarshalAuthorizedKey(sshPublicKey))
+
+	// Managed keys cannot be combined with a private key or key generation
+	for _, data := range []map[string]interface{}{
+		{"managed_key_name": "hsm-ca", "private_key": testCAPrivateKey},
+		{"managed_key_name": "hsm-ca", "generate_signing_key": true},
+		{"managed_key_name": "hsm-ca", "public_key": testCAPublicKey},
+		{"managed_key_name": "restricted"},
+	} {
+		resp, err := doReq(logical.UpdateOperation, "config/ca", data)
+		require.NoError(t, err)
+		require.True(t, resp.IsError(), data)
+	}
+
+	resp, err := doReq(logical.UpdateOperation, "config/ca", map[string]interface{}{
+		"managed_key_name": "hsm-ca",
+		"public_key":       expectedPublicKey,
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError(), resp.Error())
+	require.Equal(t, expectedPublicKey, resp.Data["public_key"])
+
+	resp, err = doReq(logical.ReadOperation, "issuer/default", nil)
+	require.NoError(t, err)
+	require.Equal(t, managedKey.uuid, resp.Data["managed_key_id"])
+	require.Equal(t, "hsm-ca", resp.Data["managed_key_name"])
+
+	// The private key is never stored
+	issuer, err := fetchIssuerByID(context.Background(), config.StorageView, resp.Data["issuer_id"].(string))
+	require.NoError(t, err)
+	require.Empty(t, issuer.PrivateKey)
+
+	// Certificates and KRLs are signed by the managed key
+	resp, err = doReq(logical.UpdateOperation, "roles/managed", map[string]interface{}{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"allowed_users":           "*",
+	})
+	require.NoError(t, err)
+	require.Nil(t, resp)
+
+	resp, err = doReq(logical.UpdateOperation, "sign/managed", map[string]interface{}{
+		"public_key": testCAPublicKeyEd25519,
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError(), resp.Error())
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(resp.Data["signed_key"].(string)))
+	require.NoError(t, err)
+	cert := parsed.(*ssh.Certificate)
+	require.Equal(t, sshPublicKey.Marshal(), cert.SignatureKey.Marshal())
+	checker := &ssh.CertChecker{IsUserAuthority: func(auth ssh.PublicKey) bool { return true }}
+	require.NoError(t, checker.CheckCert("root", cert))
+
+	resp, err = doReq(logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": resp.Data["serial_number"],
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError(), resp.Error())
+	resp, err = doReq(logical.ReadOperation, "krl", nil)
+	require.NoError(t, err)
+	krl := parseTestKRL(t, resp.Data[logical.HTTPRawBody].([]byte), sshPublicKey)
+	require.Equal(t, []uint64{cert.Serial}, krl.serials)
+
+	// The same managed key cannot back a second issuer
+	resp, err = doReq(logical.UpdateOperation, "issuers/import", map[string]interface{}{
+		"managed_key_id": managedKey.uuid,
+	})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+}
+
+func TestSSH_ManagedKeyIssuerUnsupported(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(context.Background(), config)
+	require.NoError(t, err)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issuers/import",
+		Data:      map[string]interface{}{"managed_key_name": "hsm-ca"},
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+	require.Contains(t, resp.Error().Error(), errManagedKeysUnsupported.Error())
+}
+
+// testManagedKeySystemView serves in-memory signing keys as managed keys; the
+// key named "restricted" does not allow signing.
+type testManagedKeySystemView struct {
+	*logical.StaticSystemView
+	logical.ManagedKeySystemView
+
+	t    *testing.T
+	keys []*testManagedSigningKey
+}
+
+func (v *testManagedKeySystemView) WithManagedSigningKeyByName(ctx context.Context, keyName, backendUUID string, f logical.ManagedSigningKeyConsumer) error {
+	return v.withKey(ctx, backendUUID, func(key *testManagedSigningKey) bool { return key.name == keyName }, f)
+}
+
+func (v *testManagedKeySystemView) WithManagedSigningKeyByUUID(ctx context.Context, keyUUID, backendUUID string, f logical.ManagedSigningKeyConsumer) error {
+	return v.withKey(ctx, backendUUID, func(key *testManagedSigningKey) bool { return key.uuid == keyUUID }, f)
+}
+
+func (v *testManagedKeySystemView) withKey(ctx context.Context, backendUUID string, match func(*testManagedSigningKey) bool, f logical.ManagedSigningKeyConsumer) error {
+	require.Equal(v.t, "ssh-mount", backendUUID)
+	for _, key := range v.keys {
+		if match(key) {
+			return f(ctx, key)
+		}
+	}
+	if match(&testManagedSigningKey{name: "restricted"}) {
+		return f(ctx, &testManagedSigningKey{name: "restricted", restricted: true})
+	}
+	return fmt.Errorf("no such managed key")
+}
+
+type testManagedSigningKey struct {
+	logical.ManagedSigningKey
+
+	name       string
+	uuid       string
+	key        crypto.Signer
+	restricted bool
+}
+
+func (k *testManagedSigningKey) Name() string { return k.name }
+
+func (k *testManagedSigningKey) UUID() string { return k.uuid }
+
+func (k *testManagedSigningKey) AllowsAll(usages []logical.KeyUsage) bool { return !k.restricted }
+
+func (k *testManagedSigningKey) GetPublicKey(context.Context) (crypto.PublicKey, error) {
+	return k.key.Public(), nil
+}
+
+func (k *testManagedSigningKey) GetSigner(context.Context) (crypto.Signer, error) {
+	return k.key, nil
+}
@@ -17,8 +17,8 @@ import (
 	"fmt"
 	"io"
 
-	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"golang.org/x/crypto/ssh"
 
@@ -70,6 +70,14 @@ func pathConfigCA(b *backend) *framework.Path {
 				Description: `Specifies the desired key bits when generating variable-length keys (such as when key_type="ssh-rsa") or which NIST P-curve to use when key_type="ec" (256, 384, or 521).`,
 				Default:     0,
 			},
+			"managed_key_name": {
+				Type:        framework.TypeString,
+				Description: managedKeyNameDescription,
+			},
+			"managed_key_id": {
+				Type:        framework.TypeString,
+				Description: managedKeyIDDescription,
+			},
 		},
 
 		Operations: map[logical.Operation]framework.OperationHandler{
@@ -98,25 +106,31 @@ func pathConfigCA(b *backend) *framework.Path {
 		HelpDescription: `This sets the CA information used for certificates generated by this
 by this mount. The fields must be in the standard private and public SSH format.
 
-For security reasons, the private key cannot be retrieved later.
+For security reasons, the private key cannot be retrieved later. With
+managed_key_name or managed_key_id, certificates are signed by the managed key
+instead, and the private key is never stored by this mount.
+
+The key pair is stored as the default issuer of the mount. Delete operations
+remove the default issuer; use the issuers endpoints to manage several key
+pairs and rotate the CA.
 
 Read operations will return the public key, if already stored/generated.`,
 	}
 }
 
 func (b *backend) pathConfigCARead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	publicKeyEntry, err := caKey(ctx, req.Storage, caPublicKey)
+	issuer, err := fetchIssuerByRef(ctx, req.Storage, defaultRef)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read CA public key: %w", err)
 	}
 
-	if publicKeyEntry == nil {
+	if issuer == nil {
 		return logical.ErrorResponse("keys haven't been configured yet"), nil
 	}
 
 	response := &logical.Response{
 		Data: map[string]interface{}{
-			"public_key": publicKeyEntry.Key,
+			"public_key": issuer.PublicKey,
 		},
 	}
 
@@ -124,13 +138,18 @@ func (b *backend) pathConfigCARead(ctx context.Context, req *logical.Request, da
 }
 
 func (b *backend) pathConfigCADelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	if err := req.Storage.Delete(ctx, caPrivateKeyStoragePath); err != nil {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	issuer, err := fetchIssuerByRef(ctx, req.Storage, defaultRef)
+	if err != nil {
 		return nil, err
 	}
-	if err := req.Storage.Delete(ctx, caPublicKeyStoragePath); err != nil {
-		return nil, err
+	if issuer == nil {
+		return nil, nil
 	}
-	return nil, nil
+
+	return deleteIssuer(ctx, req.Storage, issuer)
 }
 
 func caKey(ctx context.Context, storage logical.Storage, keyType string) (*keyStorageEntry, error) {
@@ -190,6 +209,31 @@ func (b *backend) pathConfigCAUpdate(ctx context.Context, req *logical.Request,
 	publicKey := data.Get("public_key").(string)
 	privateKey := data.Get("private_key").(string)
 
+	managedKeyName := data.Get("managed_key_name").(string)
+	managedKeyID := data.Get("managed_key_id").(string)
+	if managedKeyName != "" || managedKeyID != "" {
+		if privateKey != "" {
+			return logical.ErrorResponse("private_key must not be set when using a managed key"), nil
+		}
+		if generateSigningKeyRaw, ok := data.GetOk("generate_signing_key"); ok && generateSigningKeyRaw.(bool) {
+			return logical.ErrorResponse("generate_signing_key must not be set to true when using a managed key"), nil
+		}
+
+		issuer, resp, err := b.managedKeyIssuerForRequest(ctx, managedKeyName, managedKeyID, publicKey)
+		if resp != nil || err != nil {
+			return resp, err
+		}
+		if resp, err := b.configureDefaultIssuer(ctx, req.Storage, issuer); resp != nil || err != nil {
+			return resp, err
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"public_key": issuer.PublicKey,
+			},
+		}, nil
+	}
+
 	var generateSigningKey bool
 
 	generateSigningKeyRaw, ok := data.GetOk("generate_signing_key")
@@ -212,14 +256,8 @@ func (b *backend) pathConfigCAUpdate(ctx context.Context, req *logical.Request,
 			return logical.ErrorResponse("missing private_key"), nil
 		}
 
-		_, err := ssh.ParsePrivateKey([]byte(privateKey))
-		if err != nil {
-			return logical.ErrorResponse(fmt.Sprintf("Unable to parse private_key as an SSH private key: %v", err)), nil
-		}
-
-		_, err = parsePublicSSHKey(publicKey)
-		if err != nil {
-			return logical.ErrorResponse(fmt.Sprintf("Unable to parse public_key as an SSH public key: %v", err)), nil
+		if _, err := validateIssuerKeyPair(publicKey, privateKey); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
 		}
 
 	// not set and no public/private key provided so generate
@@ -245,68 +283,50 @@ func (b *backend) pathConfigCAUpdate(ctx context.Context, req *logical.Request,
 		return nil, fmt.Errorf("failed to generate or parse the keys")
 	}
 
-	publicKeyEntry, err := caKey(ctx, req.Storage, caPublicKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CA public key: %w", err)
+	if resp, err := b.configureDefaultIssuer(ctx, req.Storage, &sshIssuer{
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+	}); resp != nil || err != nil {
+		return resp, err
 	}
 
-	privateKeyEntry, err := caKey(ctx, req.Storage, caPrivateKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CA private key: %w", err)
-	}
+	if generateSigningKey {
+		response := &logical.Response{
+			Data: map[string]interface{}{
+				"public_key": publicKey,
+			},
+		}
 
-	if (publicKeyEntry != nil && publicKeyEntry.Key != "") || (privateKeyEntry != nil && privateKeyEntry.Key != "") {
-		return logical.ErrorResponse("keys are already configured; delete them before reconfiguring"), nil
+		return response, nil
 	}
 
-	entry, err := logical.StorageEntryJSON(caPublicKeyStoragePath, &keyStorageEntry{
-		Key: publicKey,
-	})
-	if err != nil {
-		return nil, err
-	}
+	return nil, nil
+}
 
-	// Save the public key
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
-		return nil, err
-	}
+// configureDefaultIssuer stores the issuer as the default issuer of the
+// mount, unless a default issuer is already configured.
+func (b *backend) configureDefaultIssuer(ctx context.Context, s logical.Storage, issuer *sshIssuer) (*logical.Response, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
 
-	entry, err = logical.StorageEntryJSON(caPrivateKeyStoragePath, &keyStorageEntry{
-		Key: privateKey,
-	})
+	defaultIssuer, err := fetchIssuerByRef(ctx, s, defaultRef)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to read CA key: %w", err)
+	}
+	if defaultIssuer != nil {
+		return logical.ErrorResponse("keys are already configured; delete them before reconfiguring"), nil
 	}
 
-	// Save the private key
-	err = req.Storage.Put(ctx, entry)
+	issuer, err = importIssuer(ctx, s, issuer)
 	if err != nil {
-		var mErr *multierror.Error
-
-		mErr = multierror.Append(mErr, fmt.Errorf("failed to store CA private key: %w", err))
-
-		// If storing private key fails, the corresponding public key should be
-		// removed
-		if delErr := req.Storage.Delete(ctx, caPublicKeyStoragePath); delErr != nil {
-			mErr = multierror.Append(mErr, fmt.Errorf("failed to cleanup CA public key: %w", delErr))
-			return nil, mErr
+		if _, ok := err.(errutil.UserError); ok {
+			return logical.ErrorResponse(err.Error()), nil
 		}
-
 		return nil, err
 	}
 
-	if generateSigningKey {
-		response := &logical.Response{
-			Data: map[string]interface{}{
-				"public_key": publicKey,
-			},
-		}
-
-		return response, nil
-	}
-
-	return nil, nil
+	// The default issuer may have been cleared while other issuers remain
+	return nil, setIssuersConfig(ctx, s, &issuerConfigEntry{DefaultIssuerID: issuer.ID})
 }
 
 func generateSSHKeyPair(randomSource io.Reader, keyType string, keyBits int) (string, string, error) {
@@ -5,6 +5,7 @@ package ssh
 
 import (
 	"context"
+	"strings"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -19,28 +20,51 @@ func pathFetchPublicKey(b *backend) *framework.Path {
 			OperationSuffix: "public-key",
 		},
 
+		Fields: map[string]*framework.FieldSchema{
+			"all_issuers": {
+				Type:        framework.TypeBool,
+				Description: `If true, returns the public keys of all issuers, one per line and starting with the default issuer, rather than only the public key of the default issuer.`,
+			},
+		},
+
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.ReadOperation: b.pathFetchPublicKey,
 		},
 
-		HelpSynopsis:    `Retrieve the public key.`,
-		HelpDescription: `This allows the public key of the SSH CA certificate that this backend has been configured with to be fetched. This is a raw response endpoint without JSON encoding; use -format=raw or an external tool (e.g., curl) to fetch this value.`,
+		HelpSynopsis: `Retrieve the public key.`,
+		HelpDescription: `This allows the public key of the SSH CA certificate that this backend has been configured with to be fetched. This is a raw response endpoint without JSON encoding; use -format=raw or an external tool (e.g., curl) to fetch this value.
+
+With all_issuers set, the public keys of all issuers are returned, so that hosts can trust a new issuer before it becomes the default one.`,
 	}
 }
 
 func (b *backend) pathFetchPublicKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	publicKeyEntry, err := caKey(ctx, req.Storage, caPublicKey)
-	if err != nil {
-		return nil, err
+	var publicKeys []byte
+	if data.Get("all_issuers").(bool) {
+		issuers, err := fetchAllIssuers(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		for _, issuer := range issuers {
+			publicKeys = append(publicKeys, strings.TrimSpace(issuer.PublicKey)+"\n"...)
+		}
+	} else {
+		issuer, err := fetchIssuerByRef(ctx, req.Storage, defaultRef)
+		if err != nil {
+			return nil, err
+		}
+		if issuer != nil {
+			publicKeys = []byte(issuer.PublicKey)
+		}
 	}
-	if publicKeyEntry == nil || publicKeyEntry.Key == "" {
+	if len(publicKeys) == 0 {
 		return nil, nil
 	}
 
 	response := &logical.Response{
 		Data: map[string]interface{}{
 			logical.HTTPContentType: "text/plain",
-			logical.HTTPRawBody:     []byte(publicKeyEntry.Key),
+			logical.HTTPRawBody:     publicKeys,
 			logical.HTTPStatusCode:  200,
 		},
 	}
@@ -101,32 +101,34 @@ func (b *backend) pathSignIssueCertificateHelper(ctx context.Context, req *logic
 		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	privateKeyEntry, err := caKey(ctx, req.Storage, caPrivateKey)
+	issuer, err := fetchIssuerByRef(ctx, req.Storage, role.issuerRef())
 	if err != nil {
 		return nil, fmt.Errorf("failed to read CA private key: %w", err)
 	}
-	if privateKeyEntry == nil || privateKeyEntry.Key == "" {
-		return nil, errors.New("failed to read CA private key")
+	if issuer == nil && role.issuerRef() != defaultRef {
+		return logical.ErrorResponse("unable to find SSH issuer for reference %q", role.issuerRef()), nil
 	}
-
-	signer, err := ssh.ParsePrivateKey([]byte(privateKeyEntry.Key))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse stored CA private key: %w", err)
+	if issuer == nil {
+		return nil, errors.New("failed to read CA private key")
 	}
 
-	cBundle := creationBundle{
-		KeyID:           keyID,
-		PublicKey:       publicKey,
-		Signer:          signer,
-		ValidPrincipals: parsedPrincipals,
-		TTL:             ttl,
-		CertificateType: certificateType,
-		Role:            role,
-		CriticalOptions: criticalOptions,
-		Extensions:      extensions,
-	}
+	var certificate *ssh.Certificate
+	err = b.withIssuerSigner(ctx, issuer, func(signer ssh.Signer) error {
+		cBundle := creationBundle{
+			KeyID:           keyID,
+			PublicKey:       publicKey,
+			Signer:          signer,
+			ValidPrincipals: parsedPrincipals,
+			TTL:             ttl,
+			CertificateType: certificateType,
+			Role:            role,
+			CriticalOptions: criticalOptions,
+			Extensions:      extensions,
+		}
 
-	certificate, err := cBundle.sign()
+		certificate, err = cBundle.sign()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -136,10 +138,17 @@ func (b *backend) pathSignIssueCertificateHelper(ctx context.Context, req *logic
 		return nil, errors.New("error marshaling signed certificate")
 	}
 
+	if role.RecordCertificates {
+		if err := recordCertificate(ctx, req.Storage, issuer.ID, certificate); err != nil {
+			return nil, fmt.Errorf("failed to record certificate: %w", err)
+		}
+	}
+
 	response := &logical.Response{
 		Data: map[string]interface{}{
 			"serial_number": strconv.FormatUint(certificate.Serial, 16),
 			"signed_key":    string(signedSSHCertificate),
+			"issuer_id":     issuer.ID,
 		},
 	}
 
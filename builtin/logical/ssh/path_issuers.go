@@ -0,0 +1,550 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ssh
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const issuerRefDescription = `Reference to an existing issuer; either "default"
+for the configured default issuer, an identifier or the name assigned
+to the issuer.`
+
+const issuerNameDescription = `Provide a name to the generated or imported issuer; the name
+must be unique across all issuers and not be the reserved value 'default'.`
+
+const managedKeyNameDescription = `The name of the managed key holding the private key of the
+CA; the private key is never exported from the managed key. Mutually exclusive with
+private_key.`
+
+const managedKeyIDDescription = `The identifier of the managed key holding the private key
+of the CA. Takes precedence over managed_key_name.`
+
+func pathListIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuers/?$",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixSSH,
+			OperationSuffix: "issuers",
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathIssuersList,
+		},
+
+		HelpSynopsis:    pathListIssuersHelpSyn,
+		HelpDescription: pathListIssuersHelpDesc,
+	}
+}
+
+func pathIssuersGenerate(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuers/generate",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixSSH,
+			OperationVerb:   "generate",
+			OperationSuffix: "issuer",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_name": {
+				Type:        framework.TypeString,
+				Description: issuerNameDescription,
+			},
+			"key_type": {
+				Type:        framework.TypeString,
+				Description: `Specifies the desired key type; could be a OpenSSH key type identifier (ssh-rsa, ecdsa-sha2-nistp256, ecdsa-sha2-nistp384, ecdsa-sha2-nistp521, or ssh-ed25519) or an algorithm (rsa, ec, ed25519).`,
+				Default:     "ssh-rsa",
+			},
+			"key_bits": {
+				Type:        framework.TypeInt,
+				Description: `Specifies the desired key bits for variable-length keys (such as when key_type="ssh-rsa") or which NIST P-curve to use when key_type="ec" (256, 384, or 521).`,
+				Default:     0,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathIssuersGenerate,
+		},
+
+		HelpSynopsis:    pathIssuersGenerateHelpSyn,
+		HelpDescription: pathIssuersGenerateHelpDesc,
+	}
+}
+
+func pathIssuersImport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuers/import",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixSSH,
+			OperationVerb:   "import",
+			OperationSuffix: "issuer",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_name": {
+				Type:        framework.TypeString,
+				Description: issuerNameDescription,
+			},
+			"private_key": {
+				Type:        framework.TypeString,
+				Description: `Private half of the SSH key that will be used to sign certificates.`,
+			},
+			"public_key": {
+				Type:        framework.TypeString,
+				Description: `Public half of the SSH key that will be used to sign certificates. Derived from the private or managed key when not provided.`,
+			},
+			"managed_key_name": {
+				Type:        framework.TypeString,
+				Description: managedKeyNameDescription,
+			},
+			"managed_key_id": {
+				Type:        framework.TypeString,
+				Description: managedKeyIDDescription,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathIssuersImport,
+		},
+
+		HelpSynopsis:    pathIssuersImportHelpSyn,
+		HelpDescription: pathIssuersImportHelpDesc,
+	}
+}
+
+func pathIssuer(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex("issuer_ref") + "$",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixSSH,
+			OperationSuffix: "issuer",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": {
+				Type:        framework.TypeString,
+				Description: issuerRefDescription,
+			},
+			"issuer_name": {
+				Type:        framework.TypeString,
+				Description: issuerNameDescription,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathIssuerRead,
+			logical.UpdateOperation: b.pathIssuerUpdate,
+			logical.DeleteOperation: b.pathIssuerDelete,
+		},
+
+		HelpSynopsis:    pathIssuerHelpSyn,
+		HelpDescription: pathIssuerHelpDesc,
+	}
+}
+
+func pathIssuerPublicKey(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex("issuer_ref") + "/public_key",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixSSH,
+			OperationSuffix: "issuer-public-key",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": {
+				Type:        framework.TypeString,
+				Description: issuerRefDescription,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathIssuerPublicKeyRead,
+		},
+
+		HelpSynopsis:    `Retrieve the public key of an issuer.`,
+		HelpDescription: `This allows the public key of an issuer to be fetched. This is a raw response endpoint without JSON encoding; use -format=raw or an external tool (e.g., curl) to fetch this value.`,
+	}
+}
+
+func pathConfigIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/issuers",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixSSH,
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"default": {
+				Type:        framework.TypeString,
+				Description: `Reference (name or identifier) to the default issuer.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathConfigIssuersRead,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "issuers-configuration",
+				},
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathConfigIssuersWrite,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationVerb:   "configure",
+					OperationSuffix: "issuers",
+				},
+			},
+		},
+
+		HelpSynopsis:    pathConfigIssuersHelpSyn,
+		HelpDescription: pathConfigIssuersHelpDesc,
+	}
+}
+
+func (b *backend) pathIssuersList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	issuers, err := fetchAllIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	keyInfo := make(map[string]interface{}, len(issuers))
+	for _, issuer := range issuers {
+		// The legacy key pair is not an issuer until it is migrated
+		if issuer.ID == "" {
+			continue
+		}
+		keys = append(keys, issuer.ID)
+		keyInfo[issuer.ID] = map[string]interface{}{
+			"issuer_name": issuer.Name,
+			"key_type":    issuer.keyType(),
+			"is_default":  config != nil && config.DefaultIssuerID == issuer.ID,
+		}
+	}
+
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
+}
+
+func (b *backend) pathIssuersGenerate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, resp := validateIssuerName(data.Get("issuer_name").(string))
+	if resp != nil {
+		return resp, nil
+	}
+
+	publicKey, privateKey, err := generateSSHKeyPair(b.Backend.GetRandomReader(), data.Get("key_type").(string), data.Get("key_bits").(int))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return b.storeIssuer(ctx, req, &sshIssuer{
+		Name:       name,
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+	})
+}
+
+func (b *backend) pathIssuersImport(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, resp := validateIssuerName(data.Get("issuer_name").(string))
+	if resp != nil {
+		return resp, nil
+	}
+
+	privateKey := data.Get("private_key").(string)
+	managedKeyName := data.Get("managed_key_name").(string)
+	managedKeyID := data.Get("managed_key_id").(string)
+
+	if managedKeyName != "" || managedKeyID != "" {
+		if privateKey != "" {
+			return logical.ErrorResponse("private_key must not be set when using a managed key"), nil
+		}
+		issuer, resp, err := b.managedKeyIssuerForRequest(ctx, managedKeyName, managedKeyID, data.Get("public_key").(string))
+		if resp != nil || err != nil {
+			return resp, err
+		}
+		issuer.Name = name
+		return b.storeIssuer(ctx, req, issuer)
+	}
+
+	if privateKey == "" {
+		return logical.ErrorResponse("missing private_key"), nil
+	}
+	publicKey, err := validateIssuerKeyPair(data.Get("public_key").(string), privateKey)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return b.storeIssuer(ctx, req, &sshIssuer{
+		Name:       name,
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+	})
+}
+
+func (b *backend) storeIssuer(ctx context.Context, req *logical.Request, issuer *sshIssuer) (*logical.Response, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	issuer, err := importIssuer(ctx, req.Storage, issuer)
+	if err != nil {
+		if _, ok := err.(errutil.UserError); ok {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		return nil, err
+	}
+
+	return b.issuerResponse(ctx, req.Storage, issuer)
+}
+
+func (b *backend) pathIssuerRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, err := fetchIssuerByRef(ctx, req.Storage, data.Get("issuer_ref").(string))
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return nil, nil
+	}
+
+	return b.issuerResponse(ctx, req.Storage, issuer)
+}
+
+func (b *backend) pathIssuerUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	issuer, err := fetchIssuerByRef(ctx, req.Storage, data.Get("issuer_ref").(string))
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return logical.ErrorResponse("unable to find SSH issuer for reference %q", data.Get("issuer_ref").(string)), nil
+	}
+
+	if nameRaw, ok := data.GetOk("issuer_name"); ok {
+		name, resp := validateIssuerName(nameRaw.(string))
+		if resp != nil {
+			return resp, nil
+		}
+		if name != "" && name != issuer.Name {
+			existing, err := fetchIssuerByRef(ctx, req.Storage, name)
+			if err != nil {
+				return nil, err
+			}
+			if existing != nil {
+				return logical.ErrorResponse("issuer name %q is already in use", name), nil
+			}
+		}
+		issuer.Name = name
+	}
+
+	if err := writeIssuer(ctx, req.Storage, issuer); err != nil {
+		return nil, err
+	}
+
+	return b.issuerResponse(ctx, req.Storage, issuer)
+}
+
+func (b *backend) pathIssuerDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	issuer, err := fetchIssuerByRef(ctx, req.Storage, data.Get("issuer_ref").(string))
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return nil, nil
+	}
+
+	return deleteIssuer(ctx, req.Storage, issuer)
+}
+
+// deleteIssuer removes the issuer, clearing the default issuer when it was
+// the default one. The issuers lock must be held.
+func deleteIssuer(ctx context.Context, s logical.Storage, issuer *sshIssuer) (*logical.Response, error) {
+	if err := s.Delete(ctx, issuerPrefix+issuer.ID); err != nil {
+		return nil, err
+	}
+	if err := deleteLegacyCA(ctx, s, issuer.PublicKey); err != nil {
+		return nil, err
+	}
+
+	config, err := getIssuersConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.DefaultIssuerID != issuer.ID {
+		return nil, nil
+	}
+
+	config.DefaultIssuerID = ""
+	if err := setIssuersConfig(ctx, s, config); err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{}
+	resp.AddWarning("Deleted the default issuer; no default issuer is configured anymore, and roles using the default issuer cannot sign certificates until a new default issuer is configured.")
+	return resp, nil
+}
+
+func (b *backend) pathIssuerPublicKeyRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, err := fetchIssuerByRef(ctx, req.Storage, data.Get("issuer_ref").(string))
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "text/plain",
+			logical.HTTPRawBody:     []byte(issuer.PublicKey),
+			logical.HTTPStatusCode:  200,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigIssuersRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &issuerConfigEntry{}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"default": config.DefaultIssuerID,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigIssuersWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ref := data.Get("default").(string)
+	if ref == "" || ref == defaultRef {
+		return logical.ErrorResponse("invalid issuer specification; must be a name or identifier of an existing issuer"), nil
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	issuer, err := fetchIssuerByRef(ctx, req.Storage, ref)
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return logical.ErrorResponse("unable to find SSH issuer for reference %q", ref), nil
+	}
+
+	if err := setIssuersConfig(ctx, req.Storage, &issuerConfigEntry{DefaultIssuerID: issuer.ID}); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"default": issuer.ID,
+		},
+	}, nil
+}
+
+func (b *backend) issuerResponse(ctx context.Context, s logical.Storage, issuer *sshIssuer) (*logical.Response, error) {
+	config, err := getIssuersConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"issuer_id":   issuer.ID,
+			"issuer_name": issuer.Name,
+			"key_type":    issuer.keyType(),
+			"public_key":  issuer.PublicKey,
+			"is_default":  config != nil && config.DefaultIssuerID == issuer.ID,
+		},
+	}
+	if issuer.ManagedKeyID != "" {
+		resp.Data["managed_key_id"] = issuer.ManagedKeyID
+		resp.Data["managed_key_name"] = issuer.ManagedKeyName
+	}
+
+	return resp, nil
+}
+
+func validateIssuerName(name string) (string, *logical.Response) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil
+	}
+	if name == defaultRef {
+		return "", logical.ErrorResponse("reserved keyword 'default' can not be used as issuer name")
+	}
+	if !issuerNameMatcher.MatchString(name) {
+		return "", logical.ErrorResponse("issuer name contained invalid characters")
+	}
+	return name, nil
+}
+
+const pathListIssuersHelpSyn = `List the issuers of this mount.`
+
+const pathListIssuersHelpDesc = `
+This endpoint lists the identifiers of the CA key pairs (issuers) configured
+on this mount, along with their name and key type.
+`
+
+const pathIssuersGenerateHelpSyn = `Generate a new issuer.`
+
+const pathIssuersGenerateHelpDesc = `
+This endpoint generates a new CA key pair (issuer). The first issuer of the
+mount becomes the default issuer; later issuers can be made the default with
+the config/issuers endpoint, once their public key has been distributed to
+the hosts.
+
+For security reasons, the private key cannot be retrieved later.
+`
+
+const pathIssuersImportHelpSyn = `Import an existing key pair as a new issuer.`
+
+const pathIssuersImportHelpDesc = `
+This endpoint imports an existing CA key pair as a new issuer. The fields must
+be in the standard private and public SSH format.
+
+Alternatively, the issuer can reference a managed key with managed_key_name or
+managed_key_id, in which case certificates are signed by the managed key and
+the private key is never stored by this mount.
+
+For security reasons, the private key cannot be retrieved later.
+`
+
+const pathIssuerHelpSyn = `Read, rename or delete an issuer.`
+
+const pathIssuerHelpDesc = `
+This endpoint allows reading the public key of an issuer, updating its name,
+or deleting it. Certificates are no longer signed with a deleted issuer, and
+its public key is no longer part of the public_key bundle.
+`
+
+const pathConfigIssuersHelpSyn = `Read and set the default issuer.`
+
+const pathConfigIssuersHelpDesc = `
+This endpoint allows setting the issuer used to sign certificates for roles
+which do not reference an issuer, as well as for the config/ca endpoint.
+`
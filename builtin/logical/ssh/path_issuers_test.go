@@ -0,0 +1,196 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ssh
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSH_Issuers(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(context.Background(), config)
+	require.NoError(t, err)
+
+	doReq := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Data:      data,
+			Storage:   config.StorageView,
+		})
+	}
+
+	readPublicKey := func(allIssuers bool) string {
+		t.Helper()
+		resp, err := doReq(logical.ReadOperation, "public_key", map[string]interface{}{"all_issuers": allIssuers})
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		return string(resp.Data[logical.HTTPRawBody].([]byte))
+	}
+
+	signingKey := func(role string) string {
+		t.Helper()
+		resp, err := doReq(logical.UpdateOperation, "sign/"+role, map[string]interface{}{
+			"public_key": testCAPublicKeyEd25519,
+		})
+		require.NoError(t, err)
+		require.False(t, resp.IsError(), resp.Error())
+		parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(resp.Data["signed_key"].(string)))
+		require.NoError(t, err)
+		return string(ssh.MarshalAuthorizedKey(parsed.(*ssh.Certificate).SignatureKey))
+	}
+
+	// Keys configured before issuers existed become the default issuer
+	for _, entry := range []*logical.StorageEntry{
+		mustStorageEntryJSON(t, caPublicKeyStoragePath, keyStorageEntry{Key: testCAPublicKey}),
+		mustStorageEntryJSON(t, caPrivateKeyStoragePath, keyStorageEntry{Key: testCAPrivateKey}),
+	} {
+		require.NoError(t, config.StorageView.Put(context.Background(), entry))
+	}
+	require.Equal(t, testCAPublicKey, readPublicKey(false))
+
+	// Until the mount is initialized, the legacy key pair is served as is
+	resp, err := doReq(logical.ListOperation, "issuers", nil)
+	require.NoError(t, err)
+	require.Empty(t, resp.Data["keys"])
+
+	initReq := &logical.InitializationRequest{Storage: config.StorageView}
+	require.NoError(t, b.Initialize(context.Background(), initReq))
+	require.NoError(t, b.Initialize(context.Background(), initReq))
+
+	resp, err = doReq(logical.ListOperation, "issuers", nil)
+	require.NoError(t, err)
+	require.Len(t, resp.Data["keys"], 1)
+	legacyID := resp.Data["keys"].([]string)[0]
+	entry, err := config.StorageView.Get(context.Background(), caPrivateKeyStoragePath)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+
+	resp, err = doReq(logical.UpdateOperation, "roles/default-issuer", map[string]interface{}{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"allowed_users":           "*",
+	})
+	require.NoError(t, err)
+	require.Nil(t, resp)
+	require.Equal(t, marshalPublicKey(t, testCAPublicKey), signingKey("default-issuer"))
+
+	// A new issuer is published alongside the default one before being used
+	resp, err = doReq(logical.UpdateOperation, "issuers/generate", map[string]interface{}{
+		"issuer_name": "next",
+		"key_type":    "ssh-ed25519",
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError(), resp.Error())
+	require.False(t, resp.Data["is_default"].(bool))
+	nextID := resp.Data["issuer_id"].(string)
+	nextPublicKey := resp.Data["public_key"].(string)
+
+	require.Equal(t, testCAPublicKey, readPublicKey(false))
+	require.Equal(t, strings.TrimSpace(testCAPublicKey)+"\n"+nextPublicKey, readPublicKey(true))
+
+	resp, err = doReq(logical.ReadOperation, "issuer/next/public_key", nil)
+	require.NoError(t, err)
+	require.Equal(t, nextPublicKey, string(resp.Data[logical.HTTPRawBody].([]byte)))
+
+	// Roles can sign with a given issuer
+	resp, err = doReq(logical.UpdateOperation, "roles/next-issuer", map[string]interface{}{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"allowed_users":           "*",
+		"issuer_ref":              "next",
+	})
+	require.NoError(t, err)
+	require.Nil(t, resp)
+	require.Equal(t, nextPublicKey, signingKey("next-issuer"))
+
+	resp, err = doReq(logical.UpdateOperation, "roles/unknown-issuer", map[string]interface{}{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"issuer_ref":              "unknown",
+	})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	// Switching the default issuer changes the signing key of roles using it
+	resp, err = doReq(logical.UpdateOperation, "config/issuers", map[string]interface{}{"default": "next"})
+	require.NoError(t, err)
+	require.Equal(t, nextID, resp.Data["default"])
+	require.Equal(t, nextPublicKey, signingKey("default-issuer"))
+	require.Equal(t, nextPublicKey+strings.TrimSpace(testCAPublicKey)+"\n", readPublicKey(true))
+
+	resp, err = doReq(logical.ReadOperation, "config/ca", nil)
+	require.NoError(t, err)
+	require.Equal(t, nextPublicKey, resp.Data["public_key"])
+
+	// Retiring the previous issuer removes it from the bundle
+	resp, err = doReq(logical.DeleteOperation, "issuer/"+legacyID, nil)
+	require.NoError(t, err)
+	require.Nil(t, resp)
+	require.Equal(t, nextPublicKey, readPublicKey(true))
+	entry, err = config.StorageView.Get(context.Background(), caPrivateKeyStoragePath)
+	require.NoError(t, err)
+	require.Nil(t, entry)
+
+	// Names must be unique, and importing requires a matching key pair
+	resp, err = doReq(logical.UpdateOperation, "issuers/import", map[string]interface{}{
+		"issuer_name": "next",
+		"private_key": testCAPrivateKey,
+	})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+	resp, err = doReq(logical.UpdateOperation, "issuers/import", map[string]interface{}{
+		"private_key": testCAPrivateKey,
+		"public_key":  nextPublicKey,
+	})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+	resp, err = doReq(logical.UpdateOperation, "issuers/import", map[string]interface{}{
+		"issuer_name": "previous",
+		"private_key": testCAPrivateKey,
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError(), resp.Error())
+
+	resp, err = doReq(logical.UpdateOperation, "issuer/previous", map[string]interface{}{"issuer_name": "default"})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	// Deleting the CA configuration deletes the default issuer only
+	resp, err = doReq(logical.DeleteOperation, "config/ca", nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.Warnings)
+	resp, err = doReq(logical.ReadOperation, "issuer/next", nil)
+	require.NoError(t, err)
+	require.Nil(t, resp)
+	resp, err = doReq(logical.ReadOperation, "issuer/previous", nil)
+	require.NoError(t, err)
+	require.False(t, resp.Data["is_default"].(bool))
+	resp, err = doReq(logical.UpdateOperation, "sign/default-issuer", map[string]interface{}{
+		"public_key": testCAPublicKeyEd25519,
+	})
+	require.Error(t, err)
+}
+
+func marshalPublicKey(t *testing.T, publicKey string) string {
+	t.Helper()
+	parsed, err := parsePublicSSHKey(publicKey)
+	require.NoError(t, err)
+	return string(ssh.MarshalAuthorizedKey(parsed))
+}
+
+func mustStorageEntryJSON(t *testing.T, path string, v interface{}) *logical.StorageEntry {
+	t.Helper()
+	entry, err := logical.StorageEntryJSON(path, v)
+	require.NoError(t, err)
+	return entry
+}
@@ -0,0 +1,553 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ssh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	certsStoragePrefix   = "certs/"
+	revokedStoragePrefix = "revoked/"
+	krlStoragePath       = "config/krl"
+)
+
+// sshCertificateEntry records a certificate signed for a role with
+// record_certificates set, so that it can be revoked by serial number.
+type sshCertificateEntry struct {
+	SerialNumber    string    `json:"serial_number"`
+	KeyID           string    `json:"key_id"`
+	IssuerID        string    `json:"issuer_id"`
+	CertificateType string    `json:"cert_type"`
+	ValidPrincipals []string  `json:"valid_principals"`
+	Expiration      time.Time `json:"expiration"`
+	RevocationTime  time.Time `json:"revocation_time,omitempty"`
+}
+
+// sshRevocationEntry revokes either a serial number or a key ID for the
+// certificates signed by an issuer.
+type sshRevocationEntry struct {
+	IssuerID       string    `json:"issuer_id"`
+	SerialNumber   string    `json:"serial_number,omitempty"`
+	KeyID          string    `json:"key_id,omitempty"`
+	RevocationTime time.Time `json:"revocation_time"`
+
+	// Expiration is only known for recorded certificates; revocations
+	// without it are kept in the KRL until their issuer is deleted.
+	Expiration time.Time `json:"expiration,omitempty"`
+}
+
+type krlStorageEntry struct {
+	Version uint64 `json:"version"`
+	KRL     []byte `json:"krl"`
+}
+
+func pathRevoke(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "revoke",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixSSH,
+			OperationVerb:   "revoke",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"serial_number": {
+				Type:        framework.TypeString,
+				Description: `Serial number of the certificate to revoke, in hexadecimal as returned when signing.`,
+			},
+			"key_id": {
+				Type:        framework.TypeString,
+				Description: `Key ID of the certificates to revoke. All certificates signed by the issuer with this key ID are revoked.`,
+			},
+			"issuer_ref": {
+				Type:        framework.TypeString,
+				Description: issuerRefDescription + ` Ignored when revoking a recorded certificate by serial number.`,
+				Default:     defaultRef,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRevokeWrite,
+		},
+
+		HelpSynopsis:    pathRevokeHelpSyn,
+		HelpDescription: pathRevokeHelpDesc,
+	}
+}
+
+func pathFetchKRL(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "krl",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixSSH,
+			OperationSuffix: "krl",
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchKRL,
+		},
+
+		HelpSynopsis:    `Retrieve the Key Revocation List.`,
+		HelpDescription: `This allows the OpenSSH Key Revocation List (KRL) of the certificates revoked on this mount to be fetched, for use with the RevokedKeys option of sshd. This is a raw response endpoint without JSON encoding; use an external tool (e.g., curl) to fetch this value.`,
+	}
+}
+
+func pathRotateKRL(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "krl/rotate",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixSSH,
+			OperationVerb:   "rotate",
+			OperationSuffix: "krl",
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateKRL,
+		},
+
+		HelpSynopsis:    `Force a rebuild of the Key Revocation List.`,
+		HelpDescription: `The KRL is rebuilt whenever a certificate is revoked. This rebuilds it on demand, dropping revoked certificates which have expired and signing it with the current default issuer.`,
+	}
+}
+
+func pathListCerts(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "certs/?$",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixSSH,
+			OperationSuffix: "certs",
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathCertsList,
+		},
+
+		HelpSynopsis:    `List the recorded certificates.`,
+		HelpDescription: `This lists the serial numbers of the certificates signed for roles with record_certificates set, along with their key ID, issuer, expiration and revocation time.`,
+	}
+}
+
+func pathFetchCert(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "cert/" + framework.GenericNameRegex("serial_number"),
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixSSH,
+			OperationSuffix: "cert",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"serial_number": {
+				Type:        framework.TypeString,
+				Description: `Serial number of the certificate, in hexadecimal.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathCertRead,
+		},
+
+		HelpSynopsis:    `Read a recorded certificate.`,
+		HelpDescription: `This reads the details recorded for a certificate signed for a role with record_certificates set.`,
+	}
+}
+
+func recordCertificate(ctx context.Context, s logical.Storage, issuerID string, certificate *ssh.Certificate) error {
+	certType := "user"
+	if certificate.CertType == ssh.HostCert {
+		certType = "host"
+	}
+
+	serial := strconv.FormatUint(certificate.Serial, 16)
+	entry, err := logical.StorageEntryJSON(certsStoragePrefix+serial, &sshCertificateEntry{
+		SerialNumber:    serial,
+		KeyID:           certificate.KeyId,
+		IssuerID:        issuerID,
+		CertificateType: certType,
+		ValidPrincipals: certificate.ValidPrincipals,
+		Expiration:      time.Unix(int64(certificate.ValidBefore), 0).UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func fetchCertificate(ctx context.Context, s logical.Storage, serial string) (*sshCertificateEntry, error) {
+	entry, err := s.Get(ctx, certsStoragePrefix+serial)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var cert sshCertificateEntry
+	if err := entry.DecodeJSON(&cert); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// normalizeSerial parses a hexadecimal serial number, accepting colons
+// between bytes, and formats it as returned when signing.
+func normalizeSerial(serial string) (uint64, string, error) {
+	parsed, err := strconv.ParseUint(strings.ReplaceAll(strings.TrimSpace(serial), ":", ""), 16, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid serial number %q: must be hexadecimal", serial)
+	}
+	return parsed, strconv.FormatUint(parsed, 16), nil
+}
+
+func (b *backend) pathRevokeWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	serialRaw := data.Get("serial_number").(string)
+	keyID := data.Get("key_id").(string)
+	switch {
+	case serialRaw == "" && keyID == "":
+		return logical.ErrorResponse("one of serial_number or key_id must be set"), nil
+	case serialRaw != "" && keyID != "":
+		return logical.ErrorResponse("only one of serial_number or key_id may be set"), nil
+	}
+
+	b.revocationLock.Lock()
+	defer b.revocationLock.Unlock()
+
+	revocation := &sshRevocationEntry{
+		KeyID:          keyID,
+		RevocationTime: time.Now().UTC(),
+	}
+
+	var cert *sshCertificateEntry
+	if serialRaw != "" {
+		_, serial, err := normalizeSerial(serialRaw)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		revocation.SerialNumber = serial
+
+		cert, err = fetchCertificate(ctx, req.Storage, serial)
+		if err != nil {
+			return nil, err
+		}
+		if cert != nil {
+			if !cert.RevocationTime.IsZero() {
+				return revocationResponse(cert.RevocationTime), nil
+			}
+			revocation.IssuerID = cert.IssuerID
+			revocation.Expiration = cert.Expiration
+		}
+	}
+
+	if revocation.IssuerID == "" {
+		issuerRef := data.Get("issuer_ref").(string)
+		issuer, err := fetchIssuerByRef(ctx, req.Storage, issuerRef)
+		if err != nil {
+			return nil, err
+		}
+		if issuer == nil {
+			return logical.ErrorResponse("unable to find SSH issuer for reference %q", issuerRef), nil
+		}
+		revocation.IssuerID = issuer.ID
+	}
+
+	path := revocationStoragePath(revocation)
+	existing, err := req.Storage.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		var previous sshRevocationEntry
+		if err := existing.DecodeJSON(&previous); err != nil {
+			return nil, err
+		}
+		return revocationResponse(previous.RevocationTime), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(path, revocation)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	if cert != nil {
+		cert.RevocationTime = revocation.RevocationTime
+		entry, err := logical.StorageEntryJSON(certsStoragePrefix+cert.SerialNumber, cert)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := revocationResponse(revocation.RevocationTime)
+	if _, err := b.rebuildKRL(ctx, req.Storage); err != nil {
+		b.Logger().Error("failed to rebuild KRL after revocation", "error", err)
+		resp.AddWarning(fmt.Sprintf("The certificate was revoked, but the KRL could not be rebuilt: %v", err))
+	}
+	return resp, nil
+}
+
+func revocationStoragePath(revocation *sshRevocationEntry) string {
+	if revocation.SerialNumber != "" {
+		return revokedStoragePrefix + revocation.IssuerID + "/serial-" + revocation.SerialNumber
+	}
+	// Key IDs are arbitrary strings, so they are hashed to form a storage key
+	keyIDHash := sha256.Sum256([]byte(revocation.KeyID))
+	return revokedStoragePrefix + revocation.IssuerID + "/key-id-" + hex.EncodeToString(keyIDHash[:])
+}
+
+func revocationResponse(revocationTime time.Time) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"revocation_time":         revocationTime.Unix(),
+			"revocation_time_rfc3339": revocationTime.Format(time.RFC3339Nano),
+		},
+	}
+}
+
+// rebuildKRL builds and stores a new KRL from the revocations of the issuers
+// of the mount, signed by the default issuer. The revocation lock must be
+// held.
+func (b *backend) rebuildKRL(ctx context.Context, s logical.Storage) (*krlStorageEntry, error) {
+	previous, err := getKRL(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	k := &krl{
+		Version:     1,
+		GeneratedAt: now,
+		Comment:     "Vault SSH secrets engine",
+	}
+	if previous != nil {
+		k.Version = previous.Version + 1
+	}
+
+	issuerIDs, err := s.List(ctx, revokedStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, issuerID := range issuerIDs {
+		issuerID = strings.TrimSuffix(issuerID, "/")
+		issuer, err := fetchIssuerByID(ctx, s, issuerID)
+		if err != nil {
+			return nil, err
+		}
+		if issuer == nil {
+			continue
+		}
+		caKey, err := parsePublicSSHKey(issuer.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key of issuer %q: %w", issuer.ID, err)
+		}
+
+		certs := krlCertificates{CAKey: caKey}
+		names, err := s.List(ctx, revokedStoragePrefix+issuerID+"/")
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			entry, err := s.Get(ctx, revokedStoragePrefix+issuerID+"/"+name)
+			if err != nil {
+				return nil, err
+			}
+			if entry == nil {
+				continue
+			}
+			var revocation sshRevocationEntry
+			if err := entry.DecodeJSON(&revocation); err != nil {
+				return nil, err
+			}
+			if !revocation.Expiration.IsZero() && revocation.Expiration.Before(now) {
+				continue
+			}
+
+			if revocation.SerialNumber != "" {
+				serial, _, err := normalizeSerial(revocation.SerialNumber)
+				if err != nil {
+					return nil, err
+				}
+				certs.Serials = append(certs.Serials, serial)
+			} else {
+				certs.KeyIDs = append(certs.KeyIDs, revocation.KeyID)
+			}
+		}
+		k.Certificates = append(k.Certificates, certs)
+	}
+
+	issuer, err := fetchIssuerByRef(ctx, s, defaultRef)
+	if err != nil {
+		return nil, err
+	}
+	var krlBytes []byte
+	if issuer != nil {
+		err = b.withIssuerSigner(ctx, issuer, func(signer ssh.Signer) error {
+			krlBytes, err = k.marshal(signer)
+			return err
+		})
+	} else {
+		krlBytes, err = k.marshal(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &krlStorageEntry{
+		Version: k.Version,
+		KRL:     krlBytes,
+	}
+	entry, err := logical.StorageEntryJSON(krlStoragePath, result)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func getKRL(ctx context.Context, s logical.Storage) (*krlStorageEntry, error) {
+	entry, err := s.Get(ctx, krlStoragePath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result krlStorageEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathFetchKRL(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	result, err := getKRL(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		b.revocationLock.Lock()
+		result, err = getKRL(ctx, req.Storage)
+		if err == nil && result == nil {
+			result, err = b.rebuildKRL(ctx, req.Storage)
+		}
+		b.revocationLock.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/octet-stream",
+			logical.HTTPRawBody:     result.KRL,
+			logical.HTTPStatusCode:  200,
+		},
+	}, nil
+}
+
+func (b *backend) pathRotateKRL(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	b.revocationLock.Lock()
+	defer b.revocationLock.Unlock()
+
+	result, err := b.rebuildKRL(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"krl_version": result.Version,
+		},
+	}, nil
+}
+
+func (b *backend) pathCertsList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	serials, err := req.Storage.List(ctx, certsStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := make(map[string]interface{}, len(serials))
+	for _, serial := range serials {
+		cert, err := fetchCertificate(ctx, req.Storage, serial)
+		if err != nil {
+			return nil, err
+		}
+		if cert == nil {
+			continue
+		}
+		keyInfo[serial] = cert.responseData()
+	}
+
+	return logical.ListResponseWithInfo(serials, keyInfo), nil
+}
+
+func (b *backend) pathCertRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, serial, err := normalizeSerial(data.Get("serial_number").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	cert, err := fetchCertificate(ctx, req.Storage, serial)
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: cert.responseData(),
+	}, nil
+}
+
+func (c *sshCertificateEntry) responseData() map[string]interface{} {
+	data := map[string]interface{}{
+		"serial_number":    c.SerialNumber,
+		"key_id":           c.KeyID,
+		"issuer_id":        c.IssuerID,
+		"cert_type":        c.CertificateType,
+		"valid_principals": c.ValidPrincipals,
+		"expiration":       c.Expiration.Unix(),
+		"revocation_time":  int64(0),
+	}
+	if !c.RevocationTime.IsZero() {
+		data["revocation_time"] = c.RevocationTime.Unix()
+	}
+	return data
+}
+
+const pathRevokeHelpSyn = `Revoke certificates.`
+
+const pathRevokeHelpDesc = `
+This endpoint revokes a certificate by serial number, or all certificates with
+a given key ID, and rebuilds the Key Revocation List served by the krl
+endpoint.
+
+Certificates signed for roles with record_certificates set are revoked with
+the issuer which signed them; otherwise, issuer_ref specifies the issuer.
+`
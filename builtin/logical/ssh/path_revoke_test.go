@@ -0,0 +1,261 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ssh
+
+import (
+	"context"
+	"encoding/binary"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSH_RevokeKRL(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(context.Background(), config)
+	require.NoError(t, err)
+
+	doReq := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Data:      data,
+			Storage:   config.StorageView,
+		})
+	}
+
+	readKRL := func() []byte {
+		t.Helper()
+		resp, err := doReq(logical.ReadOperation, "krl", nil)
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		require.Equal(t, "application/octet-stream", resp.Data[logical.HTTPContentType])
+		return resp.Data[logical.HTTPRawBody].([]byte)
+	}
+
+	resp, err := doReq(logical.UpdateOperation, "config/ca", map[string]interface{}{"key_type": "ssh-ed25519"})
+	require.NoError(t, err)
+	caKey, err := parsePublicSSHKey(resp.Data["public_key"].(string))
+	require.NoError(t, err)
+
+	// An empty KRL is served before anything is revoked
+	parsed := parseTestKRL(t, readKRL(), caKey)
+	require.Equal(t, uint64(1), parsed.version)
+	require.Empty(t, parsed.serials)
+
+	for _, role := range []string{"recorded", "unrecorded"} {
+		resp, err = doReq(logical.UpdateOperation, "roles/"+role, map[string]interface{}{
+			"key_type":                "ca",
+			"allow_user_certificates": true,
+			"allow_user_key_ids":      true,
+			"allowed_users":           "*",
+			"record_certificates":     role == "recorded",
+		})
+		require.NoError(t, err)
+		require.Nil(t, resp)
+	}
+
+	sign := func(role, keyID string) uint64 {
+		t.Helper()
+		resp, err := doReq(logical.UpdateOperation, "sign/"+role, map[string]interface{}{
+			"public_key": testCAPublicKeyEd25519,
+			"key_id":     keyID,
+		})
+		require.NoError(t, err)
+		require.False(t, resp.IsError(), resp.Error())
+		serial, err := strconv.ParseUint(resp.Data["serial_number"].(string), 16, 64)
+		require.NoError(t, err)
+		return serial
+	}
+
+	recorded := sign("recorded", "laptop")
+	unrecorded := sign("unrecorded", "build")
+	sign("unrecorded", "stolen")
+
+	// Only certificates of roles with record_certificates are recorded
+	resp, err = doReq(logical.ListOperation, "certs", nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{strconv.FormatUint(recorded, 16)}, resp.Data["keys"])
+
+	resp, err = doReq(logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": strconv.FormatUint(recorded, 16),
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError(), resp.Error())
+	revocationTime := resp.Data["revocation_time"]
+
+	resp, err = doReq(logical.ReadOperation, "cert/"+strconv.FormatUint(recorded, 16), nil)
+	require.NoError(t, err)
+	require.Equal(t, "laptop", resp.Data["key_id"])
+	require.Equal(t, revocationTime, resp.Data["revocation_time"])
+
+	// Revoking again keeps the original revocation time
+	resp, err = doReq(logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": strconv.FormatUint(recorded, 16),
+	})
+	require.NoError(t, err)
+	require.Equal(t, revocationTime, resp.Data["revocation_time"])
+
+	// Certificates which were not recorded are revoked for the given issuer
+	resp, err = doReq(logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": strconv.FormatUint(unrecorded, 16),
+		"issuer_ref":    "default",
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError(), resp.Error())
+	resp, err = doReq(logical.UpdateOperation, "revoke", map[string]interface{}{"key_id": "stolen"})
+	require.NoError(t, err)
+	require.False(t, resp.IsError(), resp.Error())
+
+	parsed = parseTestKRL(t, readKRL(), caKey)
+	require.Equal(t, uint64(4), parsed.version)
+	require.ElementsMatch(t, []uint64{recorded, unrecorded}, parsed.serials)
+	require.Equal(t, []string{"stolen"}, parsed.keyIDs)
+
+	resp, err = doReq(logical.UpdateOperation, "krl/rotate", nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), resp.Data["krl_version"])
+
+	// Tidy keeps records until their certificate expired past the safety buffer
+	tidy := func(data map[string]interface{}) (int, int) {
+		t.Helper()
+		resp, err := doReq(logical.UpdateOperation, "tidy", data)
+		require.NoError(t, err)
+		require.False(t, resp.IsError(), resp.Error())
+		return resp.Data["cert_store_deleted_count"].(int), resp.Data["revoked_cert_deleted_count"].(int)
+	}
+	certsDeleted, revocationsDeleted := tidy(map[string]interface{}{"safety_buffer": 0})
+	require.Zero(t, certsDeleted)
+	require.Zero(t, revocationsDeleted)
+
+	cert, err := fetchCertificate(context.Background(), config.StorageView, strconv.FormatUint(recorded, 16))
+	require.NoError(t, err)
+	cert.Expiration = time.Now().Add(-time.Hour).UTC()
+	require.NoError(t, config.StorageView.Put(context.Background(), mustStorageEntryJSON(t, certsStoragePrefix+cert.SerialNumber, cert)))
+	revocationPath := revocationStoragePath(&sshRevocationEntry{IssuerID: cert.IssuerID, SerialNumber: cert.SerialNumber})
+	entry, err := config.StorageView.Get(context.Background(), revocationPath)
+	require.NoError(t, err)
+	var revocation sshRevocationEntry
+	require.NoError(t, entry.DecodeJSON(&revocation))
+	revocation.Expiration = cert.Expiration
+	require.NoError(t, config.StorageView.Put(context.Background(), mustStorageEntryJSON(t, revocationPath, revocation)))
+
+	certsDeleted, revocationsDeleted = tidy(nil)
+	require.Zero(t, certsDeleted)
+	require.Zero(t, revocationsDeleted)
+
+	certsDeleted, revocationsDeleted = tidy(map[string]interface{}{"safety_buffer": "30m"})
+	require.Equal(t, 1, certsDeleted)
+	require.Equal(t, 1, revocationsDeleted)
+	resp, err = doReq(logical.ListOperation, "certs", nil)
+	require.NoError(t, err)
+	require.Empty(t, resp.Data["keys"])
+
+	parsed = parseTestKRL(t, readKRL(), caKey)
+	require.Equal(t, uint64(6), parsed.version)
+	require.Equal(t, []uint64{unrecorded}, parsed.serials)
+	require.Equal(t, []string{"stolen"}, parsed.keyIDs)
+
+	// Revocations without an expiration are removed along with their issuer
+	resp, err = doReq(logical.DeleteOperation, "issuer/default", nil)
+	require.NoError(t, err)
+	_, revocationsDeleted = tidy(map[string]interface{}{"tidy_cert_store": false})
+	require.Equal(t, 2, revocationsDeleted)
+	names, err := config.StorageView.List(context.Background(), revokedStoragePrefix)
+	require.NoError(t, err)
+	require.Empty(t, names)
+
+	// Invalid requests
+	for _, data := range []map[string]interface{}{
+		{},
+		{"serial_number": "1", "key_id": "build"},
+		{"serial_number": "not-hex"},
+		{"key_id": "build", "issuer_ref": "unknown"},
+	} {
+		resp, err = doReq(logical.UpdateOperation, "revoke", data)
+		require.NoError(t, err)
+		require.True(t, resp.IsError(), data)
+	}
+}
+
+type testKRL struct {
+	version uint64
+	serials []uint64
+	keyIDs  []string
+}
+
+// parseTestKRL parses the subset of the KRL format generated by the backend,
+// verifying that the KRL is signed by the CA key.
+func parseTestKRL(t *testing.T, data []byte, caKey ssh.PublicKey) *testKRL {
+	t.Helper()
+
+	readString := func(buf []byte) ([]byte, []byte) {
+		require.GreaterOrEqual(t, len(buf), 4)
+		n := binary.BigEndian.Uint32(buf)
+		require.GreaterOrEqual(t, len(buf), int(4+n))
+		return buf[4 : 4+n], buf[4+n:]
+	}
+
+	require.Equal(t, krlMagic, binary.BigEndian.Uint64(data))
+	require.Equal(t, krlFormatVersion, binary.BigEndian.Uint32(data[8:]))
+	result := &testKRL{version: binary.BigEndian.Uint64(data[12:])}
+
+	rest := data[36:]
+	_, rest = readString(rest) // reserved
+	_, rest = readString(rest) // comment
+
+	signed := false
+	for len(rest) > 0 {
+		sectionType := rest[0]
+		var section []byte
+		section, rest = readString(rest[1:])
+
+		switch sectionType {
+		case krlSectionCertificates:
+			var sectionCAKey []byte
+			sectionCAKey, section = readString(section)
+			require.Equal(t, caKey.Marshal(), sectionCAKey)
+			_, section = readString(section) // reserved
+			for len(section) > 0 {
+				certSectionType := section[0]
+				var list []byte
+				list, section = readString(section[1:])
+				switch certSectionType {
+				case krlSectionCertSerialList:
+					for ; len(list) > 0; list = list[8:] {
+						result.serials = append(result.serials, binary.BigEndian.Uint64(list))
+					}
+				case krlSectionCertKeyID:
+					for len(list) > 0 {
+						var keyID []byte
+						keyID, list = readString(list)
+						result.keyIDs = append(result.keyIDs, string(keyID))
+					}
+				default:
+					t.Fatalf("unexpected certificate section type %x", certSectionType)
+				}
+			}
+		case krlSectionSignature:
+			require.Equal(t, caKey.Marshal(), section)
+			signedData := data[:len(data)-len(rest)]
+			var signatureBytes []byte
+			signatureBytes, rest = readString(rest)
+			var signature ssh.Signature
+			require.NoError(t, ssh.Unmarshal(signatureBytes, &signature))
+			require.NoError(t, caKey.Verify(signedData, &signature))
+			signed = true
+		default:
+			t.Fatalf("unexpected section type %x", sectionType)
+		}
+	}
+	require.True(t, signed)
+
+	return result
+}
@@ -66,6 +66,8 @@ type sshRole struct {
 	AlgorithmSigner            string            `mapstructure:"algorithm_signer" json:"algorithm_signer"`
 	Version                    int               `mapstructure:"role_version" json:"role_version"`
 	NotBeforeDuration          time.Duration     `mapstructure:"not_before_duration" json:"not_before_duration"`
+	IssuerRef                  string            `mapstructure:"issuer_ref" json:"issuer_ref"`
+	RecordCertificates         bool              `mapstructure:"record_certificates" json:"record_certificates"`
 }
 
 func pathListRoles(b *backend) *framework.Path {
@@ -363,6 +365,30 @@ func pathRoles(b *backend) *framework.Path {
 					Value: 30,
 				},
 			},
+			"issuer_ref": {
+				Type:    framework.TypeString,
+				Default: defaultRef,
+				Description: `
+				[Not applicable for OTP type] [Optional for CA type]
+				Reference to the issuer used to sign certificates; either "default"
+				for the configured default issuer, an identifier or the name assigned
+				to the issuer.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Issuer",
+					Value: defaultRef,
+				},
+			},
+			"record_certificates": {
+				Type: framework.TypeBool,
+				Description: `
+				[Not applicable for OTP type] [Optional for CA type]
+				If set, the serial number, key ID and expiration of signed
+				certificates are recorded, so that they can be listed and
+				revoked by serial number.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "Record certificates",
+				},
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -460,6 +486,16 @@ func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, d *fr
 		if errorResponse != nil {
 			return errorResponse, nil
 		}
+
+		if role.IssuerRef != defaultRef {
+			issuer, err := fetchIssuerByRef(ctx, req.Storage, role.IssuerRef)
+			if err != nil {
+				return nil, err
+			}
+			if issuer == nil {
+				return logical.ErrorResponse("unable to find SSH issuer for reference %q", role.IssuerRef), nil
+			}
+		}
 		roleEntry = *role
 	} else {
 		return logical.ErrorResponse("invalid key type"), nil
@@ -499,6 +535,8 @@ func (b *backend) createCARole(allowedUsers, defaultUser, signer string, data *f
 		AlgorithmSigner:           signer,
 		Version:                   roleEntryVersion,
 		NotBeforeDuration:         time.Duration(data.Get("not_before_duration").(int)) * time.Second,
+		IssuerRef:                 data.Get("issuer_ref").(string),
+		RecordCertificates:        data.Get("record_certificates").(bool),
 	}
 
 	if !role.AllowUserCertificates && !role.AllowHostCertificates {
@@ -527,6 +565,15 @@ func (b *backend) createCARole(allowedUsers, defaultUser, signer string, data *f
 	return role, nil
 }
 
+// issuerRef returns the reference to the issuer signing certificates for the
+// role; roles created before issuers existed use the default issuer.
+func (role *sshRole) issuerRef() string {
+	if role.IssuerRef == "" {
+		return defaultRef
+	}
+	return role.IssuerRef
+}
+
 func (b *backend) getRole(ctx context.Context, s logical.Storage, n string) (*sshRole, error) {
 	entry, err := s.Get(ctx, "roles/"+n)
 	if err != nil {
@@ -587,17 +634,17 @@ func (b *backend) checkUpgrade(ctx context.Context, s logical.Storage, n string,
 		// signing key type as we want to make ssh-rsa an explicitly notated
 		// algorithm choice.
 		var publicKey ssh.PublicKey
-		publicKeyEntry, err := caKey(ctx, s, caPublicKey)
+		issuer, err := fetchIssuerByRef(ctx, s, result.issuerRef())
 		if err != nil {
 			b.Logger().Debug(fmt.Sprintf("failed to load public key entry while attempting to migrate: %v", err))
 			goto SKIPVERSION2
 		}
-		if publicKeyEntry == nil || publicKeyEntry.Key == "" {
+		if issuer == nil || issuer.PublicKey == "" {
 			b.Logger().Debug(fmt.Sprintf("got empty public key entry while attempting to migrate"))
 			goto SKIPVERSION2
 		}
 
-		publicKey, err = parsePublicSSHKey(publicKeyEntry.Key)
+		publicKey, err = parsePublicSSHKey(issuer.PublicKey)
 		if err == nil {
 			// Move an empty signing algorithm to an explicit ssh-rsa (SHA-1)
 			// if this key is of type RSA. This isn't a secure default but
@@ -691,6 +738,8 @@ func (b *backend) parseRole(role *sshRole) (map[string]interface{}, error) {
 			"allowed_user_key_lengths":    role.AllowedUserKeyTypesLengths,
 			"algorithm_signer":            role.AlgorithmSigner,
 			"not_before_duration":         int64(role.NotBeforeDuration.Seconds()),
+			"issuer_ref":                  role.issuerRef(),
+			"record_certificates":         role.RecordCertificates,
 		}
 	case KeyTypeDynamic:
 		return nil, fmt.Errorf("dynamic key type roles are no longer supported")
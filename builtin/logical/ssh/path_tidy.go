@@ -0,0 +1,170 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const defaultTidySafetyBuffer = 72 * time.Hour
+
+func pathTidy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy$",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixSSH,
+			OperationVerb:   "tidy",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"tidy_cert_store": {
+				Type:        framework.TypeBool,
+				Description: `Set to true to remove the recorded certificates which have expired.`,
+				Default:     true,
+			},
+			"tidy_revoked_certs": {
+				Type:        framework.TypeBool,
+				Description: `Set to true to remove the revocations of certificates which have expired, and the revocations of deleted issuers.`,
+				Default:     true,
+			},
+			"safety_buffer": {
+				Type:        framework.TypeDurationSecond,
+				Description: `The amount of extra time that must have passed beyond the expiration of a certificate before its records are removed. Defaults to 72 hours.`,
+				Default:     int(defaultTidySafetyBuffer / time.Second),
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathTidyWrite,
+		},
+
+		HelpSynopsis:    pathTidyHelpSyn,
+		HelpDescription: pathTidyHelpDesc,
+	}
+}
+
+func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	tidyCertStore := data.Get("tidy_cert_store").(bool)
+	tidyRevokedCerts := data.Get("tidy_revoked_certs").(bool)
+	safetyBuffer := time.Duration(data.Get("safety_buffer").(int)) * time.Second
+	if safetyBuffer < 0 {
+		return logical.ErrorResponse("safety_buffer must be greater than or equal to zero"), nil
+	}
+
+	b.revocationLock.Lock()
+	defer b.revocationLock.Unlock()
+
+	cutoff := time.Now().Add(-safetyBuffer)
+
+	var certsDeleted int
+	if tidyCertStore {
+		serials, err := req.Storage.List(ctx, certsStoragePrefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list recorded certificates: %w", err)
+		}
+		for _, serial := range serials {
+			cert, err := fetchCertificate(ctx, req.Storage, serial)
+			if err != nil {
+				return nil, err
+			}
+			if cert == nil || !cert.Expiration.Before(cutoff) {
+				continue
+			}
+			if err := req.Storage.Delete(ctx, certsStoragePrefix+serial); err != nil {
+				return nil, fmt.Errorf("failed to delete recorded certificate %q: %w", serial, err)
+			}
+			certsDeleted++
+		}
+	}
+
+	var revocationsDeleted int
+	if tidyRevokedCerts {
+		var err error
+		revocationsDeleted, err = tidyRevocations(ctx, req.Storage, cutoff)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"cert_store_deleted_count":   certsDeleted,
+			"revoked_cert_deleted_count": revocationsDeleted,
+		},
+	}
+	if revocationsDeleted > 0 {
+		if _, err := b.rebuildKRL(ctx, req.Storage); err != nil {
+			b.Logger().Error("failed to rebuild KRL after tidy", "error", err)
+			resp.AddWarning(fmt.Sprintf("Revocations were removed, but the KRL could not be rebuilt: %v", err))
+		}
+	}
+	return resp, nil
+}
+
+// tidyRevocations removes the revocations of certificates which expired
+// before the cutoff, along with every revocation of issuers which no longer
+// exist. The revocation lock must be held.
+func tidyRevocations(ctx context.Context, s logical.Storage, cutoff time.Time) (int, error) {
+	issuerIDs, err := s.List(ctx, revokedStoragePrefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list revocations: %w", err)
+	}
+
+	var deleted int
+	for _, issuerID := range issuerIDs {
+		issuerID = strings.TrimSuffix(issuerID, "/")
+		issuer, err := fetchIssuerByID(ctx, s, issuerID)
+		if err != nil {
+			return deleted, err
+		}
+
+		prefix := revokedStoragePrefix + issuerID + "/"
+		names, err := s.List(ctx, prefix)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to list revocations of issuer %q: %w", issuerID, err)
+		}
+		for _, name := range names {
+			if issuer != nil {
+				entry, err := s.Get(ctx, prefix+name)
+				if err != nil {
+					return deleted, err
+				}
+				if entry == nil {
+					continue
+				}
+				var revocation sshRevocationEntry
+				if err := entry.DecodeJSON(&revocation); err != nil {
+					return deleted, err
+				}
+				if revocation.Expiration.IsZero() || !revocation.Expiration.Before(cutoff) {
+					continue
+				}
+			}
+
+			if err := s.Delete(ctx, prefix+name); err != nil {
+				return deleted, fmt.Errorf("failed to delete revocation %q: %w", prefix+name, err)
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+const pathTidyHelpSyn = `Tidy up the recorded certificates and revocations.`
+
+const pathTidyHelpDesc = `
+This endpoint removes the recorded certificates and the revocations of
+certificates which expired more than safety_buffer ago. Revocations by key ID,
+and of certificates which were not recorded, have no known expiration and are
+only removed once the issuer which signed them is deleted.
+
+The KRL is rebuilt when revocations are removed.
+`
@@ -6,11 +6,10 @@ package totp
 import (
 	"context"
 	"strings"
-	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
-	cache "github.com/patrickmn/go-cache"
 )
 
 const operationPrefixTOTP = "totp"
@@ -44,7 +43,7 @@ func Backend() *backend {
 		BackendType: logical.TypeLogical,
 	}
 
-	b.usedCodes = cache.New(0, 30*time.Second)
+	b.keyLocks = locksutil.CreateLocks()
 
 	return &b
 }
@@ -52,9 +51,12 @@ func Backend() *backend {
 type backend struct {
 	*framework.Backend
 
-	usedCodes *cache.Cache
+	// keyLocks serializes updates of the counter and last used time step of
+	// the keys
+	keyLocks []*locksutil.LockEntry
 }
 
 const backendHelp = `
-The TOTP backend dynamically generates time-based one-time use passwords.
+The TOTP backend dynamically generates and validates time-based (TOTP) and
+counter-based (HOTP) one-time use passwords.
 `
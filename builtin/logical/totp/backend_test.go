@@ -18,6 +18,7 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/mitchellh/mapstructure"
 	otplib "github.com/pquerna/otp"
+	hotplib "github.com/pquerna/otp/hotp"
 	totplib "github.com/pquerna/otp/totp"
 )
 
@@ -347,6 +348,193 @@ func TestBackend_keyCrudDefaultValues(t *testing.T) {
 	})
 }
 
+func TestBackend_keyReplayedCode(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := createKey()
+
+	keyData := map[string]interface{}{
+		"key":      key,
+		"generate": false,
+	}
+
+	now := time.Now()
+	opts := totplib.ValidateOpts{
+		Period:    30,
+		Digits:    otplib.DigitsSix,
+		Algorithm: otplib.AlgorithmSHA1,
+	}
+	previousCode, _ := totplib.GenerateCodeCustom(key, now.Add(-30*time.Second), opts)
+	code, _ := totplib.GenerateCodeCustom(key, now, opts)
+
+	logicaltest.Test(t, logicaltest.TestCase{
+		LogicalBackend: b,
+		Steps: []logicaltest.TestStep{
+			testAccStepCreateKey(t, "test", keyData, false),
+			testAccStepValidateCode(t, "test", code, true, false),
+		},
+	})
+
+	// The last used time step is persisted, so a new backend rejects the
+	// code, as well as the code of the previous time step
+	b, err = Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logicaltest.Test(t, logicaltest.TestCase{
+		LogicalBackend: b,
+		Steps: []logicaltest.TestStep{
+			testAccStepValidateCode(t, "test", code, false, true),
+			testAccStepValidateCode(t, "test", previousCode, false, true),
+		},
+	})
+}
+
+func TestBackend_hotpKey(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := createKey()
+
+	keyData := map[string]interface{}{
+		"key":        key,
+		"generate":   false,
+		"type":       "hotp",
+		"counter":    5,
+		"look_ahead": 2,
+	}
+
+	expected := map[string]interface{}{
+		"issuer":       "",
+		"account_name": "",
+		"digits":       otplib.DigitsSix,
+		"period":       0,
+		"algorithm":    otplib.AlgorithmSHA1,
+		"key":          key,
+	}
+
+	hotpCode := func(counter uint64) string {
+		code, err := hotplib.GenerateCode(key, counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	logicaltest.Test(t, logicaltest.TestCase{
+		LogicalBackend: b,
+		Steps: []logicaltest.TestStep{
+			testAccStepCreateKey(t, "test", keyData, false),
+			testAccStepReadKey(t, "test", expected),
+			testAccStepReadHOTPCounter(t, "test", 5),
+			// Generated codes use up the counter
+			testAccStepReadHOTPCreds(t, "test", hotpCode(5)),
+			testAccStepReadHOTPCreds(t, "test", hotpCode(6)),
+			testAccStepReadHOTPCounter(t, "test", 7),
+			// Codes before the counter or after the look-ahead window are rejected
+			testAccStepValidateCode(t, "test", hotpCode(6), false, false),
+			testAccStepValidateCode(t, "test", hotpCode(10), false, false),
+			// Codes within the look-ahead window resynchronize the counter
+			testAccStepValidateCode(t, "test", hotpCode(9), true, false),
+			testAccStepReadHOTPCounter(t, "test", 10),
+			testAccStepValidateCode(t, "test", hotpCode(9), false, false),
+			testAccStepValidateCode(t, "test", hotpCode(8), false, false),
+			testAccStepValidateCode(t, "test", hotpCode(10), true, false),
+			testAccStepReadHOTPCounter(t, "test", 11),
+		},
+	})
+}
+
+func TestBackend_hotpKeyGenerateAdvancesCounter(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"generate":     true,
+			"type":         "hotp",
+			"issuer":       "Vault",
+			"account_name": "Test",
+		},
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+
+	readCode := func() string {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "code/test",
+			Storage:   config.StorageView,
+		})
+		if err != nil || resp.IsError() {
+			t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+		}
+		return resp.Data["code"].(string)
+	}
+
+	first, second := readCode(), readCode()
+	if first == second {
+		t.Fatalf("two reads returned the same code %q", first)
+	}
+}
+
+func TestBackend_hotpKeyURL(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := createKey()
+
+	keyData := map[string]interface{}{
+		"url":      "otpauth://hotp/Vault:test@email.com?secret=" + key + "&counter=42",
+		"generate": false,
+	}
+
+	generatedKeyData := map[string]interface{}{
+		"issuer":       "Vault",
+		"account_name": "test@email.com",
+		"generate":     true,
+		"exported":     false,
+		"type":         "hotp",
+	}
+
+	logicaltest.Test(t, logicaltest.TestCase{
+		LogicalBackend: b,
+		Steps: []logicaltest.TestStep{
+			testAccStepCreateKey(t, "test", keyData, false),
+			testAccStepReadHOTPCounter(t, "test", 42),
+			testAccStepCreateKey(t, "generated", generatedKeyData, false),
+			testAccStepReadHOTPCounter(t, "generated", 0),
+			testAccStepCreateKey(t, "invalid", map[string]interface{}{
+				"key":      key,
+				"generate": false,
+				"type":     "motp",
+			}, true),
+		},
+	})
+}
+
 func TestBackend_createKeyMissingKeyValue(t *testing.T) {
 	config := logical.TestBackendConfig()
 	config.StorageView = &logical.InmemStorage{}
@@ -1152,6 +1340,35 @@ func testAccStepReadCreds(t *testing.T, b logical.Backend, s logical.Storage, na
 	}
 }
 
+func testAccStepReadHOTPCreds(t *testing.T, name string, expected string) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.ReadOperation,
+		Path:      path.Join("code", name),
+		Check: func(resp *logical.Response) error {
+			if resp.Data["code"] != expected {
+				return fmt.Errorf("code should equal: %s", expected)
+			}
+			return nil
+		},
+	}
+}
+
+func testAccStepReadHOTPCounter(t *testing.T, name string, expected uint64) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.ReadOperation,
+		Path:      "keys/" + name,
+		Check: func(resp *logical.Response) error {
+			if resp.Data["type"] != "hotp" {
+				return fmt.Errorf("type should equal: hotp")
+			}
+			if resp.Data["counter"] != expected {
+				return fmt.Errorf("counter should equal: %d, got %v", expected, resp.Data["counter"])
+			}
+			return nil
+		},
+	}
+}
+
 func testAccStepReadKey(t *testing.T, name string, expected map[string]interface{}) logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.ReadOperation,
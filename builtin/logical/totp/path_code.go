@@ -9,8 +9,10 @@ import (
 	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	otplib "github.com/pquerna/otp"
+	hotplib "github.com/pquerna/otp/hotp"
 	totplib "github.com/pquerna/otp/totp"
 )
 
@@ -30,7 +32,7 @@ func pathCode(b *backend) *framework.Path {
 			},
 			"code": {
 				Type:        framework.TypeString,
-				Description: "TOTP code to be validated.",
+				Description: "TOTP or HOTP code to be validated.",
 			},
 		},
 
@@ -57,6 +59,11 @@ func pathCode(b *backend) *framework.Path {
 func (b *backend) pathReadCode(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	name := data.Get("name").(string)
 
+	// The key is locked since generating an HOTP code advances its counter
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
 	// Get the key
 	key, err := b.Key(ctx, req.Storage, name)
 	if err != nil {
@@ -66,12 +73,29 @@ func (b *backend) pathReadCode(ctx context.Context, req *logical.Request, data *
 		return logical.ErrorResponse(fmt.Sprintf("unknown key: %s", name)), nil
 	}
 
-	// Generate password using totp library
-	totpToken, err := totplib.GenerateCodeCustom(key.Key, time.Now(), totplib.ValidateOpts{
-		Period:    key.Period,
-		Digits:    key.Digits,
-		Algorithm: key.Algorithm,
-	})
+	// Generate password using the totp or hotp library; HOTP codes are
+	// generated for the next expected counter value, which is then used up
+	var totpToken string
+	if key.keyType() == keyTypeHOTP {
+		totpToken, err = hotplib.GenerateCodeCustom(key.Key, key.Counter, hotplib.ValidateOpts{
+			Digits:    key.Digits,
+			Algorithm: key.Algorithm,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		key.Counter++
+		if err := b.setKey(ctx, req.Storage, name, key); err != nil {
+			return nil, err
+		}
+	} else {
+		totpToken, err = totplib.GenerateCodeCustom(key.Key, time.Now(), totplib.ValidateOpts{
+			Period:    key.Period,
+			Digits:    key.Digits,
+			Algorithm: key.Algorithm,
+		})
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -93,6 +117,11 @@ func (b *backend) pathValidateCode(ctx context.Context, req *logical.Request, da
 		return logical.ErrorResponse("the code value is required"), nil
 	}
 
+	// The key is locked while its counter or last used time step is updated
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
 	// Get the key's stored values
 	key, err := b.Key(ctx, req.Storage, name)
 	if err != nil {
@@ -102,31 +131,50 @@ func (b *backend) pathValidateCode(ctx context.Context, req *logical.Request, da
 		return logical.ErrorResponse(fmt.Sprintf("unknown key: %s", name)), nil
 	}
 
-	usedName := fmt.Sprintf("%s_%s", name, code)
+	opts := hotplib.ValidateOpts{
+		Digits:    key.Digits,
+		Algorithm: key.Algorithm,
+	}
 
-	_, ok := b.usedCodes.Get(usedName)
-	if ok {
-		return logical.ErrorResponse("code already used; wait until the next time period"), nil
+	// Find the counter value of the code; for TOTP keys, the counter is the
+	// time step, allowing for the skew of the key
+	var first, last uint64
+	if key.keyType() == keyTypeHOTP {
+		first = key.Counter
+		last = key.Counter + uint64(key.LookAhead)
+	} else {
+		step := uint64(time.Now().Unix()) / uint64(key.Period)
+		first = step - uint64(key.Skew)
+		last = step + uint64(key.Skew)
 	}
 
-	valid, err := totplib.ValidateCustom(code, key.Key, time.Now(), totplib.ValidateOpts{
-		Period:    key.Period,
-		Skew:      key.Skew,
-		Digits:    key.Digits,
-		Algorithm: key.Algorithm,
-	})
-	if err != nil && err != otplib.ErrValidateInputInvalidLength {
-		return logical.ErrorResponse("an error occurred while validating the code"), err
+	var valid bool
+	var counter uint64
+	for counter = first; counter <= last; counter++ {
+		valid, err = hotplib.ValidateCustom(code, counter, key.Key, opts)
+		if err != nil && err != otplib.ErrValidateInputInvalidLength {
+			return logical.ErrorResponse("an error occurred while validating the code"), err
+		}
+		if valid {
+			break
+		}
 	}
 
-	// Take the key skew, add two for behind and in front, and multiple that by
-	// the period to cover the full possibility of the validity of the key
-	err = b.usedCodes.Add(usedName, nil, time.Duration(
-		int64(time.Second)*
-			int64(key.Period)*
-			int64((2+key.Skew))))
-	if err != nil {
-		return nil, fmt.Errorf("error adding code to used cache: %w", err)
+	if valid {
+		// Codes of the last accepted time step or earlier cannot be reused.
+		// HOTP codes cannot be reused since the counter moves past them.
+		if key.keyType() == keyTypeHOTP {
+			key.Counter = counter + 1
+		} else {
+			if key.LastTimeStep != 0 && counter <= key.LastTimeStep {
+				return logical.ErrorResponse("code already used; wait until the next time period"), nil
+			}
+			key.LastTimeStep = counter
+		}
+
+		if err := b.setKey(ctx, req.Storage, name, key); err != nil {
+			return nil, err
+		}
 	}
 
 	return &logical.Response{
@@ -141,6 +189,13 @@ Request time-based one-time use password or validate a password for a certain ke
 `
 
 const pathCodeHelpDesc = `
-This path generates and validates time-based one-time use passwords for a certain key. 
-
+This path generates and validates time-based (TOTP) or counter-based (HOTP)
+one-time use passwords for a certain key.
+
+A validated TOTP code cannot be used again, nor can any code of the same or an
+earlier time period. Validating an HOTP code advances the counter of the key
+past the counter value of the code; codes up to look_ahead values after the
+expected counter are accepted so that the key resynchronizes with the token.
+Generated HOTP codes are the ones of the expected counter value, and generating
+a code advances the counter past it, so that every read returns a new code.
 `
@@ -15,11 +15,18 @@ import (
 	"strings"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	otplib "github.com/pquerna/otp"
+	hotplib "github.com/pquerna/otp/hotp"
 	totplib "github.com/pquerna/otp/totp"
 )
 
+const (
+	keyTypeTOTP = "totp"
+	keyTypeHOTP = "hotp"
+)
+
 func pathListKeys(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "keys/?$",
@@ -120,6 +127,24 @@ func pathKeys(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: `A TOTP url string containing all of the parameters for key setup. Only used if generate is false.`,
 			},
+
+			"type": {
+				Type:        framework.TypeString,
+				Default:     keyTypeTOTP,
+				Description: `The type of the one-time passwords; either totp for time-based or hotp for counter-based (RFC 4226) passwords. Defaults to the type of the url when one is given.`,
+			},
+
+			"counter": {
+				Type:        framework.TypeInt,
+				Default:     0,
+				Description: `The initial counter value of an HOTP key. Only used if type is hotp.`,
+			},
+
+			"look_ahead": {
+				Type:        framework.TypeInt,
+				Default:     10,
+				Description: `The number of counter values after the expected one that are accepted when validating an HOTP code, to resynchronize with tokens that generated codes which were not validated. Only used if type is hotp.`,
+			},
 		},
 
 		Operations: map[logical.Operation]framework.OperationHandler{
@@ -165,8 +190,23 @@ func (b *backend) Key(ctx context.Context, s logical.Storage, n string) (*keyEnt
 	return &result, nil
 }
 
+func (b *backend) setKey(ctx context.Context, s logical.Storage, n string, key *keyEntry) error {
+	entry, err := logical.StorageEntryJSON("key/"+n, key)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
 func (b *backend) pathKeyDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	err := req.Storage.Delete(ctx, "key/"+data.Get("name").(string))
+	name := data.Get("name").(string)
+
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	err := req.Storage.Delete(ctx, "key/"+name)
 	if err != nil {
 		return nil, err
 	}
@@ -187,15 +227,23 @@ func (b *backend) pathKeyRead(ctx context.Context, req *logical.Request, data *f
 	algorithm := key.Algorithm.String()
 
 	// Return values of key
-	return &logical.Response{
+	resp := &logical.Response{
 		Data: map[string]interface{}{
+			"type":         key.keyType(),
 			"issuer":       key.Issuer,
 			"account_name": key.AccountName,
-			"period":       key.Period,
 			"algorithm":    algorithm,
 			"digits":       key.Digits,
 		},
-	}, nil
+	}
+	if key.keyType() == keyTypeHOTP {
+		resp.Data["counter"] = key.Counter
+		resp.Data["look_ahead"] = key.LookAhead
+	} else {
+		resp.Data["period"] = key.Period
+	}
+
+	return resp, nil
 }
 
 func (b *backend) pathKeyList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
@@ -221,6 +269,10 @@ func (b *backend) pathKeyCreate(ctx context.Context, req *logical.Request, data
 	qrSize := data.Get("qr_size").(int)
 	keySize := data.Get("key_size").(int)
 	inputURL := data.Get("url").(string)
+	keyType := data.Get("type").(string)
+	counter := data.Get("counter").(int)
+	lookAhead := data.Get("look_ahead").(int)
+	_, keyTypeSet := data.GetOk("type")
 
 	if generate {
 		if keyString != "" {
@@ -289,6 +341,27 @@ func (b *backend) pathKeyCreate(ctx context.Context, req *logical.Request, data
 		if algorithmQuery != "" {
 			algorithm = algorithmQuery
 		}
+
+		// Read type, unless explicitly given
+		if !keyTypeSet && urlObject.Host != "" {
+			keyType = urlObject.Host
+		}
+
+		// Read counter
+		counterQuery := urlQuery.Get("counter")
+		if counterQuery != "" {
+			counterInt, err := strconv.Atoi(counterQuery)
+			if err != nil {
+				return logical.ErrorResponse("an error occurred while parsing counter value in url"), err
+			}
+			counter = counterInt
+		}
+	}
+
+	switch keyType {
+	case keyTypeTOTP, keyTypeHOTP:
+	default:
+		return logical.ErrorResponse("the type value must be totp or hotp"), nil
 	}
 
 	// Translate digits and algorithm to a format the totp library understands
@@ -335,6 +408,14 @@ func (b *backend) pathKeyCreate(ctx context.Context, req *logical.Request, data
 		return logical.ErrorResponse("the key_size value must be greater than zero"), nil
 	}
 
+	if counter < 0 {
+		return logical.ErrorResponse("the counter value must be greater than or equal to zero"), nil
+	}
+
+	if lookAhead < 0 {
+		return logical.ErrorResponse("the look_ahead value must be greater than or equal to zero"), nil
+	}
+
 	// Period, Skew and Key Size need to be unsigned ints
 	uintPeriod := uint(period)
 	uintSkew := uint(skew)
@@ -354,15 +435,28 @@ func (b *backend) pathKeyCreate(ctx context.Context, req *logical.Request, data
 		}
 
 		// Generate a new key
-		keyObject, err := totplib.Generate(totplib.GenerateOpts{
-			Issuer:      issuer,
-			AccountName: accountName,
-			Period:      uintPeriod,
-			Digits:      keyDigits,
-			Algorithm:   keyAlgorithm,
-			SecretSize:  uintKeySize,
-			Rand:        b.GetRandomReader(),
-		})
+		var keyObject *otplib.Key
+		var err error
+		if keyType == keyTypeHOTP {
+			keyObject, err = generateHOTPKey(hotplib.GenerateOpts{
+				Issuer:      issuer,
+				AccountName: accountName,
+				Digits:      keyDigits,
+				Algorithm:   keyAlgorithm,
+				SecretSize:  uintKeySize,
+				Rand:        b.GetRandomReader(),
+			}, uint64(counter))
+		} else {
+			keyObject, err = totplib.Generate(totplib.GenerateOpts{
+				Issuer:      issuer,
+				AccountName: accountName,
+				Period:      uintPeriod,
+				Digits:      keyDigits,
+				Algorithm:   keyAlgorithm,
+				SecretSize:  uintKeySize,
+				Rand:        b.GetRandomReader(),
+			})
+		}
 		if err != nil {
 			return logical.ErrorResponse("an error occurred while generating a key"), err
 		}
@@ -415,8 +509,7 @@ func (b *backend) pathKeyCreate(ctx context.Context, req *logical.Request, data
 		}
 	}
 
-	// Store it
-	entry, err := logical.StorageEntryJSON("key/"+name, &keyEntry{
+	key := &keyEntry{
 		Key:         keyString,
 		Issuer:      issuer,
 		AccountName: accountName,
@@ -424,15 +517,43 @@ func (b *backend) pathKeyCreate(ctx context.Context, req *logical.Request, data
 		Algorithm:   keyAlgorithm,
 		Digits:      keyDigits,
 		Skew:        uintSkew,
-	})
+	}
+	if keyType == keyTypeHOTP {
+		key.Type = keyTypeHOTP
+		key.Counter = uint64(counter)
+		key.LookAhead = uint(lookAhead)
+	}
+
+	// Store it, resetting the counter and last used time step of an
+	// existing key
+	lock := locksutil.LockForKey(b.keyLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := b.setKey(ctx, req.Storage, name, key); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// generateHOTPKey generates a new HOTP key, including the initial counter in
+// its url as expected by authenticator applications.
+func generateHOTPKey(opts hotplib.GenerateOpts, counter uint64) (*otplib.Key, error) {
+	keyObject, err := hotplib.Generate(opts)
 	if err != nil {
 		return nil, err
 	}
-	if err := req.Storage.Put(ctx, entry); err != nil {
+
+	keyURL, err := url.Parse(keyObject.String())
+	if err != nil {
 		return nil, err
 	}
+	query := keyURL.Query()
+	query.Set("counter", strconv.FormatUint(counter, 10))
+	keyURL.RawQuery = query.Encode()
 
-	return response, nil
+	return otplib.NewKeyFromURL(keyURL.String())
 }
 
 type keyEntry struct {
@@ -443,6 +564,25 @@ type keyEntry struct {
 	Algorithm   otplib.Algorithm `json:"algorithm" mapstructure:"algorithm" structs:"algorithm"`
 	Digits      otplib.Digits    `json:"digits" mapstructure:"digits" structs:"digits"`
 	Skew        uint             `json:"skew" mapstructure:"skew" structs:"skew"`
+
+	// Type is empty for TOTP keys created before HOTP support
+	Type string `json:"type,omitempty" mapstructure:"type" structs:"type"`
+
+	// Counter is the next counter value expected from an HOTP key, and
+	// LookAhead the number of following values also accepted
+	Counter   uint64 `json:"counter,omitempty" mapstructure:"counter" structs:"counter"`
+	LookAhead uint   `json:"look_ahead,omitempty" mapstructure:"look_ahead" structs:"look_ahead"`
+
+	// LastTimeStep is the time step of the last TOTP code accepted, so that
+	// codes of this or an earlier time step cannot be reused
+	LastTimeStep uint64 `json:"last_time_step,omitempty" mapstructure:"last_time_step" structs:"last_time_step"`
+}
+
+func (k *keyEntry) keyType() string {
+	if k.Type == "" {
+		return keyTypeTOTP
+	}
+	return k.Type
 }
 
 const pathKeyHelpSyn = `
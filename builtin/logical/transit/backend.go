@@ -12,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/consts"
@@ -24,6 +25,10 @@ const (
 
 	// Minimum cache size for transit backend
 	minCacheSize = 10
+
+	// Number of unpersisted encryptions of a key after which they are
+	// persisted right away rather than by the periodic function
+	keyUsagePersistThreshold = 10000
 )
 
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
@@ -41,10 +46,19 @@ func Backend(ctx context.Context, conf *logical.BackendConfig) (*backend, error)
 	var b backend
 	b.Backend = &framework.Backend{
 		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"jwks/*",
+			},
+
 			SealWrapStorage: []string{
 				"archive/",
 				"policy/",
 			},
+
+			Stream: []string{
+				"encrypt-stream/*",
+				"decrypt-stream/*",
+			},
 		},
 
 		Paths: []*framework.Path{
@@ -55,6 +69,9 @@ func Backend(ctx context.Context, conf *logical.BackendConfig) (*backend, error)
 			b.pathWrappingKey(),
 			b.pathImport(),
 			b.pathImportVersion(),
+			b.pathCreateCsr(),
+			b.pathImportCertChain(),
+			b.pathKeysJWKS(),
 			b.pathKeys(),
 			b.pathListKeys(),
 			b.pathBYOKExportKeys(),
@@ -62,10 +79,19 @@ func Backend(ctx context.Context, conf *logical.BackendConfig) (*backend, error)
 			b.pathKeysConfig(),
 			b.pathEncrypt(),
 			b.pathDecrypt(),
+			b.pathEncryptStream(),
+			b.pathDecryptStream(),
 			b.pathDatakey(),
+			b.pathDerive(),
+			b.pathHPKESeal(),
+			b.pathHPKEOpen(),
 			b.pathRandom(),
 			b.pathHash(),
 			b.pathHMAC(),
+			b.pathJWTSign(),
+			b.pathJWKS(),
+			b.pathCMAC(),
+			b.pathKMAC(),
 			b.pathSign(),
 			b.pathVerify(),
 			b.pathBackup(),
@@ -117,6 +143,10 @@ type backend struct {
 	checkAutoRotateAfter time.Time
 	autoRotateOnce       sync.Once
 	backendUUID          string
+
+	// keysWithPendingUsage holds the policies, by name, with encryptions
+	// which have not been persisted yet
+	keysWithPendingUsage sync.Map
 }
 
 func GetCacheSizeFromStorage(ctx context.Context, s logical.Storage) (int, error) {
@@ -201,6 +231,10 @@ func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error
 		b.autoRotateOnce = sync.Once{}
 	}
 
+	if usageErr := b.persistPendingKeyUsage(ctx, req); usageErr != nil {
+		err = multierror.Append(err, usageErr)
+	}
+
 	return err
 }
 
@@ -284,3 +318,129 @@ func (b *backend) rotateIfRequired(ctx context.Context, req *logical.Request, ke
 	}
 	return nil
 }
+
+// updateKeyUsage is called after encrypting with a key, once the policy lock
+// has been released. Encryptions are persisted right away if there are many
+// of them, if the key has reached its usage limit, or if policies are not
+// cached; otherwise they are left to the periodic function.
+func (b *backend) updateKeyUsage(ctx context.Context, storage logical.Storage, p *keysutil.Policy) {
+	pending := p.PendingEncryptions()
+	if pending == 0 || !b.canPersistKeyUsage() {
+		return
+	}
+
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+		limitReached := p.UsageLimitReached()
+		p.Unlock()
+
+		if pending < keyUsagePersistThreshold && !limitReached {
+			b.keysWithPendingUsage.Store(p.Name, p)
+			return
+		}
+	}
+
+	if err := b.persistKeyUsage(ctx, storage, p); err != nil {
+		b.Logger().Error("failed to persist key usage, will retry", "key", p.Name, "error", err)
+	}
+}
+
+// canPersistKeyUsage returns whether this node can write the encryption counts
+// of keys to storage. Other nodes forward the requests which encrypt; see
+// forwardKeyUsage.
+func (b *backend) canPersistKeyUsage() bool {
+	replState := b.System().ReplicationState()
+	return !replState.HasState(consts.ReplicationDRSecondary|consts.ReplicationPerformanceStandby) &&
+		(b.System().LocalMount() || !replState.HasState(consts.ReplicationPerformanceSecondary))
+}
+
+// forwardKeyUsage returns logical.ErrReadOnly, so that the request is
+// forwarded to the active node, if the key has a usage limit and this node
+// cannot persist its encryptions: the limit can only be enforced by counting
+// all encryptions in one place. Keys without a limit are used locally, so
+// that most encryptions are not sent to the active node.
+func (b *backend) forwardKeyUsage(p *keysutil.Policy) error {
+	if p.MaxEncryptionsPerVersion > 0 && !b.canPersistKeyUsage() {
+		return logical.ErrReadOnly
+	}
+	return nil
+}
+
+// persistPendingKeyUsage persists the encryptions of all keys which have not
+// been persisted yet.
+func (b *backend) persistPendingKeyUsage(ctx context.Context, req *logical.Request) error {
+	if !b.canPersistKeyUsage() {
+		return nil
+	}
+
+	var errs *multierror.Error
+	b.keysWithPendingUsage.Range(func(name, p interface{}) bool {
+		b.keysWithPendingUsage.Delete(name)
+		err := b.persistKeyUsage(ctx, req.Storage, p.(*keysutil.Policy))
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		return true
+	})
+	return errs.ErrorOrNil()
+}
+
+// persistKeyUsage adds the pending encryptions of a policy to the persisted
+// usage of its key, rotating it if it has reached its usage limit. The policy
+// is fetched again, as the one the encryptions were counted on may no longer
+// be current. If the encryptions cannot be persisted, they are put back as
+// pending, and the policy is left for the periodic function to try again.
+func (b *backend) persistKeyUsage(ctx context.Context, storage logical.Storage, counted *keysutil.Policy) (retErr error) {
+	name := counted.Name
+	counts := counted.TakePendingEncryptions()
+	if len(counts) == 0 {
+		return nil
+	}
+
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		counted.RestorePendingEncryptions(counts)
+		b.keysWithPendingUsage.Store(name, counted)
+		return err
+	}
+	if p == nil {
+		return nil
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(true)
+	}
+	defer p.Unlock()
+
+	// Encryptions counted on this policy since it was fetched are persisted
+	// along
+	for ver, n := range p.TakePendingEncryptions() {
+		counts[ver] += n
+	}
+	p.AddEncryptionCounts(counts)
+
+	defer func() {
+		if retErr != nil {
+			p.RemoveEncryptionCounts(counts)
+			p.RestorePendingEncryptions(counts)
+			b.keysWithPendingUsage.Store(name, p)
+		}
+	}()
+
+	for ver := range counts {
+		metrics.SetGaugeWithLabels([]string{"secrets", "transit", "key", "encryptions"}, float32(p.EncryptionCount(ver)), []metrics.Label{
+			{Name: "key", Value: name},
+			{Name: "version", Value: strconv.Itoa(ver)},
+		})
+	}
+
+	if p.UsageLimitReached() && p.Type != keysutil.KeyType_MANAGED_KEY && (!p.Imported || p.AllowImportedKeyRotation) {
+		if b.Logger().IsDebug() {
+			b.Logger().Debug("rotating key which reached its usage limit", "key", name)
+		}
+		return p.Rotate(ctx, storage, b.GetRandomReader())
+	}
+	return p.Persist(ctx, storage)
+}
@@ -0,0 +1,256 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package transit
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathCreateCsr() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/csr",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixTransit,
+			OperationVerb:   "generate",
+			OperationSuffix: "csr-for-key",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Required:    true,
+				Description: "Name of the key",
+			},
+			"version": {
+				Type:        framework.TypeInt,
+				Description: "Optional version of the key, latest version if not set",
+			},
+			"csr": {
+				Type: framework.TypeString,
+				Description: `PEM encoded CSR template. The information attributes
+will be used as a basis for the CSR with the key in transit. If not set, an empty CSR is returned.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCreateCsrWrite,
+		},
+
+		HelpSynopsis:    pathCreateCsrHelpSyn,
+		HelpDescription: pathCreateCsrHelpDesc,
+	}
+}
+
+func (b *backend) pathImportCertChain() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/set-certificate",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixTransit,
+			OperationVerb:   "set",
+			OperationSuffix: "certificate-for-key",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Required:    true,
+				Description: "Name of the key",
+			},
+			"version": {
+				Type:        framework.TypeInt,
+				Description: "Optional version of the key, latest version if not set",
+			},
+			"certificate_chain": {
+				Type:     framework.TypeString,
+				Required: true,
+				Description: `PEM encoded certificate chain. It should be composed
+by one or more concatenated PEM blocks and ordered starting from the end-entity certificate.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportCertChainWrite,
+		},
+
+		HelpSynopsis:    pathImportCertChainHelpSyn,
+		HelpDescription: pathImportCertChainHelpDesc,
+	}
+}
+
+func (b *backend) pathCreateCsrWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse(fmt.Sprintf("key with provided name '%s' not found", name)), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	csrTemplate := &x509.CertificateRequest{}
+	if pemCsrTemplate := d.Get("csr").(string); pemCsrTemplate != "" {
+		pemBlock, _ := pem.Decode([]byte(pemCsrTemplate))
+		if pemBlock == nil {
+			return logical.ErrorResponse("could not decode PEM file"), logical.ErrInvalidRequest
+		}
+
+		csrTemplate, err = x509.ParseCertificateRequest(pemBlock.Bytes)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("could not parse CSR template: %v", err)), logical.ErrInvalidRequest
+		}
+	}
+
+	pemCsr, err := p.CreateCsr(d.Get("version").(int), csrTemplate)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name": p.Name,
+			"type": p.Type.String(),
+			"csr":  string(pemCsr),
+		},
+	}, nil
+}
+
+func (b *backend) pathImportCertChainWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse(fmt.Sprintf("key with provided name '%s' not found", name)), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(true)
+	}
+	defer p.Unlock()
+
+	keyVersion := d.Get("version").(int)
+
+	certChain, err := parseCertificateChain(d.Get("certificate_chain").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	valid, err := p.ValidateLeafCertKeyMatch(keyVersion, certChain[0].PublicKey)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+	if !valid {
+		return logical.ErrorResponse("leaf certificate public key does not match the key version"), logical.ErrInvalidRequest
+	}
+
+	derChain := make([][]byte, 0, len(certChain))
+	for _, cert := range certChain {
+		derChain = append(derChain, cert.Raw)
+	}
+
+	if err := p.PersistCertificateChain(ctx, req.Storage, keyVersion, derChain); err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// parseCertificateChain parses the concatenated PEM blocks of a certificate
+// chain and checks that every certificate is issued by the one following it.
+func parseCertificateChain(pemChain string) ([]*x509.Certificate, error) {
+	var certChain []*x509.Certificate
+	rest := []byte(strings.TrimSpace(pemChain))
+	for len(rest) > 0 {
+		var pemBlock *pem.Block
+		pemBlock, rest = pem.Decode(rest)
+		if pemBlock == nil {
+			return nil, errors.New("could not decode PEM certificate chain")
+		}
+		if pemBlock.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block of type %q in certificate chain", pemBlock.Type)
+		}
+
+		cert, err := x509.ParseCertificate(pemBlock.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate in chain: %w", err)
+		}
+		certChain = append(certChain, cert)
+		rest = []byte(strings.TrimSpace(string(rest)))
+	}
+
+	if len(certChain) == 0 {
+		return nil, errors.New("no certificates in certificate chain")
+	}
+
+	if certChain[0].IsCA {
+		return nil, errors.New("the first certificate in the chain must be an end-entity certificate")
+	}
+
+	for i := 0; i < len(certChain)-1; i++ {
+		if !certChain[i+1].IsCA {
+			return nil, fmt.Errorf("certificate %d in the chain is not a CA certificate", i+1)
+		}
+		if err := certChain[i].CheckSignatureFrom(certChain[i+1]); err != nil {
+			return nil, fmt.Errorf("certificate %d in the chain is not issued by the certificate following it: %w", i, err)
+		}
+	}
+
+	return certChain, nil
+}
+
+const pathCreateCsrHelpSyn = `Create a CSR from a key in transit`
+
+const pathCreateCsrHelpDesc = `This path is used to create a CSR from a key in
+transit. If a CSR template is provided, its significant information, except for
+the key and signature, will be added to the CSR. The CSR is signed by the given
+version of the key, defaulting to the latest version.
+`
+
+const pathImportCertChainHelpSyn = `Imports an externally-signed certificate
+chain into an existing key version`
+
+const pathImportCertChainHelpDesc = `This path is used to import an externally-
+signed certificate chain into a key in transit. The leaf certificate key has to
+match the key version in transit. The chain is returned with the key version
+when the key is read.
+`
@@ -0,0 +1,167 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package transit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransit_CertificateChain(t *testing.T) {
+	for _, keyType := range []string{"ecdsa-p256", "ecdsa-p384", "rsa-2048"} {
+		t.Run(keyType, func(t *testing.T) {
+			testTransitCertificateChain(t, keyType)
+		})
+	}
+}
+
+func testTransitCertificateChain(t *testing.T, keyType string) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   s,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	_, err := doReq("keys/signing", map[string]interface{}{"type": keyType})
+	require.NoError(t, err)
+
+	csrTemplate, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "code-signing.example.com"},
+	}, mustECDSAKey(t))
+	require.NoError(t, err)
+
+	resp, err := doReq("keys/signing/csr", map[string]interface{}{
+		"csr": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrTemplate})),
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError(), resp.Error())
+	require.Equal(t, keyType, resp.Data["type"])
+
+	// The CSR carries the template's subject, but the transit key
+	pemBlock, _ := pem.Decode([]byte(resp.Data["csr"].(string)))
+	require.NotNil(t, pemBlock)
+	csr, err := x509.ParseCertificateRequest(pemBlock.Bytes)
+	require.NoError(t, err)
+	require.NoError(t, csr.CheckSignature())
+	require.Equal(t, "code-signing.example.com", csr.Subject.CommonName)
+
+	caKey := mustECDSAKey(t)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Root CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	issue := func(publicKey interface{}) []byte {
+		leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      csr.Subject,
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		}, caCert, publicKey, caKey)
+		require.NoError(t, err)
+		return leafDER
+	}
+
+	pemChain := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issue(csr.PublicKey)})) +
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+
+	resp, err = doReq("keys/signing/set-certificate", map[string]interface{}{
+		"certificate_chain": pemChain,
+	})
+	require.NoError(t, err)
+	require.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   s,
+		Operation: logical.ReadOperation,
+		Path:      "keys/signing",
+	})
+	require.NoError(t, err)
+	keys := resp.Data["keys"].(map[string]map[string]interface{})
+	require.Equal(t, pemChain, keys["1"]["certificate_chain"])
+
+	// A certificate for another key is rejected
+	otherChain := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issue(mustECDSAKey(t).Public())}))
+	resp, err = doReq("keys/signing/set-certificate", map[string]interface{}{
+		"certificate_chain": otherChain,
+	})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+
+	// As is a chain that is not in order
+	resp, err = doReq("keys/signing/set-certificate", map[string]interface{}{
+		"certificate_chain": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})),
+	})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+
+	// New key versions start out without a certificate chain
+	_, err = doReq("keys/signing/rotate", nil)
+	require.NoError(t, err)
+	resp, err = doReq("keys/signing/set-certificate", map[string]interface{}{
+		"certificate_chain": pemChain,
+	})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+
+	resp, err = doReq("keys/signing/csr", map[string]interface{}{"version": 3})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+}
+
+func TestTransit_CertificateChain_UnsupportedKeyType(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	for _, keyType := range []string{"aes256-gcm96", "ed25519"} {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   s,
+			Operation: logical.UpdateOperation,
+			Path:      "keys/" + keyType,
+			Data:      map[string]interface{}{"type": keyType},
+		})
+		require.NoError(t, err)
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   s,
+			Operation: logical.UpdateOperation,
+			Path:      "keys/" + keyType + "/csr",
+		})
+		require.ErrorIs(t, err, logical.ErrInvalidRequest)
+		require.True(t, resp.IsError())
+	}
+}
+
+func mustECDSAKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
@@ -123,6 +123,11 @@ func (b *backend) pathDatakeyWrite(ctx context.Context, req *logical.Request, d
 	if !b.System().CachingDisabled() {
 		p.Lock(false)
 	}
+	if err := b.forwardKeyUsage(p); err != nil {
+		p.Unlock()
+		return nil, err
+	}
+	defer b.updateKeyUsage(ctx, req.Storage, p)
 	defer p.Unlock()
 
 	newKey := make([]byte, 32)
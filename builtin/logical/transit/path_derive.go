@@ -0,0 +1,192 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package transit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/kdf"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	deriveKDFNone              = "none"
+	deriveKDFHKDFSHA256        = "hkdf_sha256"
+	deriveKDFHMACSHA256Counter = "hmac-sha256-counter"
+)
+
+func (b *backend) pathDerive() *framework.Path {
+	return &framework.Path{
+		Pattern: "derive/" + framework.GenericNameRegex("name"),
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixTransit,
+			OperationVerb:   "derive",
+			OperationSuffix: "shared-secret",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The key to use for key agreement",
+			},
+
+			"peer_public_key": {
+				Type: framework.TypeString,
+				Description: `The public key of the peer, on the curve of the key. Either
+PEM-encoded in PKIX form, or base64-encoded in the raw encoding of the curve: an
+uncompressed point for NIST curves and 32 bytes for X25519.`,
+			},
+
+			"kdf": {
+				Type:    framework.TypeString,
+				Default: deriveKDFNone,
+				Description: `The KDF to pass the shared secret through. Either "none" to return
+the raw shared secret, "hkdf_sha256" or "hmac-sha256-counter". Defaults to "none".`,
+			},
+
+			"context": {
+				Type:        framework.TypeString,
+				Description: "Base64-encoded context for the KDF. Not allowed when kdf is none.",
+			},
+
+			"bits": {
+				Type: framework.TypeInt,
+				Description: `Number of bits to derive with the KDF; currently 128, 256,
+and 512 bits are supported. Defaults to 256.`,
+				Default: 256,
+			},
+
+			"key_version": {
+				Type: framework.TypeInt,
+				Description: `The version of the Vault key to use for key agreement. Must
+be 0 (for latest) or a value greater than or equal to the min_decryption_version
+configured on the key.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathDeriveWrite,
+		},
+
+		HelpSynopsis:    pathDeriveHelpSyn,
+		HelpDescription: pathDeriveHelpDesc,
+	}
+}
+
+func (b *backend) pathDeriveWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	ver := d.Get("key_version").(int)
+
+	peerPublicKeyRaw := strings.TrimSpace(d.Get("peer_public_key").(string))
+	if peerPublicKeyRaw == "" {
+		return logical.ErrorResponse("missing peer_public_key"), logical.ErrInvalidRequest
+	}
+	peerPublicKey := []byte(peerPublicKeyRaw)
+	if !strings.HasPrefix(peerPublicKeyRaw, "-----BEGIN") {
+		var err error
+		peerPublicKey, err = base64.StdEncoding.DecodeString(peerPublicKeyRaw)
+		if err != nil {
+			return logical.ErrorResponse("failed to base64-decode peer_public_key"), logical.ErrInvalidRequest
+		}
+	}
+
+	kdfMode := d.Get("kdf").(string)
+	switch kdfMode {
+	case deriveKDFNone, deriveKDFHKDFSHA256, deriveKDFHMACSHA256Counter:
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("unknown kdf %q", kdfMode)), logical.ErrInvalidRequest
+	}
+
+	contextRaw := d.Get("context").(string)
+	var context []byte
+	if len(contextRaw) != 0 {
+		if kdfMode == deriveKDFNone {
+			return logical.ErrorResponse("context is only allowed with a kdf"), logical.ErrInvalidRequest
+		}
+
+		var err error
+		context, err = base64.StdEncoding.DecodeString(contextRaw)
+		if err != nil {
+			return logical.ErrorResponse("failed to base64-decode context"), logical.ErrInvalidRequest
+		}
+	}
+
+	bits := d.Get("bits").(int)
+	switch bits {
+	case 128, 256, 512:
+	default:
+		return logical.ErrorResponse("invalid bit length"), logical.ErrInvalidRequest
+	}
+
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	secret, err := p.DeriveSharedSecret(ver, peerPublicKey)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	switch kdfMode {
+	case deriveKDFHKDFSHA256:
+		derived := make([]byte, bits/8)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, context), derived); err != nil {
+			return nil, fmt.Errorf("error deriving key: %w", err)
+		}
+		secret = derived
+	case deriveKDFHMACSHA256Counter:
+		secret, err = kdf.CounterMode(kdf.HMACSHA256PRF, kdf.HMACSHA256PRFLen, secret, context, uint32(bits))
+		if err != nil {
+			return nil, fmt.Errorf("error deriving key: %w", err)
+		}
+	}
+
+	keyVersion := ver
+	if keyVersion == 0 {
+		keyVersion = p.LatestVersion
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"shared_secret": base64.StdEncoding.EncodeToString(secret),
+			"key_version":   keyVersion,
+		},
+	}, nil
+}
+
+const pathDeriveHelpSyn = `Derive a shared secret with a peer public key`
+
+const pathDeriveHelpDesc = `
+This path performs Diffie-Hellman key agreement (ECDH) between the named
+key and the public key of a peer, and returns the shared secret, base64
+encoded. The key must be of type ecdsa-p256, ecdsa-p384, ecdsa-p521 or
+x25519. The shared secret can optionally be passed through a KDF with the
+given context, to return a key of the given number of bits instead.
+`
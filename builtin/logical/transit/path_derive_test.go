@@ -0,0 +1,121 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package transit
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/hkdf"
+)
+
+func TestTransit_Derive(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, op logical.Operation, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   s,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	// X25519 with a raw peer public key
+	_, err := doReq("keys/x", logical.UpdateOperation, map[string]interface{}{"type": "x25519"})
+	require.NoError(t, err)
+
+	resp, err := doReq("keys/x", logical.ReadOperation, nil)
+	require.NoError(t, err)
+	require.Equal(t, "x25519", resp.Data["type"])
+	keys := resp.Data["keys"].(map[string]map[string]interface{})
+	xPublicKey := keys["1"]["public_key"].(string)
+	transitPub, err := base64.StdEncoding.DecodeString(xPublicKey)
+	require.NoError(t, err)
+
+	peer, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	transitKey, err := ecdh.X25519().NewPublicKey(transitPub)
+	require.NoError(t, err)
+	expected, err := peer.ECDH(transitKey)
+	require.NoError(t, err)
+
+	resp, err = doReq("derive/x", logical.UpdateOperation, map[string]interface{}{
+		"peer_public_key": base64.StdEncoding.EncodeToString(peer.PublicKey().Bytes()),
+	})
+	require.NoError(t, err)
+	require.Equal(t, base64.StdEncoding.EncodeToString(expected), resp.Data["shared_secret"])
+	require.Equal(t, 1, resp.Data["key_version"])
+
+	// ECDSA P-256 with a PEM peer public key and HKDF
+	_, err = doReq("keys/ec", logical.UpdateOperation, map[string]interface{}{"type": "ecdsa-p256"})
+	require.NoError(t, err)
+
+	resp, err = doReq("keys/ec", logical.ReadOperation, nil)
+	require.NoError(t, err)
+	keys = resp.Data["keys"].(map[string]map[string]interface{})
+	pemBlock, _ := pem.Decode([]byte(keys["1"]["public_key"].(string)))
+	require.NotNil(t, pemBlock)
+	parsed, err := x509.ParsePKIXPublicKey(pemBlock.Bytes)
+	require.NoError(t, err)
+
+	ecPeer, err := ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecTransitKey, err := parsed.(*ecdsa.PublicKey).ECDH()
+	require.NoError(t, err)
+	ecSecret, err := ecPeer.ECDH(ecTransitKey)
+	require.NoError(t, err)
+	ecExpected := make([]byte, 16)
+	_, err = io.ReadFull(hkdf.New(sha256.New, ecSecret, nil, []byte("ctx")), ecExpected)
+	require.NoError(t, err)
+
+	peerDER, err := x509.MarshalPKIXPublicKey(ecPeer.PublicKey())
+	require.NoError(t, err)
+	resp, err = doReq("derive/ec", logical.UpdateOperation, map[string]interface{}{
+		"peer_public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: peerDER})),
+		"kdf":             "hkdf_sha256",
+		"context":         base64.StdEncoding.EncodeToString([]byte("ctx")),
+		"bits":            128,
+	})
+	require.NoError(t, err)
+	require.Equal(t, base64.StdEncoding.EncodeToString(ecExpected), resp.Data["shared_secret"])
+
+	// A peer key on another curve is rejected
+	resp, err = doReq("derive/ec", logical.UpdateOperation, map[string]interface{}{
+		"peer_public_key": base64.StdEncoding.EncodeToString(peer.PublicKey().Bytes()),
+	})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+
+	// As are keys that do not support key agreement
+	_, err = doReq("keys/aes", logical.UpdateOperation, nil)
+	require.NoError(t, err)
+	resp, err = doReq("derive/aes", logical.UpdateOperation, map[string]interface{}{
+		"peer_public_key": base64.StdEncoding.EncodeToString(peer.PublicKey().Bytes()),
+	})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+
+	// The private half of X25519 keys is not exportable
+	_, err = doReq("keys/x/config", logical.UpdateOperation, map[string]interface{}{"exportable": true})
+	require.NoError(t, err)
+	for _, exportType := range []string{"encryption-key", "signing-key"} {
+		resp, err = doReq("export/"+exportType+"/x", logical.ReadOperation, nil)
+		require.ErrorIs(t, err, logical.ErrInvalidRequest)
+		require.True(t, resp.IsError())
+	}
+	resp, err = doReq("export/public-key/x", logical.ReadOperation, nil)
+	require.NoError(t, err)
+	require.Equal(t, xPublicKey, resp.Data["keys"].(map[string]string)["1"])
+}
@@ -460,6 +460,11 @@ func (b *backend) pathEncryptWrite(ctx context.Context, req *logical.Request, d
 	if !b.System().CachingDisabled() {
 		p.Lock(false)
 	}
+	if err := b.forwardKeyUsage(p); err != nil {
+		p.Unlock()
+		return nil, err
+	}
+	defer b.updateKeyUsage(ctx, req.Storage, p)
 
 	// Process batch request items. If encryption of any request
 	// item fails, respectively mark the error in the response
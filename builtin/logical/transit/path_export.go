@@ -231,7 +231,7 @@ func getExportKey(policy *keysutil.Policy, key *keysutil.KeyEntry, exportType st
 			}
 			return ecKey, nil
 
-		case keysutil.KeyType_ED25519:
+		case keysutil.KeyType_ED25519, keysutil.KeyType_X25519:
 			return strings.TrimSpace(key.FormattedPublicKey), nil
 
 		case keysutil.KeyType_RSA2048, keysutil.KeyType_RSA3072, keysutil.KeyType_RSA4096:
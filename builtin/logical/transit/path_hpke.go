@@ -0,0 +1,252 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func hpkeFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": {
+			Type:        framework.TypeString,
+			Description: "The key to seal to or open with",
+		},
+
+		"aead": {
+			Type:    framework.TypeString,
+			Default: keysutil.HPKEAEAD_AES256GCM,
+			Description: `The HPKE AEAD: "aes-128-gcm", "aes-256-gcm" or "chacha20-poly1305".
+Defaults to "aes-256-gcm". The KEM and KDF follow from the type of the key.`,
+		},
+
+		"info": {
+			Type:        framework.TypeString,
+			Description: "Base64-encoded application info bound to the HPKE context.",
+		},
+
+		"associated_data": {
+			Type:        framework.TypeString,
+			Description: "Base64-encoded associated data authenticated along with the plaintext.",
+		},
+	}
+}
+
+func (b *backend) pathHPKESeal() *framework.Path {
+	fields := hpkeFields()
+	fields["plaintext"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Base64-encoded plaintext to seal",
+	}
+	fields["key_version"] = &framework.FieldSchema{
+		Type: framework.TypeInt,
+		Description: `The version of the key to seal to. Must be 0 (for latest)
+or a value greater than or equal to the min_encryption_version configured on the key.`,
+	}
+
+	return &framework.Path{
+		Pattern: "hpke/seal/" + framework.GenericNameRegex("name"),
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixTransit,
+			OperationVerb:   "seal",
+			OperationSuffix: "hpke",
+		},
+
+		Fields: fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathHPKESealWrite,
+		},
+
+		HelpSynopsis:    pathHPKESealHelpSyn,
+		HelpDescription: pathHPKESealHelpDesc,
+	}
+}
+
+func (b *backend) pathHPKEOpen() *framework.Path {
+	fields := hpkeFields()
+	fields["encapsulated_key"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Base64-encoded encapsulated key returned by the HPKE sender setup",
+	}
+	fields["ciphertext"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Base64-encoded ciphertext to open",
+	}
+	fields["key_version"] = &framework.FieldSchema{
+		Type: framework.TypeInt,
+		Description: `The version of the key the ciphertext was sealed to. Must be
+0 (for latest) or a value greater than or equal to the min_decryption_version
+configured on the key.`,
+	}
+
+	return &framework.Path{
+		Pattern: "hpke/open/" + framework.GenericNameRegex("name"),
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixTransit,
+			OperationVerb:   "open",
+			OperationSuffix: "hpke",
+		},
+
+		Fields: fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathHPKEOpenWrite,
+		},
+
+		HelpSynopsis:    pathHPKEOpenHelpSyn,
+		HelpDescription: pathHPKEOpenHelpDesc,
+	}
+}
+
+// decodeHPKEField base64-decodes an optional field
+func decodeHPKEField(d *framework.FieldData, field string) ([]byte, *logical.Response) {
+	raw := d.Get(field).(string)
+	if raw == "" {
+		return nil, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, logical.ErrorResponse("failed to base64-decode " + field)
+	}
+	return decoded, nil
+}
+
+func (b *backend) pathHPKESealWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	ver := d.Get("key_version").(int)
+
+	if _, ok := d.GetOk("plaintext"); !ok {
+		return logical.ErrorResponse("missing plaintext to seal"), logical.ErrInvalidRequest
+	}
+	plaintext, errResp := decodeHPKEField(d, "plaintext")
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+	info, errResp := decodeHPKEField(d, "info")
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+	associatedData, errResp := decodeHPKEField(d, "associated_data")
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	keyVersion, encapsulatedKey, ciphertext, err := p.HPKESeal(ver, d.Get("aead").(string), info, associatedData, plaintext)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"encapsulated_key": base64.StdEncoding.EncodeToString(encapsulatedKey),
+			"ciphertext":       base64.StdEncoding.EncodeToString(ciphertext),
+			"key_version":      keyVersion,
+		},
+	}, nil
+}
+
+func (b *backend) pathHPKEOpenWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	ver := d.Get("key_version").(int)
+
+	encapsulatedKey, errResp := decodeHPKEField(d, "encapsulated_key")
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+	if len(encapsulatedKey) == 0 {
+		return logical.ErrorResponse("missing encapsulated_key"), logical.ErrInvalidRequest
+	}
+	ciphertext, errResp := decodeHPKEField(d, "ciphertext")
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+	if len(ciphertext) == 0 {
+		return logical.ErrorResponse("missing ciphertext"), logical.ErrInvalidRequest
+	}
+	info, errResp := decodeHPKEField(d, "info")
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+	associatedData, errResp := decodeHPKEField(d, "associated_data")
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	plaintext, err := p.HPKEOpen(ver, d.Get("aead").(string), info, associatedData, encapsulatedKey, ciphertext)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+		},
+	}, nil
+}
+
+const pathHPKESealHelpSyn = `Seal a plaintext to a key with HPKE`
+
+const pathHPKESealHelpDesc = `
+This path seals a plaintext to the public key of the named key with HPKE
+(RFC 9180) in base mode, and returns the encapsulated key and the ciphertext,
+base64 encoded. The key must be of type ecdsa-p256, ecdsa-p384, ecdsa-p521 or
+x25519; clients holding the public key can equally seal to it themselves.
+`
+
+const pathHPKEOpenHelpSyn = `Open a ciphertext sealed to a key with HPKE`
+
+const pathHPKEOpenHelpDesc = `
+This path opens a ciphertext sealed to the public key of the named key with
+HPKE (RFC 9180) in base mode, and returns the plaintext, base64 encoded. The
+aead, info and associated data must match the ones used to seal it.
+`
@@ -0,0 +1,115 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package transit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/cloudflare/circl/hpke"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransit_HPKE(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   s,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	plaintext := base64.StdEncoding.EncodeToString([]byte("the quick brown fox"))
+	info := base64.StdEncoding.EncodeToString([]byte("app"))
+	aad := base64.StdEncoding.EncodeToString([]byte("header"))
+
+	for _, keyType := range []string{"x25519", "ecdsa-p256", "ecdsa-p384", "ecdsa-p521"} {
+		for _, aead := range []string{"aes-128-gcm", "aes-256-gcm", "chacha20-poly1305"} {
+			t.Run(keyType+"/"+aead, func(t *testing.T) {
+				_, err := doReq("keys/"+keyType, map[string]interface{}{"type": keyType})
+				require.NoError(t, err)
+
+				resp, err := doReq("hpke/seal/"+keyType, map[string]interface{}{
+					"plaintext":       plaintext,
+					"aead":            aead,
+					"info":            info,
+					"associated_data": aad,
+				})
+				require.NoError(t, err)
+				require.False(t, resp.IsError(), resp.Error())
+
+				openData := map[string]interface{}{
+					"encapsulated_key": resp.Data["encapsulated_key"],
+					"ciphertext":       resp.Data["ciphertext"],
+					"aead":             aead,
+					"info":             info,
+					"associated_data":  aad,
+				}
+				resp, err = doReq("hpke/open/"+keyType, openData)
+				require.NoError(t, err)
+				require.Equal(t, plaintext, resp.Data["plaintext"])
+
+				// The associated data is authenticated
+				openData["associated_data"] = base64.StdEncoding.EncodeToString([]byte("other"))
+				resp, err = doReq("hpke/open/"+keyType, openData)
+				require.ErrorIs(t, err, logical.ErrInvalidRequest)
+				require.True(t, resp.IsError())
+			})
+		}
+	}
+}
+
+func TestTransit_HPKE_Interop(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/server",
+		Data:      map[string]interface{}{"type": "x25519"},
+	})
+	require.NoError(t, err)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   s,
+		Operation: logical.ReadOperation,
+		Path:      "keys/server",
+	})
+	require.NoError(t, err)
+	keys := resp.Data["keys"].(map[string]map[string]interface{})
+	serverPub, err := base64.StdEncoding.DecodeString(keys["1"]["public_key"].(string))
+	require.NoError(t, err)
+
+	// A client seals to the server public key with its own HPKE
+	// implementation, and the private half stays in transit
+	suite := hpke.NewSuite(hpke.KEM_X25519_HKDF_SHA256, hpke.KDF_HKDF_SHA256, hpke.AEAD_ChaCha20Poly1305)
+	pubKey, err := hpke.KEM_X25519_HKDF_SHA256.Scheme().UnmarshalBinaryPublicKey(serverPub)
+	require.NoError(t, err)
+	sender, err := suite.NewSender(pubKey, []byte("mobile"))
+	require.NoError(t, err)
+	enc, sealer, err := sender.Setup(rand.Reader)
+	require.NoError(t, err)
+	ciphertext, err := sealer.Seal([]byte("hello from the client"), nil)
+	require.NoError(t, err)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "hpke/open/server",
+		Data: map[string]interface{}{
+			"encapsulated_key": base64.StdEncoding.EncodeToString(enc),
+			"ciphertext":       base64.StdEncoding.EncodeToString(ciphertext),
+			"aead":             "chacha20-poly1305",
+			"info":             base64.StdEncoding.EncodeToString([]byte("mobile")),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, base64.StdEncoding.EncodeToString([]byte("hello from the client")), resp.Data["plaintext"])
+}
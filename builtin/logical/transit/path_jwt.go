@@ -0,0 +1,388 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package transit
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// jwsAlgorithm describes how a JWS algorithm maps onto transit signing
+type jwsAlgorithm struct {
+	hash         keysutil.HashType
+	sigAlgorithm string
+}
+
+var rsaJWSAlgorithms = map[string]jwsAlgorithm{
+	"RS256": {keysutil.HashTypeSHA2256, "pkcs1v15"},
+	"RS384": {keysutil.HashTypeSHA2384, "pkcs1v15"},
+	"RS512": {keysutil.HashTypeSHA2512, "pkcs1v15"},
+	"PS256": {keysutil.HashTypeSHA2256, "pss"},
+	"PS384": {keysutil.HashTypeSHA2384, "pss"},
+	"PS512": {keysutil.HashTypeSHA2512, "pss"},
+}
+
+// keyJWSAlgorithm returns the JWS algorithm of keys of the given type, which
+// for RSA keys is chosen by the caller
+func keyJWSAlgorithm(keyType keysutil.KeyType, requested string) (string, jwsAlgorithm, error) {
+	var alg string
+	switch keyType {
+	case keysutil.KeyType_ECDSA_P256:
+		alg = "ES256"
+	case keysutil.KeyType_ECDSA_P384:
+		alg = "ES384"
+	case keysutil.KeyType_ECDSA_P521:
+		alg = "ES512"
+	case keysutil.KeyType_ED25519:
+		alg = "EdDSA"
+	case keysutil.KeyType_RSA2048, keysutil.KeyType_RSA3072, keysutil.KeyType_RSA4096:
+		if requested == "" {
+			requested = "RS256"
+		}
+		params, ok := rsaJWSAlgorithms[requested]
+		if !ok {
+			return "", jwsAlgorithm{}, fmt.Errorf("unsupported algorithm %q for key type %v", requested, keyType)
+		}
+		return requested, params, nil
+	default:
+		return "", jwsAlgorithm{}, fmt.Errorf("JWT signing is not supported for key type %v", keyType)
+	}
+
+	if requested != "" && requested != alg {
+		return "", jwsAlgorithm{}, fmt.Errorf("unsupported algorithm %q for key type %v", requested, keyType)
+	}
+	switch alg {
+	case "ES384":
+		return alg, jwsAlgorithm{hash: keysutil.HashTypeSHA2384}, nil
+	case "ES512":
+		return alg, jwsAlgorithm{hash: keysutil.HashTypeSHA2512}, nil
+	default:
+		return alg, jwsAlgorithm{hash: keysutil.HashTypeSHA2256}, nil
+	}
+}
+
+func (b *backend) pathJWTSign() *framework.Path {
+	return &framework.Path{
+		Pattern: "jwt/sign/" + framework.GenericNameRegex("name"),
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixTransit,
+			OperationVerb:   "sign",
+			OperationSuffix: "jwt",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The key to use",
+			},
+
+			"claims": {
+				Type:        framework.TypeMap,
+				Required:    true,
+				Description: "The claims of the JWT",
+			},
+
+			"algorithm": {
+				Type: framework.TypeString,
+				Description: `The JWS algorithm to sign with. Only RSA keys support more than one
+algorithm: RS256 (the default), RS384, RS512, PS256, PS384 and PS512.
+Other keys sign with ES256, ES384, ES512 or EdDSA, according to their type.`,
+			},
+
+			"key_version": {
+				Type: framework.TypeInt,
+				Description: `The version of the key to use for signing.
+Must be 0 (for latest) or a value greater than or equal
+to the min_encryption_version configured on the key.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathJWTSignWrite,
+		},
+
+		HelpSynopsis:    pathJWTSignHelpSyn,
+		HelpDescription: pathJWTSignHelpDesc,
+	}
+}
+
+func (b *backend) pathKeysJWKS() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/jwks",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixTransit,
+			OperationSuffix: "key-jwks",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathKeysJWKSRead,
+		},
+
+		HelpSynopsis:    pathJWKSHelpSyn,
+		HelpDescription: pathJWKSHelpDesc,
+	}
+}
+
+func (b *backend) pathJWKS() *framework.Path {
+	return &framework.Path{
+		Pattern: "jwks/" + framework.GenericNameRegex("name"),
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixTransit,
+			OperationSuffix: "public-jwks",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathJWKSRead,
+		},
+
+		HelpSynopsis:    pathJWKSHelpSyn,
+		HelpDescription: pathJWKSHelpDesc,
+	}
+}
+
+func (b *backend) pathJWTSignWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	ver := d.Get("key_version").(int)
+
+	claims := d.Get("claims").(map[string]interface{})
+	if len(claims) == 0 {
+		return logical.ErrorResponse("missing claims"), logical.ErrInvalidRequest
+	}
+
+	// Get the policy
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("signing key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	if p.Derived {
+		return logical.ErrorResponse("JWT signing is not supported for derived keys"), logical.ErrInvalidRequest
+	}
+
+	alg, params, err := keyJWSAlgorithm(p.Type, d.Get("algorithm").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	if ver == 0 {
+		ver = p.LatestVersion
+	}
+
+	header, err := json.Marshal(map[string]string{
+		"alg": alg,
+		"typ": "JWT",
+		"kid": strconv.Itoa(ver),
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid claims: %s", err)), logical.ErrInvalidRequest
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	input := []byte(signingInput)
+	if p.Type.HashSignatureInput() {
+		hf := keysutil.HashFuncMap[params.hash]()
+		hf.Write(input)
+		input = hf.Sum(nil)
+	}
+
+	sig, err := p.SignWithOptions(ver, nil, input, &keysutil.SigningOptions{
+		HashAlgorithm: params.hash,
+		Marshaling:    keysutil.MarshalingTypeJWS,
+		SaltLength:    rsa.PSSSaltLengthEqualsHash,
+		SigAlgorithm:  params.sigAlgorithm,
+	})
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	// Strip the version prefix from the signature
+	idx := strings.LastIndex(sig.Signature, ":")
+	if idx < 0 {
+		return nil, errors.New("unexpected signature format")
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"token":       signingInput + "." + sig.Signature[idx+1:],
+			"key_version": ver,
+		},
+	}, nil
+}
+
+func (b *backend) pathKeysJWKSRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.readJWKS(ctx, req, d.Get("name").(string), false)
+}
+
+func (b *backend) pathJWKSRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.readJWKS(ctx, req, d.Get("name").(string), true)
+}
+
+func (b *backend) readJWKS(ctx context.Context, req *logical.Request, name string, public bool) (*logical.Response, error) {
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || (public && !p.PublicJWKS) {
+		return nil, nil
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	if p.Derived {
+		return logical.ErrorResponse("JWKS is not supported for derived keys"), logical.ErrInvalidRequest
+	}
+
+	// The JWKS lists every version still available for verification
+	versions := make([]int, 0, len(p.Keys))
+	for k := range p.Keys {
+		ver, err := strconv.Atoi(k)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, ver)
+	}
+	sort.Ints(versions)
+
+	keys := make([]jose.JSONWebKey, 0, len(versions))
+	for _, ver := range versions {
+		jwk, err := versionJWK(p, ver, p.Keys[strconv.Itoa(ver)])
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+			default:
+				return nil, err
+			}
+		}
+		keys = append(keys, jwk)
+	}
+
+	jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: keys})
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/json",
+			logical.HTTPRawBody:     jwks,
+			logical.HTTPStatusCode:  200,
+		},
+	}, nil
+}
+
+// versionJWK returns the JWK of the public key of the given key version
+func versionJWK(p *keysutil.Policy, ver int, keyEntry keysutil.KeyEntry) (jose.JSONWebKey, error) {
+	alg, _, err := keyJWSAlgorithm(p.Type, "")
+	if err != nil {
+		return jose.JSONWebKey{}, errutil.UserError{Err: err.Error()}
+	}
+
+	var publicKey crypto.PublicKey
+	switch p.Type {
+	case keysutil.KeyType_ECDSA_P256, keysutil.KeyType_ECDSA_P384, keysutil.KeyType_ECDSA_P521:
+		curve := elliptic.P256()
+		switch p.Type {
+		case keysutil.KeyType_ECDSA_P384:
+			curve = elliptic.P384()
+		case keysutil.KeyType_ECDSA_P521:
+			curve = elliptic.P521()
+		}
+		publicKey = &ecdsa.PublicKey{Curve: curve, X: keyEntry.EC_X, Y: keyEntry.EC_Y}
+	case keysutil.KeyType_ED25519:
+		raw, err := base64.StdEncoding.DecodeString(keyEntry.FormattedPublicKey)
+		if err != nil {
+			return jose.JSONWebKey{}, fmt.Errorf("error decoding public key: %w", err)
+		}
+		publicKey = ed25519.PublicKey(raw)
+	default:
+		// RSA keys may be used with several algorithms
+		alg = ""
+		publicKey = keyEntry.RSAPublicKey
+		if keyEntry.RSAPublicKey == nil && keyEntry.RSAKey != nil {
+			publicKey = keyEntry.RSAKey.Public()
+		}
+	}
+
+	return jose.JSONWebKey{
+		Key:       publicKey,
+		KeyID:     strconv.Itoa(ver),
+		Algorithm: alg,
+		Use:       "sig",
+	}, nil
+}
+
+const pathJWTSignHelpSyn = `Sign a JWT using a named key`
+
+const pathJWTSignHelpDesc = `
+Signs the given claims as a compact JWS, with a header giving the algorithm
+and, as the key ID, the key version used. The signature can be verified with
+the key's JWKS.
+`
+
+const pathJWKSHelpSyn = `Read the JWKS of a named key`
+
+const pathJWKSHelpDesc = `
+Returns the public keys of every available version of the named signing key
+as a JSON Web Key Set, with the key versions as key IDs. The JWKS is readable
+without authentication at jwks/:name when the key has public_jwks set.
+`
@@ -0,0 +1,128 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package transit
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransit_JWT(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   s,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	readJWKS := func(path string) jose.JSONWebKeySet {
+		t.Helper()
+		resp, err := doReq(logical.ReadOperation, path, nil)
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		var jwks jose.JSONWebKeySet
+		require.NoError(t, json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &jwks))
+		return jwks
+	}
+
+	cases := []struct {
+		keyType   string
+		algorithm string
+		expected  string
+	}{
+		{"ecdsa-p256", "", "ES256"},
+		{"ecdsa-p384", "", "ES384"},
+		{"ecdsa-p521", "", "ES512"},
+		{"ed25519", "", "EdDSA"},
+		{"rsa-2048", "", "RS256"},
+		{"rsa-3072", "PS384", "PS384"},
+		{"rsa-4096", "RS512", "RS512"},
+	}
+	for _, c := range cases {
+		t.Run(c.keyType, func(t *testing.T) {
+			_, err := doReq(logical.UpdateOperation, "keys/"+c.keyType, map[string]interface{}{"type": c.keyType})
+			require.NoError(t, err)
+			_, err = doReq(logical.UpdateOperation, "keys/"+c.keyType+"/rotate", nil)
+			require.NoError(t, err)
+
+			resp, err := doReq(logical.UpdateOperation, "jwt/sign/"+c.keyType, map[string]interface{}{
+				"claims": map[string]interface{}{
+					"sub": "alice",
+					"aud": "platform",
+				},
+				"algorithm":   c.algorithm,
+				"key_version": 1,
+			})
+			require.NoError(t, err)
+			require.False(t, resp.IsError(), resp.Error())
+			require.Equal(t, 1, resp.Data["key_version"])
+
+			token, err := jwt.ParseSigned(resp.Data["token"].(string))
+			require.NoError(t, err)
+			require.Len(t, token.Headers, 1)
+			require.Equal(t, c.expected, token.Headers[0].Algorithm)
+			require.Equal(t, "1", token.Headers[0].KeyID)
+
+			jwks := readJWKS("keys/" + c.keyType + "/jwks")
+			require.Len(t, jwks.Keys, 2)
+			keys := jwks.Key(token.Headers[0].KeyID)
+			require.Len(t, keys, 1)
+
+			var claims jwt.Claims
+			require.NoError(t, token.Claims(keys[0].Key, &claims))
+			require.Equal(t, "alice", claims.Subject)
+			require.Equal(t, jwt.Audience{"platform"}, claims.Audience)
+
+			// The other version's key does not verify the token
+			other := jwks.Key("2")
+			require.Len(t, other, 1)
+			require.Error(t, token.Claims(other[0].Key, &claims))
+		})
+	}
+
+	// Trimmed versions are no longer listed
+	_, err := doReq(logical.UpdateOperation, "keys/ed25519/config", map[string]interface{}{"min_decryption_version": 2})
+	require.NoError(t, err)
+	require.Len(t, readJWKS("keys/ed25519/jwks").Keys, 1)
+
+	// The unauthenticated JWKS is only served when enabled on the key
+	resp, err := doReq(logical.ReadOperation, "jwks/ed25519", nil)
+	require.NoError(t, err)
+	require.Nil(t, resp)
+	_, err = doReq(logical.UpdateOperation, "keys/ed25519/config", map[string]interface{}{"public_jwks": true})
+	require.NoError(t, err)
+	jwks := readJWKS("jwks/ed25519")
+	require.Len(t, jwks.Keys, 1)
+	require.Equal(t, "2", jwks.Keys[0].KeyID)
+	require.True(t, jwks.Keys[0].IsPublic())
+
+	// Algorithms must match the key type
+	resp, err = doReq(logical.UpdateOperation, "jwt/sign/ecdsa-p256", map[string]interface{}{
+		"claims":    map[string]interface{}{"sub": "alice"},
+		"algorithm": "ES384",
+	})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+
+	_, err = doReq(logical.UpdateOperation, "keys/aes", nil)
+	require.NoError(t, err)
+	resp, err = doReq(logical.UpdateOperation, "jwt/sign/aes", map[string]interface{}{
+		"claims": map[string]interface{}{"sub": "alice"},
+	})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+	resp, err = doReq(logical.UpdateOperation, "keys/aes/config", map[string]interface{}{"public_jwks": true})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+}
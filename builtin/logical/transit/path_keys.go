@@ -61,7 +61,7 @@ func (b *backend) pathKeys() *framework.Path {
 				Description: `
 The type of key to create. Currently, "aes128-gcm96" (symmetric), "aes256-gcm96" (symmetric), "ecdsa-p256"
 (asymmetric), "ecdsa-p384" (asymmetric), "ecdsa-p521" (asymmetric), "ed25519" (asymmetric), "rsa-2048" (asymmetric), "rsa-3072"
-(asymmetric), "rsa-4096" (asymmetric) are supported.  Defaults to "aes256-gcm96".
+(asymmetric), "rsa-4096" (asymmetric), "x25519" (asymmetric) are supported.  Defaults to "aes256-gcm96".
 `,
 			},
 
@@ -222,6 +222,8 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 		polReq.KeyType = keysutil.KeyType_RSA4096
 	case "hmac":
 		polReq.KeyType = keysutil.KeyType_HMAC
+	case "x25519":
+		polReq.KeyType = keysutil.KeyType_X25519
 	case "managed_key":
 		polReq.KeyType = keysutil.KeyType_MANAGED_KEY
 	default:
@@ -272,6 +274,10 @@ type asymKey struct {
 	Name         string    `json:"name" structs:"name" mapstructure:"name"`
 	PublicKey    string    `json:"public_key" structs:"public_key" mapstructure:"public_key"`
 	CreationTime time.Time `json:"creation_time" structs:"creation_time" mapstructure:"creation_time"`
+
+	// CertificateChain is the PEM-encoded certificate chain set for the key
+	// version, if any
+	CertificateChain string `json:"certificate_chain,omitempty" structs:"certificate_chain,omitempty" mapstructure:"certificate_chain"`
 }
 
 func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
@@ -324,6 +330,7 @@ func (b *backend) formatKeyPolicy(p *keysutil.Policy, context []byte) (*logical.
 			"supports_derivation":    p.Type.DerivationSupported(),
 			"auto_rotate_period":     int64(p.AutoRotatePeriod.Seconds()),
 			"imported_key":           p.Imported,
+			"public_jwks":            p.PublicJWKS,
 		},
 	}
 	if p.KeySize != 0 {
@@ -347,6 +354,28 @@ func (b *backend) formatKeyPolicy(p *keysutil.Policy, context []byte) (*logical.
 		}
 	}
 
+	if p.Type.EncryptionSupported() {
+		encryptionCounts := map[string]uint64{}
+		for k := range p.Keys {
+			ver, err := strconv.Atoi(k)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version %q: %w", k, err)
+			}
+			encryptionCounts[k] = p.EncryptionCount(ver)
+		}
+		resp.Data["encryption_counts"] = encryptionCounts
+		resp.Data["max_encryptions_per_version"] = p.MaxEncryptionsPerVersion
+	}
+
+	if p.Type.CMACSupported() {
+		cmacLength := p.CMACLength
+		if cmacLength == 0 {
+			cmacLength = maxCMACLength
+		}
+		resp.Data["allow_cmac"] = p.AllowCMAC
+		resp.Data["cmac_length"] = cmacLength
+	}
+
 	if p.Derived {
 		switch p.KDF {
 		case keysutil.Kdf_hmac_sha256_counter:
@@ -369,7 +398,7 @@ func (b *backend) formatKeyPolicy(p *keysutil.Policy, context []byte) (*logical.
 		}
 		resp.Data["keys"] = retKeys
 
-	case keysutil.KeyType_ECDSA_P256, keysutil.KeyType_ECDSA_P384, keysutil.KeyType_ECDSA_P521, keysutil.KeyType_ED25519, keysutil.KeyType_RSA2048, keysutil.KeyType_RSA3072, keysutil.KeyType_RSA4096:
+	case keysutil.KeyType_ECDSA_P256, keysutil.KeyType_ECDSA_P384, keysutil.KeyType_ECDSA_P521, keysutil.KeyType_ED25519, keysutil.KeyType_RSA2048, keysutil.KeyType_RSA3072, keysutil.KeyType_RSA4096, keysutil.KeyType_X25519:
 		retKeys := map[string]map[string]interface{}{}
 		for k, v := range p.Keys {
 			key := asymKey{
@@ -379,6 +408,12 @@ func (b *backend) formatKeyPolicy(p *keysutil.Policy, context []byte) (*logical.
 			if key.CreationTime.IsZero() {
 				key.CreationTime = time.Unix(v.DeprecatedCreationTime, 0)
 			}
+			for _, derCert := range v.CertificateChain {
+				key.CertificateChain += string(pem.EncodeToMemory(&pem.Block{
+					Type:  "CERTIFICATE",
+					Bytes: derCert,
+				}))
+			}
 
 			switch p.Type {
 			case keysutil.KeyType_ECDSA_P256:
@@ -405,6 +440,8 @@ func (b *backend) formatKeyPolicy(p *keysutil.Policy, context []byte) (*logical.
 					}
 				}
 				key.Name = "ed25519"
+			case keysutil.KeyType_X25519:
+				key.Name = "x25519"
 			case keysutil.KeyType_RSA2048, keysutil.KeyType_RSA3072, keysutil.KeyType_RSA4096:
 				key.Name = "rsa-2048"
 				if p.Type == keysutil.KeyType_RSA3072 {
@@ -65,6 +65,33 @@ the latest version of the key is allowed.`,
 being automatically rotated. A value of 0
 disables automatic rotation for the key.`,
 			},
+
+			"max_encryptions_per_version": {
+				Type: framework.TypeInt64,
+				Description: `Number of encryptions after which the key is
+automatically rotated. A value of 0 disables rotation
+based on usage.`,
+			},
+
+			"public_jwks": {
+				Type: framework.TypeBool,
+				Description: `Publishes the JWKS of the key's public keys at
+jwks/:name, without authentication.`,
+			},
+
+			"allow_cmac": {
+				Type: framework.TypeBool,
+				Description: `Allows CMACs to be generated and verified with the
+AES key. The key used for encryption is used for CMACs
+as well, so only enable this on keys meant for both.`,
+			},
+
+			"cmac_length": {
+				Type: framework.TypeInt,
+				Description: `The length of the key's CMACs in bytes, between 8
+and 16. CMACs are only verified at this length, so
+changing it invalidates existing CMACs. Defaults to 16.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -104,6 +131,10 @@ func (b *backend) pathKeysConfigWrite(ctx context.Context, req *logical.Request,
 	originalDeletionAllowed := p.DeletionAllowed
 	originalExportable := p.Exportable
 	originalAllowPlaintextBackup := p.AllowPlaintextBackup
+	originalPublicJWKS := p.PublicJWKS
+	originalMaxEncryptionsPerVersion := p.MaxEncryptionsPerVersion
+	originalAllowCMAC := p.AllowCMAC
+	originalCMACLength := p.CMACLength
 
 	defer func() {
 		if retErr != nil || (resp != nil && resp.IsError()) {
@@ -112,6 +143,10 @@ func (b *backend) pathKeysConfigWrite(ctx context.Context, req *logical.Request,
 			p.DeletionAllowed = originalDeletionAllowed
 			p.Exportable = originalExportable
 			p.AllowPlaintextBackup = originalAllowPlaintextBackup
+			p.PublicJWKS = originalPublicJWKS
+			p.MaxEncryptionsPerVersion = originalMaxEncryptionsPerVersion
+			p.AllowCMAC = originalAllowCMAC
+			p.CMACLength = originalCMACLength
 		}
 	}()
 
@@ -203,6 +238,60 @@ func (b *backend) pathKeysConfigWrite(ctx context.Context, req *logical.Request,
 		}
 	}
 
+	maxEncryptionsRaw, ok := d.GetOk("max_encryptions_per_version")
+	if ok {
+		maxEncryptions := maxEncryptionsRaw.(int64)
+		if maxEncryptions < 0 {
+			return logical.ErrorResponse("max encryptions per version cannot be negative"), logical.ErrInvalidRequest
+		}
+		if maxEncryptions > 0 && !p.Type.EncryptionSupported() {
+			return logical.ErrorResponse("max encryptions per version is only supported for encryption keys"), logical.ErrInvalidRequest
+		}
+		if uint64(maxEncryptions) != p.MaxEncryptionsPerVersion {
+			p.MaxEncryptionsPerVersion = uint64(maxEncryptions)
+			persistNeeded = true
+		}
+	}
+
+	publicJWKSRaw, ok := d.GetOk("public_jwks")
+	if ok {
+		publicJWKS := publicJWKSRaw.(bool)
+		if publicJWKS && !p.Type.SigningSupported() {
+			return logical.ErrorResponse("public JWKS is only supported for signing keys"), logical.ErrInvalidRequest
+		}
+		if publicJWKS != p.PublicJWKS {
+			p.PublicJWKS = publicJWKS
+			persistNeeded = true
+		}
+	}
+
+	allowCMACRaw, ok := d.GetOk("allow_cmac")
+	if ok {
+		allowCMAC := allowCMACRaw.(bool)
+		if allowCMAC && !p.Type.CMACSupported() {
+			return logical.ErrorResponse("CMAC is only supported for AES-GCM keys"), logical.ErrInvalidRequest
+		}
+		if allowCMAC != p.AllowCMAC {
+			p.AllowCMAC = allowCMAC
+			persistNeeded = true
+		}
+	}
+
+	cmacLengthRaw, ok := d.GetOk("cmac_length")
+	if ok {
+		cmacLength := cmacLengthRaw.(int)
+		if !p.Type.CMACSupported() {
+			return logical.ErrorResponse("CMAC is only supported for AES-GCM keys"), logical.ErrInvalidRequest
+		}
+		if cmacLength < minCMACLength || cmacLength > maxCMACLength {
+			return logical.ErrorResponse(fmt.Sprintf("cmac_length must be between %d and %d", minCMACLength, maxCMACLength)), logical.ErrInvalidRequest
+		}
+		if cmacLength != p.CMACLength {
+			p.CMACLength = cmacLength
+			persistNeeded = true
+		}
+	}
+
 	autoRotatePeriodRaw, ok, err := d.GetOkErr("auto_rotate_period")
 	if err != nil {
 		return nil, err
@@ -16,6 +16,7 @@ import (
 	uuid "github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/api"
 	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/hashicorp/vault/vault"
 )
@@ -406,3 +407,177 @@ func TestTransit_UpdateKeyConfigWithAutorotation(t *testing.T) {
 		})
 	}
 }
+
+func TestTransit_KeyUsage(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   s,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		return resp
+	}
+
+	// persistedCounts returns the encryption counts in storage
+	persistedCounts := func() map[string]uint64 {
+		t.Helper()
+		entry, err := s.Get(context.Background(), "policy/foo")
+		if err != nil || entry == nil {
+			t.Fatalf("failed to read policy: %v", err)
+		}
+		var policy struct {
+			Keys map[string]struct {
+				EncryptionCount uint64 `json:"encryption_count"`
+			} `json:"keys"`
+		}
+		if err := entry.DecodeJSON(&policy); err != nil {
+			t.Fatal(err)
+		}
+		counts := map[string]uint64{}
+		for k, v := range policy.Keys {
+			counts[k] = v.EncryptionCount
+		}
+		return counts
+	}
+
+	plaintext := map[string]interface{}{"plaintext": "aGVsbG8="}
+	doReq(logical.UpdateOperation, "keys/foo", nil)
+	doReq(logical.UpdateOperation, "keys/foo/config", map[string]interface{}{"max_encryptions_per_version": 5})
+
+	doReq(logical.UpdateOperation, "encrypt/foo", plaintext)
+	doReq(logical.UpdateOperation, "encrypt/foo", map[string]interface{}{
+		"batch_input": []interface{}{plaintext, plaintext},
+	})
+
+	// Counts include encryptions which have not been persisted yet
+	resp := doReq(logical.ReadOperation, "keys/foo", nil)
+	if counts := resp.Data["encryption_counts"].(map[string]uint64); counts["1"] != 3 {
+		t.Fatalf("bad encryption counts: %v", counts)
+	}
+	if counts := persistedCounts(); counts["1"] != 0 {
+		t.Fatalf("bad persisted encryption counts: %v", counts)
+	}
+
+	// Reaching the limit rotates the key, and persists the counts
+	doReq(logical.UpdateOperation, "datakey/wrapped/foo", nil)
+	doReq(logical.UpdateOperation, "encrypt/foo", plaintext)
+	resp = doReq(logical.ReadOperation, "keys/foo", nil)
+	if resp.Data["latest_version"] != 2 {
+		t.Fatalf("expected the key to be rotated, got latest version %v", resp.Data["latest_version"])
+	}
+	if counts := persistedCounts(); counts["1"] != 5 || counts["2"] != 0 {
+		t.Fatalf("bad persisted encryption counts: %v", counts)
+	}
+
+	// Remaining counts are persisted by the periodic function
+	doReq(logical.UpdateOperation, "encrypt/foo", plaintext)
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+	if counts := persistedCounts(); counts["1"] != 5 || counts["2"] != 1 {
+		t.Fatalf("bad persisted encryption counts: %v", counts)
+	}
+	resp = doReq(logical.ReadOperation, "keys/foo", nil)
+	if counts := resp.Data["encryption_counts"].(map[string]uint64); counts["2"] != 1 {
+		t.Fatalf("bad encryption counts: %v", counts)
+	}
+	if resp.Data["max_encryptions_per_version"] != uint64(5) {
+		t.Fatalf("bad max encryptions: %v", resp.Data["max_encryptions_per_version"])
+	}
+
+	// Counts which fail to be persisted are kept, and persisted on the next
+	// run of the periodic function
+	doReq(logical.UpdateOperation, "encrypt/foo", plaintext)
+	s.(*logical.InmemStorage).FailPut(true)
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: s}); err == nil {
+		t.Fatal("expected persisting the counts to fail")
+	}
+	resp = doReq(logical.ReadOperation, "keys/foo", nil)
+	if counts := resp.Data["encryption_counts"].(map[string]uint64); counts["2"] != 2 {
+		t.Fatalf("bad encryption counts: %v", counts)
+	}
+	s.(*logical.InmemStorage).FailPut(false)
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+	if counts := persistedCounts(); counts["2"] != 2 {
+		t.Fatalf("bad persisted encryption counts: %v", counts)
+	}
+}
+
+func TestTransit_KeyUsagePerfStandby(t *testing.T) {
+	b, s := createBackendWithSysView(t)
+
+	doReq := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   s,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	for _, path := range []string{"keys/limited", "keys/unlimited"} {
+		if _, err := doReq(path, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := doReq("keys/limited/config", map[string]interface{}{"max_encryptions_per_version": 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := map[string]interface{}{"plaintext": "aGVsbG8="}
+	resp, err := doReq("encrypt/limited", plaintext)
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	ciphertext := map[string]interface{}{"ciphertext": resp.Data["ciphertext"]}
+
+	b.System().(*logical.StaticSystemView).ReplicationStateVal = consts.ReplicationPerformanceStandby
+
+	// Keys with a usage limit are only used by the active node, which counts
+	// their encryptions
+	for path, data := range map[string]map[string]interface{}{
+		"encrypt/limited":         plaintext,
+		"datakey/wrapped/limited": nil,
+		"rewrap/limited":          ciphertext,
+	} {
+		if _, err := doReq(path, data); err != logical.ErrReadOnly {
+			t.Fatalf("expected %s to be forwarded, got: %v", path, err)
+		}
+	}
+
+	// Decryption is still served locally
+	resp, err = doReq("decrypt/limited", ciphertext)
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// Encryptions with other keys are kept pending, as they cannot be
+	// persisted
+	resp, err = doReq("encrypt/unlimited", plaintext)
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   s,
+		Operation: logical.ReadOperation,
+		Path:      "keys/unlimited",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts := resp.Data["encryption_counts"].(map[string]uint64); counts["1"] != 1 {
+		t.Fatalf("bad encryption counts: %v", counts)
+	}
+}
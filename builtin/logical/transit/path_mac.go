@@ -0,0 +1,504 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package transit
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	macTypeCMAC = "cmac"
+	macTypeKMAC = "kmac"
+
+	// CMACs may be truncated down to 64 bits, as recommended by NIST SP
+	// 800-38B; the length is set on the key so that a CMAC cannot be
+	// truncated further by whoever presents it
+	minCMACLength = 8
+	maxCMACLength = 16
+
+	minKMACLength     = 16
+	maxKMACLength     = 64
+	defaultKMACLength = 32
+)
+
+// batchResponseMACItem represents a response item for CMAC and KMAC batch
+// processing
+type batchResponseMACItem struct {
+	// CMAC for the input present in the corresponding batch request item
+	CMAC string `json:"cmac,omitempty" mapstructure:"cmac"`
+
+	// KMAC for the input present in the corresponding batch request item
+	KMAC string `json:"kmac,omitempty" mapstructure:"kmac"`
+
+	// Valid indicates whether the MAC matches the one computed from the input
+	Valid bool `json:"valid,omitempty" mapstructure:"valid"`
+
+	// Error, if set represents a failure encountered while processing a
+	// corresponding batch request item
+	Error string `json:"error,omitempty" mapstructure:"error"`
+
+	// See batchResponseHMACItem
+	err error
+
+	// Reference is an arbitrary caller supplied string value that will be placed on the
+	// batch response to ease correlation between inputs and outputs
+	Reference string `json:"reference" mapstructure:"reference"`
+}
+
+// macFunc computes the MAC of the input with the given key version and length
+type macFunc func(p *keysutil.Policy, ver int, input []byte, macLength int) ([]byte, error)
+
+func (b *backend) pathCMAC() *framework.Path {
+	return &framework.Path{
+		Pattern: "cmac/" + framework.GenericNameRegex("name"),
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixTransit,
+			OperationVerb:   "generate",
+			OperationSuffix: "cmac",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The AES key to use for the CMAC function",
+			},
+
+			"input": {
+				Type:        framework.TypeString,
+				Description: "The base64-encoded input data",
+			},
+
+			"key_version": {
+				Type: framework.TypeInt,
+				Description: `The version of the key to use for generating the CMAC.
+Must be 0 (for latest) or a value greater than or equal
+to the min_encryption_version configured on the key.`,
+			},
+
+			"batch_input": {
+				Type: framework.TypeSlice,
+				Description: `
+Specifies a list of items to be processed in a single batch. When this parameter
+is set, if the parameter 'input' is also set, it will be ignored.
+Any batch output will preserve the order of the batch input.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCMACWrite,
+		},
+
+		HelpSynopsis:    pathCMACHelpSyn,
+		HelpDescription: pathCMACHelpDesc,
+	}
+}
+
+func (b *backend) pathKMAC() *framework.Path {
+	return &framework.Path{
+		Pattern: "kmac/" + framework.GenericNameRegex("name") + framework.OptionalParamRegex("urlalgorithm"),
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixTransit,
+			OperationVerb:   "generate",
+			OperationSuffix: "kmac|kmac-with-algorithm",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The key whose HMAC key to use for the KMAC function",
+			},
+
+			"input": {
+				Type:        framework.TypeString,
+				Description: "The base64-encoded input data",
+			},
+
+			"algorithm": {
+				Type:    framework.TypeString,
+				Default: keysutil.KMAC256,
+				Description: `Algorithm to use (POST body parameter). Valid values are:
+
+* kmac128
+* kmac256
+
+Defaults to "kmac256".`,
+			},
+
+			"urlalgorithm": {
+				Type:        framework.TypeString,
+				Description: `Algorithm to use (POST URL parameter)`,
+			},
+
+			"customization": {
+				Type:        framework.TypeString,
+				Description: "The customization string of the KMAC function, if any",
+			},
+
+			"mac_length": {
+				Type:        framework.TypeInt,
+				Default:     defaultKMACLength,
+				Description: "The length of the KMAC in bytes, between 16 and 64. Defaults to 32.",
+			},
+
+			"key_version": {
+				Type: framework.TypeInt,
+				Description: `The version of the key to use for generating the KMAC.
+Must be 0 (for latest) or a value greater than or equal
+to the min_encryption_version configured on the key.`,
+			},
+
+			"batch_input": {
+				Type: framework.TypeSlice,
+				Description: `
+Specifies a list of items to be processed in a single batch. When this parameter
+is set, if the parameter 'input' is also set, it will be ignored.
+Any batch output will preserve the order of the batch input.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathKMACWrite,
+		},
+
+		HelpSynopsis:    pathKMACHelpSyn,
+		HelpDescription: pathKMACHelpDesc,
+	}
+}
+
+// cmacFunc ignores the requested length: CMACs always have the length
+// configured on the key
+func cmacFunc() macFunc {
+	return func(p *keysutil.Policy, ver int, input []byte, _ int) ([]byte, error) {
+		return p.CMAC(ver, input)
+	}
+}
+
+func kmacFunc(algorithm, customization string) macFunc {
+	return func(p *keysutil.Policy, ver int, input []byte, macLength int) ([]byte, error) {
+		return p.KMAC(ver, algorithm, []byte(customization), input, macLength)
+	}
+}
+
+// kmacAlgorithm returns the KMAC variant requested on a KMAC or verify path
+func kmacAlgorithm(d *framework.FieldData) string {
+	if algorithm := d.Get("urlalgorithm").(string); algorithm != "" {
+		return algorithm
+	}
+	// On the verify path the algorithm field defaults to a hash algorithm
+	if algorithm, ok := d.GetOk("algorithm"); ok {
+		return algorithm.(string)
+	}
+	return keysutil.KMAC256
+}
+
+func (b *backend) pathCMACWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.macWrite(ctx, req, d, macTypeCMAC, 0, cmacFunc())
+}
+
+func (b *backend) pathKMACWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	macLength := d.Get("mac_length").(int)
+	if macLength < minKMACLength || macLength > maxKMACLength {
+		return logical.ErrorResponse(fmt.Sprintf("mac_length must be between %d and %d", minKMACLength, maxKMACLength)), logical.ErrInvalidRequest
+	}
+
+	algorithm := kmacAlgorithm(d)
+	switch algorithm {
+	case keysutil.KMAC128, keysutil.KMAC256:
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %q", algorithm)), logical.ErrInvalidRequest
+	}
+
+	return b.macWrite(ctx, req, d, macTypeKMAC, macLength, kmacFunc(algorithm, d.Get("customization").(string)))
+}
+
+func (b *backend) macWrite(ctx context.Context, req *logical.Request, d *framework.FieldData, macType string, macLength int, mac macFunc) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	ver := d.Get("key_version").(int)
+
+	// Get the policy
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	switch {
+	case ver == 0:
+		ver = p.LatestVersion
+	case ver == p.LatestVersion:
+		// Allowed
+	case p.MinEncryptionVersion > 0 && ver < p.MinEncryptionVersion:
+		return logical.ErrorResponse(fmt.Sprintf("cannot generate %s: version is too old (disallowed by policy)", strings.ToUpper(macType))), logical.ErrInvalidRequest
+	}
+
+	batchInputRaw := d.Raw["batch_input"]
+	var batchInputItems []batchRequestHMACItem
+	if batchInputRaw != nil {
+		err = mapstructure.Decode(batchInputRaw, &batchInputItems)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse batch input: %w", err)
+		}
+
+		if len(batchInputItems) == 0 {
+			return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+		}
+	} else {
+		valueRaw, ok := d.GetOk("input")
+		if !ok {
+			return logical.ErrorResponse(fmt.Sprintf("missing input for %s", strings.ToUpper(macType))), logical.ErrInvalidRequest
+		}
+
+		batchInputItems = []batchRequestHMACItem{{
+			"input": valueRaw.(string),
+		}}
+	}
+
+	response := make([]batchResponseMACItem, len(batchInputItems))
+
+	for i, item := range batchInputItems {
+		rawInput, ok := item["input"]
+		if !ok {
+			response[i].Error = fmt.Sprintf("missing input for %s", strings.ToUpper(macType))
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		input, err := base64.StdEncoding.DecodeString(rawInput)
+		if err != nil {
+			response[i].Error = fmt.Sprintf("unable to decode input as base64: %s", err)
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		retBytes, err := mac(p, ver, input, macLength)
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				response[i].Error = err.Error()
+				response[i].err = logical.ErrInvalidRequest
+			default:
+				response[i].err = err
+			}
+			continue
+		}
+
+		retStr := fmt.Sprintf("vault:v%s:%s", strconv.Itoa(ver), base64.StdEncoding.EncodeToString(retBytes))
+		if macType == macTypeCMAC {
+			response[i].CMAC = retStr
+		} else {
+			response[i].KMAC = retStr
+		}
+	}
+
+	// Generate the response
+	resp := &logical.Response{}
+	if batchInputRaw != nil {
+		// Copy the references
+		for i := range batchInputItems {
+			response[i].Reference = batchInputItems[i]["reference"]
+		}
+		resp.Data = map[string]interface{}{
+			"batch_results": response,
+		}
+		return resp, nil
+	}
+
+	if response[0].Error != "" || response[0].err != nil {
+		if response[0].Error != "" {
+			return logical.ErrorResponse(response[0].Error), response[0].err
+		}
+		return nil, response[0].err
+	}
+
+	if macType == macTypeCMAC {
+		resp.Data = map[string]interface{}{
+			"cmac": response[0].CMAC,
+		}
+	} else {
+		resp.Data = map[string]interface{}{
+			"kmac": response[0].KMAC,
+		}
+	}
+	return resp, nil
+}
+
+// pathMACVerify verifies CMACs or KMACs given to the verify path. CMACs are
+// compared at the length configured on the key, so a truncated CMAC does not
+// verify. The length of a KMAC is part of its computation, so each KMAC is
+// computed at the length it was given with.
+func (b *backend) pathMACVerify(ctx context.Context, req *logical.Request, d *framework.FieldData, macType string, batchInputItems []batchRequestVerifyItem) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	var mac macFunc
+	var minLength, maxLength int
+	switch macType {
+	case macTypeCMAC:
+		mac = cmacFunc()
+	case macTypeKMAC:
+		algorithm := kmacAlgorithm(d)
+		switch algorithm {
+		case keysutil.KMAC128, keysutil.KMAC256:
+		default:
+			return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %q", algorithm)), logical.ErrInvalidRequest
+		}
+		mac = kmacFunc(algorithm, d.Get("customization").(string))
+		minLength, maxLength = minKMACLength, maxKMACLength
+	}
+
+	// Get the policy
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	response := make([]batchResponseMACItem, len(batchInputItems))
+
+	for i, item := range batchInputItems {
+		input, err := base64.StdEncoding.DecodeString(item["input"])
+		if err != nil {
+			response[i].Error = fmt.Sprintf("unable to decode input as base64: %s", err)
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		verificationMAC, ok := item[macType]
+		if !ok {
+			response[i].Error = fmt.Sprintf("missing %s", macType)
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		// Verify the prefix
+		if !strings.HasPrefix(verificationMAC, "vault:v") {
+			response[i].Error = fmt.Sprintf("invalid %s to verify: no prefix", strings.ToUpper(macType))
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		splitVerificationMAC := strings.SplitN(strings.TrimPrefix(verificationMAC, "vault:v"), ":", 2)
+		if len(splitVerificationMAC) != 2 {
+			response[i].Error = fmt.Sprintf("invalid %s: wrong number of fields", strings.ToUpper(macType))
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		ver, err := strconv.Atoi(splitVerificationMAC[0])
+		if err != nil {
+			response[i].Error = fmt.Sprintf("invalid %s: version number could not be decoded", strings.ToUpper(macType))
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		verBytes, err := base64.StdEncoding.DecodeString(splitVerificationMAC[1])
+		if err != nil {
+			response[i].Error = fmt.Sprintf("unable to decode verification %s as base64: %s", strings.ToUpper(macType), err)
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		if macType == macTypeKMAC && (len(verBytes) < minLength || len(verBytes) > maxLength) {
+			response[i].Error = fmt.Sprintf("invalid %s: length must be between %d and %d bytes", strings.ToUpper(macType), minLength, maxLength)
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		if ver > p.LatestVersion {
+			response[i].Error = fmt.Sprintf("invalid %s: version is too new", strings.ToUpper(macType))
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		if p.MinDecryptionVersion > 0 && ver < p.MinDecryptionVersion {
+			response[i].Error = fmt.Sprintf("cannot verify %s: version is too old (disallowed by policy)", strings.ToUpper(macType))
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		retBytes, err := mac(p, ver, input, len(verBytes))
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				response[i].Error = err.Error()
+				response[i].err = logical.ErrInvalidRequest
+			default:
+				response[i].err = err
+			}
+			continue
+		}
+		response[i].Valid = hmac.Equal(retBytes, verBytes)
+	}
+
+	// Generate the response
+	resp := &logical.Response{}
+	if d.Raw["batch_input"] != nil {
+		// Copy the references
+		for i := range batchInputItems {
+			response[i].Reference = batchInputItems[i]["reference"]
+		}
+		resp.Data = map[string]interface{}{
+			"batch_results": response,
+		}
+		return resp, nil
+	}
+
+	if response[0].Error != "" || response[0].err != nil {
+		if response[0].Error != "" {
+			return logical.ErrorResponse(response[0].Error), response[0].err
+		}
+		return nil, response[0].err
+	}
+	resp.Data = map[string]interface{}{
+		"valid": response[0].Valid,
+	}
+	return resp, nil
+}
+
+const pathCMACHelpSyn = `Generate a CMAC for input data using the named key`
+
+const pathCMACHelpDesc = `
+Generates an AES-CMAC (NIST SP 800-38B) of the given input data with the
+named key, which must be of type aes128-gcm96 or aes256-gcm96 and have
+allow_cmac set. The CMAC has the cmac_length configured on the key, and can
+be verified with the verify endpoint.
+`
+
+const pathKMACHelpSyn = `Generate a KMAC for input data using the named key`
+
+const pathKMACHelpDesc = `
+Generates a KMAC128 or KMAC256 (NIST SP 800-185) of the given input data with
+the HMAC key of the named key. The KMAC can be verified with the verify
+endpoint.
+`
@@ -0,0 +1,224 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransit_CMAC(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   s,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	input := base64.StdEncoding.EncodeToString([]byte("the quick brown fox"))
+
+	_, err := doReq("keys/aes", map[string]interface{}{"type": "aes256-gcm96"})
+	require.NoError(t, err)
+
+	// CMAC is refused until it is allowed on the key
+	resp, err := doReq("cmac/aes", map[string]interface{}{"input": input})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+
+	_, err = doReq("keys/aes/config", map[string]interface{}{"allow_cmac": true})
+	require.NoError(t, err)
+
+	resp, err = doReq("cmac/aes", map[string]interface{}{"input": input})
+	require.NoError(t, err)
+	cmac := resp.Data["cmac"].(string)
+	require.True(t, strings.HasPrefix(cmac, "vault:v1:"))
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(cmac, "vault:v1:"))
+	require.NoError(t, err)
+	require.Len(t, raw, 16)
+
+	resp, err = doReq("verify/aes", map[string]interface{}{"input": input, "cmac": cmac})
+	require.NoError(t, err)
+	require.Equal(t, true, resp.Data["valid"])
+
+	// A truncated CMAC does not verify at the key's length
+	resp, err = doReq("verify/aes", map[string]interface{}{
+		"input": input,
+		"cmac":  "vault:v1:" + base64.StdEncoding.EncodeToString(raw[:8]),
+	})
+	require.NoError(t, err)
+	require.Equal(t, false, resp.Data["valid"])
+
+	resp, err = doReq("verify/aes", map[string]interface{}{
+		"input": base64.StdEncoding.EncodeToString([]byte("other")),
+		"cmac":  cmac,
+	})
+	require.NoError(t, err)
+	require.Equal(t, false, resp.Data["valid"])
+
+	// CMACs are truncated to the length configured on the key, and the full
+	// CMAC no longer verifies
+	resp, err = doReq("keys/aes/config", map[string]interface{}{"cmac_length": 4})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+
+	_, err = doReq("keys/aes/config", map[string]interface{}{"cmac_length": 8})
+	require.NoError(t, err)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   s,
+		Operation: logical.ReadOperation,
+		Path:      "keys/aes",
+	})
+	require.NoError(t, err)
+	require.Equal(t, true, resp.Data["allow_cmac"])
+	require.Equal(t, 8, resp.Data["cmac_length"])
+
+	resp, err = doReq("cmac/aes", map[string]interface{}{"input": input})
+	require.NoError(t, err)
+	truncated := resp.Data["cmac"].(string)
+	truncatedRaw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(truncated, "vault:v1:"))
+	require.NoError(t, err)
+	require.Equal(t, raw[:8], truncatedRaw)
+
+	resp, err = doReq("verify/aes", map[string]interface{}{"input": input, "cmac": truncated})
+	require.NoError(t, err)
+	require.Equal(t, true, resp.Data["valid"])
+
+	resp, err = doReq("verify/aes", map[string]interface{}{"input": input, "cmac": cmac})
+	require.NoError(t, err)
+	require.Equal(t, false, resp.Data["valid"])
+
+	_, err = doReq("keys/aes/config", map[string]interface{}{"cmac_length": 16})
+	require.NoError(t, err)
+
+	// Batch generation and verification, with older key versions
+	_, err = doReq("keys/aes/rotate", nil)
+	require.NoError(t, err)
+	resp, err = doReq("cmac/aes", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"input": input, "reference": "a"},
+			map[string]interface{}{"input": "not base64", "reference": "b"},
+		},
+	})
+	require.NoError(t, err)
+	results := resp.Data["batch_results"].([]batchResponseMACItem)
+	require.True(t, strings.HasPrefix(results[0].CMAC, "vault:v2:"))
+	require.Equal(t, "a", results[0].Reference)
+	require.NotEmpty(t, results[1].Error)
+
+	resp, err = doReq("verify/aes", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"input": input, "cmac": cmac, "reference": "v1"},
+			map[string]interface{}{"input": input, "cmac": results[0].CMAC, "reference": "v2"},
+		},
+	})
+	require.NoError(t, err)
+	verified := resp.Data["batch_results"].([]batchResponseMACItem)
+	require.True(t, verified[0].Valid)
+	require.True(t, verified[1].Valid)
+	require.Equal(t, "v2", verified[1].Reference)
+
+	_, err = doReq("keys/aes/config", map[string]interface{}{"min_decryption_version": 2})
+	require.NoError(t, err)
+	resp, err = doReq("verify/aes", map[string]interface{}{"input": input, "cmac": cmac})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+
+	// Only AES keys support CMAC
+	_, err = doReq("keys/ec", map[string]interface{}{"type": "ecdsa-p256"})
+	require.NoError(t, err)
+	resp, err = doReq("keys/ec/config", map[string]interface{}{"allow_cmac": true})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+	resp, err = doReq("cmac/ec", map[string]interface{}{"input": input})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+}
+
+func TestTransit_KMAC(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   s,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	input := base64.StdEncoding.EncodeToString([]byte("the quick brown fox"))
+
+	_, err := doReq("keys/foo", map[string]interface{}{"type": "ecdsa-p256"})
+	require.NoError(t, err)
+
+	resp, err := doReq("kmac/foo", map[string]interface{}{"input": input})
+	require.NoError(t, err)
+	kmac256 := resp.Data["kmac"].(string)
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(kmac256, "vault:v1:"))
+	require.NoError(t, err)
+	require.Len(t, raw, 32)
+
+	resp, err = doReq("kmac/foo/kmac128", map[string]interface{}{
+		"input":         input,
+		"customization": "app",
+		"mac_length":    64,
+	})
+	require.NoError(t, err)
+	kmac128 := resp.Data["kmac"].(string)
+	require.NotEqual(t, kmac256, kmac128)
+
+	resp, err = doReq("verify/foo", map[string]interface{}{"input": input, "kmac": kmac256})
+	require.NoError(t, err)
+	require.Equal(t, true, resp.Data["valid"])
+
+	resp, err = doReq("verify/foo/kmac128", map[string]interface{}{
+		"input":         input,
+		"kmac":          kmac128,
+		"customization": "app",
+	})
+	require.NoError(t, err)
+	require.Equal(t, true, resp.Data["valid"])
+
+	// The variant and customization string are bound into the KMAC
+	resp, err = doReq("verify/foo", map[string]interface{}{
+		"input":         input,
+		"kmac":          kmac128,
+		"algorithm":     "kmac128",
+		"customization": "other",
+	})
+	require.NoError(t, err)
+	require.Equal(t, false, resp.Data["valid"])
+
+	resp, err = doReq("verify/foo", map[string]interface{}{
+		"input":         input,
+		"kmac":          kmac128,
+		"customization": "app",
+	})
+	require.NoError(t, err)
+	require.Equal(t, false, resp.Data["valid"])
+
+	resp, err = doReq("kmac/foo/kmac512", map[string]interface{}{"input": input})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+
+	// MACs cannot be mixed within a batch
+	resp, err = doReq("verify/foo", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"input": input, "kmac": kmac256},
+			map[string]interface{}{"input": input, "hmac": kmac256},
+		},
+	})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+}
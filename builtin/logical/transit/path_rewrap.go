@@ -145,6 +145,11 @@ func (b *backend) pathRewrapWrite(ctx context.Context, req *logical.Request, d *
 	if !b.System().CachingDisabled() {
 		p.Lock(false)
 	}
+	if err := b.forwardKeyUsage(p); err != nil {
+		p.Unlock()
+		return nil, err
+	}
+	defer b.updateKeyUsage(ctx, req.Storage, p)
 
 	warnAboutNonceUsage := false
 	for i, item := range batchInputItems {
@@ -156,7 +156,7 @@ Options are 'pss' or 'pkcs1v15'. Defaults to 'pss'`,
 			"marshaling_algorithm": {
 				Type:        framework.TypeString,
 				Default:     "asn1",
-				Description: `The method by which to marshal the signature. The default is 'asn1' which is used by openssl and X.509. It can also be set to 'jws' which is used for JWT signatures; setting it to this will also cause the encoding of the signature to be url-safe base64 instead of using standard base64 encoding. Currently only valid for ECDSA P-256 key types".`,
+				Description: `The method by which to marshal the signature. The default is 'asn1' which is used by openssl and X.509. It can also be set to 'jws' which is used for JWT signatures; setting it to this will also cause the encoding of the signature to be url-safe base64 instead of using standard base64 encoding. Currently only valid for ECDSA key types.`,
 			},
 
 			"salt_length": {
@@ -216,6 +216,21 @@ derivation is enabled; currently only available with ed25519 keys.`,
 				Description: "The HMAC, including vault header/key version",
 			},
 
+			"cmac": {
+				Type:        framework.TypeString,
+				Description: "The CMAC, including vault header/key version",
+			},
+
+			"kmac": {
+				Type:        framework.TypeString,
+				Description: "The KMAC, including vault header/key version",
+			},
+
+			"customization": {
+				Type:        framework.TypeString,
+				Description: "The customization string the KMAC was generated with, if any",
+			},
+
 			"input": {
 				Type:        framework.TypeString,
 				Description: "The base64-encoded input data to verify",
@@ -266,7 +281,7 @@ Options are 'pss' or 'pkcs1v15'. Defaults to 'pss'`,
 			"marshaling_algorithm": {
 				Type:        framework.TypeString,
 				Default:     "asn1",
-				Description: `The method by which to unmarshal the signature when verifying. The default is 'asn1' which is used by openssl and X.509; can also be set to 'jws' which is used for JWT signatures in which case the signature is also expected to be url-safe base64 encoding instead of standard base64 encoding. Currently only valid for ECDSA P-256 key types".`,
+				Description: `The method by which to unmarshal the signature when verifying. The default is 'asn1' which is used by openssl and X.509; can also be set to 'jws' which is used for JWT signatures in which case the signature is also expected to be url-safe base64 encoding instead of standard base64 encoding. Currently only valid for ECDSA key types.`,
 			},
 
 			"salt_length": {
@@ -534,9 +549,38 @@ func (b *backend) pathVerifyWrite(ctx context.Context, req *logical.Request, d *
 		if hmac, ok := d.GetOk("hmac"); ok {
 			batchInputItems[0]["hmac"] = hmac.(string)
 		}
+		for _, macType := range []string{macTypeCMAC, macTypeKMAC} {
+			if mac, ok := d.GetOk(macType); ok {
+				batchInputItems[0][macType] = mac.(string)
+			}
+		}
 		batchInputItems[0]["context"] = d.Get("context").(string)
 	}
 
+	// CMACs and KMACs are verified separately, and cannot be mixed with
+	// signatures or HMACs either.
+	for _, macType := range []string{macTypeCMAC, macTypeKMAC} {
+		macFound := false
+		for _, v := range batchInputItems {
+			if _, ok := v[macType]; ok {
+				macFound = true
+				break
+			}
+		}
+		if !macFound {
+			continue
+		}
+		for _, v := range batchInputItems {
+			_, hasMAC := v[macType]
+			_, hasSig := v["signature"]
+			_, hasHMAC := v["hmac"]
+			if !hasMAC || hasSig || hasHMAC {
+				return logical.ErrorResponse(fmt.Sprintf("elements of batch_input must all provide '%s'", macType)), logical.ErrInvalidRequest
+			}
+		}
+		return b.pathMACVerify(ctx, req, d, macType, batchInputItems)
+	}
+
 	// For simplicity, 'signature' and 'hmac' cannot be mixed across batch_input elements.
 	// If one batch_input item is 'signature', they all must be 'signature'.
 	// If one batch_input item is 'hmac', they all must be 'hmac'.
@@ -0,0 +1,290 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package transit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// streamContentType is the media type of the request and response bodies of
+// the stream endpoints
+const streamContentType = "application/octet-stream"
+
+var errStreamBodyRequired = errors.New("the request body must be sent with Content-Type " + streamContentType)
+
+func (b *backend) pathEncryptStream() *framework.Path {
+	return &framework.Path{
+		Pattern: "encrypt-stream/" + framework.GenericNameRegex("name"),
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixTransit,
+			OperationVerb:   "encrypt",
+			OperationSuffix: "stream",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The backend key used for encrypting the data key of the stream",
+			},
+
+			"context": {
+				Type:        framework.TypeString,
+				Description: "Base64 encoded context for key derivation. Required for derived keys.",
+			},
+
+			"key_version": {
+				Type: framework.TypeInt,
+				Description: `The version of the Vault key to use for
+encryption of the data key. Must be 0 (for latest)
+or a value greater than or equal to the
+min_encryption_version configured on the key.`,
+			},
+
+			"aead": {
+				Type:        framework.TypeString,
+				Default:     keysutil.StreamAEAD_AES256_GCM,
+				Description: `The AEAD to encrypt the chunks with, "aes256-gcm" or "chacha20-poly1305".`,
+			},
+
+			"chunk_size": {
+				Type:        framework.TypeInt,
+				Default:     keysutil.DefaultStreamChunkSize,
+				Description: "The size in bytes of the plaintext of each encrypted chunk.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathEncryptStreamWrite,
+		},
+
+		HelpSynopsis:    pathEncryptStreamHelpSyn,
+		HelpDescription: pathEncryptStreamHelpDesc,
+	}
+}
+
+func (b *backend) pathDecryptStream() *framework.Path {
+	return &framework.Path{
+		Pattern: "decrypt-stream/" + framework.GenericNameRegex("name"),
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixTransit,
+			OperationVerb:   "decrypt",
+			OperationSuffix: "stream",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The backend key used for decrypting the data key of the stream",
+			},
+
+			"context": {
+				Type:        framework.TypeString,
+				Description: "Base64 encoded context for key derivation. Required for derived keys.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathDecryptStreamWrite,
+		},
+
+		HelpSynopsis:    pathDecryptStreamHelpSyn,
+		HelpDescription: pathDecryptStreamHelpDesc,
+	}
+}
+
+func (b *backend) pathEncryptStreamWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.HTTPRequest == nil || req.HTTPRequest.Body == nil || req.ResponseWriter == nil {
+		return logical.ErrorResponse(errStreamBodyRequired.Error()), logical.ErrInvalidRequest
+	}
+
+	derivationContext, err := decodeStreamContext(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	var wrappedKey string
+	resp, err := b.withStreamPolicy(ctx, req, d, func(p *keysutil.Policy) (err error) {
+		wrappedKey, err = p.Encrypt(d.Get("key_version").(int), derivationContext, nil, base64.StdEncoding.EncodeToString(key))
+		return err
+	})
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	header := &keysutil.StreamHeader{
+		AEAD:       d.Get("aead").(string),
+		ChunkSize:  d.Get("chunk_size").(int),
+		WrappedKey: wrappedKey,
+	}
+	if _, err := header.Marshal(); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	w := req.ResponseWriter
+	w.Header().Set("Content-Type", streamContentType)
+	w.WriteHeader(http.StatusOK)
+
+	stream, err := keysutil.NewStreamEncrypter(w, key, header)
+	if err == nil {
+		_, err = io.Copy(stream, req.HTTPRequest.Body)
+	}
+	if err == nil {
+		err = stream.Close()
+	}
+	if err != nil {
+		// The response is already under way; a truncated stream fails to
+		// decrypt, as its final chunk is missing
+		b.Logger().Debug("failed to encrypt stream", "error", err)
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathDecryptStreamWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.HTTPRequest == nil || req.HTTPRequest.Body == nil || req.ResponseWriter == nil {
+		return logical.ErrorResponse(errStreamBodyRequired.Error()), logical.ErrInvalidRequest
+	}
+
+	derivationContext, err := decodeStreamContext(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	body := req.HTTPRequest.Body
+	header, rawHeader, err := keysutil.ReadStreamHeader(body)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	var encodedKey string
+	resp, err := b.withStreamPolicy(ctx, req, d, func(p *keysutil.Policy) (err error) {
+		encodedKey, err = p.Decrypt(derivationContext, nil, header.WrappedKey)
+		return err
+	})
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+
+	stream, err := keysutil.NewStreamDecrypter(body, key, header, rawHeader)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	// Authenticate the first chunk before responding, so that a stream that
+	// was encrypted with another key, or that is corrupt from the start, is
+	// reported with an error response
+	first := make([]byte, header.ChunkSize)
+	n, err := io.ReadFull(stream, first)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	// Errors in later chunks can only be reported once the plaintext before
+	// them was sent, in a trailer
+	w := req.ResponseWriter
+	w.Header().Set("Content-Type", streamContentType)
+	w.Header().Set("Trailer", keysutil.StreamErrorTrailer)
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(first[:n])
+	if err == nil {
+		_, err = io.Copy(w, stream)
+	}
+	if err != nil {
+		w.Header().Set(keysutil.StreamErrorTrailer, err.Error())
+	}
+
+	return nil, nil
+}
+
+// withStreamPolicy calls f with the named key, and returns the response to
+// send if the key cannot be used. The key is released again before the stream
+// is processed, which may take a long time.
+func (b *backend) withStreamPolicy(ctx context.Context, req *logical.Request, d *framework.FieldData, f func(p *keysutil.Policy) error) (*logical.Response, error) {
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    d.Get("name").(string),
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	if err := b.forwardKeyUsage(p); err != nil {
+		p.Unlock()
+		return nil, err
+	}
+	defer b.updateKeyUsage(ctx, req.Storage, p)
+	defer p.Unlock()
+
+	if err := f(p); err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func decodeStreamContext(d *framework.FieldData) ([]byte, error) {
+	contextRaw := d.Get("context").(string)
+	if contextRaw == "" {
+		return nil, nil
+	}
+	derivationContext, err := base64.StdEncoding.DecodeString(contextRaw)
+	if err != nil {
+		return nil, errors.New("failed to base64-decode context")
+	}
+	return derivationContext, nil
+}
+
+const pathEncryptStreamHelpSyn = `Encrypt a stream of data`
+
+const pathEncryptStreamHelpDesc = `
+This path encrypts the raw request body, which must be sent with
+Content-Type application/octet-stream, and streams the result back.
+The body is encrypted in authenticated chunks with a single-use data
+key, which is encrypted with the named key and stored at the start of
+the result. The parameters are given as query parameters. Decrypt the
+result with the decrypt-stream path.
+`
+
+const pathDecryptStreamHelpSyn = `Decrypt a stream of data`
+
+const pathDecryptStreamHelpDesc = `
+This path decrypts a stream created by the encrypt-stream path, sent
+as the raw request body with Content-Type application/octet-stream,
+and streams the plaintext back. Each chunk is authenticated before its
+plaintext is sent. If a later chunk fails to authenticate, or the
+stream is truncated, the response ends early and carries the error in
+the X-Vault-Stream-Error trailer.
+`
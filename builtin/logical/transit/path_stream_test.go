@@ -0,0 +1,94 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package transit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransit_Stream(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/backups",
+	})
+	require.NoError(t, err)
+
+	doRequest := func(path string, data map[string]interface{}, body []byte) (*logical.Response, *http.Response) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:        storage,
+			Operation:      logical.UpdateOperation,
+			Path:           path,
+			Data:           data,
+			HTTPRequest:    httptest.NewRequest(http.MethodPost, "/v1/transit/"+path, bytes.NewReader(body)),
+			ResponseWriter: logical.NewHTTPResponseWriter(recorder),
+		})
+		if err != nil {
+			require.ErrorIs(t, err, logical.ErrInvalidRequest)
+		}
+		return resp, recorder.Result()
+	}
+
+	plaintext := make([]byte, 3*4096+17)
+	_, err = rand.Read(plaintext)
+	require.NoError(t, err)
+
+	resp, encrypted := doRequest("encrypt-stream/backups", map[string]interface{}{
+		"aead":       keysutil.StreamAEAD_ChaCha20_Poly1305,
+		"chunk_size": 4096,
+	}, plaintext)
+	require.Nil(t, resp)
+	require.Equal(t, http.StatusOK, encrypted.StatusCode)
+	ciphertext := readAll(t, encrypted)
+	require.False(t, bytes.Contains(ciphertext, plaintext[:64]))
+
+	resp, decrypted := doRequest("decrypt-stream/backups", nil, ciphertext)
+	require.Nil(t, resp)
+	require.Equal(t, plaintext, readAll(t, decrypted))
+	require.Empty(t, decrypted.Trailer.Get(keysutil.StreamErrorTrailer))
+
+	// A stream that is corrupt from the start is rejected before any
+	// plaintext is sent
+	resp, _ = doRequest("decrypt-stream/backups", nil, ciphertext[:len(ciphertext)-len(plaintext)])
+	require.True(t, resp.IsError())
+
+	// Once plaintext was sent, errors are reported in the trailer
+	resp, decrypted = doRequest("decrypt-stream/backups", nil, ciphertext[:len(ciphertext)-100])
+	require.Nil(t, resp)
+	require.Equal(t, plaintext[:2*4096], readAll(t, decrypted))
+	require.NotEmpty(t, decrypted.Trailer.Get(keysutil.StreamErrorTrailer))
+
+	resp, _ = doRequest("encrypt-stream/backups", map[string]interface{}{"aead": "des"}, plaintext)
+	require.True(t, resp.IsError())
+
+	// The raw body is required
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "encrypt-stream/backups",
+	})
+	require.ErrorIs(t, err, logical.ErrInvalidRequest)
+	require.True(t, resp.IsError())
+}
+
+func readAll(t *testing.T, resp *http.Response) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(resp.Body)
+	require.NoError(t, err)
+	return buf.Bytes()
+}
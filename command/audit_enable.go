@@ -96,6 +96,7 @@ func (c *AuditEnableCommand) AutocompleteArgs() complete.Predictor {
 		"file",
 		"syslog",
 		"socket",
+		"http",
 	)
 }
 
@@ -113,7 +114,7 @@ func (c *AuditEnableCommand) Run(args []string) int {
 
 	args = f.Args()
 	if len(args) < 1 {
-		c.UI.Error("Error enabling audit device: audit type missing. Valid types include 'file', 'socket' and 'syslog'.")
+		c.UI.Error("Error enabling audit device: audit type missing. Valid types include 'file', 'http', 'socket' and 'syslog'.")
 		return 1
 	}
 
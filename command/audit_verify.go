@@ -0,0 +1,268 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package command
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var (
+	_ cli.Command             = (*AuditVerifyCommand)(nil)
+	_ cli.CommandAutocomplete = (*AuditVerifyCommand)(nil)
+)
+
+// defaultAuditVerifyBatchSize is the number of entries hashed by each call
+// to sys/audit-hash
+const defaultAuditVerifyBatchSize = 256
+
+type AuditVerifyCommand struct {
+	*BaseCommand
+
+	flagPath         string
+	flagBatchSize    int
+	flagAllowPartial bool
+}
+
+func (c *AuditVerifyCommand) Synopsis() string {
+	return "Verifies the hash chain of an audit log"
+}
+
+func (c *AuditVerifyCommand) Help() string {
+	helpText := `
+Usage: vault audit verify [options] FILE...
+
+  Verifies that an audit log written by a file audit device with the
+  "hash_chain" option enabled has not been modified. Every entry is checked
+  against the HMAC computed with the device's salt, and against the entry
+  before it, and the first broken or missing link is reported.
+
+  The audit device records the last entry it wrote in Vault's storage, and
+  the log must contain that entry, so entries removed from the end of the
+  log are reported too. Entries written while the log is being verified are
+  not checked.
+
+  The log must start at the beginning of the chain. A log that has been
+  rotated is verified as a single chain by giving its archives, oldest first,
+  followed by the current file. Archives compressed with gzip are read
+  directly. If the oldest archives no longer exist, -allow-partial verifies
+  the rest of the chain.
+
+  The HMACs are computed by the Vault server using the audit device's salt,
+  so the token used must be allowed to use the sys/audit-hash endpoint for
+  the device that wrote the log. Entries are sent to the server in batches,
+  so verification needs one request per batch rather than per entry.
+
+  Verify a log written by the audit device enabled at "file/":
+
+      $ vault audit verify /var/log/vault_audit.log
+
+  Verify a log written by the audit device enabled at "audit_path/":
+
+      $ vault audit verify -path=audit_path /var/log/vault_audit.log
+
+  Verify a rotated log, including its archives:
+
+      $ vault audit verify /var/log/vault_audit-*.log.gz /var/log/vault_audit.log
+
+  Verify the current file of a rotated log on its own:
+
+      $ vault audit verify -allow-partial /var/log/vault_audit.log
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *AuditVerifyCommand) Flags() *FlagSets {
+	set := c.flagSet(FlagSetHTTP)
+
+	f := set.NewFlagSet("Command Options")
+
+	f.StringVar(&StringVar{
+		Name:       "path",
+		Target:     &c.flagPath,
+		Default:    "file/",
+		EnvVar:     "",
+		Completion: c.PredictVaultAudits(),
+		Usage:      "Path of the audit device that wrote the log.",
+	})
+
+	f.IntVar(&IntVar{
+		Name:    "batch-size",
+		Target:  &c.flagBatchSize,
+		Default: defaultAuditVerifyBatchSize,
+		Usage:   "Number of entries to hash with each request to the server.",
+	})
+
+	f.BoolVar(&BoolVar{
+		Name:    "allow-partial",
+		Target:  &c.flagAllowPartial,
+		Default: false,
+		Usage: "Allow the log to start after the beginning of the chain, as it " +
+			"does when the oldest archives of a rotated log have been removed.",
+	})
+
+	return set
+}
+
+func (c *AuditVerifyCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*")
+}
+
+func (c *AuditVerifyCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *AuditVerifyCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	if len(args) < 1 {
+		c.UI.Error(fmt.Sprintf("Not enough arguments (expected at least 1, got %d)", len(args)))
+		return 1
+	}
+	if c.flagBatchSize <= 0 {
+		c.UI.Error("Batch size must be greater than zero")
+		return 1
+	}
+	for _, name := range args {
+		if _, err := os.Stat(name); err != nil {
+			c.UI.Error(fmt.Sprintf("Error opening audit log: %s", err))
+			return 1
+		}
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	path := ensureNoTrailingSlash(sanitizePath(c.flagPath))
+
+	// The head must be read before the log, so that the log holds at least
+	// every entry written up to it
+	head, err := client.Sys().AuditHashChain(path)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error reading the hash chain of audit device %s: %s", path, err))
+		return 2
+	}
+
+	verifier := &audit.ChainVerifier{
+		HashFunc: func(inputs []string) ([]string, error) {
+			return client.Sys().AuditHashes(path, inputs)
+		},
+		BatchSize:    c.flagBatchSize,
+		Head:         &audit.HashChain{Seq: head.Seq, HMAC: head.HMAC},
+		AllowPartial: c.flagAllowPartial,
+	}
+
+	// Lines are numbered across every file by the verifier, so remember
+	// where each file starts in order to report failures against the file
+	// they are in
+	starts := make([]int, 0, len(args))
+	lines := 0
+	var vErr error
+	for _, name := range args {
+		starts = append(starts, lines)
+		n, err := verifyAuditLogFile(verifier, name)
+		lines += n
+		if err != nil {
+			var chainErr *audit.ChainError
+			if !errors.As(err, &chainErr) {
+				c.UI.Error(fmt.Sprintf("Error reading audit log %s: %s", name, err))
+				return 1
+			}
+			vErr = err
+			break
+		}
+	}
+	if vErr == nil {
+		vErr = verifier.Finish()
+	}
+
+	var chainErr *audit.ChainError
+	if errors.As(vErr, &chainErr) {
+		i := sort.SearchInts(starts, chainErr.Line) - 1
+		c.UI.Error(fmt.Sprintf("Verification failed in %s at line %d: %s", args[i], chainErr.Line-starts[i], chainErr.Err))
+		return 2
+	}
+
+	if verifier.Verified == 0 {
+		c.UI.Error("No chained entries found in the audit log")
+		return 2
+	}
+
+	if verifier.Skipped > 0 {
+		c.UI.Warn(fmt.Sprintf("Skipped %d unchained line(s) at the start of the log", verifier.Skipped))
+	}
+	if verifier.FirstSeq > 1 {
+		c.UI.Warn(fmt.Sprintf("The log starts at sequence %d; earlier entries were not verified", verifier.FirstSeq))
+	}
+	c.UI.Output(fmt.Sprintf("Success! Verified %d chained entries in: %s", verifier.Verified, strings.Join(args, ", ")))
+
+	return 0
+}
+
+// verifyAuditLogFile passes every line of the named file to the verifier,
+// decompressing it first if it is gzipped, and returns the number of lines
+// read.
+func verifyAuditLogFile(verifier *audit.ChainVerifier, name string) (int, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	// Only verify what was in the log when we started: if the device that
+	// wrote it is still enabled, our own calls to compute HMACs are appended
+	// to it as we go.
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	var r io.Reader = io.LimitReader(file, info.Size())
+
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	reader := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return lineNum - 1, err
+		}
+		if err == io.EOF && len(line) == 0 {
+			return lineNum - 1, nil
+		}
+		if vErr := verifier.Verify(line); vErr != nil {
+			return lineNum, vErr
+		}
+		if err == io.EOF {
+			return lineNum, nil
+		}
+	}
+}
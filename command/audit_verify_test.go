@@ -0,0 +1,218 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package command
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+)
+
+func testAuditVerifyCommand(tb testing.TB) (*cli.MockUi, *AuditVerifyCommand) {
+	tb.Helper()
+
+	ui := cli.NewMockUi()
+	return ui, &AuditVerifyCommand{
+		BaseCommand: &BaseCommand{
+			UI: ui,
+		},
+	}
+}
+
+func TestAuditVerifyCommand_Run(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validations", func(t *testing.T) {
+		t.Parallel()
+
+		cases := []struct {
+			name string
+			args []string
+			out  string
+			code int
+		}{
+			{
+				"not_enough_args",
+				nil,
+				"Not enough arguments",
+				1,
+			},
+			{
+				"zero_batch_size",
+				[]string{"-batch-size=0", "foo"},
+				"Batch size must be greater than zero",
+				1,
+			},
+			{
+				"missing_file",
+				[]string{filepath.Join(t.TempDir(), "missing.log")},
+				"Error opening audit log",
+				1,
+			},
+		}
+
+		for _, tc := range cases {
+			ui, cmd := testAuditVerifyCommand(t)
+
+			code := cmd.Run(tc.args)
+			if code != tc.code {
+				t.Errorf("%s: expected %d to be %d", tc.name, code, tc.code)
+			}
+
+			combined := ui.OutputWriter.String() + ui.ErrorWriter.String()
+			if !strings.Contains(combined, tc.out) {
+				t.Errorf("%s: expected %q to contain %q", tc.name, combined, tc.out)
+			}
+		}
+	})
+
+	t.Run("integration", func(t *testing.T) {
+		t.Parallel()
+
+		client, closer := testVaultServer(t)
+		defer closer()
+
+		// Keep the requests made to verify the log out of it, so that copies
+		// of the log are as complete as the log itself
+		if err := client.Sys().EnableAuditWithOptions("discard", &api.EnableAuditOptions{
+			Type: "file",
+			Options: map[string]string{
+				"file_path": "discard",
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		logPath := filepath.Join(t.TempDir(), "audit.log")
+		if err := client.Sys().EnableAuditWithOptions("chained", &api.EnableAuditOptions{
+			Type: "file",
+			Options: map[string]string{
+				"file_path":  logPath,
+				"hash_chain": "true",
+				"filter":     `not (path matches "^sys/audit-hash/")`,
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 3; i++ {
+			if _, err := client.Sys().ListMounts(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		verify := func(args ...string) (int, string) {
+			ui, cmd := testAuditVerifyCommand(t)
+			cmd.client = client
+
+			code := cmd.Run(append([]string{"-path", "chained", "-batch-size", "2"}, args...))
+			return code, ui.OutputWriter.String() + ui.ErrorWriter.String()
+		}
+
+		code, out := verify(logPath)
+		if code != 0 || !strings.Contains(out, "Success! Verified") {
+			t.Fatalf("expected successful verification, got %d: %s", code, out)
+		}
+
+		original, err := os.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := bytes.SplitAfter(original, []byte("\n"))
+		if len(lines) < 4 {
+			t.Fatalf("expected more audit entries, got %d", len(lines))
+		}
+
+		tampered := filepath.Join(t.TempDir(), "tampered.log")
+
+		// Edit an entry
+		edited := append([][]byte{}, lines...)
+		edited[1] = bytes.Replace(edited[1], []byte(`"time":"2`), []byte(`"time":"1`), 1)
+		if err := os.WriteFile(tampered, bytes.Join(edited, nil), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		code, out = verify(tampered)
+		if code != 2 || !strings.Contains(out, "Verification failed in "+tampered+" at line 2: broken link") {
+			t.Fatalf("expected edited entry to be detected, got %d: %s", code, out)
+		}
+
+		// Remove an entry
+		removed := append(append([][]byte{}, lines[:1]...), lines[2:]...)
+		if err := os.WriteFile(tampered, bytes.Join(removed, nil), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		code, out = verify(tampered)
+		if code != 2 || !strings.Contains(out, "Verification failed in "+tampered+" at line 2: missing link") {
+			t.Fatalf("expected removed entry to be detected, got %d: %s", code, out)
+		}
+
+		// Remove the last entry, which the device recorded in storage
+		if err := os.WriteFile(tampered, bytes.Join(lines[:len(lines)-2], nil), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		code, out = verify(tampered)
+		if code != 2 || !strings.Contains(out, "missing link: the log ends at sequence") {
+			t.Fatalf("expected removed last entry to be detected, got %d: %s", code, out)
+		}
+
+		// A log missing the start of the chain is only verified if that is
+		// explicitly allowed
+		if err := os.WriteFile(tampered, bytes.Join(lines[2:], nil), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		code, out = verify(tampered)
+		if code != 2 || !strings.Contains(out, "Verification failed in "+tampered+" at line 1: missing link: the chain starts at sequence 3") {
+			t.Fatalf("expected missing start of the chain to be detected, got %d: %s", code, out)
+		}
+		code, out = verify("-allow-partial", tampered)
+		if code != 0 || !strings.Contains(out, "earlier entries were not verified") {
+			t.Fatalf("expected partial log to verify, got %d: %s", code, out)
+		}
+
+		// Split the log as rotation would, compressing the archive, and make
+		// sure the chain is followed from one file to the next
+		archive := filepath.Join(t.TempDir(), "audit-1.log.gz")
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		if _, err := gz.Write(bytes.Join(lines[:2], nil)); err != nil {
+			t.Fatal(err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(archive, compressed.Bytes(), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		current := filepath.Join(t.TempDir(), "audit.log")
+		if err := os.WriteFile(current, bytes.Join(lines[2:], nil), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		code, out = verify(archive, current)
+		if code != 0 || !strings.Contains(out, "Success! Verified") || strings.Contains(out, "earlier entries were not verified") {
+			t.Fatalf("expected rotated log to verify as one chain, got %d: %s", code, out)
+		}
+
+		// Entries missing between files break the chain
+		if err := os.WriteFile(tampered, bytes.Join(lines[3:], nil), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		code, out = verify(archive, tampered)
+		if code != 2 || !strings.Contains(out, "Verification failed in "+tampered+" at line 1: missing link") {
+			t.Fatalf("expected break between files to be detected, got %d: %s", code, out)
+		}
+	})
+
+	t.Run("no_tabs", func(t *testing.T) {
+		t.Parallel()
+
+		_, cmd := testAuditVerifyCommand(t)
+		assertNoTabs(t, cmd)
+	})
+}
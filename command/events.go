@@ -23,6 +23,11 @@ var (
 
 type EventsSubscribeCommands struct {
 	*BaseCommand
+
+	flagFilter            string
+	flagLastEventID       string
+	flagChildNamespaces   bool
+	flagCheckCapabilities bool
 }
 
 func (c *EventsSubscribeCommands) Synopsis() string {
@@ -38,6 +43,28 @@ Usage: vault events subscribe [-format=json] [-timeout=XYZs] eventType
 
   The output will be a JSON object serialized using the default protobuf
   JSON serialization format, with one line per event received.
+
+  Only receive the events whose metadata match a boolean expression, which
+  is evaluated by the server:
+
+      $ vault events subscribe -filter='data_path matches "secret/data/app/.*"' kv*
+
+  Also receive the events sent in the child namespaces of the namespace:
+
+      $ vault events subscribe -namespace=ns1 -child-namespaces kv*
+
+  Only receive the events about paths the token has the "read", "list" or
+  "subscribe" capability on. This is always the case when subscribing to
+  child namespaces:
+
+      $ vault events subscribe -check-capabilities kv*
+
+  If the event journal is enabled for the namespace, resume a subscription
+  by passing the "id" of the last event received. The events sent since then
+  are output before live ones:
+
+      $ vault events subscribe -last-event-id=6de2a5b6-... kv*
+
 ` + c.Flags().Help()
 	return strings.TrimSpace(helpText)
 }
@@ -45,6 +72,45 @@ Usage: vault events subscribe [-format=json] [-timeout=XYZs] eventType
 func (c *EventsSubscribeCommands) Flags() *FlagSets {
 	set := c.flagSet(FlagSetHTTP)
 
+	f := set.NewFlagSet("Command Options")
+
+	f.StringVar(&StringVar{
+		Name:    "filter",
+		Target:  &c.flagFilter,
+		Default: "",
+		Usage: "Boolean expression over the event's metadata that events must " +
+			"match to be received, such as 'mount_path == \"secret/\"'. " +
+			"Selectors include event_type, plugin, mount_path, data_path " +
+			"and metadata.<key>.",
+	})
+
+	f.BoolVar(&BoolVar{
+		Name:    "child-namespaces",
+		Target:  &c.flagChildNamespaces,
+		Default: false,
+		Usage: "Also receive the events sent in the child namespaces of the " +
+			"namespace. This cannot be combined with -last-event-id.",
+	})
+
+	f.BoolVar(&BoolVar{
+		Name:    "check-capabilities",
+		Target:  &c.flagCheckCapabilities,
+		Default: false,
+		Usage: "Only receive the events about paths the token has the read, " +
+			"list or subscribe capability on. This is always done when " +
+			"subscribing to child namespaces.",
+	})
+
+	f.StringVar(&StringVar{
+		Name:    "last-event-id",
+		Target:  &c.flagLastEventID,
+		Default: "",
+		Usage: "ID of the last event received by a previous subscription. " +
+			"Events sent after it are replayed from the namespace's event " +
+			"journal before live events. The subscription fails if the event " +
+			"is no longer in the journal.",
+	})
+
 	return set
 }
 
@@ -98,6 +164,18 @@ func (c *EventsSubscribeCommands) subscribeRequest(client *api.Client, path stri
 	}
 	q := u.Query()
 	q.Set("json", "true")
+	if c.flagFilter != "" {
+		q.Set("filter", c.flagFilter)
+	}
+	if c.flagLastEventID != "" {
+		q.Set("last_event_id", c.flagLastEventID)
+	}
+	if c.flagChildNamespaces {
+		q.Set("child_namespaces", "true")
+	}
+	if c.flagCheckCapabilities {
+		q.Set("check_capabilities", "true")
+	}
 	u.RawQuery = q.Encode()
 	client.AddHeader("X-Vault-Token", client.Token())
 	client.AddHeader("X-Vault-Namesapce", client.Namespace())
@@ -31,6 +31,10 @@ Usage: vault transit <subcommand> [options] [args]
 
   $ vault transit import transit/keys/newly-imported @path/to/key type=rsa-2048
 
+  To encrypt a file of any size with a key of the specified Transit mount:
+
+  $ vault transit encrypt-file transit/keys/backups backup.sql backup.sql.enc
+
   Please see the individual subcommand help for detailed usage information.
 `
 
@@ -0,0 +1,107 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package command
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var (
+	_ cli.Command             = (*TransitDecryptFileCommand)(nil)
+	_ cli.CommandAutocomplete = (*TransitDecryptFileCommand)(nil)
+)
+
+type TransitDecryptFileCommand struct {
+	*BaseCommand
+
+	flagContext string
+}
+
+func (c *TransitDecryptFileCommand) Synopsis() string {
+	return "Decrypt a file encrypted with a Transit key."
+}
+
+func (c *TransitDecryptFileCommand) Help() string {
+	helpText := `
+Usage: vault transit decrypt-file [options] PATH INPUT OUTPUT
+
+  Decrypts the file INPUT, encrypted by "vault transit encrypt-file", into
+  OUTPUT. The file is streamed through Transit's decrypt-stream endpoint, which
+  decrypts its data key with the Transit key whose API path is PATH. Use "-" to
+  read from stdin or write to stdout. If the file has been tampered with or
+  truncated, an error is returned and the file output so far is removed.
+
+      $ vault transit decrypt-file transit/keys/backups backup.sql.enc backup.sql
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *TransitDecryptFileCommand) Flags() *FlagSets {
+	set := c.flagSet(FlagSetHTTP)
+	f := set.NewFlagSet("Command Options")
+
+	f.StringVar(&StringVar{
+		Name:    "context",
+		Target:  &c.flagContext,
+		Default: "",
+		Usage:   "The base64-encoded key derivation context, for derived Transit keys.",
+	})
+
+	return set
+}
+
+func (c *TransitDecryptFileCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*")
+}
+
+func (c *TransitDecryptFileCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *TransitDecryptFileCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	if len(args) != 3 {
+		c.UI.Error(fmt.Sprintf("Incorrect arguments (expected 3, got %d)", len(args)))
+		return 1
+	}
+
+	mount, name, err := transitKeyPath(args[0])
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	params := url.Values{}
+	if c.flagContext != "" {
+		params.Set("context", c.flagContext)
+	}
+
+	code, err := streamTransitFile(client, mount+"/decrypt-stream/"+name, params, args[1], args[2])
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error decrypting file: %s", err))
+		return code
+	}
+
+	return 0
+}
@@ -0,0 +1,249 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var (
+	_ cli.Command             = (*TransitEncryptFileCommand)(nil)
+	_ cli.CommandAutocomplete = (*TransitEncryptFileCommand)(nil)
+)
+
+type TransitEncryptFileCommand struct {
+	*BaseCommand
+
+	flagAEAD      string
+	flagChunkSize int
+	flagContext   string
+}
+
+func (c *TransitEncryptFileCommand) Synopsis() string {
+	return "Encrypt a file with a Transit key."
+}
+
+func (c *TransitEncryptFileCommand) Help() string {
+	helpText := `
+Usage: vault transit encrypt-file [options] PATH INPUT OUTPUT
+
+  Encrypts the file INPUT into OUTPUT with the Transit key whose API path is
+  PATH. The file is streamed through Transit's encrypt-stream endpoint, which
+  encrypts it in authenticated chunks with a single-use data key, so it may be
+  of any size; the data key, encrypted by the Transit key, is stored in OUTPUT.
+  Use "-" to read from stdin or write to stdout.
+
+  Encrypt a database backup:
+
+      $ vault transit encrypt-file transit/keys/backups backup.sql backup.sql.enc
+
+  Decrypt it again with "vault transit decrypt-file".
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *TransitEncryptFileCommand) Flags() *FlagSets {
+	set := c.flagSet(FlagSetHTTP)
+	f := set.NewFlagSet("Command Options")
+
+	f.StringVar(&StringVar{
+		Name:       "aead",
+		Target:     &c.flagAEAD,
+		Default:    keysutil.StreamAEAD_AES256_GCM,
+		Usage:      `The AEAD to encrypt the chunks with, "aes256-gcm" or "chacha20-poly1305".`,
+		Completion: complete.PredictSet(keysutil.StreamAEAD_AES256_GCM, keysutil.StreamAEAD_ChaCha20_Poly1305),
+	})
+
+	f.IntVar(&IntVar{
+		Name:    "chunk-size",
+		Target:  &c.flagChunkSize,
+		Default: keysutil.DefaultStreamChunkSize,
+		Usage:   "The size in bytes of the plaintext of each encrypted chunk.",
+	})
+
+	f.StringVar(&StringVar{
+		Name:    "context",
+		Target:  &c.flagContext,
+		Default: "",
+		Usage:   "The base64-encoded key derivation context, for derived Transit keys.",
+	})
+
+	return set
+}
+
+func (c *TransitEncryptFileCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*")
+}
+
+func (c *TransitEncryptFileCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *TransitEncryptFileCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	if len(args) != 3 {
+		c.UI.Error(fmt.Sprintf("Incorrect arguments (expected 3, got %d)", len(args)))
+		return 1
+	}
+
+	mount, name, err := transitKeyPath(args[0])
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	params := url.Values{}
+	params.Set("aead", c.flagAEAD)
+	params.Set("chunk_size", strconv.Itoa(c.flagChunkSize))
+	if c.flagContext != "" {
+		params.Set("context", c.flagContext)
+	}
+
+	code, err := streamTransitFile(client, mount+"/encrypt-stream/"+name, params, args[1], args[2])
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error encrypting file: %s", err))
+		return code
+	}
+
+	return 0
+}
+
+// transitKeyPath splits a key path of the form :path:/keys/:name: into the
+// Transit mount and key name
+func transitKeyPath(s string) (mount string, name string, err error) {
+	parts := keyPath.FindStringSubmatch(s)
+	if len(parts) != 3 {
+		return "", "", errors.New("expected transit path and key name in the form :path:/keys/:name:")
+	}
+	return parts[1], parts[2], nil
+}
+
+// streamTransitFile sends the input file to the Transit stream endpoint at
+// path, and writes the response to the output file. It returns the exit code
+// to use if it fails.
+func streamTransitFile(client *api.Client, path string, params url.Values, inputPath, outputPath string) (int, error) {
+	input, err := openTransitFileInput(inputPath)
+	if err != nil {
+		return 1, err
+	}
+	defer input.Close()
+
+	r := client.NewRequest(http.MethodPost, "/v1/"+path)
+	r.Params = params
+	if r.Headers == nil {
+		r.Headers = make(http.Header)
+	}
+	r.Headers.Set("Content-Type", "application/octet-stream")
+	r.Body = input
+
+	// The request takes as long as the file takes to stream
+	client.SetClientTimeout(0)
+
+	resp, err := client.RawRequestWithContext(context.Background(), r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return 2, err
+	}
+
+	err = writeTransitFileOutput(outputPath, func(w io.Writer) error {
+		if _, err := io.Copy(w, resp.Body); err != nil {
+			return err
+		}
+		if msg := resp.Trailer.Get(keysutil.StreamErrorTrailer); msg != "" {
+			return errors.New(msg)
+		}
+		return nil
+	})
+	if err != nil {
+		return 2, err
+	}
+	return 0, nil
+}
+
+func openTransitFileInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return &transitStdin{Reader: os.Stdin}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening input file: %w", err)
+	}
+	return f, nil
+}
+
+// transitStdin lets stdin be sent as a request body without being buffered:
+// the client rewinds request bodies before sending them, which only succeeds
+// for stdin as long as nothing was read from it, so that a request that has to
+// be retried fails instead.
+type transitStdin struct {
+	io.Reader
+	read bool
+}
+
+func (s *transitStdin) Read(p []byte) (int, error) {
+	s.read = true
+	return s.Reader.Read(p)
+}
+
+func (s *transitStdin) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekStart || s.read {
+		return 0, errors.New("stdin cannot be read again")
+	}
+	return 0, nil
+}
+
+func (s *transitStdin) Close() error {
+	return nil
+}
+
+// writeTransitFileOutput calls write with the output, which is removed again
+// if write fails
+func writeTransitFileOutput(path string, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
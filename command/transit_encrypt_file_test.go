@@ -0,0 +1,81 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package command
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Validate the `vault transit encrypt-file` and `decrypt-file` commands work.
+func TestTransitEncryptFile(t *testing.T) {
+	t.Parallel()
+
+	client, closer := testVaultServer(t)
+	defer closer()
+
+	if err := client.Sys().Mount("transit", &api.MountInput{
+		Type: "transit",
+	}); err != nil {
+		t.Fatalf("transit mount error: %#v", err)
+	}
+	_, err := client.Logical().Write("transit/keys/backups", nil)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	plaintextPath := filepath.Join(dir, "backup.sql")
+	encryptedPath := filepath.Join(dir, "backup.sql.enc")
+	decryptedPath := filepath.Join(dir, "backup.sql.dec")
+
+	plaintext := make([]byte, 300*1024+17)
+	_, err = rand.Read(plaintext)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(plaintextPath, plaintext, 0o600))
+
+	runTransitFileCommand := func(args ...string) (int, string) {
+		stdout := bytes.NewBuffer(nil)
+		stderr := bytes.NewBuffer(nil)
+		code := RunCustom(append([]string{"transit"}, args...), &RunOptions{
+			Stdout: stdout,
+			Stderr: stderr,
+			Client: client,
+		})
+		return code, stdout.String() + stderr.String()
+	}
+
+	for _, aead := range []string{"aes256-gcm", "chacha20-poly1305"} {
+		code, out := runTransitFileCommand("encrypt-file", "-aead="+aead, "-chunk-size=4096", "transit/keys/backups", plaintextPath, encryptedPath)
+		require.Equal(t, 0, code, out)
+
+		encrypted, err := os.ReadFile(encryptedPath)
+		require.NoError(t, err)
+		require.False(t, bytes.Contains(encrypted, plaintext[:64]))
+
+		code, out = runTransitFileCommand("decrypt-file", "transit/keys/backups", encryptedPath, decryptedPath)
+		require.Equal(t, 0, code, out)
+		decrypted, err := os.ReadFile(decryptedPath)
+		require.NoError(t, err)
+		require.Equal(t, plaintext, decrypted)
+
+		// A truncated file fails to decrypt, and no output is left behind
+		require.NoError(t, os.WriteFile(encryptedPath, encrypted[:len(encrypted)-4096], 0o600))
+		require.NoError(t, os.Remove(decryptedPath))
+		code, _ = runTransitFileCommand("decrypt-file", "transit/keys/backups", encryptedPath, decryptedPath)
+		require.Equal(t, 2, code)
+		_, err = os.Stat(decryptedPath)
+		require.True(t, os.IsNotExist(err))
+	}
+
+	code, _ := runTransitFileCommand("encrypt-file", "-aead=des", "transit/keys/backups", plaintextPath, encryptedPath)
+	require.Equal(t, 2, code)
+	code, _ = runTransitFileCommand("encrypt-file", "transit/backups", plaintextPath, encryptedPath)
+	require.Equal(t, 1, code)
+}
@@ -22,13 +22,17 @@ import (
 )
 
 type eventSubscribeArgs struct {
-	ctx     context.Context
-	logger  hclog.Logger
-	events  *eventbus.EventBus
-	ns      *namespace.Namespace
-	pattern string
-	conn    *websocket.Conn
-	json    bool
+	ctx             context.Context
+	logger          hclog.Logger
+	events          *eventbus.EventBus
+	ns              *namespace.Namespace
+	pattern         string
+	filter          string
+	conn            *websocket.Conn
+	json            bool
+	lastEventID     string
+	childNamespaces bool
+	authorize       func(context.Context, *logical.EventReceived) bool
 }
 
 // handleEventsSubscribeWebsocket runs forever, returning a websocket error code and reason
@@ -36,9 +40,18 @@ type eventSubscribeArgs struct {
 func handleEventsSubscribeWebsocket(args eventSubscribeArgs) (websocket.StatusCode, string, error) {
 	ctx := args.ctx
 	logger := args.logger
-	ch, cancel, err := args.events.Subscribe(ctx, args.ns, args.pattern)
+	ch, cancel, err := args.events.SubscribeWithOptions(ctx, args.ns, args.pattern, eventbus.SubscribeOptions{
+		Filter:                 args.filter,
+		LastEventID:            args.lastEventID,
+		IncludeChildNamespaces: args.childNamespaces,
+		Authorize:              args.authorize,
+	})
 	if err != nil {
 		logger.Info("Error subscribing", "error", err)
+		if errors.Is(err, eventbus.ErrJournalDisabled) || errors.Is(err, eventbus.ErrJournalCursorNotFound) {
+			// Let the subscriber know that it cannot resume without a gap
+			return websocket.StatusPolicyViolation, err.Error(), nil
+		}
 		return websocket.StatusUnsupportedData, "Error subscribing", nil
 	}
 	defer cancel()
@@ -48,7 +61,14 @@ func handleEventsSubscribeWebsocket(args eventSubscribeArgs) (websocket.StatusCo
 		case <-ctx.Done():
 			logger.Info("Websocket context is done, closing the connection")
 			return websocket.StatusNormalClosure, "", nil
-		case message := <-ch:
+		case message, ok := <-ch:
+			if !ok {
+				// The subscription fell behind while resuming from the
+				// journal; the subscriber can resume again from the last
+				// event it received.
+				logger.Info("Subscription was closed by the event bus, closing the connection")
+				return websocket.StatusTryAgainLater, "subscriber fell behind; resume from the last event received", nil
+			}
 			logger.Debug("Sending message to websocket", "message", message.Payload)
 			var messageBytes []byte
 			var messageType websocket.MessageType
@@ -123,6 +143,50 @@ func handleEventsSubscribe(core *vault.Core, req *logical.Request) http.Handler
 			}
 		}
 
+		filter := strings.TrimSpace(r.URL.Query().Get("filter"))
+		if filter != "" {
+			if _, err := eventbus.NewFilter(filter); err != nil {
+				respondError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		lastEventID := r.URL.Query().Get("last_event_id")
+
+		childNamespaces := false
+		childNamespacesRaw := r.URL.Query().Get("child_namespaces")
+		if childNamespacesRaw != "" {
+			var err error
+			childNamespaces, err = strconv.ParseBool(childNamespacesRaw)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, fmt.Errorf("invalid parameter for child_namespaces: %v", childNamespacesRaw))
+				return
+			}
+		}
+		if childNamespaces && lastEventID != "" {
+			respondError(w, http.StatusBadRequest, eventbus.ErrJournalChildNamespaces)
+			return
+		}
+
+		checkCapabilities := false
+		checkCapabilitiesRaw := r.URL.Query().Get("check_capabilities")
+		if checkCapabilitiesRaw != "" {
+			var err error
+			checkCapabilities, err = strconv.ParseBool(checkCapabilitiesRaw)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, fmt.Errorf("invalid parameter for check_capabilities: %v", checkCapabilitiesRaw))
+				return
+			}
+		}
+
+		// The token's access to sys/events/subscribe only covers this
+		// namespace, so events from child namespaces are always checked
+		// against its capabilities
+		var authorize func(context.Context, *logical.EventReceived) bool
+		if checkCapabilities || childNamespaces {
+			authorize = core.EventAuthorizer(req.ClientToken, ns)
+		}
+
 		conn, err := websocket.Accept(w, r, nil)
 		if err != nil {
 			logger.Info("Could not accept as websocket", "error", err)
@@ -143,7 +207,7 @@ func handleEventsSubscribe(core *vault.Core, req *logical.Request) http.Handler
 			}
 		}()
 
-		closeStatus, closeReason, err := handleEventsSubscribeWebsocket(eventSubscribeArgs{ctx, logger, core.Events(), ns, pattern, conn, json})
+		closeStatus, closeReason, err := handleEventsSubscribeWebsocket(eventSubscribeArgs{ctx, logger, core.Events(), ns, pattern, filter, conn, json, lastEventID, childNamespaces, authorize})
 		if err != nil {
 			closeStatus = websocket.CloseStatus(err)
 			if closeStatus == -1 {
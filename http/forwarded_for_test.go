@@ -6,11 +6,14 @@ package http
 import (
 	"bytes"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
 	sockaddr "github.com/hashicorp/go-sockaddr"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/internalshared/configutil"
+	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/hashicorp/vault/vault"
 )
 
@@ -256,3 +259,61 @@ func TestHandler_XForwardedFor(t *testing.T) {
 		}
 	})
 }
+
+func TestHandler_XForwardedForQuotaHeaders(t *testing.T) {
+	core, _, rootToken := vault.TestCoreUnsealed(t)
+
+	resp, err := core.HandleRequest(namespace.RootContext(nil), &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "sys/quotas/rate-limit/tenant",
+		ClientToken: rootToken,
+		Data: map[string]interface{}{
+			"path":       "sys/mounts",
+			"rate":       1,
+			"interval":   "1m",
+			"key_by":     "header",
+			"key_header": "X-Tenant",
+		},
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("failed to create quota: resp: %#v, err: %v", resp, err)
+	}
+
+	proxyAddr, err := sockaddr.NewIPAddr("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := WrapForwardedForHandler(rateLimitQuotaWrapping(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), core), getListenerConfigForMarshalerTest(proxyAddr))
+
+	get := func(remoteAddr, tenant string) int {
+		req := httptest.NewRequest("GET", "/v1/sys/mounts", nil)
+		req = req.WithContext(namespace.RootContext(nil))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Tenant", tenant)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A client connecting directly cannot escape the quota by changing the
+	// header, since it is only trusted from the proxy
+	if code := get("192.0.2.1:1234", "a"); code != http.StatusOK {
+		t.Fatalf("expected first request to be allowed, got %d", code)
+	}
+	if code := get("192.0.2.1:1234", "b"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected spoofed header to be ignored, got %d", code)
+	}
+
+	// Requests relayed by the proxy are limited by the header it sets
+	if code := get("10.0.0.1:1234", "a"); code != http.StatusOK {
+		t.Fatalf("expected first request of tenant a to be allowed, got %d", code)
+	}
+	if code := get("10.0.0.1:1234", "b"); code != http.StatusOK {
+		t.Fatalf("expected first request of tenant b to be allowed, got %d", code)
+	}
+	if code := get("10.0.0.1:1234", "a"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected second request of tenant a to be limited, got %d", code)
+	}
+}
@@ -275,7 +275,7 @@ func handleAuditNonLogical(core *vault.Core, h http.Handler) http.Handler {
 		origBody := new(bytes.Buffer)
 		reader := ioutil.NopCloser(io.TeeReader(r.Body, origBody))
 		r.Body = reader
-		req, _, status, err := buildLogicalRequestNoAuth(core.PerfStandby(), w, r)
+		req, _, status, err := buildLogicalRequestNoAuth(core, w, r)
 		if err != nil || status != 0 {
 			respondError(w, status, err)
 			return
@@ -446,12 +446,38 @@ func wrapGenericHandler(core *vault.Core, h http.Handler, props *vault.HandlerPr
 	})
 }
 
+// ctxKeyTrustedProxy marks requests whose connection comes from one of the
+// listener's x_forwarded_for_authorized_addrs. Only such proxies are trusted
+// to set headers on behalf of clients, such as the one a rate limit quota may
+// be keyed by.
+type ctxKeyTrustedProxy struct{}
+
+// fromTrustedProxy reports whether the request was marked as coming from a
+// trusted proxy by WrapForwardedForHandler.
+func fromTrustedProxy(r *http.Request) bool {
+	trusted, _ := r.Context().Value(ctxKeyTrustedProxy{}).(bool)
+	return trusted
+}
+
 func WrapForwardedForHandler(h http.Handler, l *configutil.Listener) http.Handler {
 	rejectNotPresent := l.XForwardedForRejectNotPresent
 	hopSkips := l.XForwardedForHopSkips
 	authorizedAddrs := l.XForwardedForAuthorizedAddrs
 	rejectNotAuthz := l.XForwardedForRejectNotAuthorized
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Mark the request before its address is replaced, whether or not it
+		// carries an X-Forwarded-For header
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			if addr, err := sockaddr.NewIPAddr(host); err == nil {
+				for _, authz := range authorizedAddrs {
+					if authz.Contains(addr) {
+						r = r.WithContext(context.WithValue(r.Context(), ctxKeyTrustedProxy{}, true))
+						break
+					}
+				}
+			}
+		}
+
 		headers, headersOK := r.Header[textproto.CanonicalMIMEHeaderKey("X-Forwarded-For")]
 		if !headersOK || len(headers) == 0 {
 			if !rejectNotPresent {
@@ -45,12 +45,15 @@ func (b *bufferedReader) Close() error {
 
 const MergePatchContentTypeHeader = "application/merge-patch+json"
 
-func buildLogicalRequestNoAuth(perfStandby bool, w http.ResponseWriter, r *http.Request) (*logical.Request, io.ReadCloser, int, error) {
+// buildLogicalRequestNoAuth builds the logical request for an HTTP request.
+// The core may be nil when Vault runs in recovery mode.
+func buildLogicalRequestNoAuth(core *vault.Core, w http.ResponseWriter, r *http.Request) (*logical.Request, io.ReadCloser, int, error) {
 	ns, err := namespace.FromContext(r.Context())
 	if err != nil {
 		return nil, nil, http.StatusBadRequest, nil
 	}
 	path := ns.TrimmedPath(r.URL.Path[len("/v1/"):])
+	perfStandby := core != nil && core.PerfStandby()
 
 	var data map[string]interface{}
 	var origBody io.ReadCloser
@@ -106,13 +109,24 @@ func buildLogicalRequestNoAuth(perfStandby bool, w http.ResponseWriter, r *http.
 		bufferedBody := newBufferedReader(r.Body)
 		r.Body = bufferedBody
 
-		// If we are uploading a snapshot or receiving an ocsp-request (which
-		// is der encoded) we don't want to parse it. Instead, we will simply
-		// add the HTTP request to the logical request object for later consumption.
+		// If we are uploading a snapshot, receiving an ocsp-request, a SCEP or
+		// a CMP message (which are der encoded) or an EST certificate request
+		// (which is base64 encoded) we don't want to parse it. Instead, we will
+		// simply add the HTTP request to the logical request object for later
+		// consumption.
 		contentType := r.Header.Get("Content-Type")
-		if path == "sys/storage/raft/snapshot" || path == "sys/storage/raft/snapshot-force" || isOcspRequest(contentType) {
+		if path == "sys/storage/raft/snapshot" || path == "sys/storage/raft/snapshot-force" || isOcspRequest(contentType) || isEstRequest(contentType) || isScepRequest(contentType) || isCmpRequest(contentType) {
 			passHTTPReq = true
 			origBody = r.Body
+		} else if isStreamRequest(contentType) && core != nil && core.IsStreamPath(r.Context(), path) {
+			// Raw streams sent to paths the backend declared for them, such
+			// as the ones Transit encrypts in chunks, may be of any size and
+			// are answered with a stream as well, so both are handed to the
+			// backend; parameters are passed in the query.
+			data = parseQuery(r.URL.Query())
+			passHTTPReq = true
+			origBody = r.Body
+			responseWriter = w
 		} else {
 			// Sample the first bytes to determine whether this should be parsed as
 			// a form or as JSON. The amount to look ahead (512 bytes) is arbitrary
@@ -224,6 +238,32 @@ func isOcspRequest(contentType string) bool {
 	return contentType == "application/ocsp-request"
 }
 
+func isEstRequest(contentType string) bool {
+	contentType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return contentType == "application/pkcs10"
+}
+
+func isStreamRequest(contentType string) bool {
+	contentType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return contentType == "application/octet-stream"
+}
+
+func isScepRequest(contentType string) bool {
+	return contentType == "application/x-pki-message"
+}
+
+func isCmpRequest(contentType string) bool {
+	return contentType == "application/pkixcmp"
+}
+
 func buildLogicalPath(r *http.Request) (string, int, error) {
 	ns, err := namespace.FromContext(r.Context())
 	if err != nil {
@@ -264,7 +304,7 @@ func buildLogicalPath(r *http.Request) (string, int, error) {
 }
 
 func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Request) (*logical.Request, io.ReadCloser, int, error) {
-	req, origBody, status, err := buildLogicalRequestNoAuth(core.PerfStandby(), w, r)
+	req, origBody, status, err := buildLogicalRequestNoAuth(core, w, r)
 	if err != nil || status != 0 {
 		return nil, nil, status, err
 	}
@@ -316,7 +356,7 @@ func handleLogicalNoForward(core *vault.Core) http.Handler {
 
 func handleLogicalRecovery(raw *vault.RawBackend, token *atomic.String) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		req, _, statusCode, err := buildLogicalRequestNoAuth(false, w, r)
+		req, _, statusCode, err := buildLogicalRequestNoAuth(nil, w, r)
 		if err != nil || statusCode != 0 {
 			respondError(w, statusCode, err)
 			return
@@ -314,6 +314,52 @@ func TestLogical_RequestSizeDisableLimit(t *testing.T) {
 	testResponseStatus(t, resp, http.StatusNoContent)
 }
 
+func TestLogical_StreamRequestOtherPaths(t *testing.T) {
+	core, _, rootToken := vault.TestCoreUnsealed(t)
+
+	// Paths that do not accept raw streams parse the body as usual, whatever
+	// the content type claims
+	req, _ := http.NewRequest("POST", "http://127.0.0.1:8200/v1/secret/foo", strings.NewReader(`{"foo": "bar"}`))
+	req = req.WithContext(namespace.RootContext(nil))
+	req.Header.Add(consts.AuthHeaderName, rootToken)
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	lreq, _, status, err := buildLogicalRequest(core, nil, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 0 {
+		t.Fatalf("got status %d", status)
+	}
+	if lreq.Data["foo"] != "bar" {
+		t.Fatalf("body not parsed: %#v", lreq.Data)
+	}
+	if lreq.HTTPRequest != nil || lreq.ResponseWriter != nil {
+		t.Fatal("raw request handed to a path that does not accept streams")
+	}
+}
+
+func TestLogical_RateLimitQuotaNonLoginBody(t *testing.T) {
+	core, _, rootToken := vault.TestCoreUnsealed(t)
+
+	// Role detection only applies to logins, so the body of any other request,
+	// which may be a raw stream of any size, reaches the handler unread
+	body := ioutil.NopCloser(strings.NewReader(`{"foo": "bar"}`))
+	var got io.ReadCloser
+	handler := rateLimitQuotaWrapping(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Body
+	}), core)
+
+	req, _ := http.NewRequest("POST", "http://127.0.0.1:8200/v1/secret/foo", body)
+	req = req.WithContext(namespace.RootContext(nil))
+	req.Header.Add(consts.AuthHeaderName, rootToken)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != body {
+		t.Fatal("request body was replaced before reaching the handler")
+	}
+}
+
 func TestLogical_ListSuffix(t *testing.T) {
 	core, _, rootToken := vault.TestCoreUnsealed(t)
 	req, _ := http.NewRequest("GET", "http://127.0.0.1:8200/v1/secret/foo", nil)
@@ -350,7 +396,7 @@ func TestLogical_ListSuffix(t *testing.T) {
 	req = req.WithContext(namespace.RootContext(nil))
 	req.Header.Add(consts.AuthHeaderName, rootToken)
 
-	_, _, status, err = buildLogicalRequestNoAuth(core.PerfStandby(), nil, req)
+	_, _, status, err = buildLogicalRequestNoAuth(core, nil, req)
 	if err != nil || status != 0 {
 		t.Fatal(err)
 	}
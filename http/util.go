@@ -55,28 +55,50 @@ func rateLimitQuotaWrapping(handler http.Handler, core *vault.Core) http.Handler
 		}
 		mountPath := strings.TrimPrefix(core.MatchingMount(r.Context(), path), ns.Path)
 
-		// Clone body, so we do not close the request body reader
-		bodyBytes, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			respondError(w, http.StatusInternalServerError, errors.New("failed to read request body"))
-			return
+		// Roles only apply to logins, so the body is only read, and cloned
+		// so that we do not close the request body reader, for login paths.
+		// Other requests, such as raw streams, may be of any size.
+		var role string
+		if core.IsLoginPath(r.Context(), path) {
+			bodyBytes, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, errors.New("failed to read request body"))
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+			role = core.DetermineRoleFromLoginRequestFromBytes(mountPath, bodyBytes, r.Context())
 		}
-		r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
 
-		quotaResp, err := core.ApplyRateLimitQuota(r.Context(), &quotas.Request{
+		// Only quotas may annotate requests with shadow violations
+		r.Header.Del(quotas.ShadowViolationHeader)
+
+		quotaReq := &quotas.Request{
 			Type:          quotas.TypeRateLimit,
 			Path:          path,
 			MountPath:     mountPath,
-			Role:          core.DetermineRoleFromLoginRequestFromBytes(mountPath, bodyBytes, r.Context()),
+			Role:          role,
 			NamespacePath: ns.Path,
 			ClientAddress: parseRemoteIPAddress(r),
-		})
+		}
+		// Clients can send any header they like, so quotas are only keyed by
+		// the headers of requests relayed by a trusted proxy, which must set
+		// them itself
+		if fromTrustedProxy(r) {
+			quotaReq.Headers = r.Header
+		}
+		if token, _ := getTokenFromReq(r); token != "" {
+			core.ResolveRateLimitQuotaIdentity(r.Context(), quotaReq, token)
+		}
+
+		quotaResp, err := core.ApplyRateLimitQuota(r.Context(), quotaReq)
 		if err != nil {
 			core.Logger().Error("failed to apply quota", "path", path, "error", err)
 			respondError(w, http.StatusUnprocessableEntity, err)
 			return
 		}
 
+		quotas.AnnotateShadowViolation(r.Header, quotaResp)
+
 		if core.RateLimitResponseHeadersEnabled() {
 			for h, v := range quotaResp.Headers {
 				w.Header().Set(h, v)
@@ -92,7 +114,7 @@ func rateLimitQuotaWrapping(handler http.Handler, core *vault.Core) http.Handler
 			}
 
 			if core.RateLimitAuditLoggingEnabled() {
-				req, _, status, err := buildLogicalRequestNoAuth(core.PerfStandby(), w, r)
+				req, _, status, err := buildLogicalRequestNoAuth(core, w, r)
 				if err != nil || status != 0 {
 					respondError(w, status, err)
 					return
@@ -110,6 +132,23 @@ func rateLimitQuotaWrapping(handler http.Handler, core *vault.Core) http.Handler
 			return
 		}
 
+		concurrencyResp, err := core.ApplyConcurrencyQuota(r.Context(), quotaReq)
+		if err != nil {
+			core.Logger().Error("failed to apply quota", "path", path, "error", err)
+			respondError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if !concurrencyResp.Allowed {
+			respondError(w, http.StatusTooManyRequests, fmt.Errorf("request path %q: %w", path, quotas.ErrConcurrencyQuotaExceeded))
+
+			if core.Logger().IsTrace() {
+				core.Logger().Trace("request rejected due to concurrency quota violation", "request_path", path)
+			}
+			return
+		}
+		defer quotas.Release(concurrencyResp.Access)
+		quotas.AnnotateShadowViolation(r.Header, concurrencyResp)
+
 		handler.ServeHTTP(w, r)
 		return
 	})
@@ -1,11 +1,12 @@
 module github.com/hashicorp/vault/sdk
 
-go 1.19
+go 1.20
 
 require (
 	github.com/armon/go-metrics v0.4.1
 	github.com/armon/go-radix v1.0.0
 	github.com/cenkalti/backoff/v3 v3.2.2
+	github.com/cloudflare/circl v1.3.3
 	github.com/docker/docker v23.0.4+incompatible
 	github.com/docker/go-connections v0.4.0
 	github.com/evanphx/json-patch/v5 v5.6.0
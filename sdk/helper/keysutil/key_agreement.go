@@ -0,0 +1,303 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package keysutil
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/cloudflare/circl/hpke"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+)
+
+// The AEADs that can be used for HPKE (RFC 9180) with keys supporting key
+// agreement. The KEM and KDF of the HPKE suite follow from the key type.
+const (
+	HPKEAEAD_AES128GCM        = "aes-128-gcm"
+	HPKEAEAD_AES256GCM        = "aes-256-gcm"
+	HPKEAEAD_ChaCha20Poly1305 = "chacha20-poly1305"
+)
+
+// keyAgreementKeyEntry returns the entry of a key version usable for key
+// agreement, defaulting to the latest version. Versions below minVersion are
+// disallowed by policy.
+func (p *Policy) keyAgreementKeyEntry(ver, minVersion int) (int, KeyEntry, error) {
+	if !p.Type.KeyAgreementSupported() {
+		return 0, KeyEntry{}, errutil.UserError{Err: fmt.Sprintf("key agreement not supported for key type %v", p.Type)}
+	}
+
+	switch {
+	case ver == 0:
+		ver = p.LatestVersion
+	case ver < 0:
+		return 0, KeyEntry{}, errutil.UserError{Err: "requested version is negative"}
+	case ver > p.LatestVersion:
+		return 0, KeyEntry{}, errutil.UserError{Err: "requested version is higher than the latest key version"}
+	case minVersion > 0 && ver < minVersion:
+		return 0, KeyEntry{}, errutil.UserError{Err: ErrTooOld}
+	}
+
+	keyEntry, err := p.safeGetKeyEntry(ver)
+	if err != nil {
+		return 0, KeyEntry{}, err
+	}
+	return ver, keyEntry, nil
+}
+
+// ecdhCurve returns the curve of a key supporting key agreement
+func (p *Policy) ecdhCurve() ecdh.Curve {
+	switch p.Type {
+	case KeyType_ECDSA_P384:
+		return ecdh.P384()
+	case KeyType_ECDSA_P521:
+		return ecdh.P521()
+	case KeyType_X25519:
+		return ecdh.X25519()
+	default:
+		return ecdh.P256()
+	}
+}
+
+// ecdhPrivateKeyBytes returns the private key of a key version in the
+// encoding used by crypto/ecdh and RFC 9180 alike: the fixed-size big-endian
+// scalar for NIST curves and the raw 32 bytes for X25519.
+func (p *Policy) ecdhPrivateKeyBytes(keyEntry KeyEntry) ([]byte, error) {
+	if keyEntry.IsPrivateKeyMissing() {
+		return nil, errutil.UserError{Err: "requested version does not contain a private part"}
+	}
+
+	if p.Type == KeyType_X25519 {
+		return keyEntry.Key, nil
+	}
+
+	var size int
+	switch p.Type {
+	case KeyType_ECDSA_P384:
+		size = 48
+	case KeyType_ECDSA_P521:
+		size = 66
+	default:
+		size = 32
+	}
+	return keyEntry.EC_D.FillBytes(make([]byte, size)), nil
+}
+
+// ecdhPublicKeyBytes returns the public key of a key version in the encoding
+// used by crypto/ecdh and RFC 9180 alike: the uncompressed point for NIST
+// curves and the raw 32 bytes for X25519.
+func (p *Policy) ecdhPublicKeyBytes(keyEntry KeyEntry) ([]byte, error) {
+	if p.Type == KeyType_X25519 {
+		privKey, err := ecdh.X25519().NewPrivateKey(keyEntry.Key)
+		if err != nil {
+			return nil, err
+		}
+		return privKey.PublicKey().Bytes(), nil
+	}
+
+	var curve elliptic.Curve
+	switch p.Type {
+	case KeyType_ECDSA_P384:
+		curve = elliptic.P384()
+	case KeyType_ECDSA_P521:
+		curve = elliptic.P521()
+	default:
+		curve = elliptic.P256()
+	}
+
+	pubKey, err := (&ecdsa.PublicKey{
+		Curve: curve,
+		X:     keyEntry.EC_X,
+		Y:     keyEntry.EC_Y,
+	}).ECDH()
+	if err != nil {
+		return nil, err
+	}
+	return pubKey.Bytes(), nil
+}
+
+// DeriveSharedSecret performs Diffie-Hellman key agreement between the
+// private key of the given key version and a peer public key, and returns the
+// raw shared secret. The peer public key is either PEM-encoded in PKIX form
+// or in the raw encoding of the curve: an uncompressed point for NIST curves
+// and 32 bytes for X25519.
+func (p *Policy) DeriveSharedSecret(ver int, peerPublicKey []byte) ([]byte, error) {
+	_, keyEntry, err := p.keyAgreementKeyEntry(ver, p.MinDecryptionVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	privBytes, err := p.ecdhPrivateKeyBytes(keyEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	curve := p.ecdhCurve()
+	privKey, err := curve.NewPrivateKey(privBytes)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("failed to load private key: %v", err)}
+	}
+
+	peerKey, err := parseECDHPublicKey(curve, peerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := privKey.ECDH(peerKey)
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("failed to perform key agreement: %v", err)}
+	}
+	return secret, nil
+}
+
+// parseECDHPublicKey parses a PEM-encoded PKIX or raw public key on the
+// given curve.
+func parseECDHPublicKey(curve ecdh.Curve, publicKey []byte) (*ecdh.PublicKey, error) {
+	pemBlock, _ := pem.Decode(publicKey)
+	if pemBlock == nil {
+		key, err := curve.NewPublicKey(publicKey)
+		if err != nil {
+			return nil, errutil.UserError{Err: fmt.Sprintf("invalid peer public key: %v", err)}
+		}
+		return key, nil
+	}
+
+	parsedKey, err := x509.ParsePKIXPublicKey(pemBlock.Bytes)
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("failed to parse peer public key: %v", err)}
+	}
+
+	var key *ecdh.PublicKey
+	switch parsedKey := parsedKey.(type) {
+	case *ecdh.PublicKey:
+		key = parsedKey
+	case *ecdsa.PublicKey:
+		key, err = parsedKey.ECDH()
+		if err != nil {
+			return nil, errutil.UserError{Err: fmt.Sprintf("invalid peer public key: %v", err)}
+		}
+	default:
+		return nil, errutil.UserError{Err: fmt.Sprintf("peer public key of type %T does not support key agreement", parsedKey)}
+	}
+
+	if key.Curve() != curve {
+		return nil, errutil.UserError{Err: "peer public key is not on the curve of the key"}
+	}
+	return key, nil
+}
+
+// hpkeSuite returns the HPKE suite for the key type and the given AEAD
+func (p *Policy) hpkeSuite(aead string) (hpke.Suite, error) {
+	var kemID hpke.KEM
+	var kdfID hpke.KDF
+	switch p.Type {
+	case KeyType_ECDSA_P256:
+		kemID, kdfID = hpke.KEM_P256_HKDF_SHA256, hpke.KDF_HKDF_SHA256
+	case KeyType_ECDSA_P384:
+		kemID, kdfID = hpke.KEM_P384_HKDF_SHA384, hpke.KDF_HKDF_SHA384
+	case KeyType_ECDSA_P521:
+		kemID, kdfID = hpke.KEM_P521_HKDF_SHA512, hpke.KDF_HKDF_SHA512
+	case KeyType_X25519:
+		kemID, kdfID = hpke.KEM_X25519_HKDF_SHA256, hpke.KDF_HKDF_SHA256
+	default:
+		return hpke.Suite{}, errutil.UserError{Err: fmt.Sprintf("HPKE not supported for key type %v", p.Type)}
+	}
+
+	var aeadID hpke.AEAD
+	switch aead {
+	case HPKEAEAD_AES128GCM:
+		aeadID = hpke.AEAD_AES128GCM
+	case "", HPKEAEAD_AES256GCM:
+		aeadID = hpke.AEAD_AES256GCM
+	case HPKEAEAD_ChaCha20Poly1305:
+		aeadID = hpke.AEAD_ChaCha20Poly1305
+	default:
+		return hpke.Suite{}, errutil.UserError{Err: fmt.Sprintf("unsupported HPKE AEAD %q", aead)}
+	}
+
+	return hpke.NewSuite(kemID, kdfID, aeadID), nil
+}
+
+// HPKESeal encrypts the plaintext to the public key of the given key version
+// with HPKE in base mode, and returns the encapsulated key along with the
+// ciphertext.
+func (p *Policy) HPKESeal(ver int, aead string, info, associatedData, plaintext []byte) (int, []byte, []byte, error) {
+	ver, keyEntry, err := p.keyAgreementKeyEntry(ver, p.MinEncryptionVersion)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	suite, err := p.hpkeSuite(aead)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	kemID, _, _ := suite.Params()
+
+	pubBytes, err := p.ecdhPublicKeyBytes(keyEntry)
+	if err != nil {
+		return 0, nil, nil, errutil.InternalError{Err: fmt.Sprintf("failed to load public key: %v", err)}
+	}
+	pubKey, err := kemID.Scheme().UnmarshalBinaryPublicKey(pubBytes)
+	if err != nil {
+		return 0, nil, nil, errutil.InternalError{Err: fmt.Sprintf("failed to load public key: %v", err)}
+	}
+
+	sender, err := suite.NewSender(pubKey, info)
+	if err != nil {
+		return 0, nil, nil, errutil.InternalError{Err: err.Error()}
+	}
+	encapsulatedKey, sealer, err := sender.Setup(rand.Reader)
+	if err != nil {
+		return 0, nil, nil, errutil.InternalError{Err: err.Error()}
+	}
+	ciphertext, err := sealer.Seal(plaintext, associatedData)
+	if err != nil {
+		return 0, nil, nil, errutil.InternalError{Err: err.Error()}
+	}
+
+	return ver, encapsulatedKey, ciphertext, nil
+}
+
+// HPKEOpen decrypts a ciphertext sealed with HPKE in base mode to the public
+// key of the given key version.
+func (p *Policy) HPKEOpen(ver int, aead string, info, associatedData, encapsulatedKey, ciphertext []byte) ([]byte, error) {
+	_, keyEntry, err := p.keyAgreementKeyEntry(ver, p.MinDecryptionVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	suite, err := p.hpkeSuite(aead)
+	if err != nil {
+		return nil, err
+	}
+	kemID, _, _ := suite.Params()
+
+	privBytes, err := p.ecdhPrivateKeyBytes(keyEntry)
+	if err != nil {
+		return nil, err
+	}
+	privKey, err := kemID.Scheme().UnmarshalBinaryPrivateKey(privBytes)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("failed to load private key: %v", err)}
+	}
+
+	receiver, err := suite.NewReceiver(privKey, info)
+	if err != nil {
+		return nil, errutil.InternalError{Err: err.Error()}
+	}
+	opener, err := receiver.Setup(encapsulatedKey)
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("invalid encapsulated key: %v", err)}
+	}
+	plaintext, err := opener.Open(ciphertext, associatedData)
+	if err != nil {
+		return nil, errutil.UserError{Err: "failed to open ciphertext"}
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,187 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package keysutil
+
+import (
+	"crypto/aes"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"golang.org/x/crypto/sha3"
+)
+
+// The KMAC variants of NIST SP 800-185
+const (
+	KMAC128 = "kmac128"
+	KMAC256 = "kmac256"
+)
+
+func (kt KeyType) CMACSupported() bool {
+	switch kt {
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96:
+		return true
+	}
+	return false
+}
+
+// CMAC computes the AES-CMAC (NIST SP 800-38B) of the input with the AES
+// key of the given key version, truncated to the CMAC length of the policy.
+// Since the encryption key itself is used, CMACs must be allowed on the
+// policy.
+func (p *Policy) CMAC(ver int, input []byte) ([]byte, error) {
+	if !p.Type.CMACSupported() {
+		return nil, errutil.UserError{Err: fmt.Sprintf("CMAC not supported for key type %v", p.Type)}
+	}
+	if !p.AllowCMAC {
+		return nil, errutil.UserError{Err: "CMAC is not allowed for this key"}
+	}
+
+	switch {
+	case ver <= 0:
+		return nil, errutil.UserError{Err: "key version does not exist (must be positive)"}
+	case ver > p.LatestVersion:
+		return nil, errutil.UserError{Err: fmt.Sprintf("key version does not exist; latest key version is %d", p.LatestVersion)}
+	}
+	keyEntry, err := p.safeGetKeyEntry(ver)
+	if err != nil {
+		return nil, err
+	}
+
+	mac, err := aesCMAC(keyEntry.Key, input)
+	if err != nil {
+		return nil, err
+	}
+	if p.CMACLength > 0 && p.CMACLength < len(mac) {
+		mac = mac[:p.CMACLength]
+	}
+	return mac, nil
+}
+
+// aesCMAC computes the full-length AES-CMAC of the input
+func aesCMAC(key, input []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errutil.InternalError{Err: err.Error()}
+	}
+
+	// Derive the subkeys from the encryption of the zero block
+	k1 := make([]byte, aes.BlockSize)
+	block.Encrypt(k1, k1)
+	cmacDouble(k1)
+	k2 := make([]byte, aes.BlockSize)
+	copy(k2, k1)
+	cmacDouble(k2)
+
+	n := (len(input) + aes.BlockSize - 1) / aes.BlockSize
+	complete := n > 0 && len(input)%aes.BlockSize == 0
+	if n == 0 {
+		n = 1
+	}
+
+	// The last block is masked with K1 when complete, and padded with
+	// 10* and masked with K2 otherwise
+	last := make([]byte, aes.BlockSize)
+	lastStart := (n - 1) * aes.BlockSize
+	if complete {
+		subtle.XORBytes(last, input[lastStart:], k1)
+	} else {
+		copy(last, input[lastStart:])
+		last[len(input)-lastStart] = 0x80
+		subtle.XORBytes(last, last, k2)
+	}
+
+	x := make([]byte, aes.BlockSize)
+	for i := 0; i < n-1; i++ {
+		subtle.XORBytes(x, x, input[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(x, x)
+	}
+	subtle.XORBytes(x, x, last)
+	block.Encrypt(x, x)
+
+	return x, nil
+}
+
+// cmacDouble multiplies a block by x in GF(2^128), in place
+func cmacDouble(b []byte) {
+	msb := b[0] >> 7
+	for i := 0; i < len(b)-1; i++ {
+		b[i] = b[i]<<1 | b[i+1]>>7
+	}
+	b[len(b)-1] <<= 1
+	b[len(b)-1] ^= 0x87 * msb
+}
+
+// KMAC computes the KMAC128 or KMAC256 (NIST SP 800-185) of the input with
+// the HMAC key of the given key version, and the given customization string
+// and output length in bytes.
+func (p *Policy) KMAC(ver int, variant string, customization, input []byte, macLength int) ([]byte, error) {
+	if macLength <= 0 {
+		return nil, errutil.UserError{Err: "invalid KMAC length"}
+	}
+
+	key, err := p.HMACKey(ver)
+	if err != nil {
+		return nil, errutil.UserError{Err: err.Error()}
+	}
+	if key == nil {
+		return nil, errutil.InternalError{Err: "HMAC key value could not be computed"}
+	}
+
+	return kmac(variant, key, customization, input, macLength)
+}
+
+func kmac(variant string, key, customization, input []byte, macLength int) ([]byte, error) {
+	var h sha3.ShakeHash
+	var rate int
+	switch variant {
+	case KMAC128:
+		h = sha3.NewCShake128([]byte("KMAC"), customization)
+		rate = 168
+	case KMAC256:
+		h = sha3.NewCShake256([]byte("KMAC"), customization)
+		rate = 136
+	default:
+		return nil, errutil.UserError{Err: fmt.Sprintf("unsupported KMAC variant %q", variant)}
+	}
+
+	// bytepad(encode_string(K), rate) || X || right_encode(L)
+	encodedKey := append(leftEncode(uint64(len(key))*8), key...)
+	padded := append(leftEncode(uint64(rate)), encodedKey...)
+	if rem := len(padded) % rate; rem != 0 {
+		padded = append(padded, make([]byte, rate-rem)...)
+	}
+	h.Write(padded)
+	h.Write(input)
+	h.Write(rightEncode(uint64(macLength) * 8))
+
+	out := make([]byte, macLength)
+	h.Read(out)
+	return out, nil
+}
+
+// leftEncode is left_encode of NIST SP 800-185
+func leftEncode(x uint64) []byte {
+	buf := make([]byte, 9)
+	binary.BigEndian.PutUint64(buf[1:], x)
+	i := 1
+	for i < 8 && buf[i] == 0 {
+		i++
+	}
+	buf[i-1] = byte(9 - i)
+	return buf[i-1:]
+}
+
+// rightEncode is right_encode of NIST SP 800-185
+func rightEncode(x uint64) []byte {
+	buf := make([]byte, 9)
+	binary.BigEndian.PutUint64(buf, x)
+	i := 0
+	for i < 7 && buf[i] == 0 {
+		i++
+	}
+	buf[8] = byte(8 - i)
+	return buf[i:]
+}
@@ -0,0 +1,73 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package keysutil
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Test vectors from RFC 4493
+func TestAESCMAC(t *testing.T) {
+	key := mustHex(t, "2b7e151628aed2a6abf7158809cf4f3c")
+	message := mustHex(t, "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710")
+
+	cases := []struct {
+		length   int
+		expected string
+	}{
+		{0, "bb1d6929e95937287fa37d129b756746"},
+		{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{40, "dfa66747de9ae63030ca32611497c827"},
+		{64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	}
+	for _, c := range cases {
+		mac, err := aesCMAC(key, message[:c.length])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(mac) != c.expected {
+			t.Fatalf("bad CMAC for %d bytes: expected %s, got %x", c.length, c.expected, mac)
+		}
+	}
+}
+
+// Samples from NIST SP 800-185
+func TestKMAC(t *testing.T) {
+	key := mustHex(t, "404142434445464748494a4b4c4d4e4f505152535455565758595a5b5c5d5e5f")
+	data := mustHex(t, "00010203")
+
+	cases := []struct {
+		variant       string
+		customization string
+		length        int
+		expected      string
+	}{
+		{KMAC128, "", 32, "e5780b0d3ea6f7d3a429c5706aa43a00fadbd7d49628839e3187243f456ee14e"},
+		{KMAC128, "My Tagged Application", 32, "3b1fba963cd8b0b59e8c1a6d71888b7143651af8ba0a7070c0979e2811324aa5"},
+		{KMAC256, "My Tagged Application", 64, "20c570c31346f703c9ac36c61c03cb64c3970d0cfc787e9b79599d273a68d2f7f69d4cc3de9d104a351689f27cf6f5951f0103f33f4f24871024d9c27773a8dd"},
+	}
+	for _, c := range cases {
+		mac, err := kmac(c.variant, key, []byte(c.customization), data, c.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(mac) != c.expected {
+			t.Fatalf("bad %s with customization %q: expected %s, got %x", c.variant, c.customization, c.expected, mac)
+		}
+	}
+
+	if _, err := kmac("kmac512", key, nil, data, 32); err == nil {
+		t.Fatal("expected error for unsupported variant")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdh"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/hmac"
@@ -70,6 +71,7 @@ const (
 	KeyType_RSA3072
 	KeyType_MANAGED_KEY
 	KeyType_HMAC
+	KeyType_X25519
 )
 
 const (
@@ -178,6 +180,22 @@ func (kt KeyType) ImportPublicKeySupported() bool {
 	return false
 }
 
+func (kt KeyType) KeyAgreementSupported() bool {
+	switch kt {
+	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521, KeyType_X25519:
+		return true
+	}
+	return false
+}
+
+func (kt KeyType) CertificateSupported() bool {
+	switch kt {
+	case KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096, KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521:
+		return true
+	}
+	return false
+}
+
 func (kt KeyType) String() string {
 	switch kt {
 	case KeyType_AES128_GCM96:
@@ -202,6 +220,8 @@ func (kt KeyType) String() string {
 		return "rsa-4096"
 	case KeyType_HMAC:
 		return "hmac"
+	case KeyType_X25519:
+		return "x25519"
 	case KeyType_MANAGED_KEY:
 		return "managed_key"
 	}
@@ -244,6 +264,14 @@ type KeyEntry struct {
 	DeprecatedCreationTime int64 `json:"creation_time"`
 
 	ManagedKeyUUID string `json:"managed_key_id,omitempty"`
+
+	// The DER-encoded certificate chain issued for this key version, leaf
+	// first, if one has been set
+	CertificateChain [][]byte `json:"certificate_chain,omitempty"`
+
+	// The number of encryptions performed with this key version, as last
+	// persisted
+	EncryptionCount uint64 `json:"encryption_count,omitempty"`
 }
 
 func (ke *KeyEntry) IsPrivateKeyMissing() bool {
@@ -454,6 +482,26 @@ type Policy struct {
 	// rotate. Setting this to zero disables automatic rotation for the key.
 	AutoRotatePeriod time.Duration `json:"auto_rotate_period"`
 
+	// PublicJWKS publishes the JWKS of the key's public keys without
+	// authentication
+	PublicJWKS bool `json:"public_jwks,omitempty"`
+
+	// MaxEncryptionsPerVersion is the number of encryptions after which the
+	// key is rotated. Zero disables rotation based on usage.
+	MaxEncryptionsPerVersion uint64 `json:"max_encryptions_per_version,omitempty"`
+
+	// AllowCMAC allows the AES key to be used for CMACs as well as for
+	// encryption
+	AllowCMAC bool `json:"allow_cmac,omitempty"`
+
+	// CMACLength is the length in bytes CMACs are truncated to. Zero keeps
+	// the full length.
+	CMACLength int `json:"cmac_length,omitempty"`
+
+	// pendingEncryptions counts the encryptions per key version which have
+	// not been persisted yet
+	pendingEncryptions sync.Map
+
 	// versionPrefixCache stores caches of version prefix strings and the split
 	// version template.
 	versionPrefixCache sync.Map
@@ -1680,6 +1728,13 @@ func (p *Policy) RotateInMemory(randReader io.Reader) (retErr error) {
 		}
 		entry.Key = pri
 		entry.FormattedPublicKey = base64.StdEncoding.EncodeToString(pub)
+	case KeyType_X25519:
+		privKey, err := ecdh.X25519().GenerateKey(randReader)
+		if err != nil {
+			return err
+		}
+		entry.Key = privKey.Bytes()
+		entry.FormattedPublicKey = base64.StdEncoding.EncodeToString(privKey.PublicKey().Bytes())
 	case KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
 		bitSize := 2048
 		if p.Type == KeyType_RSA3072 {
@@ -2108,6 +2163,8 @@ func (p *Policy) EncryptWithFactory(ver int, context []byte, nonce []byte, value
 		return "", errutil.InternalError{Err: fmt.Sprintf("unsupported key type %v", p.Type)}
 	}
 
+	p.recordEncryption(ver)
+
 	// Convert to base64
 	encoded := base64.StdEncoding.EncodeToString(ciphertext)
 
@@ -2393,3 +2450,132 @@ func wrapTargetPKCS8ForImport(wrappingKey *rsa.PublicKey, preppedTargetKey []byt
 	wrappedKeys := append(ephKeyWrapped, targetKeyWrapped...)
 	return base64.StdEncoding.EncodeToString(wrappedKeys), nil
 }
+
+// certificateKeyEntry returns the entry of a key version that certificates
+// can be issued for, defaulting to the latest version.
+func (p *Policy) certificateKeyEntry(ver int) (KeyEntry, error) {
+	if !p.Type.CertificateSupported() {
+		return KeyEntry{}, errutil.UserError{Err: fmt.Sprintf("certificates are not supported for key type %v", p.Type)}
+	}
+
+	switch {
+	case ver == 0:
+		ver = p.LatestVersion
+	case ver < 0:
+		return KeyEntry{}, errutil.UserError{Err: "requested version is negative"}
+	case ver > p.LatestVersion:
+		return KeyEntry{}, errutil.UserError{Err: "requested version is higher than the latest key version"}
+	case ver < p.MinAvailableVersion:
+		return KeyEntry{}, errutil.UserError{Err: "requested version is less than the minimum available key version"}
+	}
+
+	return p.safeGetKeyEntry(ver)
+}
+
+// CreateCsr builds a PEM-encoded certificate signing request from the given
+// template, signed by the private key of the given key version.
+func (p *Policy) CreateCsr(ver int, csrTemplate *x509.CertificateRequest) ([]byte, error) {
+	keyEntry, err := p.certificateKeyEntry(ver)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyEntry.IsPrivateKeyMissing() {
+		return nil, errutil.UserError{Err: "requested version does not contain a private part"}
+	}
+
+	var signer crypto.Signer
+	switch p.Type {
+	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521:
+		var curve elliptic.Curve
+		switch p.Type {
+		case KeyType_ECDSA_P384:
+			curve = elliptic.P384()
+		case KeyType_ECDSA_P521:
+			curve = elliptic.P521()
+		default:
+			curve = elliptic.P256()
+		}
+
+		signer = &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: curve,
+				X:     keyEntry.EC_X,
+				Y:     keyEntry.EC_Y,
+			},
+			D: keyEntry.EC_D,
+		}
+	case KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
+		signer = keyEntry.RSAKey
+	}
+
+	// The key and signature come from the key version, not the template
+	csrTemplate.PublicKey = nil
+	csrTemplate.PublicKeyAlgorithm = x509.UnknownPublicKeyAlgorithm
+	csrTemplate.Signature = nil
+	csrTemplate.SignatureAlgorithm = x509.UnknownSignatureAlgorithm
+
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, csrTemplate, signer)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the certificate request: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: csrBytes,
+	}), nil
+}
+
+// ValidateLeafCertKeyMatch reports whether the public key of a certificate
+// is the public key of the given key version.
+func (p *Policy) ValidateLeafCertKeyMatch(ver int, certPublicKey crypto.PublicKey) (bool, error) {
+	keyEntry, err := p.certificateKeyEntry(ver)
+	if err != nil {
+		return false, err
+	}
+
+	switch p.Type {
+	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521:
+		certKey, ok := certPublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return false, nil
+		}
+		return certKey.X.Cmp(keyEntry.EC_X) == 0 && certKey.Y.Cmp(keyEntry.EC_Y) == 0, nil
+	case KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
+		certKey, ok := certPublicKey.(*rsa.PublicKey)
+		if !ok {
+			return false, nil
+		}
+		publicKey := keyEntry.RSAPublicKey
+		if !keyEntry.IsPrivateKeyMissing() {
+			publicKey = &keyEntry.RSAKey.PublicKey
+		}
+		return certKey.Equal(publicKey), nil
+	}
+
+	return false, nil
+}
+
+// PersistCertificateChain stores the DER-encoded certificate chain, leaf
+// first, with the given key version, replacing any chain set before.
+func (p *Policy) PersistCertificateChain(ctx context.Context, storage logical.Storage, ver int, certChain [][]byte) error {
+	if ver == 0 {
+		ver = p.LatestVersion
+	}
+	keyEntry, err := p.certificateKeyEntry(ver)
+	if err != nil {
+		return err
+	}
+
+	priorChain := keyEntry.CertificateChain
+	keyEntry.CertificateChain = certChain
+	p.Keys[strconv.Itoa(ver)] = keyEntry
+
+	if err := p.Persist(ctx, storage); err != nil {
+		keyEntry.CertificateChain = priorChain
+		p.Keys[strconv.Itoa(ver)] = keyEntry
+		return err
+	}
+
+	return nil
+}
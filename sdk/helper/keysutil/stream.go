@@ -0,0 +1,318 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package keysutil
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Chunked encryption of large payloads uses the STREAM construction of
+// Hoang, Reyhanitabar, Rogaway and Vizár ("Online Authenticated-Encryption and
+// its Nonce-Reuse Misuse-Resistance"), with a single-use data key: each chunk is
+// sealed with a nonce made of a big-endian chunk counter and a flag marking the
+// final chunk, so chunks can be neither reordered nor truncated. The stream
+// header is authenticated as associated data of every chunk.
+//
+// A stream consists of
+//
+//	magic "vtstream" | version (1) | AEAD (1) | chunk size (4) |
+//	key length (2) | wrapped data key | sealed chunks...
+//
+// where the wrapped data key is the transit ciphertext of the data key.
+
+// The AEADs supported for streams
+const (
+	StreamAEAD_AES256_GCM        = "aes256-gcm"
+	StreamAEAD_ChaCha20_Poly1305 = "chacha20-poly1305"
+)
+
+const (
+	// StreamErrorTrailer is the HTTP trailer in which Transit's decrypt-stream
+	// endpoint reports an error found after the response was started
+	StreamErrorTrailer = "X-Vault-Stream-Error"
+
+	DefaultStreamChunkSize = 64 * 1024
+	MaxStreamChunkSize     = 16 * 1024 * 1024
+
+	streamMagic   = "vtstream"
+	streamVersion = 1
+)
+
+var errStreamTruncated = errors.New("stream is truncated")
+
+var streamAEADs = []string{"", StreamAEAD_AES256_GCM, StreamAEAD_ChaCha20_Poly1305}
+
+// StreamHeader describes an encrypted stream
+type StreamHeader struct {
+	AEAD      string
+	ChunkSize int
+
+	// WrappedKey is the data key encrypted by transit
+	WrappedKey string
+}
+
+// Marshal returns the binary encoding of the header
+func (h *StreamHeader) Marshal() ([]byte, error) {
+	aeadID := -1
+	for i, name := range streamAEADs {
+		if name != "" && name == h.AEAD {
+			aeadID = i
+		}
+	}
+	if aeadID < 0 {
+		return nil, fmt.Errorf("unsupported stream AEAD %q", h.AEAD)
+	}
+	if h.ChunkSize <= 0 || h.ChunkSize > MaxStreamChunkSize {
+		return nil, fmt.Errorf("chunk size must be between 1 and %d bytes", MaxStreamChunkSize)
+	}
+	if len(h.WrappedKey) == 0 || len(h.WrappedKey) > 0xffff {
+		return nil, errors.New("invalid wrapped data key")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(streamMagic)
+	buf.WriteByte(streamVersion)
+	buf.WriteByte(byte(aeadID))
+	binary.Write(&buf, binary.BigEndian, uint32(h.ChunkSize))
+	binary.Write(&buf, binary.BigEndian, uint16(len(h.WrappedKey)))
+	buf.WriteString(h.WrappedKey)
+	return buf.Bytes(), nil
+}
+
+// ReadStreamHeader reads the header at the start of an encrypted stream. It
+// returns the raw header as well, which is needed to decrypt the stream.
+func ReadStreamHeader(r io.Reader) (*StreamHeader, []byte, error) {
+	fixed := make([]byte, len(streamMagic)+8)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, nil, fmt.Errorf("error reading stream header: %w", err)
+	}
+	if string(fixed[:len(streamMagic)]) != streamMagic {
+		return nil, nil, errors.New("not an encrypted stream")
+	}
+	fields := fixed[len(streamMagic):]
+	if fields[0] != streamVersion {
+		return nil, nil, fmt.Errorf("unsupported stream version %d", fields[0])
+	}
+	if int(fields[1]) >= len(streamAEADs) || fields[1] == 0 {
+		return nil, nil, fmt.Errorf("unsupported stream AEAD %d", fields[1])
+	}
+	chunkSize := binary.BigEndian.Uint32(fields[2:6])
+	if chunkSize == 0 || chunkSize > MaxStreamChunkSize {
+		return nil, nil, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	wrappedKey := make([]byte, binary.BigEndian.Uint16(fields[6:8]))
+	if _, err := io.ReadFull(r, wrappedKey); err != nil {
+		return nil, nil, fmt.Errorf("error reading stream header: %w", err)
+	}
+
+	return &StreamHeader{
+		AEAD:       streamAEADs[fields[1]],
+		ChunkSize:  int(chunkSize),
+		WrappedKey: string(wrappedKey),
+	}, append(fixed, wrappedKey...), nil
+}
+
+func newStreamAEAD(name string, key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("stream data keys must be 256 bits")
+	}
+
+	switch name {
+	case StreamAEAD_AES256_GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case StreamAEAD_ChaCha20_Poly1305:
+		return chacha20poly1305.New(key)
+	default:
+		return nil, fmt.Errorf("unsupported stream AEAD %q", name)
+	}
+}
+
+// streamNonce returns the nonce of the given chunk: the counter fills the
+// nonce but for its last byte, which is set for the final chunk
+func streamNonce(nonce []byte, counter uint64, final bool) {
+	for i := range nonce {
+		nonce[i] = 0
+	}
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], counter)
+	if final {
+		nonce[len(nonce)-1] = 1
+	}
+}
+
+type streamEncrypter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	nonce   []byte
+	counter uint64
+	buf     []byte
+	out     []byte
+	size    int
+	closed  bool
+}
+
+// NewStreamEncrypter returns a writer which encrypts everything written to it
+// to w, with the single-use data key and the AEAD and chunk size of the
+// header. The header is written to w first. Close must be called to write the
+// final chunk.
+func NewStreamEncrypter(w io.Writer, key []byte, header *StreamHeader) (io.WriteCloser, error) {
+	rawHeader, err := header.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newStreamAEAD(header.AEAD, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(rawHeader); err != nil {
+		return nil, err
+	}
+
+	return &streamEncrypter{
+		w:      w,
+		aead:   aead,
+		header: rawHeader,
+		nonce:  make([]byte, aead.NonceSize()),
+		buf:    make([]byte, 0, header.ChunkSize),
+		size:   header.ChunkSize,
+	}, nil
+}
+
+func (e *streamEncrypter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed stream")
+	}
+
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, as the final
+		// chunk must be flagged as such
+		if len(e.buf) == e.size {
+			if err := e.seal(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(e.buf[len(e.buf):e.size], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (e *streamEncrypter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.seal(true)
+}
+
+func (e *streamEncrypter) seal(final bool) error {
+	if e.counter == 1<<64-1 {
+		return errors.New("stream is too long")
+	}
+	streamNonce(e.nonce, e.counter, final)
+	e.out = e.aead.Seal(e.out[:0], e.nonce, e.buf, e.header)
+	e.counter++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(e.out)
+	return err
+}
+
+type streamDecrypter struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	header  []byte
+	nonce   []byte
+	counter uint64
+	in      []byte
+	out     []byte
+	done    bool
+	err     error
+}
+
+// NewStreamDecrypter returns a reader of the plaintext of the stream read from
+// r, which must be positioned after the header read by ReadStreamHeader. No
+// plaintext is returned before the chunk containing it has been authenticated,
+// and an error is returned if the stream is truncated.
+func NewStreamDecrypter(r io.Reader, key []byte, header *StreamHeader, rawHeader []byte) (io.Reader, error) {
+	aead, err := newStreamAEAD(header.AEAD, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamDecrypter{
+		r:      r,
+		aead:   aead,
+		header: rawHeader,
+		nonce:  make([]byte, aead.NonceSize()),
+		in:     make([]byte, header.ChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (d *streamDecrypter) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.open()
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func (d *streamDecrypter) open() error {
+	n, err := io.ReadFull(d.r, d.in)
+	switch {
+	case err == io.EOF:
+		return errStreamTruncated
+	case err != nil && err != io.ErrUnexpectedEOF:
+		return err
+	case n < d.aead.Overhead():
+		return errStreamTruncated
+	}
+	chunk := d.in[:n]
+
+	// A short chunk can only be the final one, while a full chunk may be
+	// either
+	var out []byte
+	if n == len(d.in) {
+		streamNonce(d.nonce, d.counter, false)
+		out, err = d.aead.Open(nil, d.nonce, chunk, d.header)
+	}
+	if n < len(d.in) || err != nil {
+		streamNonce(d.nonce, d.counter, true)
+		out, err = d.aead.Open(nil, d.nonce, chunk, d.header)
+		if err != nil {
+			return errors.New("failed to authenticate stream chunk")
+		}
+		d.done = true
+
+		// Nothing may follow the final chunk
+		if m, _ := d.r.Read(make([]byte, 1)); m != 0 {
+			return errors.New("unexpected data after the final stream chunk")
+		}
+	}
+	d.counter++
+	d.out = out
+	return nil
+}
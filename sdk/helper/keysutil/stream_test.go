@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package keysutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+func encryptStream(t *testing.T, key []byte, header *StreamHeader, plaintext []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewStreamEncrypter(&buf, key, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write in odd sizes to exercise the chunking
+	for p := plaintext; len(p) > 0; {
+		n := 7
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decryptStream(key, stream []byte) ([]byte, error) {
+	r := bytes.NewReader(stream)
+	header, rawHeader, err := ReadStreamHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	d, err := NewStreamDecrypter(r, key, header, rawHeader)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(d)
+}
+
+func TestStream(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	for _, aead := range []string{StreamAEAD_AES256_GCM, StreamAEAD_ChaCha20_Poly1305} {
+		// Cover empty streams and streams ending on chunk boundaries
+		for _, size := range []int{0, 1, 63, 64, 65, 128, 1000} {
+			header := &StreamHeader{AEAD: aead, ChunkSize: 64, WrappedKey: "vault:v1:abcd"}
+			plaintext := make([]byte, size)
+			rand.Read(plaintext)
+
+			stream := encryptStream(t, key, header, plaintext)
+			decrypted, err := decryptStream(key, stream)
+			if err != nil {
+				t.Fatalf("%s/%d: %v", aead, size, err)
+			}
+			if !bytes.Equal(plaintext, decrypted) {
+				t.Fatalf("%s/%d: plaintext mismatch", aead, size)
+			}
+
+			r := bytes.NewReader(stream)
+			readHeader, _, err := ReadStreamHeader(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *readHeader != *header {
+				t.Fatalf("bad header: %#v", readHeader)
+			}
+		}
+	}
+}
+
+func TestStream_Tampering(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	header := &StreamHeader{AEAD: StreamAEAD_AES256_GCM, ChunkSize: 64, WrappedKey: "vault:v1:abcd"}
+	plaintext := make([]byte, 200)
+	rand.Read(plaintext)
+	stream := encryptStream(t, key, header, plaintext)
+	rawHeader, _ := header.Marshal()
+	chunk := 64 + 16
+
+	cases := map[string][]byte{
+		// Dropping the final chunk leaves a stream ending on a non-final chunk
+		"truncated":   stream[:len(rawHeader)+3*chunk],
+		"cut":         stream[:len(stream)-1],
+		"trailing":    append(append([]byte{}, stream...), 0),
+		"reordered":   append(append(append(append([]byte{}, rawHeader...), stream[len(rawHeader)+chunk:len(rawHeader)+2*chunk]...), stream[len(rawHeader):len(rawHeader)+chunk]...), stream[len(rawHeader)+2*chunk:]...),
+		"wrapped key": append(append([]byte{}, stream[:len(rawHeader)-1]...), append([]byte{'e'}, stream[len(rawHeader):]...)...),
+	}
+	for name, tampered := range cases {
+		if _, err := decryptStream(key, tampered); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	otherKey := make([]byte, 32)
+	rand.Read(otherKey)
+	if _, err := decryptStream(otherKey, stream); err == nil {
+		t.Fatal("expected error with the wrong key")
+	}
+}
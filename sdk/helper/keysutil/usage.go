@@ -0,0 +1,104 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package keysutil
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// Encryptions are counted in memory while holding the policy's read lock, and
+// persisted with the policy from time to time, as persisting on every
+// encryption would serialize all encryptions.
+
+func (p *Policy) recordEncryption(ver int) {
+	counter, ok := p.pendingEncryptions.Load(ver)
+	if !ok {
+		counter, _ = p.pendingEncryptions.LoadOrStore(ver, new(uint64))
+	}
+	atomic.AddUint64(counter.(*uint64), 1)
+}
+
+// PendingEncryptions returns the number of encryptions not yet persisted
+func (p *Policy) PendingEncryptions() uint64 {
+	var total uint64
+	p.pendingEncryptions.Range(func(_, counter interface{}) bool {
+		total += atomic.LoadUint64(counter.(*uint64))
+		return true
+	})
+	return total
+}
+
+// TakePendingEncryptions returns the encryptions not yet persisted per key
+// version, and resets them. They must be added to the persisted counts of the
+// policy with AddEncryptionCounts, or be given back with
+// RestorePendingEncryptions.
+func (p *Policy) TakePendingEncryptions() map[int]uint64 {
+	counts := map[int]uint64{}
+	p.pendingEncryptions.Range(func(ver, counter interface{}) bool {
+		if n := atomic.SwapUint64(counter.(*uint64), 0); n > 0 {
+			counts[ver.(int)] = n
+		}
+		return true
+	})
+	return counts
+}
+
+// RestorePendingEncryptions gives back encryptions taken with
+// TakePendingEncryptions which could not be persisted
+func (p *Policy) RestorePendingEncryptions(counts map[int]uint64) {
+	for ver, n := range counts {
+		counter, _ := p.pendingEncryptions.LoadOrStore(ver, new(uint64))
+		atomic.AddUint64(counter.(*uint64), n)
+	}
+}
+
+// AddEncryptionCounts adds the given encryptions per key version to the
+// counts persisted with the policy. Encryptions of versions which have been
+// archived are dropped. The policy must be write locked, and persisted
+// afterwards.
+func (p *Policy) AddEncryptionCounts(counts map[int]uint64) {
+	for ver, n := range counts {
+		keyEntry, ok := p.Keys[strconv.Itoa(ver)]
+		if !ok {
+			continue
+		}
+		keyEntry.EncryptionCount += n
+		p.Keys[strconv.Itoa(ver)] = keyEntry
+	}
+}
+
+// RemoveEncryptionCounts takes encryptions added with AddEncryptionCounts
+// back out of the policy, when it could not be persisted with them. They are
+// usually given back with RestorePendingEncryptions. The policy must be write
+// locked.
+func (p *Policy) RemoveEncryptionCounts(counts map[int]uint64) {
+	for ver, n := range counts {
+		keyEntry, ok := p.Keys[strconv.Itoa(ver)]
+		if !ok {
+			continue
+		}
+		if keyEntry.EncryptionCount < n {
+			n = keyEntry.EncryptionCount
+		}
+		keyEntry.EncryptionCount -= n
+		p.Keys[strconv.Itoa(ver)] = keyEntry
+	}
+}
+
+// EncryptionCount returns the number of encryptions performed with the given
+// key version, including those not yet persisted
+func (p *Policy) EncryptionCount(ver int) uint64 {
+	count := p.Keys[strconv.Itoa(ver)].EncryptionCount
+	if counter, ok := p.pendingEncryptions.Load(ver); ok {
+		count += atomic.LoadUint64(counter.(*uint64))
+	}
+	return count
+}
+
+// UsageLimitReached returns whether the latest key version has performed the
+// maximum number of encryptions, and the key should be rotated
+func (p *Policy) UsageLimitReached() bool {
+	return p.MaxEncryptionsPerVersion > 0 && p.EncryptionCount(p.LatestVersion) >= p.MaxEncryptionsPerVersion
+}
@@ -159,6 +159,16 @@ type Paths struct {
 	// On standby nodes, like all storage write operations, this will trigger
 	// an ErrReadOnly return.
 	WriteForwardedStorage []string
+
+	// Stream are the API paths that accept a raw application/octet-stream
+	// request body and write their response directly. Such requests are
+	// handed the HTTP request and response writer, so only builtin backends
+	// can serve them. The body is read by the backend alone: it is neither
+	// buffered nor parsed beforehand, so the listener's max_request_size,
+	// which is enforced while parsing, does not bound it and the backend must
+	// limit what it keeps in memory. Requests with other content types are
+	// handled as usual. The matching rules are the same as for Root.
+	Stream []string
 }
 
 type Auditor interface {
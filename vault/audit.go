@@ -122,6 +122,15 @@ func (c *Core) enableAudit(ctx context.Context, entry *MountEntry, updateStorage
 		return fmt.Errorf("nil audit backend of type %q returned from factory", entry.Type)
 	}
 
+	// Release the backend's resources, such as a spool directory, unless it
+	// ends up registered.
+	registered := false
+	defer func() {
+		if closer, ok := backend.(audit.Closer); ok && !registered {
+			closer.Close()
+		}
+	}()
+
 	if entry.Options["skip_test"] != "true" {
 		// Test the new audit device and report failure if it doesn't work.
 		testProbe, err := c.generateAuditTestProbe()
@@ -129,7 +138,8 @@ func (c *Core) enableAudit(ctx context.Context, entry *MountEntry, updateStorage
 			return err
 		}
 		err = backend.LogTestMessage(ctx, testProbe, entry.Options)
-		if err != nil {
+		// The device's filter may exclude the probe, which is not a failure
+		if err != nil && !errors.Is(err, audit.ErrEntryFiltered) {
 			c.logger.Error("new audit backend failed test", "path", entry.Path, "type", entry.Type, "error", err)
 			return fmt.Errorf("audit backend failed test message: %w", err)
 
@@ -156,6 +166,7 @@ func (c *Core) enableAudit(ctx context.Context, entry *MountEntry, updateStorage
 
 	// Register the backend
 	c.auditBroker.Register(entry.Path, backend, entry.Local)
+	registered = true
 	if c.logger.IsInfo() {
 		c.logger.Info("enabled audit backend", "path", entry.Path, "type", entry.Type)
 	}
@@ -442,6 +453,10 @@ func (c *Core) teardownAudits() error {
 		}
 	}
 
+	if c.auditBroker != nil {
+		c.auditBroker.closeAll()
+	}
+
 	c.audit = nil
 	c.auditBroker = nil
 	return nil
@@ -519,6 +534,12 @@ func (c *Core) newAuditBackend(ctx context.Context, entry *MountEntry, view logi
 				auditLogger.Debug("socket backend options", "path", entry.Path, "address", entry.Options["address"], "socket type", entry.Options["socket_type"])
 			}
 		}
+	case "http":
+		if auditLogger.IsDebug() {
+			if entry.Options != nil {
+				auditLogger.Debug("http backend options", "path", entry.Path, "address", entry.Options["address"], "spool_path", entry.Options["spool_path"])
+			}
+		}
 	case "syslog":
 		if auditLogger.IsDebug() {
 			if entry.Options != nil {
@@ -5,6 +5,7 @@ package vault
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"runtime/debug"
 	"sync"
@@ -49,11 +50,37 @@ func (a *AuditBroker) Register(name string, b audit.Backend, local bool) {
 	}
 }
 
-// Deregister is used to remove an audit backend from the broker
+// Deregister is used to remove an audit backend from the broker, closing it
+// if it holds resources
 func (a *AuditBroker) Deregister(name string) {
 	a.Lock()
-	defer a.Unlock()
+	be, ok := a.backends[name]
 	delete(a.backends, name)
+	a.Unlock()
+
+	if ok {
+		a.closeBackend(name, be.backend)
+	}
+}
+
+// closeAll closes every registered backend which holds resources; it is used
+// when the audit table is torn down.
+func (a *AuditBroker) closeAll() {
+	a.RLock()
+	defer a.RUnlock()
+	for name, be := range a.backends {
+		a.closeBackend(name, be.backend)
+	}
+}
+
+func (a *AuditBroker) closeBackend(name string, b audit.Backend) {
+	closer, ok := b.(audit.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		a.logger.Error("failed to close audit backend", "path", name, "error", err)
+	}
 }
 
 // IsRegistered is used to check if a given audit backend is registered
@@ -87,6 +114,23 @@ func (a *AuditBroker) GetHash(ctx context.Context, name string, input string) (s
 	return be.backend.GetHash(ctx, input)
 }
 
+// GetHashChainHead returns the chain state recorded after the last entry the
+// named backend wrote, or nil if it does not chain its entries.
+func (a *AuditBroker) GetHashChainHead(ctx context.Context, name string) (*audit.HashChain, error) {
+	a.RLock()
+	defer a.RUnlock()
+	be, ok := a.backends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown audit backend %q", name)
+	}
+
+	chainer, ok := be.backend.(audit.HashChainer)
+	if !ok {
+		return nil, nil
+	}
+	return chainer.HashChainHead(ctx)
+}
+
 // LogRequest is used to ensure all the audit backends have an opportunity to
 // log the given request and that *at least one* succeeds.
 func (a *AuditBroker) LogRequest(ctx context.Context, in *logical.LogInput, headersConfig *AuditedHeadersConfig) (ret error) {
@@ -131,7 +175,8 @@ func (a *AuditBroker) LogRequest(ctx context.Context, in *logical.LogInput, head
 		in.Request.Headers = headers
 	}()
 
-	// Ensure at least one backend logs
+	// Ensure at least one backend logs; entries excluded by a device's filter
+	// are not written, so they do not count
 	anyLogged := false
 	for name, be := range a.backends {
 		in.Request.Headers = nil
@@ -145,9 +190,11 @@ func (a *AuditBroker) LogRequest(ctx context.Context, in *logical.LogInput, head
 		start := time.Now()
 		lrErr := be.backend.LogRequest(ctx, in)
 		metrics.MeasureSince([]string{"audit", name, "log_request"}, start)
-		if lrErr != nil {
+		switch {
+		case errors.Is(lrErr, audit.ErrEntryFiltered):
+		case lrErr != nil:
 			a.logger.Error("backend failed to log request", "backend", name, "error", lrErr)
-		} else {
+		default:
 			anyLogged = true
 		}
 	}
@@ -196,7 +243,8 @@ func (a *AuditBroker) LogResponse(ctx context.Context, in *logical.LogInput, hea
 		in.Request.Headers = headers
 	}()
 
-	// Ensure at least one backend logs
+	// Ensure at least one backend logs; entries excluded by a device's filter
+	// are not written, so they do not count
 	anyLogged := false
 	for name, be := range a.backends {
 		in.Request.Headers = nil
@@ -210,9 +258,11 @@ func (a *AuditBroker) LogResponse(ctx context.Context, in *logical.LogInput, hea
 		start := time.Now()
 		lrErr := be.backend.LogResponse(ctx, in)
 		metrics.MeasureSince([]string{"audit", name, "log_response"}, start)
-		if lrErr != nil {
+		switch {
+		case errors.Is(lrErr, audit.ErrEntryFiltered):
+		case lrErr != nil:
 			a.logger.Error("backend failed to log response", "backend", name, "error", lrErr)
-		} else {
+		default:
 			anyLogged = true
 		}
 	}
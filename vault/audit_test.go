@@ -423,6 +423,12 @@ func TestAuditBroker_LogRequest(t *testing.T) {
 	if err := b.LogRequest(ctx, logInput, headersConf); !errwrap.Contains(err, "no audit backend succeeded in logging the request") {
 		t.Fatalf("err: %v", err)
 	}
+
+	// Should FAIL when the other backend's filter excludes the request
+	a2.ReqErr = audit.ErrEntryFiltered
+	if err := b.LogRequest(ctx, logInput, headersConf); !errwrap.Contains(err, "no audit backend succeeded in logging the request") {
+		t.Fatalf("err: %v", err)
+	}
 }
 
 func TestAuditBroker_LogResponse(t *testing.T) {
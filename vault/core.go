@@ -2319,6 +2319,12 @@ func (s standardUnsealStrategy) unseal(ctx context.Context, logger log.Logger, c
 	if err := c.setupQuotas(ctx, false); err != nil {
 		return err
 	}
+	if err := c.setupEventJournal(ctx); err != nil {
+		return err
+	}
+	if err := c.setupEventSinks(ctx); err != nil {
+		return err
+	}
 	if err := c.setupHeaderHMACKey(ctx, false); err != nil {
 		return err
 	}
@@ -2555,6 +2561,8 @@ func (c *Core) preSeal() error {
 	if err := c.teardownAudits(); err != nil {
 		result = multierror.Append(result, fmt.Errorf("error tearing down audits: %w", err))
 	}
+	c.teardownEventSinks()
+	c.teardownEventJournal()
 	if err := c.stopExpiration(); err != nil {
 		result = multierror.Append(result, fmt.Errorf("error stopping expiration: %w", err))
 	}
@@ -3260,6 +3268,18 @@ func (c *Core) MatchingMount(ctx context.Context, reqPath string) string {
 	return c.router.MatchingMount(ctx, reqPath)
 }
 
+// IsStreamPath reports whether the backend mounted at the request path accepts
+// raw request streams on it.
+func (c *Core) IsStreamPath(ctx context.Context, reqPath string) bool {
+	return c.router.StreamPath(ctx, reqPath)
+}
+
+// IsLoginPath reports whether the backend mounted at the request path serves
+// logins on it.
+func (c *Core) IsLoginPath(ctx context.Context, reqPath string) bool {
+	return c.router.LoginPath(ctx, reqPath)
+}
+
 func (c *Core) setupQuotas(ctx context.Context, isPerfStandby bool) error {
 	if c.quotaManager == nil {
 		return nil
@@ -3290,6 +3310,68 @@ func (c *Core) ApplyRateLimitQuota(ctx context.Context, req *quotas.Request) (qu
 	return resp, nil
 }
 
+// ApplyConcurrencyQuota checks the request against the applicable concurrency
+// quota, waiting for a slot if the quota allows queueing. Paths exempt from rate
+// limiting are exempt from concurrency quotas as well. If the response has an
+// Access, it must be released with quotas.Release once the request is done.
+func (c *Core) ApplyConcurrencyQuota(ctx context.Context, req *quotas.Request) (quotas.Response, error) {
+	req.Type = quotas.TypeConcurrency
+
+	resp := quotas.Response{
+		Allowed: true,
+	}
+
+	if c.quotaManager != nil {
+		if c.quotaManager.RateLimitPathExempt(req.Path) {
+			return resp, nil
+		}
+
+		return c.quotaManager.ApplyQuota(ctx, req)
+	}
+
+	return resp, nil
+}
+
+// ResolveRateLimitQuotaIdentity sets the entity ID and token accessor of the
+// token a request is made with on the quota request, when the rate limit quota
+// that applies to the request is keyed by them. Tokens that cannot be looked up
+// are ignored, as the request is rejected later on if the token is invalid, and
+// the request is limited by its client address instead.
+func (c *Core) ResolveRateLimitQuotaIdentity(ctx context.Context, req *quotas.Request, token string) {
+	if c.quotaManager == nil || token == "" {
+		return
+	}
+
+	quota, err := c.quotaManager.QueryQuota(&quotas.Request{
+		Type:          quotas.TypeRateLimit,
+		Path:          req.Path,
+		MountPath:     req.MountPath,
+		Role:          req.Role,
+		NamespacePath: req.NamespacePath,
+	})
+	if err != nil || quota == nil {
+		return
+	}
+	rlq, ok := quota.(*quotas.RateLimitQuota)
+	if !ok || !rlq.KeyedByToken() {
+		return
+	}
+
+	// Looking up a token may cost a storage read, so it is only done while
+	// the client address, which requests with invalid tokens are limited by,
+	// has room left. Otherwise the request is limited by its address.
+	if rlq.ClientAddressExhausted(ctx, req.ClientAddress) {
+		return
+	}
+
+	te, err := c.LookupToken(ctx, token)
+	if err != nil || te == nil {
+		return
+	}
+	req.EntityID = te.EntityID
+	req.TokenAccessor = te.Accessor
+}
+
 // RateLimitAuditLoggingEnabled returns if the quota configuration allows audit
 // logging of request rejections due to rate limiting quota rule violations.
 func (c *Core) RateLimitAuditLoggingEnabled() bool {
@@ -8,6 +8,8 @@ package vault
 import (
 	"context"
 	"fmt"
+	"path"
+	"strings"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/helper/namespace"
@@ -162,20 +164,125 @@ func (c *Core) initSealsForMigration() {}
 
 func (c *Core) postSealMigration(ctx context.Context) error { return nil }
 
-func (c *Core) applyLeaseCountQuota(_ context.Context, in *quotas.Request) (*quotas.Response, error) {
-	return &quotas.Response{Allowed: true}, nil
+func (c *Core) applyLeaseCountQuota(ctx context.Context, in *quotas.Request) (*quotas.Response, error) {
+	if c.quotaManager == nil {
+		return &quotas.Response{Allowed: true}, nil
+	}
+
+	in.Type = quotas.TypeLeaseCount
+	resp, err := c.quotaManager.ApplyQuota(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
 }
 
-func (c *Core) ackLeaseQuota(access quotas.Access, leaseGenerated bool) error {
-	return nil
+// ackLeaseQuota releases the reservation a lease count quota made for a
+// request about to create a lease. The lease itself is counted when the
+// expiration manager registers it.
+func (c *Core) ackLeaseQuota(access quotas.Access) error {
+	if c.quotaManager == nil || access == nil {
+		return nil
+	}
+	return c.quotaManager.AckLease(access)
 }
 
+// quotaLeaseWalker calls the callback with the quota request of every lease
+// that counts against lease count quotas, so that the quota manager can
+// recompute the counters.
 func (c *Core) quotaLeaseWalker(ctx context.Context, callback func(request *quotas.Request) bool) error {
-	return nil
+	m := c.expiration
+	if m == nil {
+		return nil
+	}
+
+	var walkErr error
+	walk := func(leaseID, role string) bool {
+		req, err := c.quotaRequestFromLease(ctx, leaseID, role)
+		if err != nil {
+			walkErr = err
+			return false
+		}
+		if req == nil {
+			return true
+		}
+		return callback(req)
+	}
+
+	m.pending.Range(func(key, value interface{}) bool {
+		return walk(key.(string), value.(pendingInfo).loginRole)
+	})
+	if walkErr != nil {
+		return walkErr
+	}
+
+	m.irrevocable.Range(func(key, value interface{}) bool {
+		var role string
+		if le, ok := value.(*leaseEntry); ok && le != nil {
+			role = le.LoginRole
+		}
+		return walk(key.(string), role)
+	})
+
+	return walkErr
 }
 
+// quotasHandleLeases updates lease count quotas with leases the expiration
+// manager loaded, created or deleted.
 func (c *Core) quotasHandleLeases(ctx context.Context, action quotas.LeaseAction, leases []*quotas.QuotaLeaseInformation) error {
-	return nil
+	if c.quotaManager == nil {
+		return nil
+	}
+
+	reqs := make([]*quotas.Request, 0, len(leases))
+	for _, lease := range leases {
+		// Non-expiring tokens are not counted, as they are never deleted
+		// through the expiration manager
+		if action == quotas.LeaseActionLoaded && c.expiration != nil {
+			if _, ok := c.expiration.nonexpiring.Load(lease.LeaseId); ok {
+				continue
+			}
+		}
+
+		req, err := c.quotaRequestFromLease(ctx, lease.LeaseId, lease.Role)
+		if err != nil {
+			return err
+		}
+		if req != nil {
+			reqs = append(reqs, req)
+		}
+	}
+
+	return c.quotaManager.HandleLeases(action, reqs)
+}
+
+// quotaRequestFromLease returns the quota request that would have created the
+// lease. It returns nil if the lease's namespace no longer exists.
+func (c *Core) quotaRequestFromLease(ctx context.Context, leaseID, role string) (*quotas.Request, error) {
+	leaseID, nsID := namespace.SplitIDFromString(leaseID)
+
+	ns := namespace.RootNamespace
+	if nsID != "" {
+		var err error
+		ns, err = NamespaceByID(ctx, nsID, c)
+		if err != nil {
+			return nil, err
+		}
+		if ns == nil {
+			return nil, nil
+		}
+	}
+
+	reqPath := path.Dir(leaseID)
+	mountPath := c.router.MatchingMount(namespace.ContextWithNamespace(ctx, ns), reqPath)
+
+	return &quotas.Request{
+		Type:          quotas.TypeLeaseCount,
+		Path:          reqPath,
+		MountPath:     strings.TrimPrefix(mountPath, ns.Path),
+		Role:          role,
+		NamespacePath: ns.Path,
+	}, nil
 }
 
 func (c *Core) namespaceByPath(path string) *namespace.Namespace {
@@ -0,0 +1,180 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+// estEnrollPathRegex matches the enrollment endpoints of the EST (RFC 7030)
+// API of the PKI secrets engine, relative to the mount.
+var estEnrollPathRegex = regexp.MustCompile(`^((roles/[^/]+/)|(issuer/[^/]+/)|(issuer/[^/]+/roles/[^/]+/))?est/(simpleenroll|simplereenroll)$`)
+
+type estAuthenticator struct {
+	Accessor string `mapstructure:"accessor"`
+	CertRole string `mapstructure:"cert_role"`
+}
+
+// loginEstRequest authenticates EST enrollment requests that do not carry a
+// Vault token. EST clients authenticate with HTTP Basic credentials or a TLS
+// client certificate, which are exchanged for a token by logging in against
+// the auth mounts configured in the PKI mount's config/est. The token then
+// goes through the usual ACL checks of the enrollment path, and is returned so
+// that it can be revoked with revokeEstToken once the request is done. A
+// non-nil response is returned when the client must be challenged for
+// credentials.
+func (c *Core) loginEstRequest(ctx context.Context, req *logical.Request) (*logical.Response, string, error) {
+	if req.ClientToken != "" || req.Operation != logical.UpdateOperation || req.MountPoint == "" {
+		return nil, "", nil
+	}
+
+	entry := c.router.MatchingMountEntry(ctx, req.Path)
+	if entry == nil || entry.Table != mountTableType || entry.Type != "pki" {
+		return nil, "", nil
+	}
+	if !estEnrollPathRegex.MatchString(strings.TrimPrefix(req.Path, req.MountPoint)) {
+		return nil, "", nil
+	}
+
+	configResp, err := c.router.Route(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      req.MountPoint + "config/est",
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read EST configuration: %w", err)
+	}
+	if configResp == nil || configResp.IsError() {
+		return nil, "", nil
+	}
+	if enabled, _ := configResp.Data["enabled"].(bool); !enabled {
+		return nil, "", nil
+	}
+
+	var authenticators map[string]estAuthenticator
+	if err := mapstructure.Decode(configResp.Data["authenticators"], &authenticators); err != nil {
+		return nil, "", fmt.Errorf("failed to decode EST authenticators: %w", err)
+	}
+
+	userpassAuthenticator, hasUserpass := authenticators["userpass"]
+	certAuthenticator, hasCert := authenticators["cert"]
+	username, password, hasBasicAuth := basicAuth(req)
+	hasClientCert := req.Connection != nil && req.Connection.ConnState != nil && len(req.Connection.ConnState.PeerCertificates) > 0
+
+	var loginReq *logical.Request
+	switch {
+	case hasBasicAuth && hasUserpass:
+		if strings.Contains(username, "/") {
+			return estBasicAuthChallenge(), "", nil
+		}
+		authPath, err := c.estAuthenticatorPath(ctx, userpassAuthenticator.Accessor, "userpass")
+		if err != nil {
+			return nil, "", err
+		}
+		loginReq = &logical.Request{
+			Path: authPath + "login/" + username,
+			Data: map[string]interface{}{
+				"password": password,
+			},
+		}
+	case hasClientCert && hasCert:
+		authPath, err := c.estAuthenticatorPath(ctx, certAuthenticator.Accessor, "cert")
+		if err != nil {
+			return nil, "", err
+		}
+		loginReq = &logical.Request{
+			Path: authPath + "login",
+			Data: map[string]interface{}{
+				"name": certAuthenticator.CertRole,
+			},
+		}
+	case hasUserpass:
+		return estBasicAuthChallenge(), "", nil
+	default:
+		return nil, "", nil
+	}
+
+	loginReq.ID, err = uuid.GenerateUUID()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate identifier for the EST login request: %w", err)
+	}
+	loginReq.Operation = logical.UpdateOperation
+	loginReq.Connection = req.Connection
+
+	resp, err := c.handleCancelableRequest(ctx, loginReq)
+	if errors.Is(err, logical.ErrPerfStandbyPleaseForward) {
+		return nil, "", err
+	}
+	if err != nil || resp == nil || resp.IsError() || resp.Auth == nil || resp.Auth.ClientToken == "" {
+		c.logger.Debug("EST login failed", "mount_point", req.MountPoint, "error", err)
+		if hasUserpass {
+			return estBasicAuthChallenge(), "", nil
+		}
+		return nil, "", logical.ErrPermissionDenied
+	}
+
+	req.ClientToken = resp.Auth.ClientToken
+	req.ClientTokenSource = logical.ClientTokenFromVaultHeader
+
+	// Batch tokens are not stored, so there is nothing to revoke
+	if resp.Auth.TokenType == logical.TokenTypeBatch {
+		return nil, "", nil
+	}
+	return nil, resp.Auth.ClientToken, nil
+}
+
+// revokeEstToken revokes the token an EST client was logged in with, along
+// with its lease, so that every enrollment does not leave one behind.
+// Enrollments do not create leases, so nothing issued with it is revoked.
+func (c *Core) revokeEstToken(ctx context.Context, token string) {
+	te, err := c.tokenStore.Lookup(ctx, token)
+	if err == nil && te != nil {
+		err = c.tokenStore.revokeOrphan(ctx, te.ID)
+	}
+	if err != nil {
+		c.logger.Warn("failed to revoke EST login token", "error", err)
+	}
+}
+
+// estBasicAuthChallenge asks the client to retry with HTTP Basic credentials,
+// as described in RFC 7030 Section 3.2.3.
+func estBasicAuthChallenge() *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:            http.StatusUnauthorized,
+			logical.HTTPContentType:           "text/plain",
+			logical.HTTPRawBody:               []byte("authentication required"),
+			logical.HTTPWWWAuthenticateHeader: `Basic realm="vault"`,
+		},
+	}
+}
+
+// estAuthenticatorPath returns the login path prefix of the auth mount with
+// the given accessor, which must be of the expected type and live in the
+// namespace of the request.
+func (c *Core) estAuthenticatorPath(ctx context.Context, accessor, mountType string) (string, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	entry := c.router.MatchingMountByAccessor(accessor)
+	if entry == nil || entry.Table != credentialTableType || entry.NamespaceID != ns.ID {
+		return "", fmt.Errorf("EST authenticator references unknown auth mount accessor %q", accessor)
+	}
+	if entry.Type != mountType {
+		return "", fmt.Errorf("EST authenticator auth mount %q is of type %q, expected %q", accessor, entry.Type, mountType)
+	}
+
+	return credentialRoutePrefix + entry.Path, nil
+}
@@ -28,6 +28,10 @@ const (
 	// based on what each subscriber is interested in.
 	eventTypeAll   = "*"
 	defaultTimeout = 60 * time.Second
+
+	// defaultReplayBuffer is the number of live events held for a
+	// subscription resumed from the journal while it is behind
+	defaultReplayBuffer = 1000
 )
 
 var (
@@ -44,6 +48,9 @@ type EventBus struct {
 	started         atomic.Bool
 	formatterNodeID eventlogger.NodeID
 	timeout         time.Duration
+	replayBuffer    int
+	journal         atomic.Pointer[Journal]
+	sinks           atomic.Pointer[SinkManager]
 }
 
 type pluginEventBus struct {
@@ -58,6 +65,9 @@ type asyncChanNode struct {
 	ch     chan *eventlogger.Event
 	logger hclog.Logger
 
+	// authorize, if set, decides whether each event is delivered
+	authorize func(ctx context.Context, event *logical.EventReceived) bool
+
 	// used to close the connection
 	closeOnce  sync.Once
 	cancelFunc context.CancelFunc
@@ -100,6 +110,17 @@ func (bus *EventBus) SendInternal(ctx context.Context, ns *namespace.Namespace,
 	}
 	bus.logger.Info("Sending event", "event", eventReceived)
 
+	// Journal the event before sending it, so that a subscriber replaying
+	// the journal concurrently sees it either there or live. An event that
+	// cannot be journaled is still delivered to current subscribers; only a
+	// later replay will miss it.
+	if journal := bus.journal.Load(); journal != nil {
+		if err := journal.append(ctx, ns.ID, eventReceived, time.Now()); err != nil {
+			bus.logger.Error("error writing event to journal", "namespace", ns.Path, "event_type", eventType, "error", err)
+			metrics.IncrCounter([]string{"events", "journal", "write_failure"}, 1)
+		}
+	}
+
 	// We can't easily know when the Send is complete, so we can't call the cancel function.
 	// But, it is called automatically after bus.timeout, so there won't be any leak as long as bus.timeout is not too long.
 	ctx, _ = context.WithTimeout(ctx, bus.timeout)
@@ -167,38 +188,204 @@ func NewEventBus(logger hclog.Logger) (*EventBus, error) {
 		broker:          broker,
 		formatterNodeID: formatterNodeID,
 		timeout:         defaultTimeout,
+		replayBuffer:    defaultReplayBuffer,
 	}, nil
 }
 
+// SubscribeOptions configures a subscription beyond the event types it
+// receives.
+type SubscribeOptions struct {
+	// Filter is an expression over the event's metadata that events must
+	// match to be delivered; see NewFilter.
+	Filter string
+
+	// LastEventID, if set, replays the events sent after it from the
+	// namespace's journal before delivering live events; see SubscribeFrom.
+	LastEventID string
+
+	// IncludeChildNamespaces also delivers the events sent in the
+	// namespace's descendants.
+	IncludeChildNamespaces bool
+
+	// Authorize, if set, is called with each event that matches the
+	// subscription, which is only delivered if it returns true. It is not
+	// called while the event is being sent, so it may be slow.
+	Authorize func(ctx context.Context, event *logical.EventReceived) bool
+}
+
+// Subscribe returns a channel of the events sent in the namespace whose type
+// matches pattern.
 func (bus *EventBus) Subscribe(ctx context.Context, ns *namespace.Namespace, pattern string) (<-chan *eventlogger.Event, context.CancelFunc, error) {
+	return bus.SubscribeWithOptions(ctx, ns, pattern, SubscribeOptions{})
+}
+
+// SubscribeFrom is like Subscribe, but first delivers the events that were
+// sent after the event with the given ID, as recorded in the namespace's
+// event journal. Events are not delivered twice if they are sent while the
+// journal is being replayed. If the event is no longer in the journal,
+// ErrJournalCursorNotFound is returned rather than silently skipping the
+// events in between.
+//
+// Live events are held while the subscriber is behind. If more of them
+// arrive than are held, the subscription is cancelled and the channel is
+// closed, so that the subscriber can resume from the last event it received
+// rather than miss events.
+func (bus *EventBus) SubscribeFrom(ctx context.Context, ns *namespace.Namespace, pattern string, lastEventID string) (<-chan *eventlogger.Event, context.CancelFunc, error) {
+	return bus.SubscribeWithOptions(ctx, ns, pattern, SubscribeOptions{LastEventID: lastEventID})
+}
+
+// SubscribeWithOptions returns a channel of the events sent in the namespace
+// whose type matches pattern, as configured by opts.
+func (bus *EventBus) SubscribeWithOptions(ctx context.Context, ns *namespace.Namespace, pattern string, opts SubscribeOptions) (<-chan *eventlogger.Event, context.CancelFunc, error) {
+	filter, err := parseFilter(opts.Filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.LastEventID == "" {
+		return bus.subscribe(ctx, ns, pattern, filter, opts)
+	}
+
+	// Each namespace has its own journal, and events sent in different
+	// namespaces cannot be put back in order
+	if opts.IncludeChildNamespaces {
+		return nil, nil, ErrJournalChildNamespaces
+	}
+
+	journal := bus.journal.Load()
+	if journal == nil {
+		return nil, nil, ErrJournalDisabled
+	}
+
+	// Subscribe before reading the journal, so that no event falls between
+	// the two
+	ctx, cancelReplay := context.WithCancel(ctx)
+	live, err := bus.subscribeNode(ctx, ns, pattern, filter, opts)
+	if err != nil {
+		cancelReplay()
+		return nil, nil, err
+	}
+	cancel := func() {
+		live.Close()
+		cancelReplay()
+	}
+
+	missed, err := journal.since(ctx, ns.ID, opts.LastEventID)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	filterNode := newFilterNode(ns, pattern, filter, opts.IncludeChildNamespaces)
+	replay := make([]*eventlogger.Event, 0, len(missed))
+	replayed := make(map[string]struct{}, len(missed))
+	for _, e := range missed {
+		keep, err := filterNode.Predicate(e)
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		if keep {
+			replay = append(replay, e)
+			replayed[e.Payload.(*logical.EventReceived).ID()] = struct{}{}
+		}
+	}
+
+	ch := make(chan *eventlogger.Event)
+	go func() {
+		defer close(ch)
+		defer cancel()
+
+		// Live events are always read, so that the live subscription does
+		// not time out while the subscriber catches up, and are held behind
+		// the replayed events until they can be delivered.
+		pending := replay
+		replayLeft := len(replay)
+		var next *eventlogger.Event
+		for {
+			if next == nil && len(pending) > 0 {
+				e := pending[0]
+				pending = pending[1:]
+				if replayLeft > 0 {
+					replayLeft--
+					// Live events are authorized by the subscription's sink node
+					if opts.Authorize != nil && !opts.Authorize(ctx, e.Payload.(*logical.EventReceived)) {
+						continue
+					}
+				}
+				next = e
+			}
+
+			var out chan<- *eventlogger.Event
+			if next != nil {
+				out = ch
+			}
+
+			select {
+			case out <- next:
+				next = nil
+			case e := <-live.ch:
+				id := e.Payload.(*logical.EventReceived).ID()
+				if _, ok := replayed[id]; ok {
+					delete(replayed, id)
+					continue
+				}
+				if len(pending)-replayLeft >= bus.replayBuffer {
+					bus.logger.Info("Subscriber resumed from the journal fell too far behind, closing")
+					return
+				}
+				pending = append(pending, e)
+			case <-live.ctx.Done():
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, cancel, nil
+}
+
+func (bus *EventBus) subscribe(ctx context.Context, ns *namespace.Namespace, pattern string, filter *Filter, opts SubscribeOptions) (<-chan *eventlogger.Event, context.CancelFunc, error) {
+	asyncNode, err := bus.subscribeNode(ctx, ns, pattern, filter, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return asyncNode.ch, asyncNode.Close, nil
+}
+
+// subscribeNode registers a pipeline delivering the matching events to a
+// new sink node, which is returned.
+func (bus *EventBus) subscribeNode(ctx context.Context, ns *namespace.Namespace, pattern string, filter *Filter, opts SubscribeOptions) (*asyncChanNode, error) {
 	// subscriptions are still stored even if the bus has not been started
 	pipelineID, err := uuid.GenerateUUID()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	filterNodeID, err := uuid.GenerateUUID()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	filterNode := newFilterNode(ns, pattern)
+	filterNode := newFilterNode(ns, pattern, filter, opts.IncludeChildNamespaces)
 	err = bus.broker.RegisterNode(eventlogger.NodeID(filterNodeID), filterNode)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	sinkNodeID, err := uuid.GenerateUUID()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	asyncNode := newAsyncNode(ctx, bus.logger)
+	asyncNode.authorize = opts.Authorize
 	err = bus.broker.RegisterNode(eventlogger.NodeID(sinkNodeID), asyncNode)
 	if err != nil {
 		defer cancel()
-		return nil, nil, err
+		return nil, err
 	}
 
 	nodes := []eventlogger.NodeID{eventlogger.NodeID(filterNodeID), bus.formatterNodeID, eventlogger.NodeID(sinkNodeID)}
@@ -211,14 +398,35 @@ func (bus *EventBus) Subscribe(ctx context.Context, ns *namespace.Namespace, pat
 	err = bus.broker.RegisterPipeline(pipeline)
 	if err != nil {
 		defer cancel()
-		return nil, nil, err
+		return nil, err
 	}
 
 	addSubscriptions(1)
 	// add info needed to cancel the subscription
 	asyncNode.pipelineID = eventlogger.PipelineID(pipelineID)
 	asyncNode.cancelFunc = cancel
-	return asyncNode.ch, asyncNode.Close, nil
+	return asyncNode, nil
+}
+
+// LoadJournal loads the event journal from storage and starts recording
+// events in the namespaces that have it enabled.
+func (bus *EventBus) LoadJournal(ctx context.Context, storage logical.Storage) error {
+	journal, err := newJournal(ctx, storage, bus.logger.Named("journal"))
+	if err != nil {
+		return err
+	}
+	bus.journal.Store(journal)
+	return nil
+}
+
+// UnloadJournal stops recording events in the event journal.
+func (bus *EventBus) UnloadJournal() {
+	bus.journal.Store(nil)
+}
+
+// Journal returns the event journal, or nil if it has not been loaded.
+func (bus *EventBus) Journal() *Journal {
+	return bus.journal.Load()
 }
 
 // SetSendTimeout sets the timeout of sending events. If the events are not accepted by the
@@ -227,14 +435,27 @@ func (bus *EventBus) SetSendTimeout(timeout time.Duration) {
 	bus.timeout = timeout
 }
 
-func newFilterNode(ns *namespace.Namespace, pattern string) *eventlogger.Filter {
+// parseFilter returns nil if the expression is empty, which matches every
+// event.
+func parseFilter(bexprFilter string) (*Filter, error) {
+	if strings.TrimSpace(bexprFilter) == "" {
+		return nil, nil
+	}
+	return NewFilter(bexprFilter)
+}
+
+func newFilterNode(ns *namespace.Namespace, pattern string, filter *Filter, includeChildNamespaces bool) *eventlogger.Filter {
 	return &eventlogger.Filter{
 		Predicate: func(e *eventlogger.Event) (bool, error) {
 			eventRecv := e.Payload.(*logical.EventReceived)
 
-			// Drop if event is not in our namespace.
-			// TODO: add wildcard/child namespace processing here in some cases?
-			if eventRecv.Namespace != ns.Path {
+			// Drop if event is not in our namespace, or one of its children
+			// if asked for.
+			if includeChildNamespaces {
+				if !strings.HasPrefix(eventRecv.Namespace, ns.Path) {
+					return false, nil
+				}
+			} else if eventRecv.Namespace != ns.Path {
 				return false, nil
 			}
 
@@ -243,6 +464,15 @@ func newFilterNode(ns *namespace.Namespace, pattern string) *eventlogger.Filter
 				return false, nil
 			}
 
+			// Filter on the event's metadata. An event the expression cannot
+			// be evaluated against is not one the subscriber asked for.
+			if filter != nil {
+				matches, err := filter.Matches(eventRecv)
+				if err != nil || !matches {
+					return false, nil
+				}
+			}
+
 			return true, nil
 		},
 	}
@@ -273,6 +503,10 @@ func (node *asyncChanNode) Close() {
 func (node *asyncChanNode) Process(ctx context.Context, e *eventlogger.Event) (*eventlogger.Event, error) {
 	// sends to the channel async in another goroutine
 	go func() {
+		if node.authorize != nil && !node.authorize(node.ctx, e.Payload.(*logical.EventReceived)) {
+			return
+		}
+
 		var timeout bool
 		select {
 		case node.ch <- e:
@@ -14,6 +14,7 @@ import (
 	"github.com/hashicorp/go-secure-stdlib/strutil"
 	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/sdk/logical"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // TestBusBasics tests that basic event sending and subscribing function.
@@ -377,3 +378,128 @@ func TestBusWildcardSubscriptions(t *testing.T) {
 		t.Error("Timeout waiting for event2")
 	}
 }
+
+// TestBusFilterSubscriptions tests that a subscription with a filter
+// expression only receives the events whose metadata match it.
+func TestBusFilterSubscriptions(t *testing.T) {
+	bus, err := NewEventBus(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	bus.Start()
+
+	if _, _, err := bus.SubscribeWithOptions(ctx, namespace.RootNamespace, "*", SubscribeOptions{Filter: `unknown == "x"`}); err == nil {
+		t.Fatal("expected an invalid filter to be rejected")
+	}
+
+	ch, cancel, err := bus.SubscribeWithOptions(ctx, namespace.RootNamespace, "kv*", SubscribeOptions{Filter: `data_path matches "^secret/app/"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	pluginInfo := &logical.EventPluginInfo{Plugin: "kv", MountPath: "secret/"}
+	send := func(path string) string {
+		event, err := logical.NewEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		event.Metadata, err = structpb.NewStruct(map[string]interface{}{"path": path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bus.SendInternal(ctx, namespace.RootNamespace, pluginInfo, "kv/write", event); err != nil {
+			t.Fatal(err)
+		}
+		return event.Id
+	}
+
+	send("other/foo")
+	expected := send("app/foo")
+
+	timeout := time.After(1 * time.Second)
+	select {
+	case message := <-ch:
+		if id := message.Payload.(*logical.EventReceived).Event.Id; id != expected {
+			t.Errorf("Expected event %s but got %s", expected, id)
+		}
+	case <-timeout:
+		t.Fatal("Timeout waiting for event")
+	}
+
+	select {
+	case message := <-ch:
+		t.Errorf("Got unexpected message: %v", message)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestBusChildNamespaceSubscriptions tests that a subscription can receive
+// the events of child namespaces, and that the events it is not authorized
+// to receive are dropped.
+func TestBusChildNamespaceSubscriptions(t *testing.T) {
+	bus, err := NewEventBus(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	bus.Start()
+
+	ns1 := &namespace.Namespace{ID: "ns1", Path: "ns1/"}
+	ns2 := &namespace.Namespace{ID: "ns2", Path: "ns1/ns2/"}
+	other := &namespace.Namespace{ID: "other", Path: "other/"}
+
+	ch, cancel, err := bus.SubscribeWithOptions(ctx, ns1, "*", SubscribeOptions{
+		IncludeChildNamespaces: true,
+		Authorize: func(_ context.Context, event *logical.EventReceived) bool {
+			return event.Event.Note != "denied"
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	send := func(ns *namespace.Namespace, note string) string {
+		event, err := logical.NewEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		event.Note = note
+		if err := bus.SendInternal(ctx, ns, nil, "kv/write", event); err != nil {
+			t.Fatal(err)
+		}
+		return event.Id
+	}
+
+	expected := []string{send(ns1, ""), send(ns2, "")}
+	send(ns2, "denied")
+	send(other, "")
+
+	timeout := time.After(1 * time.Second)
+	var seen []string
+	for len(seen) < len(expected) {
+		select {
+		case message := <-ch:
+			seen = append(seen, message.Payload.(*logical.EventReceived).Event.Id)
+		case <-timeout:
+			t.Fatalf("Timeout waiting for events, got %v", seen)
+		}
+	}
+	for _, id := range expected {
+		if !strutil.StrListContains(seen, id) {
+			t.Errorf("Did not receive event %s", id)
+		}
+	}
+
+	select {
+	case message := <-ch:
+		t.Errorf("Got unexpected message: %v", message)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, _, err := bus.SubscribeWithOptions(ctx, ns1, "*", SubscribeOptions{IncludeChildNamespaces: true, LastEventID: expected[0]}); err != ErrJournalChildNamespaces {
+		t.Fatalf("Expected ErrJournalChildNamespaces, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package eventbus
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-bexpr"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Filter decides which events a subscription receives, by evaluating a
+// boolean expression (see https://github.com/hashicorp/go-bexpr) over the
+// event's metadata.
+type Filter struct {
+	expression string
+	evaluator  *bexpr.Evaluator
+}
+
+// filterDatum holds the properties of an event that a filter expression can
+// select on.
+type filterDatum struct {
+	EventType     string            `bexpr:"event_type"`
+	Namespace     string            `bexpr:"namespace"`
+	Plugin        string            `bexpr:"plugin"`
+	PluginVersion string            `bexpr:"plugin_version"`
+	MountClass    string            `bexpr:"mount_class"`
+	MountPath     string            `bexpr:"mount_path"`
+	MountAccessor string            `bexpr:"mount_accessor"`
+	DataPath      string            `bexpr:"data_path"`
+	EntityIDs     []string          `bexpr:"entity_ids"`
+	Metadata      map[string]string `bexpr:"metadata"`
+}
+
+// NewFilter parses a filter expression such as
+//
+//	mount_path == "secret/" and data_path matches "secret/data/app/.*"
+//
+// Selectors are checked here, so that a typo is reported when subscribing
+// rather than silently dropping every event.
+func NewFilter(expression string) (*Filter, error) {
+	evaluator, err := bexpr.CreateEvaluator(expression)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing filter: %w", err)
+	}
+
+	if _, err := evaluator.Evaluate(filterDatum{}); err != nil {
+		return nil, fmt.Errorf("error validating filter: %w", err)
+	}
+
+	return &Filter{
+		expression: expression,
+		evaluator:  evaluator,
+	}, nil
+}
+
+// Matches reports whether the event should be delivered.
+func (f *Filter) Matches(event *logical.EventReceived) (bool, error) {
+	return f.evaluator.Evaluate(newFilterDatum(event))
+}
+
+// String returns the filter expression.
+func (f *Filter) String() string {
+	return f.expression
+}
+
+// newFilterDatum flattens an event for filtering. Metadata values that are
+// not strings are selected by their JSON form.
+func newFilterDatum(event *logical.EventReceived) filterDatum {
+	datum := filterDatum{
+		EventType: event.EventType,
+		Namespace: event.Namespace,
+		DataPath:  DataPath(event),
+		Metadata:  map[string]string{},
+	}
+
+	if pluginInfo := event.PluginInfo; pluginInfo != nil {
+		datum.Plugin = pluginInfo.Plugin
+		datum.PluginVersion = pluginInfo.PluginVersion
+		datum.MountClass = pluginInfo.MountClass
+		datum.MountPath = pluginInfo.MountPath
+		datum.MountAccessor = pluginInfo.MountAccessor
+	}
+
+	if data := event.Event; data != nil {
+		datum.EntityIDs = data.EntityIds
+		for k, v := range data.GetMetadata().GetFields() {
+			if s, ok := v.AsInterface().(string); ok {
+				datum.Metadata[k] = s
+				continue
+			}
+			raw, err := v.MarshalJSON()
+			if err != nil {
+				continue
+			}
+			datum.Metadata[k] = string(raw)
+		}
+	}
+
+	return datum
+}
+
+// DataPath returns the path an event is about, as it would appear in a
+// request in the event's namespace: the event's "path" metadata prefixed with
+// the mount path. It is empty if the event has no path.
+func DataPath(event *logical.EventReceived) string {
+	path, ok := event.GetEvent().GetMetadata().GetFields()["path"]
+	if !ok {
+		return ""
+	}
+	return event.GetPluginInfo().GetMountPath() + strings.TrimPrefix(path.GetStringValue(), "/")
+}
@@ -0,0 +1,76 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package eventbus
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestFilter_new(t *testing.T) {
+	cases := map[string]bool{
+		`mount_path == "secret/"`:                                  true,
+		`data_path matches "^secret/data/app/" and plugin == "kv"`: true,
+		`metadata.current_version == "2"`:                          true,
+		`"abc" in entity_ids or event_type == "kv-v2/data-write"`:  true,
+		`mount_path ==`:      false,
+		`mount == "secret/"`: false,
+	}
+
+	for expression, valid := range cases {
+		_, err := NewFilter(expression)
+		if valid && err != nil {
+			t.Errorf("%q: unexpected error: %v", expression, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("%q: expected error", expression)
+		}
+	}
+}
+
+func TestFilter_matches(t *testing.T) {
+	newEvent := func(mountPath string, metadata map[string]interface{}) *logical.EventReceived {
+		m, err := structpb.NewStruct(metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &logical.EventReceived{
+			EventType: "kv-v2/data-write",
+			Event:     &logical.EventData{Id: "abc", Metadata: m},
+			PluginInfo: &logical.EventPluginInfo{
+				Plugin:    "kv",
+				MountPath: mountPath,
+			},
+		}
+	}
+
+	cases := []struct {
+		expression string
+		event      *logical.EventReceived
+		expected   bool
+	}{
+		{`data_path == "secret/data/app/foo"`, newEvent("secret/", map[string]interface{}{"path": "data/app/foo"}), true},
+		{`data_path == "secret/data/app/foo"`, newEvent("other/", map[string]interface{}{"path": "data/app/foo"}), false},
+		{`data_path matches "^secret/data/app/"`, newEvent("secret/", nil), false},
+		{`metadata.current_version == "2"`, newEvent("secret/", map[string]interface{}{"current_version": "2"}), true},
+		{`metadata.destroyed == "true"`, newEvent("secret/", map[string]interface{}{"destroyed": true}), true},
+		{`plugin == "kv" and metadata.missing == "x"`, newEvent("secret/", nil), false},
+	}
+
+	for _, tc := range cases {
+		filter, err := NewFilter(tc.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		match, err := filter.Matches(tc.event)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.expression, err)
+		}
+		if match != tc.expected {
+			t.Errorf("%q on %v: expected %v, got %v", tc.expression, tc.event, tc.expected, match)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hashicorp/eventlogger"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// DefaultJournalMaxEvents is the number of events kept in a namespace's
+	// journal if no limit is configured.
+	DefaultJournalMaxEvents = 1000
+
+	journalConfigKey    = "config"
+	journalEventsPrefix = "events/"
+)
+
+var (
+	ErrJournalDisabled        = errors.New("event journal is not enabled for this namespace")
+	ErrJournalCursorNotFound  = errors.New("event not found in the event journal; it may be older than the oldest event kept")
+	ErrJournalChildNamespaces = errors.New("events cannot be replayed when subscribing to child namespaces")
+)
+
+// JournalConfig configures the event journal of a single namespace.
+type JournalConfig struct {
+	Enabled   bool `json:"enabled"`
+	MaxEvents int  `json:"max_events"`
+}
+
+// journalEntry is the stored form of an event in the journal.
+type journalEntry struct {
+	CreatedAt time.Time `json:"created_at"`
+	Event     []byte    `json:"event"`
+}
+
+// namespaceJournal tracks the events stored for a namespace, oldest first.
+// Only the sequence numbers and IDs are kept in memory; the events
+// themselves are read from storage when replayed.
+type namespaceJournal struct {
+	// lock serializes appends, so that events are stored in the order they
+	// are sent, without holding up events in other namespaces
+	lock   sync.Mutex
+	config JournalConfig
+	seqs   []uint64
+	ids    []string
+}
+
+// Journal records the events sent in each namespace that has it enabled, so
+// that subscribers that were disconnected can receive the events they missed.
+// Each namespace keeps a bounded number of its most recent events.
+type Journal struct {
+	logger  hclog.Logger
+	storage logical.Storage
+
+	// lock protects the map of namespaces, but not the journals in it
+	lock       sync.Mutex
+	namespaces map[string]*namespaceJournal
+}
+
+// newJournal loads the journal of every namespace from storage.
+func newJournal(ctx context.Context, storage logical.Storage, logger hclog.Logger) (*Journal, error) {
+	j := &Journal{
+		logger:     logger,
+		storage:    storage,
+		namespaces: make(map[string]*namespaceJournal),
+	}
+
+	nsIDs, err := storage.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, nsID := range nsIDs {
+		nsID = strings.TrimSuffix(nsID, "/")
+
+		var config JournalConfig
+		entry, err := storage.Get(ctx, nsID+"/"+journalConfigKey)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		if err := entry.DecodeJSON(&config); err != nil {
+			return nil, err
+		}
+
+		keys, err := storage.List(ctx, nsID+"/"+journalEventsPrefix)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(keys)
+
+		nsj := &namespaceJournal{config: config}
+		for _, key := range keys {
+			seq, id, err := parseJournalKey(key)
+			if err != nil {
+				logger.Warn("ignoring malformed event journal entry", "namespace_id", nsID, "key", key)
+				continue
+			}
+			nsj.seqs = append(nsj.seqs, seq)
+			nsj.ids = append(nsj.ids, id)
+		}
+		j.namespaces[nsID] = nsj
+	}
+
+	return j, nil
+}
+
+// namespace returns the journal of the namespace, creating it if asked to.
+// It returns nil if the namespace has no journal and create is false.
+func (j *Journal) namespace(nsID string, create bool) *namespaceJournal {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	nsj, ok := j.namespaces[nsID]
+	if !ok && create {
+		nsj = &namespaceJournal{}
+		j.namespaces[nsID] = nsj
+	}
+	return nsj
+}
+
+// Config returns the journal configuration of the namespace.
+func (j *Journal) Config(nsID string) JournalConfig {
+	if nsj := j.namespace(nsID, false); nsj != nil {
+		nsj.lock.Lock()
+		defer nsj.lock.Unlock()
+		return nsj.config
+	}
+	return JournalConfig{MaxEvents: DefaultJournalMaxEvents}
+}
+
+// SetConfig stores the journal configuration of the namespace. Disabling the
+// journal removes the events kept so far, and lowering the limit removes the
+// oldest events beyond it.
+func (j *Journal) SetConfig(ctx context.Context, nsID string, config JournalConfig) error {
+	if config.MaxEvents <= 0 {
+		config.MaxEvents = DefaultJournalMaxEvents
+	}
+
+	nsj := j.namespace(nsID, true)
+	nsj.lock.Lock()
+	defer nsj.lock.Unlock()
+
+	entry, err := logical.StorageEntryJSON(nsID+"/"+journalConfigKey, config)
+	if err != nil {
+		return err
+	}
+	if err := j.storage.Put(ctx, entry); err != nil {
+		return err
+	}
+	nsj.config = config
+
+	limit := config.MaxEvents
+	if !config.Enabled {
+		limit = 0
+	}
+	j.prune(ctx, nsID, nsj, limit)
+
+	return nil
+}
+
+// append stores an event in the journal of the namespace, if enabled.
+func (j *Journal) append(ctx context.Context, nsID string, event *logical.EventReceived, createdAt time.Time) error {
+	nsj := j.namespace(nsID, false)
+	if nsj == nil {
+		return nil
+	}
+
+	nsj.lock.Lock()
+	defer nsj.lock.Unlock()
+
+	if !nsj.config.Enabled {
+		return nil
+	}
+
+	id := event.GetEvent().GetId()
+	if id == "" || strings.Contains(id, "/") {
+		return fmt.Errorf("event ID %q cannot be journaled", id)
+	}
+
+	eventBytes, err := proto.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var seq uint64 = 1
+	if len(nsj.seqs) > 0 {
+		seq = nsj.seqs[len(nsj.seqs)-1] + 1
+	}
+
+	entry, err := logical.StorageEntryJSON(journalKey(nsID, seq, id), &journalEntry{
+		CreatedAt: createdAt,
+		Event:     eventBytes,
+	})
+	if err != nil {
+		return err
+	}
+	if err := j.storage.Put(ctx, entry); err != nil {
+		return fmt.Errorf("error writing event to journal: %w", err)
+	}
+
+	nsj.seqs = append(nsj.seqs, seq)
+	nsj.ids = append(nsj.ids, id)
+	j.prune(ctx, nsID, nsj, nsj.config.MaxEvents)
+
+	return nil
+}
+
+// prune removes the oldest events of the namespace until at most limit are
+// left. Events that cannot be removed are kept, and removal is tried again
+// on the next append. The namespace's lock must be held before calling this.
+func (j *Journal) prune(ctx context.Context, nsID string, nsj *namespaceJournal, limit int) {
+	for len(nsj.seqs) > limit {
+		if err := j.storage.Delete(ctx, journalKey(nsID, nsj.seqs[0], nsj.ids[0])); err != nil {
+			j.logger.Warn("error removing event from journal", "namespace_id", nsID, "error", err)
+			return
+		}
+		nsj.seqs = nsj.seqs[1:]
+		nsj.ids = nsj.ids[1:]
+	}
+}
+
+// since returns the events of the namespace stored after the event with the
+// given ID, oldest first.
+func (j *Journal) since(ctx context.Context, nsID string, lastEventID string) ([]*eventlogger.Event, error) {
+	nsj := j.namespace(nsID, false)
+	if nsj == nil {
+		return nil, ErrJournalDisabled
+	}
+
+	nsj.lock.Lock()
+	if !nsj.config.Enabled {
+		nsj.lock.Unlock()
+		return nil, ErrJournalDisabled
+	}
+
+	idx := -1
+	for i := len(nsj.ids) - 1; i >= 0; i-- {
+		if nsj.ids[i] == lastEventID {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		nsj.lock.Unlock()
+		return nil, ErrJournalCursorNotFound
+	}
+
+	keys := make([]string, 0, len(nsj.ids)-idx-1)
+	for i := idx + 1; i < len(nsj.ids); i++ {
+		keys = append(keys, journalKey(nsID, nsj.seqs[i], nsj.ids[i]))
+	}
+	nsj.lock.Unlock()
+
+	events := make([]*eventlogger.Event, 0, len(keys))
+	for _, key := range keys {
+		entry, err := j.storage.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			// Pruned since we released the lock, so the subscriber would
+			// miss it
+			return nil, ErrJournalCursorNotFound
+		}
+
+		var stored journalEntry
+		if err := entry.DecodeJSON(&stored); err != nil {
+			return nil, err
+		}
+		eventReceived := &logical.EventReceived{}
+		if err := proto.Unmarshal(stored.Event, eventReceived); err != nil {
+			return nil, err
+		}
+
+		e := &eventlogger.Event{
+			Type:      eventTypeAll,
+			CreatedAt: stored.CreatedAt,
+			Payload:   eventReceived,
+		}
+		if _, err := cloudEventsFormatterFilter.Process(ctx, e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+// journalKey returns the storage key of an event. Keys sort in the order
+// events were sent, and carry the event ID so that the journal can be
+// indexed on load without reading every event.
+func journalKey(nsID string, seq uint64, id string) string {
+	return fmt.Sprintf("%s/%s%020d_%s", nsID, journalEventsPrefix, seq, id)
+}
+
+func parseJournalKey(key string) (uint64, string, error) {
+	seqRaw, id, ok := strings.Cut(key, "_")
+	if !ok || id == "" {
+		return 0, "", fmt.Errorf("malformed key %q", key)
+	}
+	seq, err := strconv.ParseUint(seqRaw, 10, 64)
+	if err != nil {
+		return 0, "", err
+	}
+	return seq, id, nil
+}
@@ -0,0 +1,239 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/eventlogger"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// newJournaledBus returns a started bus with the journal enabled for the root
+// namespace.
+func newJournaledBus(t *testing.T, storage logical.Storage, maxEvents int) *EventBus {
+	t.Helper()
+
+	bus, err := NewEventBus(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Start()
+
+	ctx := context.Background()
+	if err := bus.LoadJournal(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	err = bus.Journal().SetConfig(ctx, namespace.RootNamespaceID, JournalConfig{
+		Enabled:   true,
+		MaxEvents: maxEvents,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bus
+}
+
+func sendEvents(t *testing.T, bus *EventBus, eventType logical.EventType, n int) []string {
+	t.Helper()
+
+	var ids []string
+	for i := 0; i < n; i++ {
+		event, err := logical.NewEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bus.SendInternal(context.Background(), namespace.RootNamespace, nil, eventType, event); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, event.Id)
+	}
+	return ids
+}
+
+func receiveEvents(t *testing.T, ch <-chan *eventlogger.Event, n int) []string {
+	t.Helper()
+
+	var ids []string
+	timeout := time.After(1 * time.Second)
+	for len(ids) < n {
+		select {
+		case message := <-ch:
+			if _, ok := message.Format("cloudevents-json"); !ok {
+				t.Fatal("expected event to be formatted as cloudevents JSON")
+			}
+			ids = append(ids, message.Payload.(*logical.EventReceived).Event.Id)
+		case <-timeout:
+			t.Fatalf("timeout waiting for events, got %d of %d", len(ids), n)
+		}
+	}
+	return ids
+}
+
+// TestJournalReplay verifies that a subscription resumed from an event first
+// receives the events sent after it, and then live events.
+func TestJournalReplay(t *testing.T) {
+	bus := newJournaledBus(t, &logical.InmemStorage{}, 10)
+	ctx := context.Background()
+
+	ids := sendEvents(t, bus, "kv-write", 2)
+	sendEvents(t, bus, "other", 1)
+	ids = append(ids, sendEvents(t, bus, "kv-write", 2)...)
+
+	ch, cancel, err := bus.SubscribeFrom(ctx, namespace.RootNamespace, "kv*", ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	ids = append(ids, sendEvents(t, bus, "kv-write", 1)...)
+
+	received := receiveEvents(t, ch, 4)
+	for i, id := range received {
+		if id != ids[i+1] {
+			t.Fatalf("expected events %v, got %v", ids[1:], received)
+		}
+	}
+
+	// Nothing is delivered twice
+	select {
+	case message := <-ch:
+		t.Fatalf("unexpected event %+v", message.Payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestJournalReplaySlowSubscriber verifies that live events are held for a
+// subscriber that is still catching up from the journal, and that the
+// subscription is closed rather than silently losing events once too many
+// of them are held.
+func TestJournalReplaySlowSubscriber(t *testing.T) {
+	bus := newJournaledBus(t, &logical.InmemStorage{}, 10)
+	bus.SetSendTimeout(50 * time.Millisecond)
+	bus.replayBuffer = 2
+	ctx := context.Background()
+
+	ids := sendEvents(t, bus, "kv-write", 3)
+
+	ch, cancel, err := bus.SubscribeFrom(ctx, namespace.RootNamespace, "*", ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	// The live event outlasts the send timeout while the replay is not read
+	ids = append(ids, sendEvents(t, bus, "kv-write", 1)...)
+	time.Sleep(200 * time.Millisecond)
+
+	received := receiveEvents(t, ch, 3)
+	for i, id := range received {
+		if id != ids[i+1] {
+			t.Fatalf("expected events %v, got %v", ids[1:], received)
+		}
+	}
+
+	// One event waits to be delivered, two are held and the fourth is one
+	// too many
+	sendEvents(t, bus, "kv-write", 4)
+	timeout := time.After(1 * time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("expected the subscription to be closed")
+		}
+	}
+}
+
+// TestJournalPrune verifies that only the most recent events are kept, and
+// that resuming from an event that is no longer kept fails.
+func TestJournalPrune(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	bus := newJournaledBus(t, storage, 2)
+	ctx := context.Background()
+
+	ids := sendEvents(t, bus, "kv-write", 4)
+
+	_, _, err := bus.SubscribeFrom(ctx, namespace.RootNamespace, "*", ids[1])
+	if !errors.Is(err, ErrJournalCursorNotFound) {
+		t.Fatalf("expected cursor not found error, got %v", err)
+	}
+
+	keys, err := storage.List(ctx, namespace.RootNamespaceID+"/"+journalEventsPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 stored events, got %v", keys)
+	}
+
+	// The journal survives being reloaded, as happens on unseal
+	bus.UnloadJournal()
+	if err := bus.LoadJournal(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	ch, cancel, err := bus.SubscribeFrom(ctx, namespace.RootNamespace, "*", ids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	if received := receiveEvents(t, ch, 1); received[0] != ids[3] {
+		t.Fatalf("expected event %s, got %s", ids[3], received[0])
+	}
+
+	// Disabling the journal removes what it kept
+	if err := bus.Journal().SetConfig(ctx, namespace.RootNamespaceID, JournalConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	keys, err = storage.List(ctx, namespace.RootNamespaceID+"/"+journalEventsPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("expected no stored events, got %v", keys)
+	}
+	_, _, err = bus.SubscribeFrom(ctx, namespace.RootNamespace, "*", ids[3])
+	if !errors.Is(err, ErrJournalDisabled) {
+		t.Fatalf("expected journal disabled error, got %v", err)
+	}
+}
+
+// TestJournalWriteFailure verifies that events which cannot be journaled
+// are still delivered to current subscribers.
+func TestJournalWriteFailure(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	bus := newJournaledBus(t, storage, 10)
+	ctx := context.Background()
+
+	ch, cancel, err := bus.Subscribe(ctx, namespace.RootNamespace, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	storage.FailPut(true)
+	ids := sendEvents(t, bus, "kv-write", 2)
+
+	received := receiveEvents(t, ch, 2)
+	if received[0] != ids[0] || received[1] != ids[1] {
+		t.Fatalf("expected events %v, got %v", ids, received)
+	}
+
+	keys, err := storage.List(ctx, namespace.RootNamespaceID+"/"+journalEventsPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("expected no stored events, got %v", keys)
+	}
+}
@@ -0,0 +1,526 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/eventlogger"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	SinkTypeWebhook = "webhook"
+
+	DefaultSinkMaxRetries     = 3
+	DefaultSinkRetryBackoff   = 1 * time.Second
+	DefaultSinkRequestTimeout = 10 * time.Second
+
+	// sinkQueueSize is the number of events buffered for a sink while it is
+	// delivering. Events that do not fit are dead-lettered straight away.
+	sinkQueueSize = 1000
+
+	// sinkMaxDeadLetters is the number of undeliverable events kept per
+	// sink. The oldest are removed once there are more.
+	sinkMaxDeadLetters = 1000
+
+	sinkMaxBackoff = 1 * time.Minute
+
+	sinkConfigPrefix     = "config/"
+	sinkDeadLetterPrefix = "dead-letter/"
+
+	// SinkSignatureHeader carries the HMAC-SHA256 signature of a webhook
+	// request, computed with the sink's secret over the timestamp header, a
+	// period and the body.
+	SinkSignatureHeader = "X-Vault-Event-Signature"
+	SinkTimestampHeader = "X-Vault-Event-Timestamp"
+	SinkEventIDHeader   = "X-Vault-Event-Id"
+)
+
+var ErrSinkNotFound = errors.New("event sink not found")
+
+// SinkConfig configures an event sink, which forwards the events matching a
+// pattern to an external system.
+type SinkConfig struct {
+	Name           string        `json:"name"`
+	NamespaceID    string        `json:"namespace_id"`
+	NamespacePath  string        `json:"namespace_path"`
+	Type           string        `json:"type"`
+	Pattern        string        `json:"pattern"`
+	Filter         string        `json:"filter,omitempty"`
+	URL            string        `json:"url"`
+	Secret         string        `json:"secret"`
+	MaxRetries     int           `json:"max_retries"`
+	RetryBackoff   time.Duration `json:"retry_backoff"`
+	RequestTimeout time.Duration `json:"request_timeout"`
+}
+
+// DeadLetter is an event that a sink could not deliver.
+type DeadLetter struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+	Event []byte    `json:"event"`
+}
+
+// sink delivers the events of one subscription to a webhook.
+type sink struct {
+	config  *SinkConfig
+	manager *SinkManager
+	logger  hclog.Logger
+	client  *http.Client
+	queue   chan *eventlogger.Event
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	// deadLetters are the storage keys of the sink's dead letters, oldest
+	// first
+	deadLetterLock sync.Mutex
+	deadLetters    []string
+}
+
+// SinkManager runs the event sinks configured in every namespace. Sinks are
+// stored so that they are started again after a restart or leadership
+// change, and only run on the active node.
+type SinkManager struct {
+	bus     *EventBus
+	logger  hclog.Logger
+	storage logical.Storage
+
+	lock  sync.Mutex
+	sinks map[string]*sink
+
+	// runLock serializes starting and stopping sinks, so that a sink and
+	// its replacement never run at the same time
+	runLock sync.Mutex
+}
+
+// LoadSinks loads the event sinks from storage and starts them.
+func (bus *EventBus) LoadSinks(ctx context.Context, storage logical.Storage) error {
+	m := &SinkManager{
+		bus:     bus,
+		logger:  bus.logger.Named("sinks"),
+		storage: storage,
+		sinks:   make(map[string]*sink),
+	}
+
+	nsIDs, err := storage.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, nsID := range nsIDs {
+		nsID = strings.TrimSuffix(nsID, "/")
+
+		names, err := storage.List(ctx, nsID+"/"+sinkConfigPrefix)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			entry, err := storage.Get(ctx, nsID+"/"+sinkConfigPrefix+name)
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				continue
+			}
+			var config SinkConfig
+			if err := entry.DecodeJSON(&config); err != nil {
+				return err
+			}
+			if err := m.start(ctx, &config); err != nil {
+				m.stopAll()
+				return fmt.Errorf("error starting event sink %q: %w", name, err)
+			}
+		}
+	}
+
+	if old := bus.sinks.Swap(m); old != nil {
+		old.stopAll()
+	}
+	return nil
+}
+
+// UnloadSinks stops all event sinks.
+func (bus *EventBus) UnloadSinks() {
+	if m := bus.sinks.Swap(nil); m != nil {
+		m.stopAll()
+	}
+}
+
+// Sinks returns the event sink manager, or nil if sinks have not been loaded.
+func (bus *EventBus) Sinks() *SinkManager {
+	return bus.sinks.Load()
+}
+
+// List returns the names of the sinks in the namespace.
+func (m *SinkManager) List(nsID string) []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var names []string
+	for _, s := range m.sinks {
+		if s.config.NamespaceID == nsID {
+			names = append(names, s.config.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the configuration of a sink, or nil if there is no such sink.
+func (m *SinkManager) Get(nsID, name string) *SinkConfig {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s, ok := m.sinks[sinkKey(nsID, name)]
+	if !ok {
+		return nil
+	}
+	config := *s.config
+	return &config
+}
+
+// Put stores the configuration of a sink, and starts it, replacing the sink
+// of the same name if there is one.
+func (m *SinkManager) Put(ctx context.Context, config *SinkConfig) error {
+	entry, err := logical.StorageEntryJSON(config.NamespaceID+"/"+sinkConfigPrefix+config.Name, config)
+	if err != nil {
+		return err
+	}
+	if err := m.storage.Put(ctx, entry); err != nil {
+		return err
+	}
+
+	return m.start(ctx, config)
+}
+
+// Delete stops a sink and removes its configuration and dead letters.
+func (m *SinkManager) Delete(ctx context.Context, nsID, name string) error {
+	m.runLock.Lock()
+	m.lock.Lock()
+	s, ok := m.sinks[sinkKey(nsID, name)]
+	delete(m.sinks, sinkKey(nsID, name))
+	m.lock.Unlock()
+	if ok {
+		s.stop()
+	}
+	m.runLock.Unlock()
+
+	if err := m.storage.Delete(ctx, nsID+"/"+sinkConfigPrefix+name); err != nil {
+		return err
+	}
+	return logical.ClearView(ctx, logical.NewStorageView(m.storage, deadLetterPrefix(nsID, name)))
+}
+
+// DeadLetters returns the events a sink could not deliver, oldest first.
+func (m *SinkManager) DeadLetters(ctx context.Context, nsID, name string) ([]*DeadLetter, error) {
+	if m.Get(nsID, name) == nil {
+		return nil, ErrSinkNotFound
+	}
+
+	prefix := deadLetterPrefix(nsID, name)
+	keys, err := m.storage.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	deadLetters := make([]*DeadLetter, 0, len(keys))
+	for _, key := range keys {
+		entry, err := m.storage.Get(ctx, prefix+key)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		var deadLetter DeadLetter
+		if err := entry.DecodeJSON(&deadLetter); err != nil {
+			return nil, err
+		}
+		deadLetters = append(deadLetters, &deadLetter)
+	}
+	return deadLetters, nil
+}
+
+// ClearDeadLetters removes the events a sink could not deliver.
+func (m *SinkManager) ClearDeadLetters(ctx context.Context, nsID, name string) error {
+	m.lock.Lock()
+	s, ok := m.sinks[sinkKey(nsID, name)]
+	m.lock.Unlock()
+	if !ok {
+		return ErrSinkNotFound
+	}
+
+	s.deadLetterLock.Lock()
+	defer s.deadLetterLock.Unlock()
+
+	if err := logical.ClearView(ctx, logical.NewStorageView(m.storage, deadLetterPrefix(nsID, name))); err != nil {
+		return err
+	}
+	s.deadLetters = nil
+	return nil
+}
+
+// start starts a sink, stopping the sink of the same name if it is running.
+func (m *SinkManager) start(ctx context.Context, config *SinkConfig) error {
+	m.runLock.Lock()
+	defer m.runLock.Unlock()
+
+	// Stop the sink being replaced before subscribing, so that no event is
+	// delivered by both, and so that the events it dead-letters while
+	// stopping are counted towards the new sink's dead letters
+	m.lock.Lock()
+	old := m.sinks[sinkKey(config.NamespaceID, config.Name)]
+	delete(m.sinks, sinkKey(config.NamespaceID, config.Name))
+	m.lock.Unlock()
+	if old != nil {
+		old.stop()
+	}
+
+	deadLetters, err := m.storage.List(ctx, deadLetterPrefix(config.NamespaceID, config.Name))
+	if err != nil {
+		return err
+	}
+	sort.Strings(deadLetters)
+
+	ns := &namespace.Namespace{
+		ID:   config.NamespaceID,
+		Path: config.NamespacePath,
+	}
+
+	// Sinks outlive the request that configured them
+	sinkCtx, cancel := context.WithCancel(namespace.ContextWithNamespace(context.Background(), ns))
+	ch, cancelSubscription, err := m.bus.SubscribeWithOptions(sinkCtx, ns, config.Pattern, SubscribeOptions{Filter: config.Filter})
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	client := cleanhttp.DefaultPooledClient()
+	client.Timeout = config.RequestTimeout
+
+	s := &sink{
+		config:      config,
+		manager:     m,
+		logger:      m.logger.With("namespace", config.NamespacePath, "name", config.Name),
+		client:      client,
+		queue:       make(chan *eventlogger.Event, sinkQueueSize),
+		done:        make(chan struct{}),
+		deadLetters: deadLetters,
+		cancel: func() {
+			cancelSubscription()
+			cancel()
+		},
+	}
+
+	m.lock.Lock()
+	m.sinks[sinkKey(config.NamespaceID, config.Name)] = s
+	m.lock.Unlock()
+
+	go s.receive(sinkCtx, ch)
+	go s.deliver(sinkCtx)
+
+	return nil
+}
+
+func (m *SinkManager) stopAll() {
+	m.runLock.Lock()
+	defer m.runLock.Unlock()
+
+	m.lock.Lock()
+	sinks := m.sinks
+	m.sinks = make(map[string]*sink)
+	m.lock.Unlock()
+
+	for _, s := range sinks {
+		s.stop()
+	}
+}
+
+// stop stops the sink and waits for an in-flight delivery to finish.
+func (s *sink) stop() {
+	s.cancel()
+	<-s.done
+}
+
+// receive queues the events of the sink's subscription. It never blocks on
+// delivery, so that a slow webhook does not cause the bus to close the
+// subscription.
+func (s *sink) receive(ctx context.Context, ch <-chan *eventlogger.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-ch:
+			select {
+			case s.queue <- e:
+			default:
+				metrics.IncrCounter([]string{"events", "sinks", "queue_full"}, 1)
+				s.deadLetter(e, errors.New("sink queue is full"))
+			}
+		}
+	}
+}
+
+// deliver sends queued events to the webhook one at a time, in the order
+// they were received. Events still queued when the sink is stopped are
+// dead-lettered rather than dropped.
+func (s *sink) deliver(ctx context.Context) {
+	defer close(s.done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-s.queue:
+					s.deadLetter(e, errors.New("sink was stopped before the event was delivered"))
+				default:
+					return
+				}
+			}
+		case e := <-s.queue:
+			if err := s.send(ctx, e); err != nil {
+				s.logger.Warn("error delivering event, dead-lettering it", "error", err)
+				s.deadLetter(e, err)
+			}
+		}
+	}
+}
+
+func (s *sink) send(ctx context.Context, e *eventlogger.Event) error {
+	body, ok := e.Format("cloudevents-json")
+	if !ok {
+		return errors.New("could not get cloudevents JSON format")
+	}
+	id := e.Payload.(*logical.EventReceived).ID()
+
+	backoff := s.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.post(ctx, id, body)
+		if err == nil {
+			metrics.IncrCounter([]string{"events", "sinks", "delivered"}, 1)
+			return nil
+		}
+		if attempt >= s.config.MaxRetries {
+			return err
+		}
+
+		metrics.IncrCounter([]string{"events", "sinks", "retry"}, 1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > sinkMaxBackoff {
+			backoff = sinkMaxBackoff
+		}
+	}
+}
+
+func (s *sink) post(ctx context.Context, id string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	req.Header.Set(SinkEventIDHeader, id)
+	req.Header.Set(SinkTimestampHeader, timestamp)
+	req.Header.Set(SinkSignatureHeader, "v1="+SignSinkRequest(s.config.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response from webhook: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// deadLetter stores an event the sink could not deliver, removing the oldest
+// dead letters beyond the limit.
+func (s *sink) deadLetter(e *eventlogger.Event, deliveryErr error) {
+	metrics.IncrCounter([]string{"events", "sinks", "dead_lettered"}, 1)
+
+	// Dead letters are also stored while the sink is being stopped
+	ctx := context.Background()
+
+	body, _ := e.Format("cloudevents-json")
+	now := time.Now()
+	key := fmt.Sprintf("%020d_%s", now.UnixNano(), e.Payload.(*logical.EventReceived).ID())
+	prefix := deadLetterPrefix(s.config.NamespaceID, s.config.Name)
+
+	s.deadLetterLock.Lock()
+	defer s.deadLetterLock.Unlock()
+
+	entry, err := logical.StorageEntryJSON(prefix+key, &DeadLetter{
+		Time:  now,
+		Error: deliveryErr.Error(),
+		Event: body,
+	})
+	if err == nil {
+		err = s.manager.storage.Put(ctx, entry)
+	}
+	if err != nil {
+		s.logger.Error("error storing dead-lettered event", "error", err)
+		return
+	}
+
+	s.deadLetters = append(s.deadLetters, key)
+	for len(s.deadLetters) > sinkMaxDeadLetters {
+		if err := s.manager.storage.Delete(ctx, prefix+s.deadLetters[0]); err != nil {
+			s.logger.Warn("error removing old dead-lettered event", "error", err)
+			return
+		}
+		s.deadLetters = s.deadLetters[1:]
+	}
+}
+
+// SignSinkRequest returns the hex-encoded signature of a webhook request, as
+// sent in the SinkSignatureHeader. Receivers should compute it over the
+// request they receive and compare it in constant time, and may reject
+// requests with an old timestamp to guard against replays.
+func SignSinkRequest(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func sinkKey(nsID, name string) string {
+	return nsID + "/" + name
+}
+
+func deadLetterPrefix(nsID, name string) string {
+	return nsID + "/" + sinkDeadLetterPrefix + name + "/"
+}
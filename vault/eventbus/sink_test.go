@@ -0,0 +1,264 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package eventbus
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// testWebhook records the IDs of the events posted to it, after checking
+// their signature, and fails the first failures requests.
+type testWebhook struct {
+	t        *testing.T
+	secret   string
+	lock     sync.Mutex
+	failures int
+	requests int
+	ids      []string
+}
+
+func (h *testWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.t.Error(err)
+		return
+	}
+
+	expected := "v1=" + SignSinkRequest(h.secret, r.Header.Get(SinkTimestampHeader), body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(SinkSignatureHeader))) {
+		h.t.Errorf("bad signature %q", r.Header.Get(SinkSignatureHeader))
+	}
+
+	var event struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		h.t.Error(err)
+	}
+	if event.ID != r.Header.Get(SinkEventIDHeader) {
+		h.t.Errorf("expected event ID %q, got %q", r.Header.Get(SinkEventIDHeader), event.ID)
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.requests++
+	if h.requests <= h.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	h.ids = append(h.ids, event.ID)
+}
+
+func (h *testWebhook) received() []string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return append([]string(nil), h.ids...)
+}
+
+func newSinkConfig(name, url string) *SinkConfig {
+	return &SinkConfig{
+		Name:           name,
+		NamespaceID:    namespace.RootNamespaceID,
+		NamespacePath:  namespace.RootNamespace.Path,
+		Type:           SinkTypeWebhook,
+		Pattern:        "kv*",
+		URL:            url,
+		Secret:         "secret",
+		MaxRetries:     1,
+		RetryBackoff:   10 * time.Millisecond,
+		RequestTimeout: time.Second,
+	}
+}
+
+// TestSinkDelivery verifies that a sink forwards matching events, retries
+// failed deliveries, and is started again when sinks are reloaded.
+func TestSinkDelivery(t *testing.T) {
+	webhook := &testWebhook{t: t, secret: "secret", failures: 1}
+	srv := httptest.NewServer(webhook)
+	defer srv.Close()
+
+	bus, err := NewEventBus(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Start()
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+
+	if err := bus.LoadSinks(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	defer bus.UnloadSinks()
+	if err := bus.Sinks().Put(ctx, newSinkConfig("deploys", srv.URL)); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := sendEvents(t, bus, "kv-write", 2)
+	sendEvents(t, bus, "other", 1)
+	waitFor(t, 2*time.Second, func() bool { return len(webhook.received()) == 2 })
+
+	// Reload, as happens when another node becomes active
+	bus.UnloadSinks()
+	if err := bus.LoadSinks(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	if names := bus.Sinks().List(namespace.RootNamespaceID); len(names) != 1 || names[0] != "deploys" {
+		t.Fatalf("expected the sink to be loaded, got %v", names)
+	}
+	ids = append(ids, sendEvents(t, bus, "kv-write", 1)...)
+	waitFor(t, 2*time.Second, func() bool { return len(webhook.received()) == 3 })
+
+	received := webhook.received()
+	for i := range ids {
+		if received[i] != ids[i] {
+			t.Fatalf("expected events %v, got %v", ids, received)
+		}
+	}
+}
+
+// TestSinkDeadLetter verifies that events that cannot be delivered are
+// dead-lettered.
+func TestSinkDeadLetter(t *testing.T) {
+	webhook := &testWebhook{t: t, secret: "secret", failures: 100}
+	srv := httptest.NewServer(webhook)
+	defer srv.Close()
+
+	bus, err := NewEventBus(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Start()
+	ctx := context.Background()
+
+	if err := bus.LoadSinks(ctx, &logical.InmemStorage{}); err != nil {
+		t.Fatal(err)
+	}
+	defer bus.UnloadSinks()
+	sinks := bus.Sinks()
+	if err := sinks.Put(ctx, newSinkConfig("deploys", srv.URL)); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := sendEvents(t, bus, "kv-write", 1)
+
+	var deadLetters []*DeadLetter
+	waitFor(t, 2*time.Second, func() bool {
+		deadLetters, err = sinks.DeadLetters(ctx, namespace.RootNamespaceID, "deploys")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(deadLetters) == 1
+	})
+	if !strings.Contains(deadLetters[0].Error, "503") {
+		t.Fatalf("unexpected error %q", deadLetters[0].Error)
+	}
+	if !strings.Contains(string(deadLetters[0].Event), ids[0]) {
+		t.Fatalf("expected dead letter for event %s, got %s", ids[0], deadLetters[0].Event)
+	}
+
+	// One attempt and one retry
+	webhook.lock.Lock()
+	requests := webhook.requests
+	webhook.lock.Unlock()
+	if requests != 2 {
+		t.Fatalf("expected 2 requests, got %d", requests)
+	}
+
+	if err := sinks.ClearDeadLetters(ctx, namespace.RootNamespaceID, "deploys"); err != nil {
+		t.Fatal(err)
+	}
+	if deadLetters, err = sinks.DeadLetters(ctx, namespace.RootNamespaceID, "deploys"); err != nil || len(deadLetters) != 0 {
+		t.Fatalf("expected no dead letters, got %v (err %v)", deadLetters, err)
+	}
+
+	if err := sinks.Delete(ctx, namespace.RootNamespaceID, "deploys"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sinks.DeadLetters(ctx, namespace.RootNamespaceID, "deploys"); err != ErrSinkNotFound {
+		t.Fatalf("expected sink not found error, got %v", err)
+	}
+}
+
+// TestSinkReplace verifies that an event is not delivered twice while a sink
+// is being replaced.
+func TestSinkReplace(t *testing.T) {
+	webhook := &testWebhook{t: t, secret: "secret"}
+	srv := httptest.NewServer(webhook)
+	defer srv.Close()
+
+	bus, err := NewEventBus(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Start()
+	ctx := context.Background()
+
+	if err := bus.LoadSinks(ctx, &logical.InmemStorage{}); err != nil {
+		t.Fatal(err)
+	}
+	defer bus.UnloadSinks()
+	sinks := bus.Sinks()
+	if err := sinks.Put(ctx, newSinkConfig("deploys", srv.URL)); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			event, err := logical.NewEvent()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := bus.SendInternal(ctx, namespace.RootNamespace, nil, "kv-write", event); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		if err := sinks.Put(ctx, newSinkConfig("deploys", srv.URL)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	// Events are delivered in order, so the others have been delivered once
+	// this one has
+	last := sendEvents(t, bus, "kv-write", 1)[0]
+	waitFor(t, 5*time.Second, func() bool {
+		received := webhook.received()
+		return len(received) > 0 && received[len(received)-1] == last
+	})
+
+	seen := make(map[string]bool)
+	for _, id := range webhook.received() {
+		if seen[id] {
+			t.Fatalf("event %s was delivered twice", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault/eventbus"
+)
+
+const (
+	// eventJournalSubPath is the sub-path used for the event journal of
+	// every namespace.
+	eventJournalSubPath = "events/journal/"
+
+	// eventSinksSubPath is the sub-path used for the event sinks of every
+	// namespace, and for the events they could not deliver.
+	eventSinksSubPath = "events/sinks/"
+)
+
+// setupEventJournal loads the event journal, so that events are recorded for
+// replay in the namespaces that have it enabled. This should only be called
+// with the core state lock held for writing.
+func (c *Core) setupEventJournal(ctx context.Context) error {
+	if c.events == nil {
+		return nil
+	}
+
+	view := c.systemBarrierView.SubView(eventJournalSubPath)
+	if err := c.events.LoadJournal(ctx, view); err != nil {
+		return fmt.Errorf("failed to load event journal: %w", err)
+	}
+
+	return nil
+}
+
+// teardownEventJournal stops recording events in the event journal.
+func (c *Core) teardownEventJournal() {
+	if c.events == nil {
+		return
+	}
+
+	c.events.UnloadJournal()
+}
+
+// setupEventSinks starts the configured event sinks. Sinks only run on the
+// active node, so that every event is forwarded once. This should only be
+// called with the core state lock held for writing.
+func (c *Core) setupEventSinks(ctx context.Context) error {
+	if c.events == nil || c.IsDRSecondary() {
+		return nil
+	}
+
+	view := c.systemBarrierView.SubView(eventSinksSubPath)
+	if err := c.events.LoadSinks(ctx, view); err != nil {
+		return fmt.Errorf("failed to load event sinks: %w", err)
+	}
+
+	return nil
+}
+
+// teardownEventSinks stops the event sinks.
+func (c *Core) teardownEventSinks() {
+	if c.events == nil {
+		return
+	}
+
+	c.events.UnloadSinks()
+}
+
+// EventAuthorizer returns a function that reports whether the token may
+// receive an event sent in ns or one of its children. The token's policies
+// are checked for every event, so that revoking the token or changing its
+// policies applies to subscriptions that are already open. An event is only
+// delivered if the token has the read, list or subscribe capability on the
+// event's data path, or on its mount path if it has no data path. Events that
+// are about neither, such as those sent by Vault itself, are delivered to
+// every subscriber of their namespace.
+func (c *Core) EventAuthorizer(token string, ns *namespace.Namespace) func(context.Context, *logical.EventReceived) bool {
+	return func(ctx context.Context, event *logical.EventReceived) bool {
+		if !strings.HasPrefix(event.Namespace, ns.Path) {
+			return false
+		}
+
+		path := eventbus.DataPath(event)
+		if path == "" {
+			path = event.GetPluginInfo().GetMountPath()
+		}
+		if path == "" && event.Namespace == ns.Path {
+			return true
+		}
+
+		// Capabilities are checked relative to the subscription's namespace
+		path = strings.TrimPrefix(event.Namespace, ns.Path) + path
+		capabilities, err := c.Capabilities(namespace.ContextWithNamespace(ctx, ns), token, path)
+		if err != nil {
+			c.logger.Debug("error checking capabilities for event", "event_id", event.GetEvent().GetId(), "error", err)
+			return false
+		}
+
+		for _, capability := range capabilities {
+			switch capability {
+			case RootCapability, ReadCapability, ListCapability, SubscribeCapability:
+				return true
+			}
+		}
+		return false
+	}
+}
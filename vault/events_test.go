@@ -10,6 +10,7 @@ import (
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/sdk/logical"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 func TestCanSendEventsFromBuiltinPlugin(t *testing.T) {
@@ -57,3 +58,235 @@ func TestCanSendEventsFromBuiltinPlugin(t *testing.T) {
 		t.Error("timeout waiting for event")
 	}
 }
+
+// TestEventJournal verifies that the event journal is configured through the
+// system backend, and that its events survive sealing and unsealing.
+func TestEventJournal(t *testing.T) {
+	c, keys, root := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/events/journal")
+	req.ClientToken = root
+	req.Data = map[string]interface{}{
+		"enabled":    true,
+		"max_events": 5,
+	}
+	resp, err := c.HandleRequest(ctx, req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	eventType, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for i := 0; i < 2; i++ {
+		event, err := logical.NewEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.cubbyholeBackend.SendEvent(ctx, logical.EventType(eventType), event); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, event.Id)
+	}
+
+	if err := TestCoreSeal(c); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if _, err := TestCoreUnseal(c, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/events/journal")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(ctx, req)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if resp.Data["enabled"] != true || resp.Data["max_events"] != 5 {
+		t.Fatalf("unexpected journal configuration: %#v", resp.Data)
+	}
+
+	ch, cancel, err := c.events.SubscribeFrom(ctx, namespace.RootNamespace, eventType, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	select {
+	case receivedEvent := <-ch:
+		received := receivedEvent.Payload.(*logical.EventReceived)
+		if received.Event.Id != ids[1] {
+			t.Errorf("Got wrong event: %+v, expected %s", received, ids[1])
+		}
+	case <-time.After(1 * time.Second):
+		t.Error("timeout waiting for event")
+	}
+}
+
+// TestEventSinks verifies that event sinks are managed through the system
+// backend.
+func TestEventSinks(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/events/sinks/deploys")
+	req.ClientToken = root
+	req.Data = map[string]interface{}{
+		"pattern": "kv*",
+		"url":     "ftp://example.com/",
+		"secret":  "secret",
+	}
+	resp, err := c.HandleRequest(ctx, req)
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for a non-http URL, got err: %v, resp: %#v", err, resp)
+	}
+
+	req.Data["url"] = "https://example.com/hook"
+	req.Data["filter"] = `mount == "secret/"`
+	resp, err = c.HandleRequest(ctx, req)
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for an invalid filter, got err: %v, resp: %#v", err, resp)
+	}
+
+	req.Data["filter"] = `mount_path == "secret/"`
+	resp, err = c.HandleRequest(ctx, req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ListOperation, "sys/events/sinks")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(ctx, req)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "deploys" {
+		t.Fatalf("unexpected sinks: %v", keys)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/events/sinks/deploys")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(ctx, req)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if resp.Data["url"] != "https://example.com/hook" || resp.Data["filter"] != `mount_path == "secret/"` || resp.Data["max_retries"] != 3 {
+		t.Fatalf("unexpected sink configuration: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["secret"]; ok {
+		t.Fatal("expected the secret not to be returned")
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/events/sinks/deploys")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(ctx, req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if names := c.events.Sinks().List(namespace.RootNamespaceID); len(names) != 0 {
+		t.Fatalf("expected no sinks, got %v", names)
+	}
+}
+
+// TestEventAuthorizer verifies that events are only delivered to tokens that
+// have the read, list or subscribe capability on their data path.
+func TestEventAuthorizer(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	policy, err := ParseACLPolicy(namespace.RootNamespace, `
+name = "events"
+path "secret/data/app/*" {
+	capabilities = ["subscribe"]
+}
+path "secret/data/team/*" {
+	capabilities = ["read"]
+}
+path "secret/data/app/private" {
+	capabilities = ["deny"]
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.policyStore.SetPolicy(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+	testMakeServiceTokenViaBackend(t, c.tokenStore, root, "client", "", []string{"events"})
+
+	newEvent := func(path string) *logical.EventReceived {
+		metadata, err := structpb.NewStruct(map[string]interface{}{"path": path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &logical.EventReceived{
+			EventType:  "kv-v2/data-write",
+			Event:      &logical.EventData{Id: "abc", Metadata: metadata},
+			PluginInfo: &logical.EventPluginInfo{MountPath: "secret/"},
+		}
+	}
+
+	cases := map[string]bool{
+		"data/app/foo":     true,
+		"data/team/foo":    true,
+		"data/app/private": false,
+		"data/other":       false,
+	}
+
+	authorize := c.EventAuthorizer("client", namespace.RootNamespace)
+	rootAuthorize := c.EventAuthorizer(root, namespace.RootNamespace)
+	for path, expected := range cases {
+		if actual := authorize(ctx, newEvent(path)); actual != expected {
+			t.Errorf("%s: expected %v, got %v", path, expected, actual)
+		}
+		if !rootAuthorize(ctx, newEvent(path)) {
+			t.Errorf("%s: expected the root token to be authorized", path)
+		}
+	}
+
+	// Events that are not about any path are only checked by the
+	// subscription itself
+	if !authorize(ctx, &logical.EventReceived{EventType: "internal", Event: &logical.EventData{Id: "abc"}}) {
+		t.Error("expected an event without a path to be authorized")
+	}
+
+	if c.EventAuthorizer("invalid", namespace.RootNamespace)(ctx, newEvent("data/app/foo")) {
+		t.Error("expected an invalid token not to be authorized")
+	}
+}
+
+// TestSubscribeCapabilityMountAccess verifies that the subscribe capability
+// does not make a mount visible, as that would reveal its metadata to
+// tokens that can only receive its events.
+func TestSubscribeCapabilityMountAccess(t *testing.T) {
+	ctx := namespace.RootContext(nil)
+
+	policy, err := ParseACLPolicy(namespace.RootNamespace, `
+name = "events"
+path "secret/*" {
+	capabilities = ["subscribe"]
+}
+path "kv/*" {
+	capabilities = ["read"]
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl, err := NewACL(ctx, []*Policy{policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hasMountAccess(ctx, acl, "secret/") {
+		t.Error("expected the subscribe capability not to give access to the mount")
+	}
+	if !hasMountAccess(ctx, acl, "kv/") {
+		t.Error("expected the read capability to give access to the mount")
+	}
+}
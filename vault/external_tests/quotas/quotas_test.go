@@ -4,6 +4,7 @@
 package quotas
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 	"time"
@@ -542,3 +543,213 @@ func TestQuotas_RateLimitQuota(t *testing.T) {
 		t.Fatalf("unexpected number of failed requests: %d", numFail)
 	}
 }
+
+func TestQuotas_LeaseCountQuota(t *testing.T) {
+	conf, opts := teststorage.ClusterSetup(coreConfig, nil, nil)
+	opts.NoDefaultQuotas = true
+	cluster := vault.NewTestCluster(t, conf, opts)
+	cluster.Start()
+	defer cluster.Cleanup()
+	core := cluster.Cores[0].Core
+	client := cluster.Cores[0].Client
+	vault.TestWaitActive(t, core)
+
+	setupMounts(t, client)
+
+	issue := func() (*api.Secret, error) {
+		return client.Logical().Write("pki/issue/test", map[string]interface{}{
+			"common_name": "test.testvault.com",
+		})
+	}
+
+	// Lease created before the quota is counted when the quota is set
+	s, err := issue()
+	require.NoError(t, err)
+	firstLease := s.LeaseID
+
+	_, err = client.Logical().Write("sys/quotas/lease-count/pki-lcq", map[string]interface{}{
+		"path":       "pki/",
+		"max_leases": 2,
+	})
+	require.NoError(t, err)
+
+	_, err = issue()
+	require.NoError(t, err)
+
+	// Rejected requests are not routed, so no certificate is issued for them
+	_, err = issue()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), logical.ErrLeaseCountQuotaExceeded.Error())
+
+	// Requests that do not create leases are not held back
+	_, err = client.Logical().Read("pki/roles/test")
+	require.NoError(t, err)
+	certs, err := client.Logical().List("pki/certs")
+	require.NoError(t, err)
+	require.Len(t, certs.Data["keys"], 3)
+
+	s, err = client.Logical().Read("sys/quotas/lease-count/pki-lcq")
+	require.NoError(t, err)
+	require.Equal(t, "pki/", s.Data["path"])
+	require.EqualValues(t, "2", s.Data["max_leases"].(json.Number).String())
+	require.EqualValues(t, "2", s.Data["counter"].(json.Number).String())
+
+	// Revoking a lease frees up room for another one
+	require.NoError(t, client.Sys().Revoke(firstLease))
+	_, err = issue()
+	require.NoError(t, err)
+
+	s, err = client.Logical().List("sys/quotas/lease-count")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"pki-lcq"}, s.Data["keys"])
+
+	_, err = client.Logical().Delete("sys/quotas/lease-count/pki-lcq")
+	require.NoError(t, err)
+
+	_, err = issue()
+	require.NoError(t, err)
+}
+
+func TestQuotas_RateLimitQuota_KeyByTokenAccessor(t *testing.T) {
+	conf, opts := teststorage.ClusterSetup(coreConfig, nil, nil)
+	opts.NoDefaultQuotas = true
+	cluster := vault.NewTestCluster(t, conf, opts)
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	core := cluster.Cores[0].Core
+	client := cluster.Cores[0].Client
+	vault.TestWaitActive(t, core)
+
+	newClient := func() *api.Client {
+		t.Helper()
+		secret, err := client.Auth().Token().Create(&api.TokenCreateRequest{
+			Policies: []string{"default"},
+		})
+		require.NoError(t, err)
+
+		c, err := client.Clone()
+		require.NoError(t, err)
+		c.SetToken(secret.Auth.ClientToken)
+		return c
+	}
+	client1, client2 := newClient(), newClient()
+
+	_, err := client.Logical().Write("sys/quotas/rate-limit/lookup-self", map[string]interface{}{
+		"path":     "auth/token/lookup-self",
+		"rate":     1,
+		"interval": "1m",
+		"key_by":   "token_accessor",
+	})
+	require.NoError(t, err)
+
+	s, err := client.Logical().Read("sys/quotas/rate-limit/lookup-self")
+	require.NoError(t, err)
+	require.Equal(t, "token_accessor", s.Data["key_by"])
+
+	// Both tokens come from the same address, but are limited separately
+	_, err = client1.Auth().Token().LookupSelf()
+	require.NoError(t, err)
+	_, err = client1.Auth().Token().LookupSelf()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "429")
+
+	_, err = client2.Auth().Token().LookupSelf()
+	require.NoError(t, err)
+
+	_, err = client.Logical().Write("sys/quotas/rate-limit/lookup-self", map[string]interface{}{
+		"rate":   1,
+		"key_by": "header",
+	})
+	require.Error(t, err)
+}
+
+func TestQuotas_ConcurrencyQuota(t *testing.T) {
+	conf, opts := teststorage.ClusterSetup(coreConfig, nil, nil)
+	opts.NoDefaultQuotas = true
+	opts.RequestResponseCallback = schema.ResponseValidatingCallback(t)
+	cluster := vault.NewTestCluster(t, conf, opts)
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	core := cluster.Cores[0].Core
+	client := cluster.Cores[0].Client
+	vault.TestWaitActive(t, core)
+
+	_, err := client.Logical().Write("sys/quotas/concurrency/cq", map[string]interface{}{
+		"path":         "sys/quotas/concurrency/*",
+		"max_requests": 1,
+	})
+	require.NoError(t, err)
+
+	// The read is itself executing under the quota
+	s, err := client.Logical().Read("sys/quotas/concurrency/cq")
+	require.NoError(t, err)
+	require.Equal(t, "sys/quotas/concurrency/*", s.Data["path"])
+	require.Equal(t, json.Number("1"), s.Data["max_requests"])
+	require.Equal(t, json.Number("1"), s.Data["queue_timeout"])
+	require.Equal(t, json.Number("1"), s.Data["in_flight"])
+
+	s, err = client.Logical().List("sys/quotas/concurrency")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"cq"}, s.Data["keys"])
+
+	_, err = client.Logical().Write("sys/quotas/concurrency/cq", map[string]interface{}{
+		"max_requests": 0,
+	})
+	require.Error(t, err)
+
+	_, err = client.Logical().Delete("sys/quotas/concurrency/cq")
+	require.NoError(t, err)
+}
+
+func TestQuotas_ShadowMode(t *testing.T) {
+	conf, opts := teststorage.ClusterSetup(coreConfig, nil, nil)
+	opts.NoDefaultQuotas = true
+	opts.RequestResponseCallback = schema.ResponseValidatingCallback(t)
+	cluster := vault.NewTestCluster(t, conf, opts)
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	core := cluster.Cores[0].Core
+	client := cluster.Cores[0].Client
+	vault.TestWaitActive(t, core)
+
+	_, err := client.Logical().Write("sys/quotas/rate-limit/rlq", map[string]interface{}{
+		"path":     "sys/quotas/rate-limit/*",
+		"rate":     1,
+		"interval": "1m",
+		"mode":     "invalid",
+	})
+	require.Error(t, err)
+
+	_, err = client.Logical().Write("sys/quotas/rate-limit/rlq", map[string]interface{}{
+		"path":     "sys/quotas/rate-limit/*",
+		"rate":     1,
+		"interval": "1m",
+		"mode":     "shadow",
+	})
+	require.NoError(t, err)
+
+	// Requests over the limit are allowed in shadow mode
+	for i := 0; i < 3; i++ {
+		s, err := client.Logical().Read("sys/quotas/rate-limit/rlq")
+		require.NoError(t, err)
+		require.Equal(t, "shadow", s.Data["mode"])
+	}
+
+	// The update itself is still allowed, being made in shadow mode
+	_, err = client.Logical().Write("sys/quotas/rate-limit/rlq", map[string]interface{}{
+		"path":     "sys/quotas/rate-limit/*",
+		"rate":     1,
+		"interval": "1m",
+		"mode":     "enforce",
+	})
+	require.NoError(t, err)
+
+	_, err = client.Logical().Read("sys/quotas/rate-limit/rlq")
+	require.NoError(t, err)
+	_, err = client.Logical().Read("sys/quotas/rate-limit/rlq")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "429")
+}
@@ -200,6 +200,7 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 	b.Backend.Paths = append(b.Backend.Paths, b.rootActivityPaths()...)
 	b.Backend.Paths = append(b.Backend.Paths, b.loginMFAPaths()...)
 	b.Backend.Paths = append(b.Backend.Paths, b.experimentPaths()...)
+	b.Backend.Paths = append(b.Backend.Paths, b.eventsPaths()...)
 	b.Backend.Paths = append(b.Backend.Paths, b.introspectionPaths()...)
 
 	if core.rawEnabled {
@@ -3217,12 +3218,45 @@ func (b *SystemBackend) handleAuditTable(ctx context.Context, req *logical.Reque
 func (b *SystemBackend) handleAuditHash(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	path := data.Get("path").(string)
 	input := data.Get("input").(string)
-	if input == "" {
+	rawInputs := data.Get("inputs").([]interface{})
+	inputs := make([]string, 0, len(rawInputs))
+	for _, raw := range rawInputs {
+		// Audit entries are hashed as they are, so unlike string slices the
+		// inputs must not be split or trimmed
+		input, ok := raw.(string)
+		if !ok {
+			return logical.ErrorResponse("the \"inputs\" parameter must be a list of strings"), nil
+		}
+		inputs = append(inputs, input)
+	}
+	switch {
+	case input != "" && len(inputs) > 0:
+		return logical.ErrorResponse("only one of \"input\" or \"inputs\" may be given"), nil
+	case input == "" && len(inputs) == 0:
 		return logical.ErrorResponse("the \"input\" parameter is empty"), nil
 	}
 
 	path = sanitizePath(path)
 
+	// Hash a batch in one request, as verifying an audit log line by line
+	// would otherwise take a request (and audit entry) per line
+	if len(inputs) > 0 {
+		hashes := make([]string, 0, len(inputs))
+		for _, input := range inputs {
+			hash, err := b.Core.auditBroker.GetHash(ctx, path, input)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			hashes = append(hashes, hash)
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"hashes": hashes,
+			},
+		}, nil
+	}
+
 	hash, err := b.Core.auditBroker.GetHash(ctx, path, input)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
@@ -3235,6 +3269,27 @@ func (b *SystemBackend) handleAuditHash(ctx context.Context, req *logical.Reques
 	}, nil
 }
 
+// handleAuditHashChain returns the last entry the audit backend linked into
+// its hash chain, so that a log can be checked for entries missing at its end
+func (b *SystemBackend) handleAuditHashChain(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := sanitizePath(data.Get("path").(string))
+
+	head, err := b.Core.auditBroker.GetHashChainHead(ctx, path)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if head == nil {
+		return logical.ErrorResponse(fmt.Sprintf("audit backend %q does not chain its entries", path)), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"seq":  head.Seq,
+			"hmac": head.HMAC,
+		},
+	}, nil
+}
+
 // handleEnableAudit is used to enable a new audit backend
 func (b *SystemBackend) handleEnableAudit(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	repState := b.Core.ReplicationState()
@@ -4133,10 +4188,12 @@ func hasMountAccess(ctx context.Context, acl *ACL, path string) bool {
 	}
 
 	// If a policy is giving us direct access to the mount path then we can do
-	// a fast return.
-	capabilities := acl.Capabilities(ctx, ns.TrimmedPath(path))
-	if !strutil.StrListContains(capabilities, DenyCapability) {
-		return true
+	// a fast return. Being able to receive a mount's events does not give
+	// access to the mount itself.
+	for _, capability := range acl.Capabilities(ctx, ns.TrimmedPath(path)) {
+		if capability != DenyCapability && capability != SubscribeCapability {
+			return true
+		}
 	}
 
 	var aclCapabilitiesGiven bool
@@ -4173,7 +4230,7 @@ func hasMountAccess(ctx context.Context, acl *ACL, path string) bool {
 	}
 
 	if !aclCapabilitiesGiven {
-		if perms := acl.CheckAllowedFromNonExactPaths(path, true); perms != nil {
+		if perms := acl.CheckAllowedFromNonExactPaths(path, true); perms != nil && perms.CapabilitiesBitmap != SubscribeCapabilityInt {
 			return true
 		}
 	}
@@ -4477,6 +4534,9 @@ func (b *SystemBackend) pathInternalUIResultantACL(ctx context.Context, req *log
 		if perms.CapabilitiesBitmap&PatchCapabilityInt > 0 {
 			capabilities = append(capabilities, PatchCapability)
 		}
+		if perms.CapabilitiesBitmap&SubscribeCapabilityInt > 0 {
+			capabilities = append(capabilities, SubscribeCapability)
+		}
 
 		// If "deny" is explicitly set or if the path has no capabilities at all,
 		// set the path capabilities to "deny"
@@ -5658,7 +5718,11 @@ or delete a policy.
 
 	"audit-hash": {
 		"The hash of the given string via the given audit backend",
-		"",
+		`
+Writing to this path hashes the given input, or list of inputs, with the salt
+of the audit backend. Reading it returns the sequence number and HMAC of the
+last entry written by an audit backend which chains its entries.
+		`,
 	},
 
 	"audit-table": {
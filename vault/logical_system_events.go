@@ -0,0 +1,585 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package vault
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault/eventbus"
+)
+
+// eventsPaths returns paths for configuring the event system
+func (b *SystemBackend) eventsPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "events/journal$",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "events-journal",
+			},
+
+			Fields: map[string]*framework.FieldSchema{
+				"enabled": {
+					Type:        framework.TypeBool,
+					Description: "If set, events sent in this namespace are recorded so that subscribers can replay the events they missed.",
+				},
+				"max_events": {
+					Type:        framework.TypeInt,
+					Description: "The number of most recent events to keep in the journal.",
+					Default:     eventbus.DefaultJournalMaxEvents,
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleEventsJournalRead,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationSuffix: "configuration",
+					},
+					Summary: "Return the event journal configuration of the namespace.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Fields: map[string]*framework.FieldSchema{
+								"enabled": {
+									Type:     framework.TypeBool,
+									Required: true,
+								},
+								"max_events": {
+									Type:     framework.TypeInt,
+									Required: true,
+								},
+							},
+						}},
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleEventsJournalUpdate,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb: "configure",
+					},
+					Summary: "Configure the event journal of the namespace.",
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: "OK",
+						}},
+					},
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(eventsHelp["events-journal"][0]),
+			HelpDescription: strings.TrimSpace(eventsHelp["events-journal"][1]),
+		},
+		{
+			Pattern: "events/sinks/?$",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "events-sinks",
+				OperationVerb:   "list",
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handleEventsSinksList,
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Fields: map[string]*framework.FieldSchema{
+								"keys": {
+									Type:     framework.TypeStringSlice,
+									Required: true,
+								},
+							},
+						}},
+					},
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(eventsHelp["events-sinks-list"][0]),
+			HelpDescription: strings.TrimSpace(eventsHelp["events-sinks-list"][1]),
+		},
+		{
+			Pattern: "events/sinks/" + framework.GenericNameRegex("name") + "$",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "events-sinks",
+			},
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the sink.",
+				},
+				"type": {
+					Type:        framework.TypeString,
+					Description: `Type of the sink. Only "webhook" is supported.`,
+					Default:     eventbus.SinkTypeWebhook,
+				},
+				"pattern": {
+					Type:        framework.TypeString,
+					Description: "Event type to forward, which may contain wildcards (*), as for subscriptions.",
+				},
+				"filter": {
+					Type:        framework.TypeString,
+					Description: "Boolean expression over the event's metadata that events must match to be forwarded, as for subscriptions.",
+				},
+				"url": {
+					Type:        framework.TypeString,
+					Description: "URL that events are posted to.",
+				},
+				"secret": {
+					Type:        framework.TypeString,
+					Description: "Secret used to sign the requests sent to the webhook with HMAC-SHA256.",
+					DisplayAttrs: &framework.DisplayAttributes{
+						Sensitive: true,
+					},
+				},
+				"max_retries": {
+					Type:        framework.TypeInt,
+					Description: "Number of times delivery of an event is retried before it is dead-lettered.",
+					Default:     eventbus.DefaultSinkMaxRetries,
+				},
+				"retry_backoff": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Time to wait before the first retry. It doubles with every retry.",
+					Default:     int(eventbus.DefaultSinkRetryBackoff.Seconds()),
+				},
+				"request_timeout": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Timeout of each request to the webhook.",
+					Default:     int(eventbus.DefaultSinkRequestTimeout.Seconds()),
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleEventsSinkRead,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb: "read",
+					},
+					Summary: "Return the configuration of an event sink.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Fields: map[string]*framework.FieldSchema{
+								"name": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"type": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"pattern": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"filter": {
+									Type:     framework.TypeString,
+									Required: false,
+								},
+								"url": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"max_retries": {
+									Type:     framework.TypeInt,
+									Required: true,
+								},
+								"retry_backoff": {
+									Type:     framework.TypeDurationSecond,
+									Required: true,
+								},
+								"request_timeout": {
+									Type:     framework.TypeDurationSecond,
+									Required: true,
+								},
+							},
+						}},
+					},
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleEventsSinkUpdate,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb: "write",
+					},
+					Summary: "Create or update an event sink.",
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: "OK",
+						}},
+					},
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleEventsSinkDelete,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb: "delete",
+					},
+					Summary: "Delete an event sink and the events it could not deliver.",
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: "OK",
+						}},
+					},
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(eventsHelp["events-sinks"][0]),
+			HelpDescription: strings.TrimSpace(eventsHelp["events-sinks"][1]),
+		},
+		{
+			Pattern: "events/sinks/" + framework.GenericNameRegex("name") + "/dead-letter$",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "events-sinks",
+			},
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the sink.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleEventsSinkDeadLetterRead,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb:   "read",
+						OperationSuffix: "dead-letters",
+					},
+					Summary: "Return the events an event sink could not deliver.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Fields: map[string]*framework.FieldSchema{
+								"events": {
+									Type:     framework.TypeSlice,
+									Required: true,
+								},
+							},
+						}},
+					},
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleEventsSinkDeadLetterDelete,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb:   "delete",
+						OperationSuffix: "dead-letters",
+					},
+					Summary: "Remove the events an event sink could not deliver.",
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: "OK",
+						}},
+					},
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(eventsHelp["events-sinks-dead-letter"][0]),
+			HelpDescription: strings.TrimSpace(eventsHelp["events-sinks-dead-letter"][1]),
+		},
+	}
+}
+
+func (b *SystemBackend) eventJournal() (*eventbus.Journal, error) {
+	if b.Core.events == nil {
+		return nil, errors.New("events are not available")
+	}
+	journal := b.Core.events.Journal()
+	if journal == nil {
+		return nil, errors.New("event journal is not loaded")
+	}
+	return journal, nil
+}
+
+func (b *SystemBackend) handleEventsJournalRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	journal, err := b.eventJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	config := journal.Config(ns.ID)
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":    config.Enabled,
+			"max_events": config.MaxEvents,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleEventsJournalUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	journal, err := b.eventJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	config := journal.Config(ns.ID)
+	if enabledRaw, ok := d.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+	if maxEventsRaw, ok := d.GetOk("max_events"); ok {
+		config.MaxEvents = maxEventsRaw.(int)
+		if config.MaxEvents <= 0 {
+			return logical.ErrorResponse("max_events must be greater than zero"), logical.ErrInvalidRequest
+		}
+	}
+
+	if err := journal.SetConfig(ctx, ns.ID, config); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) eventSinks() (*eventbus.SinkManager, error) {
+	if b.Core.events == nil {
+		return nil, errors.New("events are not available")
+	}
+	sinks := b.Core.events.Sinks()
+	if sinks == nil {
+		return nil, errors.New("event sinks are not loaded")
+	}
+	return sinks, nil
+}
+
+func (b *SystemBackend) handleEventsSinksList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sinks, err := b.eventSinks()
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(sinks.List(ns.ID)), nil
+}
+
+func (b *SystemBackend) handleEventsSinkRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sinks, err := b.eventSinks()
+	if err != nil {
+		return nil, err
+	}
+
+	config := sinks.Get(ns.ID, d.Get("name").(string))
+	if config == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":            config.Name,
+			"type":            config.Type,
+			"pattern":         config.Pattern,
+			"filter":          config.Filter,
+			"url":             config.URL,
+			"max_retries":     config.MaxRetries,
+			"retry_backoff":   int64(config.RetryBackoff.Seconds()),
+			"request_timeout": int64(config.RequestTimeout.Seconds()),
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleEventsSinkUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sinks, err := b.eventSinks()
+	if err != nil {
+		return nil, err
+	}
+
+	name := d.Get("name").(string)
+	config := sinks.Get(ns.ID, name)
+	if config == nil {
+		config = &eventbus.SinkConfig{
+			Name:           name,
+			NamespaceID:    ns.ID,
+			NamespacePath:  ns.Path,
+			Type:           d.Get("type").(string),
+			MaxRetries:     d.Get("max_retries").(int),
+			RetryBackoff:   time.Duration(d.Get("retry_backoff").(int)) * time.Second,
+			RequestTimeout: time.Duration(d.Get("request_timeout").(int)) * time.Second,
+		}
+	}
+
+	if typeRaw, ok := d.GetOk("type"); ok {
+		config.Type = typeRaw.(string)
+	}
+	if patternRaw, ok := d.GetOk("pattern"); ok {
+		config.Pattern = strings.TrimSpace(patternRaw.(string))
+	}
+	if filterRaw, ok := d.GetOk("filter"); ok {
+		config.Filter = strings.TrimSpace(filterRaw.(string))
+	}
+	if urlRaw, ok := d.GetOk("url"); ok {
+		config.URL = urlRaw.(string)
+	}
+	if secretRaw, ok := d.GetOk("secret"); ok {
+		config.Secret = secretRaw.(string)
+	}
+	if maxRetriesRaw, ok := d.GetOk("max_retries"); ok {
+		config.MaxRetries = maxRetriesRaw.(int)
+	}
+	if retryBackoffRaw, ok := d.GetOk("retry_backoff"); ok {
+		config.RetryBackoff = time.Duration(retryBackoffRaw.(int)) * time.Second
+	}
+	if requestTimeoutRaw, ok := d.GetOk("request_timeout"); ok {
+		config.RequestTimeout = time.Duration(requestTimeoutRaw.(int)) * time.Second
+	}
+
+	switch {
+	case config.Type != eventbus.SinkTypeWebhook:
+		return logical.ErrorResponse("unsupported sink type %q", config.Type), logical.ErrInvalidRequest
+	case config.Pattern == "":
+		return logical.ErrorResponse("pattern is required"), logical.ErrInvalidRequest
+	case config.Secret == "":
+		return logical.ErrorResponse("secret is required"), logical.ErrInvalidRequest
+	case config.MaxRetries < 0:
+		return logical.ErrorResponse("max_retries must not be negative"), logical.ErrInvalidRequest
+	case config.RetryBackoff <= 0:
+		return logical.ErrorResponse("retry_backoff must be greater than zero"), logical.ErrInvalidRequest
+	case config.RequestTimeout <= 0:
+		return logical.ErrorResponse("request_timeout must be greater than zero"), logical.ErrInvalidRequest
+	}
+
+	if config.Filter != "" {
+		if _, err := eventbus.NewFilter(config.Filter); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+	}
+
+	u, err := url.Parse(config.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return logical.ErrorResponse("url must be an http or https URL"), logical.ErrInvalidRequest
+	}
+
+	if err := sinks.Put(ctx, config); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleEventsSinkDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sinks, err := b.eventSinks()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sinks.Delete(ctx, ns.ID, d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleEventsSinkDeadLetterRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sinks, err := b.eventSinks()
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetters, err := sinks.DeadLetters(ctx, ns.ID, d.Get("name").(string))
+	if errors.Is(err, eventbus.ErrSinkNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]map[string]interface{}, 0, len(deadLetters))
+	for _, deadLetter := range deadLetters {
+		var event map[string]interface{}
+		if err := jsonutil.DecodeJSON(deadLetter.Event, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, map[string]interface{}{
+			"time":  deadLetter.Time.Format(time.RFC3339Nano),
+			"error": deadLetter.Error,
+			"event": event,
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"events": events,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleEventsSinkDeadLetterDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sinks, err := b.eventSinks()
+	if err != nil {
+		return nil, err
+	}
+
+	err = sinks.ClearDeadLetters(ctx, ns.ID, d.Get("name").(string))
+	if err != nil && !errors.Is(err, eventbus.ErrSinkNotFound) {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+var eventsHelp = map[string][2]string{
+	"events-journal": {
+		"Configure the event journal of the namespace.",
+		`When the event journal is enabled, the most recent events sent in the
+namespace are stored, so that a subscriber that reconnects can pass the ID of
+the last event it received and be sent the events it missed before live ones.`,
+	},
+	"events-sinks-list": {
+		"List the event sinks of the namespace.",
+		"",
+	},
+	"events-sinks": {
+		"Create, read, update or delete an event sink.",
+		`An event sink forwards the events of the namespace that match its pattern
+to a webhook. Each event is posted as a CloudEvents JSON document, signed with
+an HMAC-SHA256 of the request's timestamp and body keyed with the sink's secret.
+Deliveries that still fail after the configured retries are dead-lettered.
+Sinks are run by the active node and are restarted after a restart or leader
+election.`,
+	},
+	"events-sinks-dead-letter": {
+		"Read or remove the events an event sink could not deliver.",
+		"",
+	},
+}
@@ -1506,9 +1506,35 @@ func (b *SystemBackend) auditPaths() []*framework.Path {
 				"input": {
 					Type: framework.TypeString,
 				},
+
+				"inputs": {
+					Type:        framework.TypeSlice,
+					Description: "A list of strings to hash in a single request, instead of input. The strings are hashed exactly as given.",
+				},
 			},
 
 			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleAuditHashChain,
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb:   "read",
+						OperationSuffix: "hash-chain",
+					},
+					Summary: "Read the last entry the audit device linked into its hash chain.",
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Fields: map[string]*framework.FieldSchema{
+								"seq": {
+									Type: framework.TypeInt64,
+								},
+								"hmac": {
+									Type: framework.TypeString,
+								},
+							},
+						}},
+					},
+				},
 				logical.UpdateOperation: &framework.PathOperation{
 					Callback: b.handleAuditHash,
 					Responses: map[int][]framework.Response{
@@ -1516,8 +1542,10 @@ func (b *SystemBackend) auditPaths() []*framework.Path {
 							Description: "OK",
 							Fields: map[string]*framework.FieldSchema{
 								"hash": {
-									Type:     framework.TypeString,
-									Required: true,
+									Type: framework.TypeString,
+								},
+								"hashes": {
+									Type: framework.TypeStringSlice,
 								},
 							},
 						}},
@@ -134,6 +134,13 @@ namespace1/auth/userpass adds a quota to userpass in namespace1.`,
 					Type: framework.TypeString,
 					Description: `Login role to apply this quota to. Note that when set, path must be configured
 to a valid auth method with a concept of roles.`,
+				},
+				"mode": {
+					Type:    framework.TypeString,
+					Default: quotas.ModeEnforce,
+					Description: `Either 'enforce' or 'shadow'. A quota in shadow mode reports the requests it
+would reject through metrics, logs and the X-Vault-Quota-Shadow-Violation request
+header, but allows them.`,
 				},
 				"rate": {
 					Type: framework.TypeFloat,
@@ -149,6 +156,17 @@ The 'rate' must be positive.`,
 					Description: `If set, when a client reaches a rate limit threshold, the client will be prohibited
 from any further requests until after the 'block_interval' has elapsed.`,
 				},
+				"key_by": {
+					Type:    framework.TypeString,
+					Default: quotas.KeyByClientIP,
+					Description: `What requests are grouped by, each group being rate limited separately. One of
+'client_ip', 'entity_id', 'token_accessor', 'role' or 'header'. Requests that lack
+the selected property are grouped by client IP address.`,
+				},
+				"key_header": {
+					Type:        framework.TypeString,
+					Description: "Name of the request header to group requests by, when 'key_by' is 'header'. The header is set by the client, so it should be one a trusted proxy overwrites.",
+				},
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.UpdateOperation: &framework.PathOperation{
@@ -187,6 +205,10 @@ from any further requests until after the 'block_interval' has elapsed.`,
 									Type:     framework.TypeString,
 									Required: true,
 								},
+								"mode": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
 								"rate": {
 									Type:     framework.TypeFloat,
 									Required: true,
@@ -199,6 +221,14 @@ from any further requests until after the 'block_interval' has elapsed.`,
 									Type:     framework.TypeInt,
 									Required: true,
 								},
+								"key_by": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"key_header": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
 							},
 						}},
 					},
@@ -218,6 +248,286 @@ from any further requests until after the 'block_interval' has elapsed.`,
 			HelpSynopsis:    strings.TrimSpace(quotasHelp["rate-limit"][0]),
 			HelpDescription: strings.TrimSpace(quotasHelp["rate-limit"][1]),
 		},
+		{
+			Pattern: "quotas/lease-count/?$",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "lease-count-quotas",
+				OperationVerb:   "list",
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasList(),
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Fields: map[string]*framework.FieldSchema{
+								"keys": {
+									Type:     framework.TypeStringSlice,
+									Required: true,
+								},
+							},
+						}},
+					},
+				},
+			},
+			HelpSynopsis:    strings.TrimSpace(quotasHelp["lease-count-list"][0]),
+			HelpDescription: strings.TrimSpace(quotasHelp["lease-count-list"][1]),
+		},
+		{
+			Pattern: "quotas/lease-count/" + framework.GenericNameRegex("name"),
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "lease-count-quotas",
+			},
+
+			Fields: map[string]*framework.FieldSchema{
+				"type": {
+					Type:        framework.TypeString,
+					Description: "Type of the quota rule.",
+				},
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the quota rule.",
+				},
+				"path": {
+					Type: framework.TypeString,
+					Description: `Path of the mount or namespace to apply the quota. A blank path configures a
+global quota. For example namespace1/ adds a quota to a full namespace,
+namespace1/auth/userpass adds a quota to userpass in namespace1.`,
+				},
+				"role": {
+					Type: framework.TypeString,
+					Description: `Login role to apply this quota to. Note that when set, path must be configured
+to a valid auth method with a concept of roles.`,
+				},
+				"mode": {
+					Type:    framework.TypeString,
+					Default: quotas.ModeEnforce,
+					Description: `Either 'enforce' or 'shadow'. A quota in shadow mode reports the requests it
+would reject through metrics, logs and the X-Vault-Quota-Shadow-Violation request
+header, but allows them.`,
+				},
+				"max_leases": {
+					Type: framework.TypeInt,
+					Description: `The maximum number of live leases allowed by the quota rule. The 'max_leases'
+must be positive.`,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasUpdate(),
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb: "write",
+					},
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: http.StatusText(http.StatusNoContent),
+						}},
+					},
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasRead(),
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb: "read",
+					},
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Fields: map[string]*framework.FieldSchema{
+								"type": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"name": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"path": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"role": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"mode": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"max_leases": {
+									Type:     framework.TypeInt,
+									Required: true,
+								},
+								"counter": {
+									Type:     framework.TypeInt,
+									Required: true,
+								},
+							},
+						}},
+					},
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasDelete(),
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb: "delete",
+					},
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: "OK",
+						}},
+					},
+				},
+			},
+			HelpSynopsis:    strings.TrimSpace(quotasHelp["lease-count"][0]),
+			HelpDescription: strings.TrimSpace(quotasHelp["lease-count"][1]),
+		},
+		{
+			Pattern: "quotas/concurrency/?$",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "concurrency-quotas",
+				OperationVerb:   "list",
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handleConcurrencyQuotasList(),
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Fields: map[string]*framework.FieldSchema{
+								"keys": {
+									Type:     framework.TypeStringSlice,
+									Required: true,
+								},
+							},
+						}},
+					},
+				},
+			},
+			HelpSynopsis:    strings.TrimSpace(quotasHelp["concurrency-list"][0]),
+			HelpDescription: strings.TrimSpace(quotasHelp["concurrency-list"][1]),
+		},
+		{
+			Pattern: "quotas/concurrency/" + framework.GenericNameRegex("name"),
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				OperationPrefix: "concurrency-quotas",
+			},
+
+			Fields: map[string]*framework.FieldSchema{
+				"type": {
+					Type:        framework.TypeString,
+					Description: "Type of the quota rule.",
+				},
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the quota rule.",
+				},
+				"path": {
+					Type: framework.TypeString,
+					Description: `Path of the mount or namespace to apply the quota. A blank path configures a
+global quota. For example namespace1/ adds a quota to a full namespace,
+namespace1/auth/userpass adds a quota to userpass in namespace1.`,
+				},
+				"role": {
+					Type: framework.TypeString,
+					Description: `Login role to apply this quota to. Note that when set, path must be configured
+to a valid auth method with a concept of roles.`,
+				},
+				"mode": {
+					Type:    framework.TypeString,
+					Default: quotas.ModeEnforce,
+					Description: `Either 'enforce' or 'shadow'. A quota in shadow mode reports the requests it
+would reject through metrics, logs and the X-Vault-Quota-Shadow-Violation request
+header, but allows them.`,
+				},
+				"max_requests": {
+					Type: framework.TypeInt,
+					Description: `The maximum number of requests allowed to execute at the same time on each node.
+The 'max_requests' must be positive.`,
+				},
+				"queue_timeout": {
+					Type:    framework.TypeDurationSecond,
+					Default: 1,
+					Description: `How long a request waits for a slot once 'max_requests' are executing, before it
+is rejected (default '1s'). Set to 0 to reject such requests right away.`,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleConcurrencyQuotasUpdate(),
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb: "write",
+					},
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: http.StatusText(http.StatusNoContent),
+						}},
+					},
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleConcurrencyQuotasRead(),
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb: "read",
+					},
+					Responses: map[int][]framework.Response{
+						http.StatusOK: {{
+							Description: "OK",
+							Fields: map[string]*framework.FieldSchema{
+								"type": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"name": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"path": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"role": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"mode": {
+									Type:     framework.TypeString,
+									Required: true,
+								},
+								"max_requests": {
+									Type:     framework.TypeInt,
+									Required: true,
+								},
+								"queue_timeout": {
+									Type:     framework.TypeInt,
+									Required: true,
+								},
+								"in_flight": {
+									Type:     framework.TypeInt,
+									Required: true,
+								},
+							},
+						}},
+					},
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleConcurrencyQuotasDelete(),
+					DisplayAttrs: &framework.DisplayAttributes{
+						OperationVerb: "delete",
+					},
+					Responses: map[int][]framework.Response{
+						http.StatusNoContent: {{
+							Description: "OK",
+						}},
+					},
+				},
+			},
+			HelpSynopsis:    strings.TrimSpace(quotasHelp["concurrency"][0]),
+			HelpDescription: strings.TrimSpace(quotasHelp["concurrency"][1]),
+		},
 	}
 }
 
@@ -300,42 +610,29 @@ func (b *SystemBackend) handleRateLimitQuotasUpdate() framework.OperationFunc {
 			return logical.ErrorResponse("'block' is invalid"), nil
 		}
 
-		mountPath := sanitizePath(d.Get("path").(string))
-		ns := b.Core.namespaceByPath(mountPath)
-		if ns.ID != namespace.RootNamespaceID {
-			mountPath = strings.TrimPrefix(mountPath, ns.Path)
-		}
-
-		var pathSuffix string
-		if mountPath != "" {
-			me := b.Core.router.MatchingMountEntry(namespace.ContextWithNamespace(ctx, ns), mountPath)
-			if me == nil {
-				return logical.ErrorResponse("invalid mount path %q", mountPath), nil
+		keyBy := d.Get("key_by").(string)
+		keyHeader := d.Get("key_header").(string)
+		switch keyBy {
+		case quotas.KeyByClientIP, quotas.KeyByEntityID, quotas.KeyByTokenAccessor, quotas.KeyByRole:
+			if keyHeader != "" {
+				return logical.ErrorResponse("'key_header' can only be set when 'key_by' is %q", quotas.KeyByHeader), nil
+			}
+		case quotas.KeyByHeader:
+			if keyHeader == "" {
+				return logical.ErrorResponse("'key_header' is required when 'key_by' is %q", quotas.KeyByHeader), nil
 			}
+		default:
+			return logical.ErrorResponse("'key_by' is invalid"), nil
+		}
 
-			mountAPIPath := me.APIPathNoNamespace()
-			pathSuffix = strings.TrimSuffix(strings.TrimPrefix(mountPath, mountAPIPath), "/")
-			mountPath = mountAPIPath
+		ns, mountPath, pathSuffix, role, errResp := b.quotaTarget(ctx, d)
+		if errResp != nil {
+			return errResp, nil
 		}
 
-		role := d.Get("role").(string)
-		// If this is a quota with a role, ensure the backend supports role resolution
-		if role != "" {
-			if pathSuffix != "" {
-				return logical.ErrorResponse("Quotas cannot contain both a path suffix and a role. If a role is provided, path must be a valid auth mount with a concept of roles"), nil
-			}
-			authBackend := b.Core.router.MatchingBackend(namespace.ContextWithNamespace(ctx, ns), mountPath)
-			if authBackend == nil || authBackend.Type() != logical.TypeCredential {
-				return logical.ErrorResponse("Mount path %q is not a valid auth method and therefore unsuitable for use with role-based quotas", mountPath), nil
-			}
-			// We will always error as we aren't supplying real data, but we're looking for "unsupported operation" in particular
-			_, err := authBackend.HandleRequest(ctx, &logical.Request{
-				Path:      "login",
-				Operation: logical.ResolveRoleOperation,
-			})
-			if err != nil && (err == logical.ErrUnsupportedOperation || err == logical.ErrUnsupportedPath) {
-				return logical.ErrorResponse("Mount path %q does not support use with role-based quotas", mountPath), nil
-			}
+		mode := d.Get("mode").(string)
+		if mode != quotas.ModeEnforce && mode != quotas.ModeShadow {
+			return logical.ErrorResponse("'mode' is invalid"), nil
 		}
 
 		// Disallow creation of new quota that has properties similar to an
@@ -356,7 +653,11 @@ func (b *SystemBackend) handleRateLimitQuotasUpdate() framework.OperationFunc {
 
 		switch {
 		case quota == nil:
-			quota = quotas.NewRateLimitQuota(name, ns.Path, mountPath, pathSuffix, role, rate, interval, blockInterval)
+			rlq := quotas.NewRateLimitQuota(name, ns.Path, mountPath, pathSuffix, role, rate, interval, blockInterval)
+			rlq.KeyBy = keyBy
+			rlq.KeyHeader = keyHeader
+			rlq.Mode = mode
+			quota = rlq
 		default:
 			// Re-inserting the already indexed object in memdb might cause problems.
 			// So, clone the object. See https://github.com/hashicorp/go-memdb/issues/76.
@@ -368,6 +669,9 @@ func (b *SystemBackend) handleRateLimitQuotasUpdate() framework.OperationFunc {
 			rlq.Rate = rate
 			rlq.Interval = interval
 			rlq.BlockInterval = blockInterval
+			rlq.KeyBy = keyBy
+			rlq.KeyHeader = keyHeader
+			rlq.Mode = mode
 			quota = rlq
 		}
 
@@ -388,6 +692,51 @@ func (b *SystemBackend) handleRateLimitQuotasUpdate() framework.OperationFunc {
 	}
 }
 
+// quotaTarget resolves the namespace, mount, path suffix and role a quota
+// applies to from the request's path and role fields. It returns an error
+// response if they do not name a valid target.
+func (b *SystemBackend) quotaTarget(ctx context.Context, d *framework.FieldData) (*namespace.Namespace, string, string, string, *logical.Response) {
+	mountPath := sanitizePath(d.Get("path").(string))
+	ns := b.Core.namespaceByPath(mountPath)
+	if ns.ID != namespace.RootNamespaceID {
+		mountPath = strings.TrimPrefix(mountPath, ns.Path)
+	}
+
+	var pathSuffix string
+	if mountPath != "" {
+		me := b.Core.router.MatchingMountEntry(namespace.ContextWithNamespace(ctx, ns), mountPath)
+		if me == nil {
+			return nil, "", "", "", logical.ErrorResponse("invalid mount path %q", mountPath)
+		}
+
+		mountAPIPath := me.APIPathNoNamespace()
+		pathSuffix = strings.TrimSuffix(strings.TrimPrefix(mountPath, mountAPIPath), "/")
+		mountPath = mountAPIPath
+	}
+
+	role := d.Get("role").(string)
+	// If this is a quota with a role, ensure the backend supports role resolution
+	if role != "" {
+		if pathSuffix != "" {
+			return nil, "", "", "", logical.ErrorResponse("Quotas cannot contain both a path suffix and a role. If a role is provided, path must be a valid auth mount with a concept of roles")
+		}
+		authBackend := b.Core.router.MatchingBackend(namespace.ContextWithNamespace(ctx, ns), mountPath)
+		if authBackend == nil || authBackend.Type() != logical.TypeCredential {
+			return nil, "", "", "", logical.ErrorResponse("Mount path %q is not a valid auth method and therefore unsuitable for use with role-based quotas", mountPath)
+		}
+		// We will always error as we aren't supplying real data, but we're looking for "unsupported operation" in particular
+		_, err := authBackend.HandleRequest(ctx, &logical.Request{
+			Path:      "login",
+			Operation: logical.ResolveRoleOperation,
+		})
+		if err != nil && (err == logical.ErrUnsupportedOperation || err == logical.ErrUnsupportedPath) {
+			return nil, "", "", "", logical.ErrorResponse("Mount path %q does not support use with role-based quotas", mountPath)
+		}
+	}
+
+	return ns, mountPath, pathSuffix, role, nil
+}
+
 func (b *SystemBackend) handleRateLimitQuotasRead() framework.OperationFunc {
 	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 		name := d.Get("name").(string)
@@ -413,9 +762,12 @@ func (b *SystemBackend) handleRateLimitQuotasRead() framework.OperationFunc {
 			"name":           rlq.Name,
 			"path":           nsPath + rlq.MountPath + rlq.PathSuffix,
 			"role":           rlq.Role,
+			"mode":           rlq.Mode,
 			"rate":           rlq.Rate,
 			"interval":       int(rlq.Interval.Seconds()),
 			"block_interval": int(rlq.BlockInterval.Seconds()),
+			"key_by":         rlq.KeyBy,
+			"key_header":     rlq.KeyHeader,
 		}
 
 		return &logical.Response{
@@ -441,6 +793,283 @@ func (b *SystemBackend) handleRateLimitQuotasDelete() framework.OperationFunc {
 	}
 }
 
+func (b *SystemBackend) handleLeaseCountQuotasList() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		names, err := b.Core.quotaManager.QuotaNames(quotas.TypeLeaseCount)
+		if err != nil {
+			return nil, err
+		}
+
+		return logical.ListResponse(names), nil
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		qType := quotas.TypeLeaseCount.String()
+		maxLeases := d.Get("max_leases").(int)
+		if maxLeases <= 0 {
+			return logical.ErrorResponse("'max_leases' is invalid"), nil
+		}
+
+		ns, mountPath, pathSuffix, role, errResp := b.quotaTarget(ctx, d)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		mode := d.Get("mode").(string)
+		if mode != quotas.ModeEnforce && mode != quotas.ModeShadow {
+			return logical.ErrorResponse("'mode' is invalid"), nil
+		}
+
+		// Disallow creation of new quota that has properties similar to an
+		// existing quota.
+		quotaByFactors, err := b.Core.quotaManager.QuotaByFactors(ctx, qType, ns.Path, mountPath, pathSuffix, role)
+		if err != nil {
+			return nil, err
+		}
+		if quotaByFactors != nil && quotaByFactors.QuotaName() != name {
+			return logical.ErrorResponse("quota rule with similar properties exists under the name %q", quotaByFactors.QuotaName()), nil
+		}
+
+		// If a quota already exists, fetch and update it.
+		quota, err := b.Core.quotaManager.QuotaByName(qType, name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case quota == nil:
+			lcq := quotas.NewLeaseCountQuota(name, ns.Path, mountPath, pathSuffix, role, maxLeases)
+			lcq.Mode = mode
+			quota = lcq
+		default:
+			// Clone the object, see handleRateLimitQuotasUpdate.
+			clonedQuota := quota.Clone()
+			lcq := clonedQuota.(*quotas.LeaseCountQuota)
+			lcq.NamespacePath = ns.Path
+			lcq.MountPath = mountPath
+			lcq.PathSuffix = pathSuffix
+			lcq.Role = role
+			lcq.MaxLeases = maxLeases
+			lcq.Mode = mode
+			quota = lcq
+		}
+
+		entry, err := logical.StorageEntryJSON(quotas.QuotaStoragePath(qType, name), quota)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+
+		if err := b.Core.quotaManager.SetQuota(ctx, qType, quota, false); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+		qType := quotas.TypeLeaseCount.String()
+
+		quota, err := b.Core.quotaManager.QuotaByName(qType, name)
+		if err != nil {
+			return nil, err
+		}
+		if quota == nil {
+			return nil, nil
+		}
+
+		lcq := quota.(*quotas.LeaseCountQuota)
+
+		nsPath := lcq.NamespacePath
+		if lcq.NamespacePath == "root" {
+			nsPath = ""
+		}
+
+		data := map[string]interface{}{
+			"type":       qType,
+			"name":       lcq.Name,
+			"path":       nsPath + lcq.MountPath + lcq.PathSuffix,
+			"role":       lcq.Role,
+			"mode":       lcq.Mode,
+			"max_leases": lcq.MaxLeases,
+			"counter":    lcq.LeaseCount(),
+		}
+
+		return &logical.Response{
+			Data: data,
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasDelete() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+		qType := quotas.TypeLeaseCount.String()
+
+		if err := req.Storage.Delete(ctx, quotas.QuotaStoragePath(qType, name)); err != nil {
+			return nil, err
+		}
+
+		if err := b.Core.quotaManager.DeleteQuota(ctx, qType, name); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleConcurrencyQuotasList() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		names, err := b.Core.quotaManager.QuotaNames(quotas.TypeConcurrency)
+		if err != nil {
+			return nil, err
+		}
+
+		return logical.ListResponse(names), nil
+	}
+}
+
+func (b *SystemBackend) handleConcurrencyQuotasUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		qType := quotas.TypeConcurrency.String()
+		maxRequests := d.Get("max_requests").(int)
+		if maxRequests <= 0 {
+			return logical.ErrorResponse("'max_requests' is invalid"), nil
+		}
+
+		queueTimeout := time.Second * time.Duration(d.Get("queue_timeout").(int))
+		if queueTimeout < 0 {
+			return logical.ErrorResponse("'queue_timeout' is invalid"), nil
+		}
+
+		ns, mountPath, pathSuffix, role, errResp := b.quotaTarget(ctx, d)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		mode := d.Get("mode").(string)
+		if mode != quotas.ModeEnforce && mode != quotas.ModeShadow {
+			return logical.ErrorResponse("'mode' is invalid"), nil
+		}
+
+		// Disallow creation of new quota that has properties similar to an
+		// existing quota.
+		quotaByFactors, err := b.Core.quotaManager.QuotaByFactors(ctx, qType, ns.Path, mountPath, pathSuffix, role)
+		if err != nil {
+			return nil, err
+		}
+		if quotaByFactors != nil && quotaByFactors.QuotaName() != name {
+			return logical.ErrorResponse("quota rule with similar properties exists under the name %q", quotaByFactors.QuotaName()), nil
+		}
+
+		// If a quota already exists, fetch and update it.
+		quota, err := b.Core.quotaManager.QuotaByName(qType, name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case quota == nil:
+			cq := quotas.NewConcurrencyQuota(name, ns.Path, mountPath, pathSuffix, role, maxRequests, queueTimeout)
+			cq.Mode = mode
+			quota = cq
+		default:
+			// Clone the object, see handleRateLimitQuotasUpdate.
+			clonedQuota := quota.Clone()
+			cq := clonedQuota.(*quotas.ConcurrencyQuota)
+			cq.NamespacePath = ns.Path
+			cq.MountPath = mountPath
+			cq.PathSuffix = pathSuffix
+			cq.Role = role
+			cq.MaxRequests = maxRequests
+			cq.QueueTimeout = queueTimeout
+			cq.Mode = mode
+			quota = cq
+		}
+
+		entry, err := logical.StorageEntryJSON(quotas.QuotaStoragePath(qType, name), quota)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+
+		if err := b.Core.quotaManager.SetQuota(ctx, qType, quota, false); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleConcurrencyQuotasRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+		qType := quotas.TypeConcurrency.String()
+
+		quota, err := b.Core.quotaManager.QuotaByName(qType, name)
+		if err != nil {
+			return nil, err
+		}
+		if quota == nil {
+			return nil, nil
+		}
+
+		cq := quota.(*quotas.ConcurrencyQuota)
+
+		nsPath := cq.NamespacePath
+		if cq.NamespacePath == "root" {
+			nsPath = ""
+		}
+
+		data := map[string]interface{}{
+			"type":          qType,
+			"name":          cq.Name,
+			"path":          nsPath + cq.MountPath + cq.PathSuffix,
+			"role":          cq.Role,
+			"mode":          cq.Mode,
+			"max_requests":  cq.MaxRequests,
+			"queue_timeout": int(cq.QueueTimeout.Seconds()),
+			"in_flight":     cq.InFlight(),
+		}
+
+		return &logical.Response{
+			Data: data,
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleConcurrencyQuotasDelete() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+		qType := quotas.TypeConcurrency.String()
+
+		if err := req.Storage.Delete(ctx, quotas.QuotaStoragePath(qType, name)); err != nil {
+			return nil, err
+		}
+
+		if err := b.Core.quotaManager.DeleteQuota(ctx, qType, name); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
 var quotasHelp = map[string][2]string{
 	"quotas-config": {
 		"Create, update and read the quota configuration.",
@@ -458,4 +1087,27 @@ IP address.`,
 		"Lists the names of all the rate limit quotas.",
 		"This list contains quota definitions from all the namespaces.",
 	},
+	"lease-count": {
+		`Get, create or update lease count quota for an optional namespace, mount, path
+or login role.`,
+		`A lease count quota limits the number of live leases under a namespace, mount,
+path or login role to 'max_leases'. Requests that would create a lease are
+rejected while the limit is reached, until leases are revoked or expire.`,
+	},
+	"lease-count-list": {
+		"Lists the names of all the lease count quotas.",
+		"This list contains quota definitions from all the namespaces.",
+	},
+	"concurrency": {
+		`Get, create or update concurrency quota for an optional namespace, mount, path
+or login role.`,
+		`A concurrency quota limits the number of requests executing at the same time
+under a namespace, mount, path or login role to 'max_requests' on each node.
+Further requests wait up to 'queue_timeout' for one of them to finish, and are
+rejected otherwise.`,
+	},
+	"concurrency-list": {
+		"Lists the names of all the concurrency quotas.",
+		"This list contains quota definitions from all the namespaces.",
+	},
 }
@@ -2522,6 +2522,58 @@ func TestSystemBackend_auditHash(t *testing.T) {
 	if hash.(string) != "hmac-sha256:f9320baf0249169e73850cd6156ded0106e2bb6ad8cab01b7bbbebe6d1065317" {
 		t.Fatalf("bad hash back: %s", hash.(string))
 	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "audit-hash/foo")
+	req.Data["inputs"] = []string{"bar", "baz"}
+
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Data == nil {
+		t.Fatalf("response or its data was nil")
+	}
+
+	schema.ValidateResponse(
+		t,
+		schema.GetResponseSchema(t, b.(*SystemBackend).Route(req.Path), req.Operation),
+		resp,
+		true,
+	)
+
+	hashes, ok := resp.Data["hashes"].([]string)
+	if !ok || len(hashes) != 2 {
+		t.Fatalf("did not get hashes back in response, response was %#v", resp.Data)
+	}
+	if hashes[0] != hash.(string) || hashes[1] == hashes[0] {
+		t.Fatalf("bad hashes back: %v", hashes)
+	}
+
+	// Inputs are hashed exactly as given, without being trimmed or split
+	req = logical.TestRequest(t, logical.UpdateOperation, "audit-hash/foo")
+	req.Data["inputs"] = []interface{}{" bar ", "bar,baz"}
+
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	hashes, ok = resp.Data["hashes"].([]string)
+	if !ok || len(hashes) != 2 {
+		t.Fatalf("did not get hashes back in response, response was %#v", resp.Data)
+	}
+	if hashes[0] == hash.(string) {
+		t.Fatalf("input was trimmed before being hashed")
+	}
+
+	// The noop device does not chain its entries
+	req = logical.TestRequest(t, logical.ReadOperation, "audit-hash/foo")
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !resp.IsError() || !strings.Contains(resp.Error().Error(), "does not chain its entries") {
+		t.Fatalf("expected an error for a device without a hash chain, got %#v", resp)
+	}
 }
 
 func TestSystemBackend_enableAudit_invalid(t *testing.T) {
@@ -798,6 +798,7 @@ func (c *Core) LoginMFACreateToken(ctx context.Context, reqPath string, cachedAu
 		MountPath:     strings.TrimPrefix(mountPoint, ns.Path),
 		Role:          c.DetermineRoleFromLoginRequest(mountPoint, loginRequestData, ctx),
 		NamespacePath: ns.Path,
+		Login:         true,
 	})
 
 	if quotaErr != nil {
@@ -816,13 +817,10 @@ func (c *Core) LoginMFACreateToken(ctx context.Context, reqPath string, cachedAu
 	// note that we don't need to handle the error for the following function right away.
 	// The function takes the response as in input variable and modify it. So, the returned
 	// arguments are resp and err.
-	leaseGenerated, resp, err := c.LoginCreateToken(ctx, ns, reqPath, mountPoint, resp, loginRequestData)
+	_, resp, err = c.LoginCreateToken(ctx, ns, reqPath, mountPoint, resp, loginRequestData)
 
-	if quotaResp.Access != nil {
-		quotaAckErr := c.ackLeaseQuota(quotaResp.Access, leaseGenerated)
-		if quotaAckErr != nil {
-			err = multierror.Append(err, quotaAckErr)
-		}
+	if quotaAckErr := c.ackLeaseQuota(quotaResp.Access); quotaAckErr != nil {
+		err = multierror.Append(err, quotaAckErr)
 	}
 
 	return resp, err
@@ -249,6 +249,7 @@ func (c *Core) reloadBackendCommon(ctx context.Context, entry *MountEntry, isAut
 				return err
 			}
 			re.loginPaths.Store(loginPathsEntry)
+			re.streamPaths.Store(pathsToRadix(paths.Stream))
 		}
 	}
 
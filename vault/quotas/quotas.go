@@ -7,9 +7,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"path"
 	"strings"
 
+	"github.com/armon/go-metrics"
 	log "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-memdb"
 	"github.com/hashicorp/vault/helper/locking"
@@ -17,6 +19,7 @@ import (
 	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/sdk/helper/pathmanager"
 	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/sethvargo/go-limiter/httplimit"
 )
 
 // Type represents the quota kind
@@ -28,6 +31,9 @@ const (
 
 	// TypeLeaseCount represents the lease count limiting quota type
 	TypeLeaseCount Type = "lease-count"
+
+	// TypeConcurrency represents the in-flight request limiting quota type
+	TypeConcurrency Type = "concurrency"
 )
 
 // LeaseAction is the action taken by the expiration manager on the lease. The
@@ -79,6 +85,8 @@ func (q Type) String() string {
 		return "lease-count"
 	case TypeRateLimit:
 		return "rate-limit"
+	case TypeConcurrency:
+		return "concurrency"
 	}
 	return "unknown"
 }
@@ -117,8 +125,46 @@ var (
 	// ErrRateLimitQuotaExceeded is returned when a request is rejected due to a
 	// rate limit quota being exceeded.
 	ErrRateLimitQuotaExceeded = errors.New("rate limit quota exceeded")
+
+	// ErrConcurrencyQuotaExceeded is returned when a request is rejected due to
+	// a concurrency quota being exceeded.
+	ErrConcurrencyQuotaExceeded = errors.New("concurrency quota exceeded")
+)
+
+// The modes of a quota. Quotas in shadow mode report the requests they would
+// reject through metrics, logs and the ShadowViolationHeader, but allow them.
+const (
+	ModeEnforce = "enforce"
+	ModeShadow  = "shadow"
 )
 
+// ShadowViolationHeader is the request header that names the quotas in shadow
+// mode that would have rejected a request. Audit devices record it once it is
+// configured as an audited request header.
+const ShadowViolationHeader = "X-Vault-Quota-Shadow-Violation"
+
+// validateMode defaults an empty mode to ModeEnforce, and checks that the mode
+// is known.
+func validateMode(mode *string) error {
+	switch *mode {
+	case "":
+		*mode = ModeEnforce
+	case ModeEnforce, ModeShadow:
+	default:
+		return fmt.Errorf("invalid mode: %q", *mode)
+	}
+	return nil
+}
+
+// AnnotateShadowViolation records on the request headers that a quota in
+// shadow mode would have rejected the request.
+func AnnotateShadowViolation(headers map[string][]string, resp Response) {
+	if resp.ShadowViolation == "" || headers == nil {
+		return
+	}
+	http.Header(headers).Add(ShadowViolationHeader, resp.ShadowViolation)
+}
+
 var defaultExemptPaths = []string{
 	"sys/generate-recovery-token/attempt",
 	"sys/generate-recovery-token/update",
@@ -213,6 +259,10 @@ type Quota interface {
 
 	// handleRemount updates the mount and namesapce paths of the quota
 	handleRemount(string, string)
+
+	// shadow reports whether the quota is in shadow mode, in which requests it
+	// would reject are allowed
+	shadow() bool
 }
 
 // Response holds information about the result of the Allow() call. The response
@@ -229,6 +279,10 @@ type Response struct {
 	// Headers defines any optional headers that may be returned by the quota rule
 	// to clients.
 	Headers map[string]string
+
+	// ShadowViolation is the name of the quota in shadow mode that would have
+	// rejected the request, if any. Allowed is set in that case.
+	ShadowViolation string
 }
 
 // Config holds operator preferences around quota behaviors
@@ -268,6 +322,20 @@ type Request struct {
 	// ClientAddress is client unique addressable string (e.g. IP address). It can
 	// be empty if the quota type does not need it.
 	ClientAddress string
+
+	// EntityID and TokenAccessor identify the token the request is made with.
+	// They are only resolved for rate limit quotas keyed by them.
+	EntityID      string
+	TokenAccessor string
+
+	// Headers are the HTTP headers of the request, only set if it was
+	// relayed by a trusted proxy, since clients control their own headers
+	Headers map[string][]string
+
+	// Login is set for requests about to create a login token. Lease count
+	// quotas apply to them regardless of whether their path created leases
+	// before.
+	Login bool
 }
 
 // NewManager creates and initializes a new quota manager to hold all the quota
@@ -656,14 +724,31 @@ func (m *Manager) ApplyQuota(ctx context.Context, req *Request) (Response, error
 		return resp, nil
 	}
 
-	// If the quota type is lease count, and if the path is not known to
-	// generate leases, allow the request.
-	if req.Type == TypeLeaseCount && !m.inLeasePathCache(req.Path) {
+	// Lease count quotas are applied before a request is routed, when whether
+	// it creates a lease is not known yet. Only logins, and requests to paths
+	// that created leases before, are held back by them.
+	if req.Type == TypeLeaseCount && !req.Login && !m.inLeasePathCache(req) {
 		resp.Allowed = true
 		return resp, nil
 	}
 
-	return quota.allow(ctx, req)
+	resp, err = quota.allow(ctx, req)
+	if err != nil || resp.Allowed || !quota.shadow() {
+		return resp, err
+	}
+
+	m.metricSink.IncrCounterWithLabels([]string{"quota", "shadow_violation"}, 1, []metrics.Label{
+		{Name: "type", Value: req.Type.String()},
+		{Name: "name", Value: quota.QuotaName()},
+	})
+	if m.logger.IsDebug() {
+		m.logger.Debug("request would have been rejected by quota in shadow mode", "type", req.Type, "name", quota.QuotaName(), "path", req.Path)
+	}
+
+	resp.Allowed = true
+	resp.ShadowViolation = quota.QuotaName()
+	delete(resp.Headers, httplimit.HeaderRetryAfter)
+	return resp, nil
 }
 
 // SetEnableRateLimitAuditLogging updates the operator preference regarding the
@@ -1010,6 +1095,8 @@ func Load(ctx context.Context, storage logical.Storage, qType, name string) (Quo
 		quota = &RateLimitQuota{}
 	case TypeLeaseCount.String():
 		quota = &LeaseCountQuota{}
+	case TypeConcurrency.String():
+		quota = &ConcurrencyQuota{}
 	default:
 		return nil, fmt.Errorf("unsupported type: %v", qType)
 	}
@@ -0,0 +1,263 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package quotas
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/metricsutil"
+	"github.com/hashicorp/vault/sdk/helper/cryptoutil"
+)
+
+// Ensure that ConcurrencyQuota implements the Quota interface
+var _ Quota = (*ConcurrencyQuota)(nil)
+
+// ConcurrencyQuota represents the quota rule properties that is used to limit
+// the number of requests executing at the same time under a namespace, mount
+// or path. Requests are counted on each node separately.
+type ConcurrencyQuota struct {
+	// ID is the identifier of the quota
+	ID string `json:"id"`
+
+	// Type of quota this represents
+	Type Type `json:"type"`
+
+	// Name of the quota rule
+	Name string `json:"name"`
+
+	// NamespacePath is the path of the namespace to which this quota is
+	// applicable.
+	NamespacePath string `json:"namespace_path"`
+
+	// MountPath is the path of the mount to which this quota is applicable
+	MountPath string `json:"mount_path"`
+
+	// Role is the role on an auth mount to apply the quota to upon /login requests
+	// Not applicable for use with path suffixes
+	Role string `json:"role"`
+
+	// PathSuffix is the path suffix to which this quota is applicable
+	PathSuffix string `json:"path_suffix"`
+
+	// Mode is ModeEnforce or ModeShadow
+	Mode string `json:"mode"`
+
+	// MaxRequests is the maximum number of requests allowed to execute at the
+	// same time.
+	MaxRequests int `json:"max_requests"`
+
+	// QueueTimeout is how long a request waits for another request to finish
+	// when the maximum is reached, before it is rejected. Requests are
+	// rejected right away if zero.
+	QueueTimeout time.Duration `json:"queue_timeout"`
+
+	lock       *sync.RWMutex
+	logger     log.Logger
+	metricSink *metricsutil.ClusterMetricSink
+
+	// slots holds a value for every request executing under the quota
+	slots chan struct{}
+}
+
+// NewConcurrencyQuota creates a quota checker for imposing limits on the
+// number of requests executing at the same time.
+func NewConcurrencyQuota(name, nsPath, mountPath, pathSuffix, role string, maxRequests int, queueTimeout time.Duration) *ConcurrencyQuota {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		// Fall back to generating with a hash of the name, later in initialize
+		id = ""
+	}
+	return &ConcurrencyQuota{
+		Name:          name,
+		ID:            id,
+		Type:          TypeConcurrency,
+		NamespacePath: nsPath,
+		MountPath:     mountPath,
+		Role:          role,
+		PathSuffix:    pathSuffix,
+		MaxRequests:   maxRequests,
+		QueueTimeout:  queueTimeout,
+	}
+}
+
+func (cq *ConcurrencyQuota) Clone() Quota {
+	return &ConcurrencyQuota{
+		ID:            cq.ID,
+		Name:          cq.Name,
+		MountPath:     cq.MountPath,
+		Role:          cq.Role,
+		Type:          cq.Type,
+		NamespacePath: cq.NamespacePath,
+		PathSuffix:    cq.PathSuffix,
+		Mode:          cq.Mode,
+		MaxRequests:   cq.MaxRequests,
+		QueueTimeout:  cq.QueueTimeout,
+	}
+}
+
+// initialize ensures the namespace and max requests are initialized and sets
+// the ID if it's currently empty. Requests that are executing under a previous
+// instance of the quota are not counted against the new one.
+func (cq *ConcurrencyQuota) initialize(logger log.Logger, ms *metricsutil.ClusterMetricSink) error {
+	if cq.lock == nil {
+		cq.lock = new(sync.RWMutex)
+	}
+
+	cq.lock.Lock()
+	defer cq.lock.Unlock()
+
+	// Memdb requires a non-empty value for indexing
+	if cq.NamespacePath == "" {
+		cq.NamespacePath = "root"
+	}
+
+	if err := validateMode(&cq.Mode); err != nil {
+		return err
+	}
+
+	if cq.MaxRequests <= 0 {
+		return fmt.Errorf("invalid max requests: %v", cq.MaxRequests)
+	}
+
+	if cq.QueueTimeout < 0 {
+		return fmt.Errorf("invalid queue timeout: %v", cq.QueueTimeout)
+	}
+
+	if logger != nil {
+		cq.logger = logger
+	}
+
+	if cq.metricSink == nil {
+		cq.metricSink = ms
+	}
+
+	if cq.ID == "" {
+		// See RateLimitQuota.initialize, performance standbys need to derive
+		// the same ID for a quota persisted without one.
+		cq.ID = hex.EncodeToString(cryptoutil.Blake2b256Hash(cq.Name))
+	}
+
+	cq.slots = make(chan struct{}, cq.MaxRequests)
+
+	return nil
+}
+
+// quotaID returns the identifier of the quota rule
+func (cq *ConcurrencyQuota) quotaID() string {
+	return cq.ID
+}
+
+// QuotaName returns the name of the quota rule
+func (cq *ConcurrencyQuota) QuotaName() string {
+	return cq.Name
+}
+
+// InFlight returns the number of requests executing under the quota on this
+// node.
+func (cq *ConcurrencyQuota) InFlight() int {
+	cq.lock.RLock()
+	defer cq.lock.RUnlock()
+	return len(cq.slots)
+}
+
+// allow decides if the request is allowed by the quota. A request is allowed
+// if fewer than the maximum number of requests are executing, waiting up to
+// the queue timeout for one of them to finish. An allowed request must be
+// released with Release once it is done.
+func (cq *ConcurrencyQuota) allow(ctx context.Context, _ *Request) (Response, error) {
+	resp := Response{}
+
+	cq.lock.RLock()
+	slots := cq.slots
+	queueTimeout := cq.QueueTimeout
+	cq.lock.RUnlock()
+
+	// Requests are not held back in shadow mode, so they are not queued
+	if cq.shadow() {
+		queueTimeout = 0
+	}
+
+	select {
+	case slots <- struct{}{}:
+	default:
+		if !cq.wait(ctx, slots, queueTimeout) {
+			if !cq.shadow() {
+				cq.metricSink.IncrCounterWithLabels([]string{"quota", "concurrency", "violation"}, 1, []metrics.Label{{Name: "name", Value: cq.Name}})
+			}
+			return resp, nil
+		}
+	}
+
+	resp.Allowed = true
+	resp.Access = &concurrencyAccess{
+		access: access{quotaID: cq.ID},
+		slots:  slots,
+	}
+	return resp, nil
+}
+
+// wait queues the request for a slot until the timeout, and reports whether
+// it got one.
+func (cq *ConcurrencyQuota) wait(ctx context.Context, slots chan struct{}, timeout time.Duration) bool {
+	if timeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// shadow reports whether the quota is in shadow mode
+func (cq *ConcurrencyQuota) shadow() bool {
+	return cq.Mode == ModeShadow
+}
+
+// close is a no-op, as requests still executing release their slots through
+// their access.
+func (cq *ConcurrencyQuota) close(_ context.Context) error {
+	return nil
+}
+
+func (cq *ConcurrencyQuota) handleRemount(mountpath, nspath string) {
+	cq.MountPath = mountpath
+	cq.NamespacePath = nspath
+}
+
+// concurrencyAccess is the access granted by a concurrency quota. It holds on
+// to the slots of the quota instance that allowed the request, so that the
+// slot is released there even if the quota was updated since.
+type concurrencyAccess struct {
+	access
+	slots chan struct{}
+	once  sync.Once
+}
+
+// Release frees the slot taken by a request that a concurrency quota allowed,
+// once the request is done. It does nothing for accesses granted by other
+// quota types.
+func Release(a Access) {
+	ca, ok := a.(*concurrencyAccess)
+	if !ok {
+		return
+	}
+	ca.once.Do(func() {
+		<-ca.slots
+	})
+}
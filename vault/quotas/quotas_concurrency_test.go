@@ -0,0 +1,99 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package quotas
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/helper/metricsutil"
+	"github.com/hashicorp/vault/sdk/helper/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyQuota_Allow(t *testing.T) {
+	cq := NewConcurrencyQuota("test-concurrency", "", "", "", "", 2, 0)
+	require.NoError(t, cq.initialize(logging.NewVaultLogger(log.Trace), metricsutil.BlackholeSink()))
+
+	var accesses []Access
+	for i := 0; i < 2; i++ {
+		resp, err := cq.allow(context.Background(), &Request{})
+		require.NoError(t, err)
+		require.True(t, resp.Allowed)
+		accesses = append(accesses, resp.Access)
+	}
+	require.Equal(t, 2, cq.InFlight())
+
+	resp, err := cq.allow(context.Background(), &Request{})
+	require.NoError(t, err)
+	require.False(t, resp.Allowed)
+
+	// Releasing twice only frees one slot
+	Release(accesses[0])
+	Release(accesses[0])
+	require.Equal(t, 1, cq.InFlight())
+
+	resp, err = cq.allow(context.Background(), &Request{})
+	require.NoError(t, err)
+	require.True(t, resp.Allowed)
+}
+
+func TestConcurrencyQuota_Queue(t *testing.T) {
+	cq := NewConcurrencyQuota("test-concurrency", "", "", "", "", 1, 5*time.Second)
+	require.NoError(t, cq.initialize(logging.NewVaultLogger(log.Trace), metricsutil.BlackholeSink()))
+
+	resp, err := cq.allow(context.Background(), &Request{})
+	require.NoError(t, err)
+	require.True(t, resp.Allowed)
+
+	// A queued request gets the slot once the executing one is done
+	go func(a Access) {
+		time.Sleep(100 * time.Millisecond)
+		Release(a)
+	}(resp.Access)
+
+	resp, err = cq.allow(context.Background(), &Request{})
+	require.NoError(t, err)
+	require.True(t, resp.Allowed)
+
+	// A queued request is rejected if the client goes away
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	resp, err = cq.allow(ctx, &Request{})
+	require.NoError(t, err)
+	require.False(t, resp.Allowed)
+}
+
+func TestConcurrencyQuota_Update(t *testing.T) {
+	qm, err := NewManager(logging.NewVaultLogger(log.Trace), nil, metricsutil.BlackholeSink())
+	require.NoError(t, err)
+
+	quota := NewConcurrencyQuota("cq", "", "kv/", "", "", 1, 0)
+	require.NoError(t, qm.SetQuota(context.Background(), TypeConcurrency.String(), quota, false))
+
+	req := &Request{Type: TypeConcurrency, MountPath: "kv/", Path: "kv/foo"}
+	resp, err := qm.ApplyQuota(context.Background(), req)
+	require.NoError(t, err)
+	require.True(t, resp.Allowed)
+
+	// Requests executing under the previous instance of the quota release
+	// their slot there
+	updated := quota.Clone().(*ConcurrencyQuota)
+	updated.MaxRequests = 2
+	require.NoError(t, qm.SetQuota(context.Background(), TypeConcurrency.String(), updated, false))
+	Release(resp.Access)
+	require.Equal(t, 0, quota.InFlight())
+	require.Equal(t, 0, updated.InFlight())
+
+	for i := 0; i < 2; i++ {
+		resp, err = qm.ApplyQuota(context.Background(), req)
+		require.NoError(t, err)
+		require.True(t, resp.Allowed)
+	}
+	resp, err = qm.ApplyQuota(context.Background(), req)
+	require.NoError(t, err)
+	require.False(t, resp.Allowed)
+}
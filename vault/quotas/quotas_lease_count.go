@@ -0,0 +1,248 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package quotas
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/armon/go-metrics"
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/metricsutil"
+	"github.com/hashicorp/vault/sdk/helper/cryptoutil"
+)
+
+// Ensure that LeaseCountQuota implements the Quota interface
+var _ Quota = (*LeaseCountQuota)(nil)
+
+// LeaseCountQuota represents the quota rule properties that is used to limit
+// the number of live leases created under a namespace, mount, path or role.
+type LeaseCountQuota struct {
+	// ID is the identifier of the quota
+	ID string `json:"id"`
+
+	// Type of quota this represents
+	Type Type `json:"type"`
+
+	// Name of the quota rule
+	Name string `json:"name"`
+
+	// NamespacePath is the path of the namespace to which this quota is
+	// applicable.
+	NamespacePath string `json:"namespace_path"`
+
+	// MountPath is the path of the mount to which this quota is applicable
+	MountPath string `json:"mount_path"`
+
+	// Role is the role on an auth mount to apply the quota to upon /login requests
+	// Not applicable for use with path suffixes
+	Role string `json:"role"`
+
+	// PathSuffix is the path suffix to which this quota is applicable
+	PathSuffix string `json:"path_suffix"`
+
+	// Mode is ModeEnforce or ModeShadow
+	Mode string `json:"mode"`
+
+	// MaxLeases is the maximum number of leases allowed by the quota rule
+	MaxLeases int `json:"max_leases"`
+
+	lock       *sync.Mutex
+	logger     log.Logger
+	metricSink *metricsutil.ClusterMetricSink
+
+	// counter is the number of live leases counted against the quota
+	counter int
+
+	// pending is the number of requests that were allowed by the quota and
+	// may still create a lease
+	pending int
+
+	// isPerfStandby is set on performance standby nodes, which forward the
+	// requests that create leases to the active node
+	isPerfStandby bool
+}
+
+// NewLeaseCountQuota creates a quota checker for imposing limits on the number
+// of live leases.
+func NewLeaseCountQuota(name, nsPath, mountPath, pathSuffix, role string, maxLeases int) *LeaseCountQuota {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		// Fall back to generating with a hash of the name, later in initialize
+		id = ""
+	}
+	return &LeaseCountQuota{
+		Name:          name,
+		ID:            id,
+		Type:          TypeLeaseCount,
+		NamespacePath: nsPath,
+		MountPath:     mountPath,
+		Role:          role,
+		PathSuffix:    pathSuffix,
+		MaxLeases:     maxLeases,
+	}
+}
+
+func (lcq *LeaseCountQuota) Clone() Quota {
+	return &LeaseCountQuota{
+		ID:            lcq.ID,
+		Name:          lcq.Name,
+		MountPath:     lcq.MountPath,
+		Role:          lcq.Role,
+		Type:          lcq.Type,
+		NamespacePath: lcq.NamespacePath,
+		PathSuffix:    lcq.PathSuffix,
+		Mode:          lcq.Mode,
+		MaxLeases:     lcq.MaxLeases,
+	}
+}
+
+// initialize ensures the namespace and max leases are initialized and sets the
+// ID if it's currently empty. Note, initialize resets the lease counter, which
+// is recomputed by the manager once the quota is in place.
+func (lcq *LeaseCountQuota) initialize(logger log.Logger, ms *metricsutil.ClusterMetricSink) error {
+	if lcq.lock == nil {
+		lcq.lock = new(sync.Mutex)
+	}
+
+	lcq.lock.Lock()
+	defer lcq.lock.Unlock()
+
+	// Memdb requires a non-empty value for indexing
+	if lcq.NamespacePath == "" {
+		lcq.NamespacePath = "root"
+	}
+
+	if err := validateMode(&lcq.Mode); err != nil {
+		return err
+	}
+
+	if lcq.MaxLeases <= 0 {
+		return fmt.Errorf("invalid max leases: %v", lcq.MaxLeases)
+	}
+
+	if logger != nil {
+		lcq.logger = logger
+	}
+
+	if lcq.metricSink == nil {
+		lcq.metricSink = ms
+	}
+
+	if lcq.ID == "" {
+		// See RateLimitQuota.initialize, performance standbys need to derive
+		// the same ID for a quota persisted without one.
+		lcq.ID = hex.EncodeToString(cryptoutil.Blake2b256Hash(lcq.Name))
+	}
+
+	lcq.counter = 0
+	lcq.pending = 0
+
+	return nil
+}
+
+// quotaID returns the identifier of the quota rule
+func (lcq *LeaseCountQuota) quotaID() string {
+	return lcq.ID
+}
+
+// QuotaName returns the name of the quota rule
+func (lcq *LeaseCountQuota) QuotaName() string {
+	return lcq.Name
+}
+
+// LeaseCount returns the number of live leases counted against the quota.
+func (lcq *LeaseCountQuota) LeaseCount() int {
+	lcq.lock.Lock()
+	defer lcq.lock.Unlock()
+	return lcq.counter
+}
+
+// allow decides if the request is allowed by the quota. A request is allowed
+// if the leases counted against the quota and the leases that the requests
+// allowed so far may still create are fewer than the maximum. An allowed
+// request must be acknowledged once it is known whether it created a lease.
+func (lcq *LeaseCountQuota) allow(_ context.Context, _ *Request) (Response, error) {
+	resp := Response{}
+
+	// The active node counts the leases, and enforces the quota on the
+	// requests forwarded to it
+	if lcq.isPerfStandby {
+		resp.Allowed = true
+		return resp, nil
+	}
+
+	lcq.lock.Lock()
+	defer lcq.lock.Unlock()
+
+	if lcq.counter+lcq.pending >= lcq.MaxLeases {
+		if !lcq.shadow() {
+			lcq.metricSink.IncrCounterWithLabels([]string{"quota", "lease_count", "violation"}, 1, []metrics.Label{{Name: "name", Value: lcq.Name}})
+		}
+		return resp, nil
+	}
+
+	lcq.pending++
+	resp.Allowed = true
+	resp.Access = &access{quotaID: lcq.ID}
+	return resp, nil
+}
+
+// ack releases the slot taken by an allowed request. If the request created a
+// lease, the lease itself is counted when the expiration manager registers it.
+func (lcq *LeaseCountQuota) ack() {
+	lcq.lock.Lock()
+	defer lcq.lock.Unlock()
+
+	if lcq.pending > 0 {
+		lcq.pending--
+	}
+}
+
+// incCounter counts a live lease against the quota.
+func (lcq *LeaseCountQuota) incCounter() {
+	lcq.lock.Lock()
+	defer lcq.lock.Unlock()
+
+	lcq.counter++
+	lcq.metricSink.SetGaugeWithLabels([]string{"quota", "lease_count", "counter"}, float32(lcq.counter), []metrics.Label{{Name: "name", Value: lcq.Name}})
+}
+
+// decCounter removes a lease that was revoked or expired from the quota.
+func (lcq *LeaseCountQuota) decCounter() {
+	lcq.lock.Lock()
+	defer lcq.lock.Unlock()
+
+	if lcq.counter > 0 {
+		lcq.counter--
+	}
+	lcq.metricSink.SetGaugeWithLabels([]string{"quota", "lease_count", "counter"}, float32(lcq.counter), []metrics.Label{{Name: "name", Value: lcq.Name}})
+}
+
+// resetCounter clears the lease counter before it is recomputed.
+func (lcq *LeaseCountQuota) resetCounter() {
+	lcq.lock.Lock()
+	defer lcq.lock.Unlock()
+
+	lcq.counter = 0
+}
+
+// shadow reports whether the quota is in shadow mode
+func (lcq *LeaseCountQuota) shadow() bool {
+	return lcq.Mode == ModeShadow
+}
+
+// close is a no-op, as lease count quotas do not run anything in the
+// background.
+func (lcq *LeaseCountQuota) close(_ context.Context) error {
+	return nil
+}
+
+func (lcq *LeaseCountQuota) handleRemount(mountpath, nspath string) {
+	lcq.MountPath = mountpath
+	lcq.NamespacePath = nspath
+}
@@ -0,0 +1,116 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package quotas
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/helper/metricsutil"
+	"github.com/hashicorp/vault/sdk/helper/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaseCountQuota_Allow(t *testing.T) {
+	qm, err := NewManager(logging.NewVaultLogger(log.Trace), nil, metricsutil.BlackholeSink())
+	require.NoError(t, err)
+
+	quota := NewLeaseCountQuota("lcq", "", "kv/", "", "", 2)
+	require.NoError(t, qm.SetQuota(context.Background(), TypeLeaseCount.String(), quota, false))
+
+	newReq := func() *Request {
+		return &Request{
+			Type:      TypeLeaseCount,
+			MountPath: "kv/",
+			Path:      "kv/creds/role",
+		}
+	}
+
+	// Requests to paths that never created a lease are not held back
+	resp, err := qm.ApplyQuota(context.Background(), newReq())
+	require.NoError(t, err)
+	require.True(t, resp.Allowed)
+	require.Nil(t, resp.Access)
+
+	require.NoError(t, qm.HandleLeases(LeaseActionCreated, []*Request{newReq()}))
+	require.Equal(t, 1, quota.LeaseCount())
+
+	// Logins reserve a slot regardless
+	login := &Request{
+		Type:      TypeLeaseCount,
+		MountPath: "kv/",
+		Path:      "kv/login",
+		Login:     true,
+	}
+	resp, err = qm.ApplyQuota(context.Background(), login)
+	require.NoError(t, err)
+	require.True(t, resp.Allowed)
+	require.NotNil(t, resp.Access)
+	require.NoError(t, qm.AckLease(resp.Access))
+
+	// Requests to paths that created leases reserve a slot until they are
+	// done, so that a burst of them cannot exceed the quota: with one lease
+	// left, a second request is rejected while the first one is in flight
+	resp, err = qm.ApplyQuota(context.Background(), newReq())
+	require.NoError(t, err)
+	require.True(t, resp.Allowed)
+	require.NotNil(t, resp.Access)
+
+	rejected, err := qm.ApplyQuota(context.Background(), newReq())
+	require.NoError(t, err)
+	require.False(t, rejected.Allowed)
+
+	require.NoError(t, qm.HandleLeases(LeaseActionCreated, []*Request{newReq()}))
+	require.NoError(t, qm.AckLease(resp.Access))
+	require.Equal(t, 2, quota.LeaseCount())
+
+	rejected, err = qm.ApplyQuota(context.Background(), newReq())
+	require.NoError(t, err)
+	require.False(t, rejected.Allowed)
+
+	// Once a lease is gone, requests are allowed again
+	require.NoError(t, qm.HandleLeases(LeaseActionDeleted, []*Request{newReq()}))
+	require.Equal(t, 1, quota.LeaseCount())
+
+	resp, err = qm.ApplyQuota(context.Background(), newReq())
+	require.NoError(t, err)
+	require.True(t, resp.Allowed)
+	require.NoError(t, qm.AckLease(resp.Access))
+}
+
+func TestLeaseCountQuota_Recompute(t *testing.T) {
+	leases := []*Request{
+		{MountPath: "kv/", Path: "kv/creds/a"},
+		{MountPath: "kv/", Path: "kv/creds/b"},
+		{MountPath: "kv/", Path: "kv/creds/b"},
+		{MountPath: "other/", Path: "other/creds/a"},
+	}
+	walkFunc := func(_ context.Context, cb func(*Request) bool) error {
+		for _, lease := range leases {
+			req := *lease
+			if !cb(&req) {
+				break
+			}
+		}
+		return nil
+	}
+
+	qm, err := NewManager(logging.NewVaultLogger(log.Trace), walkFunc, metricsutil.BlackholeSink())
+	require.NoError(t, err)
+
+	mountQuota := NewLeaseCountQuota("mount", "", "kv/", "", "", 10)
+	require.NoError(t, qm.SetQuota(context.Background(), TypeLeaseCount.String(), mountQuota, false))
+	require.Equal(t, 3, mountQuota.LeaseCount())
+
+	// A more specific quota takes the leases under its path away from the
+	// mount quota
+	pathQuota := NewLeaseCountQuota("path", "", "kv/", "creds/b", "", 10)
+	require.NoError(t, qm.SetQuota(context.Background(), TypeLeaseCount.String(), pathQuota, false))
+	require.Equal(t, 1, mountQuota.LeaseCount())
+	require.Equal(t, 2, pathQuota.LeaseCount())
+
+	require.NoError(t, qm.DeleteQuota(context.Background(), TypeLeaseCount.String(), "path"))
+	require.Equal(t, 3, mountQuota.LeaseCount())
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math"
+	"net/http"
 	"strconv"
 	"sync"
 	"time"
@@ -35,6 +36,16 @@ const (
 	EnvVaultEnableRateLimitAuditLogging = "VAULT_ENABLE_RATE_LIMIT_AUDIT_LOGGING"
 )
 
+// The values of RateLimitQuota.KeyBy, which select what a rate limit quota
+// keeps a separate limiter for.
+const (
+	KeyByClientIP      = "client_ip"
+	KeyByEntityID      = "entity_id"
+	KeyByTokenAccessor = "token_accessor"
+	KeyByRole          = "role"
+	KeyByHeader        = "header"
+)
+
 // Ensure that RateLimitQuota implements the Quota interface
 var _ Quota = (*RateLimitQuota)(nil)
 
@@ -64,6 +75,9 @@ type RateLimitQuota struct {
 	// PathSuffix is the path suffix to which this quota is applicable
 	PathSuffix string `json:"path_suffix"`
 
+	// Mode is ModeEnforce or ModeShadow
+	Mode string `json:"mode"`
+
 	// Rate defines the number of requests allowed per Interval.
 	Rate float64 `json:"rate"`
 
@@ -75,6 +89,17 @@ type RateLimitQuota struct {
 	// reaches the rate limit.
 	BlockInterval time.Duration `json:"block_interval"`
 
+	// KeyBy selects what the requests are grouped by, each group being rate
+	// limited separately. It is one of the KeyBy constants, and defaults to the
+	// client IP address. Requests that lack the selected property, such as
+	// unauthenticated requests when keyed by entity, are keyed by client IP
+	// address.
+	KeyBy string `json:"key_by"`
+
+	// KeyHeader is the name of the request header to key by, when KeyBy is
+	// KeyByHeader.
+	KeyHeader string `json:"key_header"`
+
 	lock                *sync.RWMutex
 	store               limiter.Store
 	logger              log.Logger
@@ -122,9 +147,12 @@ func (q *RateLimitQuota) Clone() Quota {
 		Type:          q.Type,
 		NamespacePath: q.NamespacePath,
 		PathSuffix:    q.PathSuffix,
+		Mode:          q.Mode,
 		BlockInterval: q.BlockInterval,
 		Rate:          q.Rate,
 		Interval:      q.Interval,
+		KeyBy:         q.KeyBy,
+		KeyHeader:     q.KeyHeader,
 	}
 	return rlq
 }
@@ -146,6 +174,10 @@ func (rlq *RateLimitQuota) initialize(logger log.Logger, ms *metricsutil.Cluster
 		rlq.NamespacePath = "root"
 	}
 
+	if err := validateMode(&rlq.Mode); err != nil {
+		return err
+	}
+
 	if rlq.Interval == 0 {
 		rlq.Interval = time.Second
 	}
@@ -158,6 +190,24 @@ func (rlq *RateLimitQuota) initialize(logger log.Logger, ms *metricsutil.Cluster
 		return fmt.Errorf("invalid block interval: %v", rlq.BlockInterval)
 	}
 
+	// Quotas persisted before key_by was introduced are keyed by client IP
+	if rlq.KeyBy == "" {
+		rlq.KeyBy = KeyByClientIP
+	}
+
+	switch rlq.KeyBy {
+	case KeyByClientIP, KeyByEntityID, KeyByTokenAccessor, KeyByRole:
+		if rlq.KeyHeader != "" {
+			return fmt.Errorf("key header is only valid when keyed by %q", KeyByHeader)
+		}
+	case KeyByHeader:
+		if rlq.KeyHeader == "" {
+			return fmt.Errorf("missing key header")
+		}
+	default:
+		return fmt.Errorf("invalid key by: %q", rlq.KeyBy)
+	}
+
 	if logger != nil {
 		rlq.logger = logger
 	}
@@ -275,16 +325,64 @@ func (rlq *RateLimitQuota) QuotaName() string {
 	return rlq.Name
 }
 
+// KeyedByToken reports whether the quota keys requests by a property of the
+// token they are made with, which must then be resolved into the request.
+func (rlq *RateLimitQuota) KeyedByToken() bool {
+	return rlq.KeyBy == KeyByEntityID || rlq.KeyBy == KeyByTokenAccessor
+}
+
+// ClientAddressExhausted reports whether the client address has used up its
+// allowance under the quota, without taking from it. Quotas keyed by token
+// fall back to the client address for requests whose token cannot be
+// resolved, so checking this first bounds how often a client sending invalid
+// tokens has them looked up.
+func (rlq *RateLimitQuota) ClientAddressExhausted(ctx context.Context, addr string) bool {
+	if v, ok := rlq.blockedClients.Load(addr); ok && time.Since(v.(time.Time)) < rlq.BlockInterval {
+		return true
+	}
+
+	// A client without a limiter yet has not used any of its allowance. The
+	// remaining count is only refilled on the next take, so an exhausted
+	// client is checked against its address until then.
+	tokens, remaining, err := rlq.store.Get(ctx, addr)
+	return err != nil || (tokens > 0 && remaining == 0)
+}
+
+// clientKey returns the key of the limiter the request is checked against. It
+// falls back to the client address if the request lacks the property the
+// quota is keyed by.
+func (rlq *RateLimitQuota) clientKey(req *Request) string {
+	var key string
+	switch rlq.KeyBy {
+	case KeyByEntityID:
+		key = req.EntityID
+	case KeyByTokenAccessor:
+		key = req.TokenAccessor
+	case KeyByRole:
+		key = req.Role
+	case KeyByHeader:
+		key = http.Header(req.Headers).Get(rlq.KeyHeader)
+	}
+	if key == "" {
+		return req.ClientAddress
+	}
+
+	// Keep the keys of different kinds apart from client addresses
+	return rlq.KeyBy + ":" + key
+}
+
 // allow decides if the request is allowed by the quota. An error will be
-// returned if the request ID or address is empty. If the path is exempt, the
-// quota will not be evaluated. Otherwise, the client rate limiter is retrieved
-// by address and the rate limit quota is checked against that limiter.
+// returned if the request's key, which falls back to its address, is empty.
+// If the path is exempt, the quota will not be evaluated. Otherwise, the
+// client rate limiter is retrieved by key and the rate limit quota is checked
+// against that limiter.
 func (rlq *RateLimitQuota) allow(ctx context.Context, req *Request) (Response, error) {
 	resp := Response{
 		Headers: make(map[string]string),
 	}
 
-	if req.ClientAddress == "" {
+	key := rlq.clientKey(req)
+	if key == "" {
 		return resp, fmt.Errorf("missing request client address in quota request")
 	}
 
@@ -293,7 +391,9 @@ func (rlq *RateLimitQuota) allow(ctx context.Context, req *Request) (Response, e
 	defer func() {
 		if !resp.Allowed {
 			resp.Headers[httplimit.HeaderRetryAfter] = retryAfter
-			rlq.metricSink.IncrCounterWithLabels([]string{"quota", "rate_limit", "violation"}, 1, []metrics.Label{{"name", rlq.Name}})
+			if !rlq.shadow() {
+				rlq.metricSink.IncrCounterWithLabels([]string{"quota", "rate_limit", "violation"}, 1, []metrics.Label{{"name", rlq.Name}})
+			}
 		}
 	}()
 
@@ -302,11 +402,11 @@ func (rlq *RateLimitQuota) allow(ctx context.Context, req *Request) (Response, e
 	// of purging blocked clients may not yield a false negative. In other words,
 	// a client may no longer be considered blocked whereas the purging interval
 	// has yet to run.
-	if v, ok := rlq.blockedClients.Load(req.ClientAddress); ok {
+	if v, ok := rlq.blockedClients.Load(key); ok {
 		blockedAt := v.(time.Time)
 		if time.Since(blockedAt) >= rlq.BlockInterval {
 			// allow the request and remove the blocked client
-			rlq.blockedClients.Delete(req.ClientAddress)
+			rlq.blockedClients.Delete(key)
 		} else {
 			// deny the request and return early
 			resp.Allowed = false
@@ -315,7 +415,7 @@ func (rlq *RateLimitQuota) allow(ctx context.Context, req *Request) (Response, e
 		}
 	}
 
-	limit, remaining, reset, allow, err := rlq.store.Take(ctx, req.ClientAddress)
+	limit, remaining, reset, allow, err := rlq.store.Take(ctx, key)
 	if err != nil {
 		return resp, err
 	}
@@ -331,12 +431,17 @@ func (rlq *RateLimitQuota) allow(ctx context.Context, req *Request) (Response, e
 	if !resp.Allowed && rlq.purgeBlocked {
 		blockedAt := time.Now()
 		retryAfter = strconv.Itoa(int(time.Until(blockedAt.Add(rlq.BlockInterval)).Seconds()))
-		rlq.blockedClients.Store(req.ClientAddress, blockedAt)
+		rlq.blockedClients.Store(key, blockedAt)
 	}
 
 	return resp, nil
 }
 
+// shadow reports whether the quota is in shadow mode
+func (rlq *RateLimitQuota) shadow() bool {
+	return rlq.Mode == ModeShadow
+}
+
 // close stops the current running client purge loop.
 // It should be called with the write lock held.
 func (rlq *RateLimitQuota) close(ctx context.Context) error {
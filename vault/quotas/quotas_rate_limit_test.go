@@ -227,3 +227,77 @@ func TestRateLimitQuota_Update(t *testing.T) {
 
 	require.Nil(t, quota.close(context.Background()))
 }
+
+func TestRateLimitQuota_KeyBy(t *testing.T) {
+	newQuota := func(t *testing.T, keyBy, keyHeader string) *RateLimitQuota {
+		t.Helper()
+		rlq := NewRateLimitQuota("test-rate-limiter", "", "", "", "", 1, time.Minute, 0)
+		rlq.KeyBy = keyBy
+		rlq.KeyHeader = keyHeader
+		require.NoError(t, rlq.initialize(logging.NewVaultLogger(log.Trace), metricsutil.BlackholeSink()))
+		t.Cleanup(func() { rlq.close(context.Background()) })
+		return rlq
+	}
+
+	allowed := func(t *testing.T, rlq *RateLimitQuota, req *Request) bool {
+		t.Helper()
+		resp, err := rlq.allow(context.Background(), req)
+		require.NoError(t, err)
+		return resp.Allowed
+	}
+
+	t.Run("entity_id", func(t *testing.T) {
+		rlq := newQuota(t, KeyByEntityID, "")
+
+		// The same entity is limited across client addresses
+		require.True(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.1", EntityID: "e1"}))
+		require.False(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.2", EntityID: "e1"}))
+
+		// Other entities behind the same address are not
+		require.True(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.1", EntityID: "e2"}))
+
+		// Requests without an entity fall back to the client address
+		require.False(t, rlq.ClientAddressExhausted(context.Background(), "127.0.0.1"))
+		require.True(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.1"}))
+		require.False(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.1"}))
+
+		// Once the address has used up its allowance, its tokens are not
+		// resolved anymore
+		require.True(t, rlq.ClientAddressExhausted(context.Background(), "127.0.0.1"))
+		require.False(t, rlq.ClientAddressExhausted(context.Background(), "127.0.0.2"))
+	})
+
+	t.Run("token_accessor", func(t *testing.T) {
+		rlq := newQuota(t, KeyByTokenAccessor, "")
+		require.True(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.1", TokenAccessor: "a1"}))
+		require.False(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.2", TokenAccessor: "a1"}))
+		require.True(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.1", TokenAccessor: "a2"}))
+	})
+
+	t.Run("role", func(t *testing.T) {
+		rlq := newQuota(t, KeyByRole, "")
+		require.True(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.1", Role: "r1"}))
+		require.False(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.2", Role: "r1"}))
+		require.True(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.1", Role: "r2"}))
+	})
+
+	t.Run("header", func(t *testing.T) {
+		rlq := newQuota(t, KeyByHeader, "X-Tenant")
+		require.True(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.1", Headers: map[string][]string{"X-Tenant": {"t1"}}}))
+		require.False(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.2", Headers: map[string][]string{"X-Tenant": {"t1"}}}))
+		require.True(t, allowed(t, rlq, &Request{ClientAddress: "127.0.0.1", Headers: map[string][]string{"X-Tenant": {"t2"}}}))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, tc := range []struct{ keyBy, keyHeader string }{
+			{"unknown", ""},
+			{KeyByHeader, ""},
+			{KeyByClientIP, "X-Tenant"},
+		} {
+			rlq := NewRateLimitQuota("test-rate-limiter", "", "", "", "", 1, time.Minute, 0)
+			rlq.KeyBy = tc.keyBy
+			rlq.KeyHeader = tc.keyHeader
+			require.Error(t, rlq.initialize(logging.NewVaultLogger(log.Trace), metricsutil.BlackholeSink()), tc)
+		}
+	})
+}
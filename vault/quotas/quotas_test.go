@@ -117,3 +117,49 @@ func TestQuotas_Precedence(t *testing.T) {
 	checkQuotaFunc(t, "", "", "", "", rateLimitGlobalQuota)
 	checkQuotaFunc(t, "testns/", "", "", "", rateLimitNSQuota)
 }
+
+func TestQuotas_ShadowMode(t *testing.T) {
+	qm, err := NewManager(logging.NewVaultLogger(log.Trace), nil, metricsutil.BlackholeSink())
+	require.NoError(t, err)
+
+	rlq := NewRateLimitQuota("rlq", "", "kv/", "", "", 1, time.Minute, 0)
+	rlq.Mode = ModeShadow
+	require.NoError(t, qm.SetQuota(context.Background(), TypeRateLimit.String(), rlq, false))
+
+	req := &Request{Type: TypeRateLimit, MountPath: "kv/", Path: "kv/foo", ClientAddress: "127.0.0.1"}
+	resp, err := qm.ApplyQuota(context.Background(), req)
+	require.NoError(t, err)
+	require.True(t, resp.Allowed)
+	require.Empty(t, resp.ShadowViolation)
+
+	// Requests over the limit are allowed, but reported
+	resp, err = qm.ApplyQuota(context.Background(), req)
+	require.NoError(t, err)
+	require.True(t, resp.Allowed)
+	require.Equal(t, "rlq", resp.ShadowViolation)
+
+	headers := map[string][]string{}
+	AnnotateShadowViolation(headers, resp)
+	require.Equal(t, []string{"rlq"}, headers[ShadowViolationHeader])
+
+	// Concurrency quotas in shadow mode do not queue requests
+	cq := NewConcurrencyQuota("cq", "", "kv/", "", "", 1, time.Minute)
+	cq.Mode = ModeShadow
+	require.NoError(t, qm.SetQuota(context.Background(), TypeConcurrency.String(), cq, false))
+
+	req = &Request{Type: TypeConcurrency, MountPath: "kv/", Path: "kv/foo"}
+	resp, err = qm.ApplyQuota(context.Background(), req)
+	require.NoError(t, err)
+	require.True(t, resp.Allowed)
+
+	start := time.Now()
+	resp, err = qm.ApplyQuota(context.Background(), req)
+	require.NoError(t, err)
+	require.True(t, resp.Allowed)
+	require.Equal(t, "cq", resp.ShadowViolation)
+	require.Less(t, time.Since(start), time.Minute)
+
+	invalid := NewLeaseCountQuota("lcq", "", "kv/", "", "", 1)
+	invalid.Mode = "bogus"
+	require.Error(t, qm.SetQuota(context.Background(), TypeLeaseCount.String(), invalid, false))
+}
@@ -7,66 +7,175 @@ package quotas
 
 import (
 	"context"
-
-	log "github.com/hashicorp/go-hclog"
-	"github.com/hashicorp/vault/helper/metricsutil"
+	"fmt"
+	"sync"
 
 	memdb "github.com/hashicorp/go-memdb"
 )
 
 func quotaTypes() []string {
 	return []string{
+		TypeLeaseCount.String(),
 		TypeRateLimit.String(),
+		TypeConcurrency.String(),
 	}
 }
 
-func (m *Manager) init(walkFunc leaseWalkFunc) {}
+func (m *Manager) init(walkFunc leaseWalkFunc) {
+	m.leaseWalkFunc = walkFunc
+	m.leasePaths = make(map[string]struct{})
+}
 
+// recomputeLeaseCounts counts every live lease again against the lease count
+// quota that applies to it, after the set of quotas changed. It must be called
+// with the quota lock held, and with the transaction that changed the quotas.
 func (m *Manager) recomputeLeaseCounts(ctx context.Context, txn *memdb.Txn) error {
-	return nil
-}
+	iter, err := txn.Get(TypeLeaseCount.String(), indexID)
+	if err != nil {
+		return err
+	}
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		raw.(*LeaseCountQuota).resetCounter()
+	}
 
-func (m *Manager) setIsPerfStandby(quota Quota) {}
+	if m.leaseWalkFunc == nil {
+		return nil
+	}
 
-func (m *Manager) inLeasePathCache(path string) bool {
-	return false
+	var walkErr error
+	err = m.leaseWalkFunc(ctx, func(req *Request) bool {
+		m.addLeasePath(req)
+
+		req.Type = TypeLeaseCount
+		quota, err := m.queryQuota(txn, req)
+		if err != nil {
+			walkErr = err
+			return false
+		}
+		if quota != nil {
+			quota.(*LeaseCountQuota).incCounter()
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return walkErr
 }
 
-type entManager struct {
-	isPerfStandby bool
-	isDRSecondary bool
+func (m *Manager) setIsPerfStandby(quota Quota) {
+	if lcq, ok := quota.(*LeaseCountQuota); ok {
+		lcq.isPerfStandby = m.isPerfStandby
+	}
 }
 
-func (*entManager) Reset() error {
-	return nil
+// inLeasePathCache reports whether a lease was ever created for the request's
+// path. Lease count quotas only apply to requests to such paths, so that
+// requests which never create leases, such as reads of static secrets, are not
+// held back by them.
+func (m *Manager) inLeasePathCache(req *Request) bool {
+	m.leasePathsLock.RLock()
+	defer m.leasePathsLock.RUnlock()
+
+	_, ok := m.leasePaths[leasePathKey(req)]
+	return ok
 }
 
-type LeaseCountQuota struct{}
+func (m *Manager) addLeasePath(req *Request) {
+	key := leasePathKey(req)
 
-func (l LeaseCountQuota) allow(_ context.Context, _ *Request) (Response, error) {
-	panic("implement me")
-}
+	m.leasePathsLock.RLock()
+	_, ok := m.leasePaths[key]
+	m.leasePathsLock.RUnlock()
+	if ok {
+		return
+	}
 
-func (l LeaseCountQuota) quotaID() string {
-	panic("implement me")
+	m.leasePathsLock.Lock()
+	m.leasePaths[key] = struct{}{}
+	m.leasePathsLock.Unlock()
 }
 
-func (l LeaseCountQuota) QuotaName() string {
-	panic("implement me")
+func leasePathKey(req *Request) string {
+	nsPath := req.NamespacePath
+	if nsPath == "root" {
+		nsPath = ""
+	}
+	return nsPath + req.Path
 }
 
-func (l LeaseCountQuota) initialize(logger log.Logger, sink *metricsutil.ClusterMetricSink) error {
-	panic("implement me")
+// HandleLeases updates the lease count quotas and the lease path cache with
+// leases that were loaded, created or deleted by the expiration manager.
+func (m *Manager) HandleLeases(action LeaseAction, reqs []*Request) error {
+	if m.isDRSecondary {
+		return nil
+	}
+
+	m.dbAndCacheLock.RLock()
+	defer m.dbAndCacheLock.RUnlock()
+
+	txn := m.db.Txn(false)
+	for _, req := range reqs {
+		if action != LeaseActionDeleted {
+			m.addLeasePath(req)
+		}
+
+		req.Type = TypeLeaseCount
+		quota, err := m.queryQuota(txn, req)
+		if err != nil {
+			return err
+		}
+		if quota == nil {
+			continue
+		}
+
+		lcq := quota.(*LeaseCountQuota)
+		switch action {
+		case LeaseActionLoaded, LeaseActionCreated:
+			lcq.incCounter()
+		case LeaseActionDeleted:
+			lcq.decCounter()
+		default:
+			return fmt.Errorf("unsupported lease action %q", action)
+		}
+	}
+
+	return nil
 }
 
-func (l LeaseCountQuota) close(_ context.Context) error {
-	panic("implement me")
+// AckLease releases the slot a lease count quota reserved for a request it
+// allowed, once the request is done.
+func (m *Manager) AckLease(access Access) error {
+	quota, err := m.QuotaByID(TypeLeaseCount.String(), access.QuotaID())
+	if err != nil {
+		return err
+	}
+	// The quota may have been removed or replaced since, in which case its
+	// reservations were dropped with it
+	if quota == nil {
+		return nil
+	}
+
+	quota.(*LeaseCountQuota).ack()
+	return nil
 }
 
-func (l LeaseCountQuota) Clone() Quota {
-	panic("implement me")
+type entManager struct {
+	isPerfStandby bool
+	isDRSecondary bool
+
+	leaseWalkFunc leaseWalkFunc
+
+	// leasePaths holds the paths, prefixed with their namespace path, that
+	// leases were created for
+	leasePathsLock sync.RWMutex
+	leasePaths     map[string]struct{}
 }
 
-func (l LeaseCountQuota) handleRemount(mountPath, nsPath string) {
-	panic("implement me")
+func (m *entManager) Reset() error {
+	m.leasePathsLock.Lock()
+	defer m.leasePathsLock.Unlock()
+
+	m.leasePaths = make(map[string]struct{})
+	return nil
 }
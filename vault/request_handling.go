@@ -523,6 +523,16 @@ func (c *Core) handleCancelableRequest(ctx context.Context, req *logical.Request
 		return nil, logical.ErrMissingRequiredState
 	}
 
+	// EST clients cannot send Vault tokens; log them in through the auth
+	// mounts configured on the PKI mount before the token is looked up.
+	estResp, estToken, err := c.loginEstRequest(ctx, req)
+	if estResp != nil || err != nil {
+		return estResp, err
+	}
+	if estToken != "" {
+		defer c.revokeEstToken(ctx, estToken)
+	}
+
 	err = c.PopulateTokenEntry(ctx, req)
 	if err != nil {
 		return nil, err
@@ -1021,35 +1031,21 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 		return nil, nil, multierror.Append(retErr, err)
 	}
 
-	leaseGenerated := false
-	quotaResp, quotaErr := c.applyLeaseCountQuota(ctx, &quotas.Request{
-		Path:          req.Path,
-		MountPath:     strings.TrimPrefix(req.MountPoint, ns.Path),
-		NamespacePath: ns.Path,
-	})
-	if quotaErr != nil {
-		c.logger.Error("failed to apply quota", "path", req.Path, "error", quotaErr)
-		retErr = multierror.Append(retErr, quotaErr)
-		return nil, auth, retErr
-	}
-
-	if !quotaResp.Allowed {
-		if c.logger.IsTrace() {
-			c.logger.Trace("request rejected due to lease count quota violation", "request_path", req.Path)
+	// Requests which may create a lease reserve a lease count quota slot
+	// before they are routed, so that a rejected request has no side effects
+	switch req.Operation {
+	case logical.ReadOperation, logical.CreateOperation, logical.UpdateOperation, logical.PatchOperation:
+		quotaAccess, quotaErr := c.checkLeaseCountQuota(ctx, req, ns, "", false)
+		if quotaErr != nil {
+			retErr = multierror.Append(retErr, quotaErr)
+			return nil, auth, retErr
 		}
-
-		retErr = multierror.Append(retErr, fmt.Errorf("request path %q: %w", req.Path, quotas.ErrLeaseCountQuotaExceeded))
-		return nil, auth, retErr
-	}
-
-	defer func() {
-		if quotaResp.Access != nil {
-			quotaAckErr := c.ackLeaseQuota(quotaResp.Access, leaseGenerated)
-			if quotaAckErr != nil {
+		defer func() {
+			if quotaAckErr := c.ackLeaseQuota(quotaAccess); quotaAckErr != nil {
 				retErr = multierror.Append(retErr, quotaAckErr)
 			}
-		}
-	}()
+		}()
+	}
 
 	// Route the request
 	resp, routeErr := c.doRouting(ctx, req)
@@ -1170,7 +1166,6 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 				retErr = multierror.Append(retErr, ErrInternalError)
 				return nil, auth, retErr
 			}
-			leaseGenerated = true
 			resp.Secret.LeaseID = leaseID
 
 			// Count the lease creation
@@ -1258,7 +1253,6 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 					if registeredTokenEntry.ExternalID != "" {
 						resp.Auth.ClientToken = registeredTokenEntry.ExternalID
 					}
-					leaseGenerated = true
 				}
 			}
 		}
@@ -1288,6 +1282,34 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 	return resp, auth, retErr
 }
 
+// checkLeaseCountQuota applies the lease count quotas to a request that may
+// create a lease. Besides logins, only requests to paths that created leases
+// before are held back once a quota is reached. The returned access has to be
+// released with ackLeaseQuota once the request is done.
+func (c *Core) checkLeaseCountQuota(ctx context.Context, req *logical.Request, ns *namespace.Namespace, role string, login bool) (quotas.Access, error) {
+	quotaResp, err := c.applyLeaseCountQuota(ctx, &quotas.Request{
+		Path:          req.Path,
+		MountPath:     strings.TrimPrefix(req.MountPoint, ns.Path),
+		Role:          role,
+		NamespacePath: ns.Path,
+		Login:         login,
+	})
+	if err != nil {
+		c.logger.Error("failed to apply quota", "path", req.Path, "error", err)
+		return nil, err
+	}
+
+	if !quotaResp.Allowed {
+		if c.logger.IsTrace() {
+			c.logger.Trace("request rejected due to lease count quota violation", "request_path", req.Path)
+		}
+		return nil, fmt.Errorf("request path %q: %w", req.Path, quotas.ErrLeaseCountQuotaExceeded)
+	}
+	quotas.AnnotateShadowViolation(req.Headers, *quotaResp)
+
+	return quotaResp.Access, nil
+}
+
 // handleLoginRequest is used to handle a login request, which is an
 // unauthenticated request to the backend.
 func (c *Core) handleLoginRequest(ctx context.Context, req *logical.Request) (retResp *logical.Response, retAuth *logical.Auth, retErr error) {
@@ -1465,8 +1487,6 @@ func (c *Core) handleLoginRequest(ctx context.Context, req *logical.Request) (re
 	}
 	// If the response generated an authentication, then generate the token
 	if resp != nil && resp.Auth != nil && req.Path != "sys/mfa/validate" {
-		leaseGenerated := false
-
 		// by placing this after the authorization check, we don't leak
 		// information about locked namespaces to unauthenticated clients.
 		if err := enterpriseBlockRequestIfError(c, ns.Path, req.Path); err != nil {
@@ -1476,34 +1496,14 @@ func (c *Core) handleLoginRequest(ctx context.Context, req *logical.Request) (re
 
 		// The request successfully authenticated itself. Run the quota checks
 		// before creating lease.
-		quotaResp, quotaErr := c.applyLeaseCountQuota(ctx, &quotas.Request{
-			Path:          req.Path,
-			MountPath:     strings.TrimPrefix(req.MountPoint, ns.Path),
-			Role:          c.DetermineRoleFromLoginRequest(req.MountPoint, req.Data, ctx),
-			NamespacePath: ns.Path,
-		})
-
+		quotaAccess, quotaErr := c.checkLeaseCountQuota(ctx, req, ns, c.DetermineRoleFromLoginRequest(req.MountPoint, req.Data, ctx), true)
 		if quotaErr != nil {
-			c.logger.Error("failed to apply quota", "path", req.Path, "error", quotaErr)
 			retErr = multierror.Append(retErr, quotaErr)
 			return
 		}
-
-		if !quotaResp.Allowed {
-			if c.logger.IsTrace() {
-				c.logger.Trace("request rejected due to lease count quota violation", "request_path", req.Path)
-			}
-
-			retErr = multierror.Append(retErr, fmt.Errorf("request path %q: %w", req.Path, quotas.ErrLeaseCountQuotaExceeded))
-			return
-		}
-
 		defer func() {
-			if quotaResp.Access != nil {
-				quotaAckErr := c.ackLeaseQuota(quotaResp.Access, leaseGenerated)
-				if quotaAckErr != nil {
-					retErr = multierror.Append(retErr, quotaAckErr)
-				}
+			if quotaAckErr := c.ackLeaseQuota(quotaAccess); quotaAckErr != nil {
+				retErr = multierror.Append(retErr, quotaAckErr)
 			}
 		}()
 
@@ -1671,8 +1671,7 @@ func (c *Core) handleLoginRequest(ctx context.Context, req *logical.Request) (re
 		// Attach the display name, might be used by audit backends
 		req.DisplayName = auth.DisplayName
 
-		leaseGen, respTokenCreate, errCreateToken := c.LoginCreateToken(ctx, ns, req.Path, source, resp, req.Data)
-		leaseGenerated = leaseGen
+		_, respTokenCreate, errCreateToken := c.LoginCreateToken(ctx, ns, req.Path, source, resp, req.Data)
 		if errCreateToken != nil {
 			return respTokenCreate, nil, errCreateToken
 		}
@@ -65,6 +65,7 @@ type routeEntry struct {
 	storagePrefix string
 	rootPaths     atomic.Value
 	loginPaths    atomic.Value
+	streamPaths   atomic.Value
 	l             sync.RWMutex
 }
 
@@ -201,6 +202,7 @@ func (r *Router) Mount(backend logical.Backend, prefix string, mountEntry *Mount
 		return err
 	}
 	re.loginPaths.Store(loginPathsEntry)
+	re.streamPaths.Store(pathsToRadix(paths.Stream))
 
 	switch {
 	case prefix == "":
@@ -876,6 +878,43 @@ func (r *Router) RootPath(ctx context.Context, path string) bool {
 	return match == remain
 }
 
+// StreamPath checks if the given path accepts raw request streams
+func (r *Router) StreamPath(ctx context.Context, path string) bool {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return false
+	}
+
+	adjustedPath := ns.Path + path
+
+	r.l.RLock()
+	mount, raw, ok := r.root.LongestPrefix(adjustedPath)
+	r.l.RUnlock()
+	if !ok {
+		return false
+	}
+	re := raw.(*routeEntry)
+
+	// Trim to get remaining path
+	remain := strings.TrimPrefix(adjustedPath, mount)
+
+	// Check the streamPaths of this backend
+	streamPaths := re.streamPaths.Load().(*radix.Tree)
+	match, raw, ok := streamPaths.LongestPrefix(remain)
+	if !ok {
+		return false
+	}
+	prefixMatch := raw.(bool)
+
+	// Handle the prefix match case
+	if prefixMatch {
+		return strings.HasPrefix(remain, match)
+	}
+
+	// Handle the exact match case
+	return match == remain
+}
+
 // LoginPath checks if the given path is used for logins
 // Matching Priority
 //  1. prefix
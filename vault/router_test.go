@@ -338,6 +338,44 @@ func TestRouter_RootPath(t *testing.T) {
 	}
 }
 
+func TestRouter_StreamPath(t *testing.T) {
+	r := NewRouter()
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &NoopBackend{
+		Stream: []string{
+			"encrypt-stream/*",
+		},
+	}
+	err = r.Mount(n, "transit/", &MountEntry{UUID: meUUID, Accessor: "transitaccessor", NamespaceID: namespace.RootNamespaceID, namespace: namespace.RootNamespace}, view)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		path   string
+		expect bool
+	}
+	tcases := []tcase{
+		{"random", false},
+		{"transit/encrypt/key", false},
+		{"transit/encrypt-stream", false},
+		{"transit/encrypt-stream/key", true},
+	}
+
+	for _, tc := range tcases {
+		out := r.StreamPath(namespace.RootContext(nil), tc.path)
+		if out != tc.expect {
+			t.Fatalf("bad: path: %s expect: %v got %v", tc.path, tc.expect, out)
+		}
+	}
+}
+
 func TestRouter_LoginPath(t *testing.T) {
 	r := NewRouter()
 	_, barrier, _ := mockBarrier(t)
@@ -21,6 +21,7 @@ type NoopBackend struct {
 
 	Root            []string
 	Login           []string
+	Stream          []string
 	Paths           []string
 	Requests        []*logical.Request
 	Response        *logical.Response
@@ -71,6 +72,7 @@ func (n *NoopBackend) SpecialPaths() *logical.Paths {
 	return &logical.Paths{
 		Root:            n.Root,
 		Unauthenticated: n.Login,
+		Stream:          n.Stream,
 	}
 }
 